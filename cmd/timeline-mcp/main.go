@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/kmio11/agent-timeline-mcp/internal/database"
+	"github.com/kmio11/agent-timeline-mcp/internal/mcpserver"
+	"github.com/kmio11/agent-timeline-mcp/internal/timeline"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+func main() {
+	// stdout carries the MCP protocol, so all logs must go to stderr
+	slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, nil)))
+
+	dbURL := os.Getenv("DATABASE_URL")
+	if dbURL == "" {
+		slog.Error("Environment variable DATABASE_URL is required but not set")
+		os.Exit(1)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	db, err := database.Open(ctx, dbURL)
+	if err != nil {
+		slog.Error("Unable to connect to database", "error", err)
+		os.Exit(1)
+	}
+	defer db.Close()
+
+	if err := database.CheckSchema(ctx, db); err != nil {
+		slog.Error("Database schema check failed", "error", err)
+		os.Exit(1)
+	}
+
+	service := timeline.NewService(db)
+	// Sessions are shared with the API server, so they expire after the same idle timeout
+	if value, ok := os.LookupEnv("TL_SERVER_SESSION_IDLE_TIMEOUT"); ok {
+		timeout, err := time.ParseDuration(value)
+		if err != nil || timeout <= 0 {
+			slog.Error("TL_SERVER_SESSION_IDLE_TIMEOUT must be a positive duration", "value", value)
+			os.Exit(1)
+		}
+		service.SetIdleTimeout(timeout)
+	}
+	service.StartSessionCleanup(ctx, timeline.SessionCleanupInterval)
+
+	server := mcpserver.NewServer(service)
+
+	slog.Info("Timeline MCP server starting", "transport", "stdio")
+	if err := server.Run(ctx, &mcp.StdioTransport{}); err != nil && ctx.Err() == nil {
+		slog.Error("MCP server stopped with error", "error", err)
+		os.Exit(1)
+	}
+	slog.Info("Timeline MCP server stopped")
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/kmio11/agent-timeline-mcp/internal/database"
+)
+
+const usage = `Usage: timeline-migrate <command>
+
+Commands:
+  up          Apply all pending migrations
+  down [N]    Revert the last N migrations (default 1)
+  status      Show applied and pending migrations
+
+The database is selected with the DATABASE_URL environment variable.
+`
+
+func main() {
+	if err := run(context.Background(), os.Args[1:], os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+}
+
+func run(ctx context.Context, args []string, out io.Writer) error {
+	if len(args) == 0 {
+		fmt.Fprint(out, usage)
+		return fmt.Errorf("missing command")
+	}
+
+	dbURL := os.Getenv("DATABASE_URL")
+	if dbURL == "" {
+		return fmt.Errorf("environment variable DATABASE_URL is required but not set")
+	}
+
+	db, err := database.Open(ctx, dbURL)
+	if err != nil {
+		return fmt.Errorf("unable to connect to database: %w", err)
+	}
+	defer db.Close()
+
+	switch args[0] {
+	case "up":
+		applied, err := db.MigrateUp(ctx)
+		for _, migration := range applied {
+			fmt.Fprintf(out, "Applied %04d_%s\n", migration.Version, migration.Name)
+		}
+		if err != nil {
+			return err
+		}
+		if len(applied) == 0 {
+			fmt.Fprintln(out, "Database schema is up to date")
+		}
+		return nil
+
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps <= 0 {
+				return fmt.Errorf("invalid number of steps: %s", args[1])
+			}
+		}
+		reverted, err := db.MigrateDown(ctx, steps)
+		for _, migration := range reverted {
+			fmt.Fprintf(out, "Reverted %04d_%s\n", migration.Version, migration.Name)
+		}
+		return err
+
+	case "status":
+		statuses, err := db.MigrationStatus(ctx)
+		if err != nil {
+			return err
+		}
+		return printStatus(out, statuses)
+
+	default:
+		fmt.Fprint(out, usage)
+		return fmt.Errorf("unknown command: %s", args[0])
+	}
+}
+
+func printStatus(out io.Writer, statuses []database.MigrationStatus) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tSTATUS\tAPPLIED AT")
+	for _, status := range statuses {
+		name := status.Name
+		if name == "" {
+			name = "(unknown)"
+		}
+		state, appliedAt := "pending", ""
+		if status.Applied {
+			state = "applied"
+			appliedAt = status.AppliedAt.Local().Format("2006-01-02 15:04:05")
+		}
+		fmt.Fprintf(w, "%04d\t%s\t%s\t%s\n", status.Version, name, state, appliedAt)
+	}
+	return w.Flush()
+}
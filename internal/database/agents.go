@@ -0,0 +1,152 @@
+package database
+
+import (
+	"strings"
+	"time"
+)
+
+// Agent statuses reported by the agent directory
+const (
+	AgentStatusActive = "active"
+	AgentStatusIdle   = "idle"
+)
+
+// RecentPostWindow is the period counted by AgentSummary.RecentPostCount when no start is given
+const RecentPostWindow = 24 * time.Hour
+
+// Agent directory sort keys
+const (
+	AgentSortLastActive = "last_active"
+	AgentSortName       = "name"
+	AgentSortPostCount  = "post_count"
+	AgentSortLastPostAt = "last_post_at"
+	AgentSortCreatedAt  = "created_at"
+)
+
+// agentSortColumns maps the agent directory sort keys to their ORDER BY expressions
+var agentSortColumns = map[string]string{
+	AgentSortLastActive: "a.last_active",
+	AgentSortName:       "lower(a.display_name)",
+	AgentSortPostCount:  "post_count",
+	AgentSortLastPostAt: "s.last_post_at",
+	AgentSortCreatedAt:  "a.created_at",
+}
+
+// IsAgentSort reports whether key is one of the AgentSort keys
+func IsAgentSort(key string) bool {
+	_, ok := agentSortColumns[key]
+	return ok
+}
+
+// AgentSummary is an agent with its posting activity
+type AgentSummary struct {
+	Agent
+	PostCount int `json:"post_count"`
+	// RecentPostCount is the number of posts since AgentQuery.RecentSince
+	RecentPostCount int        `json:"recent_post_count"`
+	FirstPostAt     *time.Time `json:"first_post_at"`
+	LastPostAt      *time.Time `json:"last_post_at"`
+	// Status is AgentStatusActive when the agent was active since AgentQuery.ActiveSince
+	Status string `json:"status"`
+}
+
+// AgentQuery selects agents for the directory
+type AgentQuery struct {
+	Limit int
+
+	// Filters; zero values match every agent
+	ID          *int
+	Name        string
+	IdentityKey string
+	Context     string
+	// Search matches agents whose display name contains the text, ignoring case
+	Search string
+	// Status only includes agents with this AgentStatus
+	Status string
+
+	// ActiveSince separates active agents from idle ones
+	ActiveSince time.Time
+	// RecentSince is the start of the period counted by AgentSummary.RecentPostCount
+	RecentSince time.Time
+
+	// Sort is one of the AgentSort keys, AgentSortLastActive when empty
+	Sort      string
+	Ascending bool
+}
+
+// status returns the directory status of an agent last active at the given time
+func (q AgentQuery) status(lastActive time.Time) string {
+	if lastActive.Before(q.ActiveSince) {
+		return AgentStatusIdle
+	}
+	return AgentStatusActive
+}
+
+// buildAgentsQuery returns the SQL and arguments that select agent summaries.
+// Agents without posts sort after the others when ordered by last post.
+func buildAgentsQuery(dialect string, query AgentQuery) (string, []any) {
+	b := &queryBuilder{dialect: dialect}
+
+	recentSince := b.arg(query.RecentSince)
+	if query.ID != nil {
+		b.where("a.id = ?", *query.ID)
+	}
+	if query.Name != "" {
+		b.where("a.name = ?", query.Name)
+	}
+	if query.IdentityKey != "" {
+		b.where("a.identity_key = ?", query.IdentityKey)
+	}
+	if query.Context != "" {
+		b.where("a.context = ?", query.Context)
+	}
+	if query.Search != "" {
+		b.where(`lower(a.display_name) LIKE ? ESCAPE '\'`, "%"+escapeLike(strings.ToLower(query.Search))+"%")
+	}
+	switch query.Status {
+	case AgentStatusActive:
+		b.where("a.last_active >= ?", query.ActiveSince)
+	case AgentStatusIdle:
+		b.where("a.last_active < ?", query.ActiveSince)
+	}
+
+	sortColumn, ok := agentSortColumns[query.Sort]
+	if !ok {
+		sortColumn = agentSortColumns[AgentSortLastActive]
+	}
+	order := "DESC"
+	if query.Ascending {
+		order = "ASC"
+	}
+	ordering := sortColumn + " " + order + ", a.id " + order
+	if query.Sort == AgentSortLastPostAt {
+		ordering = "s.last_post_at IS NULL, " + ordering
+	}
+
+	sql := `
+		SELECT
+			a.id, a.name, a.context, a.display_name, a.identity_key, a.avatar_seed, a.last_active, a.created_at, a.channel_id,
+			COALESCE(s.post_count, 0) AS post_count,
+			COALESCE(s.recent_post_count, 0) AS recent_post_count,
+			s.first_post_at,
+			s.last_post_at
+		FROM agents a
+		LEFT JOIN (
+			SELECT
+				agent_id,
+				COUNT(*) AS post_count,
+				SUM(CASE WHEN timestamp >= ` + recentSince + ` THEN 1 ELSE 0 END) AS recent_post_count,
+				MIN(timestamp) AS first_post_at,
+				MAX(timestamp) AS last_post_at
+			FROM posts
+			GROUP BY agent_id
+		) s ON s.agent_id = a.id` + b.clause() + `
+		ORDER BY ` + ordering + `
+		LIMIT ` + b.arg(query.Limit)
+	return sql, b.args
+}
+
+// escapeLike escapes the LIKE wildcards in text, using \ as the escape character
+func escapeLike(text string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(text)
+}
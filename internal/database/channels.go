@@ -0,0 +1,45 @@
+package database
+
+import (
+	"errors"
+	"regexp"
+	"time"
+)
+
+// GeneralChannel is the slug of the channel that holds posts without a channel
+const GeneralChannel = "general"
+
+// ErrChannelNotFound is returned when a post or agent refers to a channel that does not exist
+var ErrChannelNotFound = errors.New("channel not found")
+
+// ErrChannelExists is returned by CreateChannel when the slug is already taken
+var ErrChannelExists = errors.New("channel already exists")
+
+// ChannelSlugPattern matches valid channel slugs such as "general" or "docs-rewrite"
+var ChannelSlugPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,49}$`)
+
+// Channel is a named timeline that posts belong to
+type Channel struct {
+	ID          int       `json:"id"`
+	Slug        string    `json:"slug"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// CreateChannelParams represents parameters for creating a new channel
+type CreateChannelParams struct {
+	Slug        string `json:"slug"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// channelColumns are the columns read by the channel scanners
+const channelColumns = "id, slug, name, description, created_at"
+
+// resolveChannelQuery selects the ID and slug of a channel by ID, falling back to the
+// general channel when the ID is NULL
+var resolveChannelQuery = map[string]string{
+	dialectPostgres: "SELECT id, slug FROM channels WHERE id = COALESCE($1, (SELECT id FROM channels WHERE slug = '" + GeneralChannel + "'))",
+	dialectSQLite:   "SELECT id, slug FROM channels WHERE id = COALESCE(?, (SELECT id FROM channels WHERE slug = '" + GeneralChannel + "'))",
+}
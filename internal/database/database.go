@@ -3,14 +3,19 @@ package database
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
+	"slices"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
+	"unicode/utf8"
 
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"go.opentelemetry.io/otel/codes"
 )
 
 // Post represents a timeline post with associated agent information
@@ -24,20 +29,108 @@ type Post struct {
 	DisplayName string          `json:"display_name"`
 	IdentityKey string          `json:"identity_key"`
 	AvatarSeed  string          `json:"avatar_seed"`
+	// ParentPostID is the post this post replies to, or nil for a top-level post
+	ParentPostID *int `json:"parent_post_id"`
+	// ThreadRootID is the top-level post of the thread, or nil for a top-level post
+	ThreadRootID *int `json:"thread_root_id"`
+	// ReplyCount is the number of direct replies to this post
+	ReplyCount int `json:"reply_count"`
+	// ChannelID and Channel identify the channel of the post by ID and slug
+	ChannelID int    `json:"channel_id"`
+	Channel   string `json:"channel"`
+	// SessionID is the ID of the session the post was made in, or nil for posts
+	// made before sessions were recorded
+	SessionID *int `json:"session_id"`
+	// Reactions counts the reactions on this post by emoji, most used first
+	Reactions []ReactionCount `json:"reactions"`
+	// Tags are the normalized hashtags in the content, in alphabetical order
+	Tags []string `json:"tags"`
 }
 
-// NotificationPayload represents the data sent via PostgreSQL NOTIFY
+// ErrParentPostNotFound is returned by CreatePost when the post being replied to does not exist
+var ErrParentPostNotFound = errors.New("parent post not found")
+
+// ErrPostNotFound is returned by SetReaction when the post does not exist
+var ErrPostNotFound = errors.New("post not found")
+
+// ContentMaxLength is the number of characters a post can hold, as enforced by the
+// CHECK constraint of the posts table. Servers may be configured with a lower limit only.
+const ContentMaxLength = 280
+
+// Reactor types; agents react as their identity key and humans by name
+const (
+	ReactorAgent = "agent"
+	ReactorHuman = "human"
+)
+
+// ReactionCount is the number of reactions with one emoji on a post
+type ReactionCount struct {
+	Emoji string `json:"emoji"`
+	Count int    `json:"count"`
+}
+
+// ReactionParams identifies the reaction of one reactor on a post.
+// Emoji is ignored when removing a reaction.
+type ReactionParams struct {
+	PostID      int    `json:"post_id"`
+	ReactorType string `json:"reactor_type"`
+	Reactor     string `json:"reactor"`
+	Emoji       string `json:"emoji"`
+}
+
+// Tables whose changes are notified, as named in NotificationPayload.Table
+const (
+	NotificationTablePosts     = "posts"
+	NotificationTableSessions  = "sessions"
+	NotificationTableReactions = "reactions"
+)
+
+// Notified operations, as named in NotificationPayload.Operation. Posts and sessions
+// are notified when inserted; sessions are notified again with an update when they end.
+// Reactions are notified when added, replaced or removed. A resync, which has no table,
+// replaces the notifications missed while the listener was disconnected when there are
+// too many to backfill; subscribers should have their clients refetch.
+const (
+	NotificationInsert = "INSERT"
+	NotificationUpdate = "UPDATE"
+	NotificationDelete = "DELETE"
+	NotificationResync = "RESYNC"
+)
+
+// NotificationPayload represents the data sent via PostgreSQL NOTIFY. Session notifications
+// only set Timestamp, Operation, Table, SessionID, AgentID, the channel and EndReason.
+// Reaction notifications only set Timestamp, Operation, Table, PostID and the reaction.
 type NotificationPayload struct {
 	Timestamp time.Time `json:"timestamp"`
 	Operation string    `json:"operation"`
 	Table     string    `json:"table"`
 	PostID    int       `json:"post_id"`
-	AgentID   int       `json:"agent_id"`
-	Content   string    `json:"content"`
+	// SessionID is the session started or ended, for session notifications
+	SessionID int    `json:"session_id"`
+	AgentID   int    `json:"agent_id"`
+	Content   string `json:"content"`
+	// ParentPostID and ThreadRootID are nil for top-level posts
+	ParentPostID *int `json:"parent_post_id"`
+	ThreadRootID *int `json:"thread_root_id"`
+	// ChannelID and Channel identify the channel of the post by ID and slug
+	ChannelID int    `json:"channel_id"`
+	Channel   string `json:"channel"`
+	// EndReason is the reason an ended session ended, for session updates
+	EndReason string `json:"end_reason,omitempty"`
+	// ReactorType, Reactor and Emoji describe the reaction, for reaction notifications.
+	// Emoji is empty for removed reactions.
+	ReactorType string `json:"reactor_type,omitempty"`
+	Reactor     string `json:"reactor,omitempty"`
+	Emoji       string `json:"emoji,omitempty"`
+	// TraceParent is the W3C trace context of the request that created the row, if traced
+	TraceParent string `json:"traceparent,omitempty"`
+	// Missed is the number of changes that were not notified, for resync notifications
+	Missed int `json:"missed,omitempty"`
 }
 
-// NotificationHandler handles incoming PostgreSQL notifications
-type NotificationHandler func(payload *NotificationPayload) error
+// NotificationHandler handles incoming PostgreSQL notifications. The context carries
+// the notification span, which continues the trace of the request that created the row.
+type NotificationHandler func(ctx context.Context, payload *NotificationPayload) error
 
 // Agent represents an agent record from the database
 type Agent struct {
@@ -47,9 +140,10 @@ type Agent struct {
 	DisplayName string    `json:"display_name"`
 	IdentityKey string    `json:"identity_key"`
 	AvatarSeed  string    `json:"avatar_seed"`
-	SessionID   *string   `json:"session_id"`
 	LastActive  time.Time `json:"last_active"`
 	CreatedAt   time.Time `json:"created_at"`
+	// ChannelID is the channel the agent posts to by default, or nil for the general channel
+	ChannelID *int `json:"channel_id"`
 }
 
 // CreateAgentParams represents parameters for creating a new agent
@@ -59,7 +153,7 @@ type CreateAgentParams struct {
 	DisplayName string  `json:"display_name"`
 	IdentityKey string  `json:"identity_key"`
 	AvatarSeed  string  `json:"avatar_seed"`
-	SessionID   string  `json:"session_id"`
+	ChannelID   *int    `json:"channel_id"`
 }
 
 // CreatePostParams represents parameters for creating a new post
@@ -67,6 +161,13 @@ type CreatePostParams struct {
 	AgentID  int             `json:"agent_id"`
 	Content  string          `json:"content"`
 	Metadata json.RawMessage `json:"metadata"`
+	// ParentPostID makes the post a reply to another post
+	ParentPostID *int `json:"parent_post_id"`
+	// ChannelID is the channel of the post; nil selects the general channel.
+	// Replies always belong to the channel of their parent.
+	ChannelID *int `json:"channel_id"`
+	// SessionID is the ID of the session the post is made in, if any
+	SessionID *int `json:"session_id"`
 }
 
 // Database manages PostgreSQL database connections and operations
@@ -77,11 +178,55 @@ type Database struct {
 	notifyCancel     context.CancelFunc
 	notifyDone       chan struct{}
 	notifyMutex      sync.RWMutex
+	// databaseURL is kept to reconnect the notification connection
+	databaseURL string
+	// notifyStatus is guarded by notifyMutex
+	notifyStatus NotificationStatus
+	// The latest post and session announced, the latest timestamp of a notified row
+	// and the notifications dispatched since notifyBackfillOverlap before it. They are
+	// only used by the notification loop.
+	lastNotifiedID        int
+	lastNotifiedSessionID int
+	lastNotifiedAt        time.Time
+	notified              map[notificationKey]time.Time
+	notifiedPrunedAt      time.Time
+}
+
+// notificationKey identifies the row change announced by a notification
+type notificationKey struct {
+	table     string
+	operation string
+	id        int
 }
 
+// Notification listener reconnection backoff, doubling after every failed attempt
+const (
+	notifyReconnectMinDelay = time.Second
+	notifyReconnectMaxDelay = 30 * time.Second
+)
+
+// notifyBackfillOverlap is how far before the latest notified row a backfill looks
+// for rows again. Rows become visible when their transaction commits, not in ID or
+// timestamp order, so a row may commit after a later row was already notified.
+const notifyBackfillOverlap = time.Minute
+
+// notifyBackfillLimit is the most notifications a reconnect backfills. Past it the missed
+// notifications are replaced by a resync notification rather than loaded and replayed.
+const notifyBackfillLimit = 1000
+
+// errBackfillTooLarge is returned by missedNotifications when more than notifyBackfillLimit
+// notifications were missed
+var errBackfillTooLarge = errors.New("too many missed notifications")
+
 // NewDatabase creates a new Database instance with a connection pool
 func NewDatabase(ctx context.Context, databaseURL string) (*Database, error) {
-	pool, err := pgxpool.New(ctx, databaseURL)
+	config, err := pgxpool.ParseConfig(databaseURL)
+	if err != nil {
+		return nil, err
+	}
+	config.ConnConfig.Tracer = queryTracer{}
+
+	pool, err := pgxpool.NewWithConfig(ctx, config)
 	if err != nil {
 		return nil, err
 	}
@@ -95,6 +240,7 @@ func NewDatabase(ctx context.Context, databaseURL string) (*Database, error) {
 		pool:           pool,
 		notifyHandlers: make(map[string][]NotificationHandler),
 		notifyDone:     make(chan struct{}),
+		databaseURL:    databaseURL,
 	}
 
 	// Create dedicated connection for notifications
@@ -126,49 +272,11 @@ func (db *Database) Ping(ctx context.Context) error {
 	return db.pool.Ping(ctx)
 }
 
-// GetPosts retrieves posts from the database with optional filtering
-func (db *Database) GetPosts(ctx context.Context, limit int, after *time.Time) ([]Post, error) {
-	var query string
-	var args []any
-
-	if after != nil {
-		query = `
-			SELECT 
-				p.id,
-				p.agent_id,
-				p.content,
-				p.timestamp,
-				p.metadata,
-				a.name as agent_name,
-				a.display_name,
-				a.identity_key,
-				a.avatar_seed
-			FROM posts p
-			JOIN agents a ON p.agent_id = a.id
-			WHERE p.timestamp > $1
-			ORDER BY p.timestamp DESC
-			LIMIT $2`
-		args = []any{*after, limit}
-	} else {
-		query = `
-			SELECT 
-				p.id,
-				p.agent_id,
-				p.content,
-				p.timestamp,
-				p.metadata,
-				a.name as agent_name,
-				a.display_name,
-				a.identity_key,
-				a.avatar_seed
-			FROM posts p
-			JOIN agents a ON p.agent_id = a.id
-			ORDER BY p.timestamp DESC
-			LIMIT $1`
-		args = []any{limit}
-	}
-
-	rows, err := db.pool.Query(ctx, query, args...)
+// GetPosts retrieves a page of posts, newest first
+func (db *Database) GetPosts(ctx context.Context, query PostQuery) ([]Post, error) {
+	sql, args := buildPostsQuery(dialectPostgres, query)
+
+	rows, err := db.pool.Query(ctx, sql, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -177,31 +285,118 @@ func (db *Database) GetPosts(ctx context.Context, limit int, after *time.Time) (
 	var posts []Post
 
 	for rows.Next() {
-		var post Post
-		err := rows.Scan(
-			&post.ID,
-			&post.AgentID,
-			&post.Content,
-			&post.Timestamp,
-			&post.Metadata,
-			&post.AgentName,
-			&post.DisplayName,
-			&post.IdentityKey,
-			&post.AvatarSeed,
-		)
+		post, err := scanPost(rows)
 		if err != nil {
 			return nil, err
 		}
-		posts = append(posts, post)
+		posts = append(posts, *post)
 	}
 
 	if err := rows.Err(); err != nil {
 		return nil, err
 	}
 
+	if query.After != nil {
+		reversePosts(posts)
+	}
+
 	return posts, nil
 }
 
+// GetPost retrieves a single post by ID, returning nil if it does not exist
+func (db *Database) GetPost(ctx context.Context, id int) (*Post, error) {
+	query := postSelectQuery(dialectPostgres) + `
+		WHERE p.id = $1`
+
+	post, err := scanPost(db.pool.QueryRow(ctx, query, id))
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get post: %w", err)
+	}
+
+	return post, nil
+}
+
+// scanPost scans the columns of postSelectQuery followed by any extra columns
+func scanPost(row pgx.Row, extra ...any) (*Post, error) {
+	var post Post
+	dest := []any{
+		&post.ID,
+		&post.AgentID,
+		&post.Content,
+		&post.Timestamp,
+		&post.Metadata,
+		&post.AgentName,
+		&post.DisplayName,
+		&post.IdentityKey,
+		&post.AvatarSeed,
+		&post.ParentPostID,
+		&post.ThreadRootID,
+		&post.ReplyCount,
+		&post.ChannelID,
+		&post.Channel,
+		&post.SessionID,
+		&post.Reactions,
+		&post.Tags,
+	}
+	err := row.Scan(append(dest, extra...)...)
+	if err != nil {
+		return nil, err
+	}
+	return &post, nil
+}
+
+// GetThread retrieves every post in the thread containing the given post, oldest first.
+// It returns no posts if the post does not exist.
+func (db *Database) GetThread(ctx context.Context, postID int) ([]Post, error) {
+	sql, args := buildThreadQuery(dialectPostgres, postID)
+
+	rows, err := db.pool.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get thread: %w", err)
+	}
+	defer rows.Close()
+
+	var posts []Post
+
+	for rows.Next() {
+		post, err := scanPost(rows)
+		if err != nil {
+			return nil, err
+		}
+		posts = append(posts, *post)
+	}
+
+	return posts, rows.Err()
+}
+
+// SearchPosts retrieves a page of posts matching a full-text search, best match first
+func (db *Database) SearchPosts(ctx context.Context, query SearchQuery) ([]SearchResult, error) {
+	sql, args := buildSearchQuery(dialectPostgres, query)
+
+	rows, err := db.pool.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []SearchResult
+
+	for rows.Next() {
+		var result SearchResult
+		post, err := scanPost(rows, &result.Rank, &result.Highlight)
+		if err != nil {
+			return nil, err
+		}
+		result.Post = *post
+		results = append(results, result)
+	}
+
+	return results, rows.Err()
+}
+
 // ParseTimeFilter parses a time string in RFC3339 format
 func ParseTimeFilter(timeStr string) (*time.Time, error) {
 	if timeStr == "" {
@@ -216,7 +411,7 @@ func ParseTimeFilter(timeStr string) (*time.Time, error) {
 	return &t, nil
 }
 
-// ParseLimit parses a limit string and returns a valid integer
+// ParseLimit parses a limit string and returns a valid integer no greater than MaxPostsLimit
 func ParseLimit(limitStr string, defaultLimit int) int {
 	if limitStr == "" {
 		return defaultLimit
@@ -227,7 +422,7 @@ func ParseLimit(limitStr string, defaultLimit int) int {
 		return defaultLimit
 	}
 	
-	return limit
+	return min(limit, MaxPostsLimit)
 }
 
 // StartNotifications begins listening for PostgreSQL notifications
@@ -236,8 +431,16 @@ func (db *Database) StartNotifications(ctx context.Context) error {
 		return fmt.Errorf("notification connection not initialized")
 	}
 
+	// Only posts and sessions created or ended after this point are backfilled after a reconnect
+	err := db.pool.QueryRow(ctx, `
+		SELECT COALESCE((SELECT MAX(id) FROM posts), 0), COALESCE((SELECT MAX(id) FROM sessions), 0), CURRENT_TIMESTAMP
+	`).Scan(&db.lastNotifiedID, &db.lastNotifiedSessionID, &db.lastNotifiedAt)
+	if err != nil {
+		return fmt.Errorf("failed to start listening: %w", err)
+	}
+
 	// Start listening to the timeline_posts channel
-	_, err := db.notifyConn.Exec(ctx, "LISTEN timeline_posts")
+	_, err = db.notifyConn.Exec(ctx, "LISTEN "+NotificationChannel)
 	if err != nil {
 		return fmt.Errorf("failed to start listening: %w", err)
 	}
@@ -246,9 +449,10 @@ func (db *Database) StartNotifications(ctx context.Context) error {
 	notifyCtx, cancel := context.WithCancel(ctx)
 	db.notifyCancel = cancel
 
+	db.setNotifyListening(true, nil, 0)
 	go db.notificationLoop(notifyCtx)
-	
-	slog.Info("PostgreSQL LISTEN/NOTIFY started", "channel", "timeline_posts")
+
+	slog.Info("PostgreSQL LISTEN/NOTIFY started", "channel", NotificationChannel)
 	return nil
 }
 
@@ -257,6 +461,7 @@ func (db *Database) StopNotifications() {
 	if db.notifyCancel != nil {
 		db.notifyCancel()
 		<-db.notifyDone // Wait for notification loop to finish
+		db.setNotifyListening(false, nil, 0)
 	}
 }
 
@@ -267,127 +472,436 @@ func (db *Database) AddNotificationHandler(channel string, handler NotificationH
 	db.notifyHandlers[channel] = append(db.notifyHandlers[channel], handler)
 }
 
-// notificationLoop handles incoming PostgreSQL notifications
+// NotificationStatus reports whether the listener is connected and how often it reconnected
+func (db *Database) NotificationStatus() NotificationStatus {
+	db.notifyMutex.RLock()
+	defer db.notifyMutex.RUnlock()
+	return db.notifyStatus
+}
+
+// setNotifyListening records a change of the listener state. err is the reason a
+// connection was lost or a reconnect failed; backfilled counts the notifications
+// recovered by a reconnect.
+func (db *Database) setNotifyListening(listening bool, err error, backfilled int) {
+	db.notifyMutex.Lock()
+	defer db.notifyMutex.Unlock()
+	if listening != db.notifyStatus.Listening {
+		now := time.Now()
+		db.notifyStatus.Since = &now
+	}
+	db.notifyStatus.Listening = listening
+	if err != nil {
+		db.notifyStatus.LastError = err.Error()
+	}
+	db.notifyStatus.Backfilled += backfilled
+}
+
+// notificationLoop handles incoming PostgreSQL notifications. When the connection
+// breaks it reconnects and backfills the posts and sessions created in the meantime.
 func (db *Database) notificationLoop(ctx context.Context) {
 	defer close(db.notifyDone)
-	
+
+	for {
+		notification, err := db.notifyConn.WaitForNotification(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				slog.Info("Notification loop stopping")
+				return
+			}
+			slog.Error("Notification connection lost", "error", err)
+			db.setNotifyListening(false, err, 0)
+			if !db.reconnectNotifications(ctx) {
+				slog.Info("Notification loop stopping")
+				return
+			}
+			continue
+		}
+
+		// Parse the notification payload
+		var payload NotificationPayload
+		if err := json.Unmarshal([]byte(notification.Payload), &payload); err != nil {
+			slog.Error("Error parsing notification payload", "error", err, "payload", notification.Payload)
+			continue
+		}
+
+		// Skip notifications the backfill has already delivered
+		if _, ok := db.notified[payload.key()]; ok {
+			continue
+		}
+		db.dispatchNotification(notification.Channel, &payload)
+	}
+}
+
+// key identifies the row announced by the notification
+func (p *NotificationPayload) key() notificationKey {
+	if p.Table == NotificationTableSessions {
+		return notificationKey{table: p.Table, operation: p.Operation, id: p.SessionID}
+	}
+	return notificationKey{table: p.Table, operation: p.Operation, id: p.PostID}
+}
+
+// dispatchNotification calls the handlers of a channel and advances the backfill position.
+// Reaction notifications are not backfilled and leave it unchanged.
+func (db *Database) dispatchNotification(channel string, payload *NotificationPayload) {
+	db.notifyMutex.RLock()
+	handlers := db.notifyHandlers[channel]
+	db.notifyMutex.RUnlock()
+
+	ctx, span := startNotificationSpan(channel, payload)
+	for _, handler := range handlers {
+		if err := handler(ctx, payload); err != nil {
+			slog.Error("Error in notification handler", "error", err, "channel", channel, "table", payload.Table, "post_id", payload.PostID, "session_id", payload.SessionID)
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+	}
+	span.End()
+
+	switch payload.Table {
+	case NotificationTablePosts:
+		db.lastNotifiedID = max(db.lastNotifiedID, payload.PostID)
+	case NotificationTableSessions:
+		if payload.Operation == NotificationInsert {
+			db.lastNotifiedSessionID = max(db.lastNotifiedSessionID, payload.SessionID)
+		}
+	default:
+		return
+	}
+	db.rememberNotification(payload)
+}
+
+// rememberNotification records a dispatched notification, so that neither a backfill nor
+// a duplicate live notification delivers it again, and forgets the notifications older
+// than notifyBackfillOverlap before the latest one
+func (db *Database) rememberNotification(payload *NotificationPayload) {
+	if payload.Timestamp.After(db.lastNotifiedAt) {
+		db.lastNotifiedAt = payload.Timestamp
+	}
+	if db.notified == nil {
+		db.notified = make(map[notificationKey]time.Time)
+	}
+	db.notified[payload.key()] = payload.Timestamp
+
+	// Prune at most once per overlap, so that the map holds about two overlaps of notifications
+	if db.lastNotifiedAt.Sub(db.notifiedPrunedAt) < notifyBackfillOverlap {
+		return
+	}
+	since := db.lastNotifiedAt.Add(-notifyBackfillOverlap)
+	for key, timestamp := range db.notified {
+		if timestamp.Before(since) {
+			delete(db.notified, key)
+		}
+	}
+	db.notifiedPrunedAt = db.lastNotifiedAt
+}
+
+// reconnectNotifications opens a new notification connection with exponential backoff
+// until it succeeds, then backfills missed notifications. It returns false if the
+// context is cancelled first.
+func (db *Database) reconnectNotifications(ctx context.Context) bool {
+	delay := notifyReconnectMinDelay
 	for {
 		select {
 		case <-ctx.Done():
-			slog.Info("Notification loop stopping")
-			return
-		default:
-			// Wait for notifications with timeout
-			notification, err := db.notifyConn.WaitForNotification(ctx)
-			if err != nil {
-				if ctx.Err() != nil {
-					// Context cancelled, exit gracefully
-					return
-				}
-				slog.Error("Error waiting for notification", "error", err)
-				continue
-			}
+			return false
+		case <-time.After(delay):
+		}
 
-			// Parse the notification payload
-			var payload NotificationPayload
-			if err := json.Unmarshal([]byte(notification.Payload), &payload); err != nil {
-				slog.Error("Error parsing notification payload", "error", err, "payload", notification.Payload)
-				continue
+		backfilled, err := db.reconnectAndBackfill(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return false
 			}
+			delay = min(delay*2, notifyReconnectMaxDelay)
+			slog.Warn("Notification reconnect failed", "error", err, "retry_in", delay)
+			db.setNotifyListening(false, err, 0)
+			continue
+		}
 
-			// Call handlers for this channel
-			db.notifyMutex.RLock()
-			handlers := db.notifyHandlers[notification.Channel]
-			db.notifyMutex.RUnlock()
-			
-			for _, handler := range handlers {
-				if err := handler(&payload); err != nil {
-					slog.Error("Error in notification handler", "error", err, "channel", notification.Channel, "post_id", payload.PostID)
-				}
-			}
+		db.notifyMutex.Lock()
+		db.notifyStatus.Reconnects++
+		db.notifyMutex.Unlock()
+		db.setNotifyListening(true, nil, backfilled)
+		slog.Info("Notification listener reconnected", "backfilled", backfilled)
+		return true
+	}
+}
+
+// reconnectAndBackfill replaces the notification connection, listens again and then
+// dispatches the posts and sessions created or ended since the last notified ones that
+// have not been notified, or a resync notification if there are more than
+// notifyBackfillLimit. Listening first means that nothing falls between the backfill
+// and the live notifications; duplicates of backfilled rows are skipped by the
+// notification loop.
+func (db *Database) reconnectAndBackfill(ctx context.Context) (int, error) {
+	if db.notifyConn != nil {
+		closeCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		db.notifyConn.Close(closeCtx)
+		cancel()
+	}
+
+	conn, err := pgx.Connect(ctx, db.databaseURL)
+	if err != nil {
+		return 0, fmt.Errorf("failed to connect: %w", err)
+	}
+	db.notifyConn = conn
+	if _, err := conn.Exec(ctx, "LISTEN "+NotificationChannel); err != nil {
+		return 0, fmt.Errorf("failed to start listening: %w", err)
+	}
+
+	payloads, err := db.missedNotifications(ctx, notifyBackfillLimit)
+	if errors.Is(err, errBackfillTooLarge) {
+		missed, err := db.skipMissedNotifications(ctx)
+		if err != nil {
+			return 0, fmt.Errorf("failed to skip missed notifications: %w", err)
+		}
+		slog.Warn("Too many missed notifications to backfill, requesting a resync", "missed", missed)
+		db.dispatchNotification(NotificationChannel, &NotificationPayload{Timestamp: time.Now(), Operation: NotificationResync, Missed: missed})
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to backfill notifications: %w", err)
+	}
+
+	backfilled := 0
+	for i := range payloads {
+		if _, ok := db.notified[payloads[i].key()]; ok {
+			continue
 		}
+		db.dispatchNotification(NotificationChannel, &payloads[i])
+		backfilled++
 	}
+	return backfilled, nil
 }
 
-// CreateTables creates the necessary database tables and indexes
-func (db *Database) CreateTables(ctx context.Context) error {
-	// Create agents table
-	agentsTable := `
-		CREATE TABLE IF NOT EXISTS agents (
-			id SERIAL PRIMARY KEY,
-			name VARCHAR(255) NOT NULL,
-			context TEXT,
-			display_name VARCHAR(255) NOT NULL,
-			identity_key VARCHAR(255) NOT NULL,
-			avatar_seed VARCHAR(255) NOT NULL,
-			session_id VARCHAR(255) UNIQUE,
-			last_active TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
-			created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
-		);
-		CREATE INDEX IF NOT EXISTS idx_agents_session_id ON agents(session_id);
-		CREATE INDEX IF NOT EXISTS idx_agents_name ON agents(name);
-		CREATE INDEX IF NOT EXISTS idx_agents_display_name ON agents(display_name);
-		CREATE INDEX IF NOT EXISTS idx_agents_identity_key ON agents(identity_key);
-	`
+// missedNotifications returns the notifications of the posts and sessions created after
+// the last notified ones or less than notifyBackfillOverlap before the latest notified
+// row, and of the sessions ended since then, oldest first. The caller skips the ones
+// already notified. It returns errBackfillTooLarge without reading further if there are
+// more than limit.
+func (db *Database) missedNotifications(ctx context.Context, limit int) ([]NotificationPayload, error) {
+	var payloads []NotificationPayload
+	since := db.lastNotifiedAt.Add(-notifyBackfillOverlap)
+
+	rows, err := db.pool.Query(ctx, `
+		SELECT p.id, p.agent_id, p.content, p.timestamp, p.parent_post_id, p.thread_root_id, p.channel_id, c.slug
+		FROM posts p
+		JOIN channels c ON c.id = p.channel_id
+		WHERE p.id > $1 OR p.timestamp >= $2
+		ORDER BY p.id ASC
+		LIMIT $3`, db.lastNotifiedID, since, limit+1)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		payload := NotificationPayload{Operation: NotificationInsert, Table: NotificationTablePosts}
+		if err := rows.Scan(&payload.PostID, &payload.AgentID, &payload.Content, &payload.Timestamp, &payload.ParentPostID, &payload.ThreadRootID, &payload.ChannelID, &payload.Channel); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		payloads = append(payloads, payload)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(payloads) > limit {
+		return nil, errBackfillTooLarge
+	}
 
-	if _, err := db.pool.Exec(ctx, agentsTable); err != nil {
-		return fmt.Errorf("failed to create agents table: %w", err)
-	}
-
-	// Create posts table
-	postsTable := `
-		CREATE TABLE IF NOT EXISTS posts (
-			id SERIAL PRIMARY KEY,
-			agent_id INTEGER NOT NULL REFERENCES agents(id),
-			content TEXT NOT NULL CHECK (char_length(content) <= 280),
-			timestamp TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
-			metadata JSONB DEFAULT '{}'
-		);
-		CREATE INDEX IF NOT EXISTS idx_posts_agent_id ON posts(agent_id);
-		CREATE INDEX IF NOT EXISTS idx_posts_timestamp ON posts(timestamp DESC);
-	`
+	rows, err = db.pool.Query(ctx, `
+		SELECT s.id, s.agent_id, s.started_at, c.id, c.slug
+		FROM sessions s
+		JOIN channels c ON c.id = s.channel_id OR (s.channel_id IS NULL AND c.slug = '`+GeneralChannel+`')
+		WHERE s.id > $1 OR s.started_at >= $2
+		ORDER BY s.id ASC
+		LIMIT $3`, db.lastNotifiedSessionID, since, limit+1-len(payloads))
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		payload := NotificationPayload{Operation: NotificationInsert, Table: NotificationTableSessions}
+		if err := rows.Scan(&payload.SessionID, &payload.AgentID, &payload.Timestamp, &payload.ChannelID, &payload.Channel); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		payloads = append(payloads, payload)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(payloads) > limit {
+		return nil, errBackfillTooLarge
+	}
 
-	if _, err := db.pool.Exec(ctx, postsTable); err != nil {
-		return fmt.Errorf("failed to create posts table: %w", err)
-	}
-
-	// Create notification trigger function
-	triggerFunction := `
-		CREATE OR REPLACE FUNCTION notify_timeline_posts()
-		RETURNS TRIGGER AS $$
-		BEGIN
-			PERFORM pg_notify('timeline_posts', 
-				json_build_object(
-					'timestamp', EXTRACT(EPOCH FROM NEW.timestamp),
-					'operation', TG_OP,
-					'table', TG_TABLE_NAME,
-					'post_id', NEW.id,
-					'agent_id', NEW.agent_id,
-					'content', NEW.content
-				)::text
-			);
-			RETURN NEW;
-		END;
-		$$ LANGUAGE plpgsql;
-	`
+	rows, err = db.pool.Query(ctx, `
+		SELECT s.id, s.agent_id, s.ended_at, s.end_reason, c.id, c.slug
+		FROM sessions s
+		JOIN channels c ON c.id = s.channel_id OR (s.channel_id IS NULL AND c.slug = '`+GeneralChannel+`')
+		WHERE s.ended_at >= $1
+		ORDER BY s.ended_at ASC, s.id ASC
+		LIMIT $2`, since, limit+1-len(payloads))
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		payload := NotificationPayload{Operation: NotificationUpdate, Table: NotificationTableSessions}
+		if err := rows.Scan(&payload.SessionID, &payload.AgentID, &payload.Timestamp, &payload.EndReason, &payload.ChannelID, &payload.Channel); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		payloads = append(payloads, payload)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(payloads) > limit {
+		return nil, errBackfillTooLarge
+	}
+
+	return payloads, nil
+}
 
-	if _, err := db.pool.Exec(ctx, triggerFunction); err != nil {
-		return fmt.Errorf("failed to create trigger function: %w", err)
+// skipMissedNotifications moves the backfill position to the latest posts and sessions
+// without dispatching the missed notifications, and returns how many were missed
+func (db *Database) skipMissedNotifications(ctx context.Context) (int, error) {
+	since := db.lastNotifiedAt.Add(-notifyBackfillOverlap)
+
+	var missed int
+	err := db.pool.QueryRow(ctx, `
+		SELECT
+			(SELECT COALESCE(MAX(id), 0) FROM posts),
+			(SELECT COALESCE(MAX(id), 0) FROM sessions),
+			CURRENT_TIMESTAMP,
+			(SELECT COUNT(*) FROM posts WHERE id > $1)
+				+ (SELECT COUNT(*) FROM sessions WHERE id > $2)
+				+ (SELECT COUNT(*) FROM sessions WHERE ended_at >= $3)`,
+		db.lastNotifiedID, db.lastNotifiedSessionID, since,
+	).Scan(&db.lastNotifiedID, &db.lastNotifiedSessionID, &db.lastNotifiedAt, &missed)
+	if err != nil {
+		return 0, err
 	}
+	return missed, nil
+}
+
+// migrationLockID is the advisory lock key serializing concurrent migration runs
+const migrationLockID int64 = 72031001
+
+// MigrateUp applies all pending schema migrations
+func (db *Database) MigrateUp(ctx context.Context) ([]Migration, error) {
+	return migrateUp(ctx, db, dialectPostgres)
+}
 
-	// Create trigger
-	trigger := `
-		DROP TRIGGER IF EXISTS timeline_posts_notify ON posts;
-		CREATE TRIGGER timeline_posts_notify
-			AFTER INSERT ON posts
-			FOR EACH ROW EXECUTE FUNCTION notify_timeline_posts();
+// MigrateDown reverts the given number of most recently applied schema migrations
+func (db *Database) MigrateDown(ctx context.Context, steps int) ([]Migration, error) {
+	return migrateDown(ctx, db, dialectPostgres, steps)
+}
+
+// MigrationStatus reports which schema migrations have been applied
+func (db *Database) MigrationStatus(ctx context.Context) ([]MigrationStatus, error) {
+	return migrationStatus(ctx, db, dialectPostgres)
+}
+
+func (db *Database) ensureMigrationsTable(ctx context.Context) error {
+	query := `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY,
+			name TEXT NOT NULL,
+			applied_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+		)
 	`
+	if _, err := db.pool.Exec(ctx, query); err != nil {
+		return fmt.Errorf("failed to create schema_migrations table: %w", err)
+	}
+	return nil
+}
 
-	if _, err := db.pool.Exec(ctx, trigger); err != nil {
-		return fmt.Errorf("failed to create trigger: %w", err)
+func (db *Database) appliedMigrations(ctx context.Context) (map[int]time.Time, error) {
+	rows, err := db.pool.Query(ctx, "SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema_migrations: %w", err)
 	}
+	defer rows.Close()
 
-	return nil
+	applied := make(map[int]time.Time)
+	for rows.Next() {
+		var version int
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = appliedAt
+	}
+	return applied, rows.Err()
+}
+
+func (db *Database) runMigration(ctx context.Context, migration Migration, up bool) error {
+	tx, err := db.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	// Serialize with other server replicas migrating at the same time
+	if _, err := tx.Exec(ctx, "SELECT pg_advisory_xact_lock($1)", migrationLockID); err != nil {
+		return fmt.Errorf("failed to acquire migration lock: %w", err)
+	}
+
+	var applied bool
+	err = tx.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM schema_migrations WHERE version = $1)", migration.Version).Scan(&applied)
+	if err != nil {
+		return err
+	}
+	if applied == up {
+		return nil
+	}
+
+	if up {
+		if _, err := tx.Exec(ctx, migration.Up); err != nil {
+			return err
+		}
+		if err := backfillMigration(ctx, pgxMigrationTx{tx}, dialectPostgres, migration); err != nil {
+			return err
+		}
+		_, err = tx.Exec(ctx, "INSERT INTO schema_migrations (version, name) VALUES ($1, $2)", migration.Version, migration.Name)
+	} else {
+		if _, err := tx.Exec(ctx, migration.Down); err != nil {
+			return err
+		}
+		_, err = tx.Exec(ctx, "DELETE FROM schema_migrations WHERE version = $1", migration.Version)
+	}
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// pgxMigrationTx runs the Go steps of a migration in its transaction
+type pgxMigrationTx struct {
+	tx pgx.Tx
+}
+
+func (t pgxMigrationTx) exec(ctx context.Context, query string, args ...any) error {
+	_, err := t.tx.Exec(ctx, query, args...)
+	return err
+}
+
+func (t pgxMigrationTx) query(ctx context.Context, query string, row func(rowScanner) error) error {
+	rows, err := t.tx.Query(ctx, query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		if err := row(rows); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
 }
 
 // ExecuteQuery executes a generic query with parameters and returns typed results
@@ -398,9 +912,9 @@ func (db *Database) ExecuteQuery(ctx context.Context, query string, args ...any)
 // CreateAgent creates a new agent record
 func (db *Database) CreateAgent(ctx context.Context, params CreateAgentParams) (*Agent, error) {
 	query := `
-		INSERT INTO agents (name, context, display_name, identity_key, avatar_seed, session_id, last_active)
+		INSERT INTO agents (name, context, display_name, identity_key, avatar_seed, channel_id, last_active)
 		VALUES ($1, $2, $3, $4, $5, $6, CURRENT_TIMESTAMP)
-		RETURNING id, name, context, display_name, identity_key, avatar_seed, session_id, last_active, created_at
+		RETURNING id, name, context, display_name, identity_key, avatar_seed, last_active, created_at, channel_id
 	`
 
 	var agent Agent
@@ -410,7 +924,7 @@ func (db *Database) CreateAgent(ctx context.Context, params CreateAgentParams) (
 		params.DisplayName,
 		params.IdentityKey,
 		params.AvatarSeed,
-		params.SessionID,
+		params.ChannelID,
 	).Scan(
 		&agent.ID,
 		&agent.Name,
@@ -418,9 +932,9 @@ func (db *Database) CreateAgent(ctx context.Context, params CreateAgentParams) (
 		&agent.DisplayName,
 		&agent.IdentityKey,
 		&agent.AvatarSeed,
-		&agent.SessionID,
 		&agent.LastActive,
 		&agent.CreatedAt,
+		&agent.ChannelID,
 	)
 
 	if err != nil {
@@ -430,32 +944,32 @@ func (db *Database) CreateAgent(ctx context.Context, params CreateAgentParams) (
 	return &agent, nil
 }
 
-// GetAgentBySessionID retrieves an agent by session ID
-func (db *Database) GetAgentBySessionID(ctx context.Context, sessionID string) (*Agent, error) {
+// GetAgent retrieves an agent by ID, returning nil if it does not exist
+func (db *Database) GetAgent(ctx context.Context, id int) (*Agent, error) {
 	query := `
-		SELECT id, name, context, display_name, identity_key, avatar_seed, session_id, last_active, created_at
+		SELECT id, name, context, display_name, identity_key, avatar_seed, last_active, created_at, channel_id
 		FROM agents
-		WHERE session_id = $1
+		WHERE id = $1
 	`
 
 	var agent Agent
-	err := db.pool.QueryRow(ctx, query, sessionID).Scan(
+	err := db.pool.QueryRow(ctx, query, id).Scan(
 		&agent.ID,
 		&agent.Name,
 		&agent.Context,
 		&agent.DisplayName,
 		&agent.IdentityKey,
 		&agent.AvatarSeed,
-		&agent.SessionID,
 		&agent.LastActive,
 		&agent.CreatedAt,
+		&agent.ChannelID,
 	)
 
 	if err != nil {
 		if err == pgx.ErrNoRows {
 			return nil, nil
 		}
-		return nil, fmt.Errorf("failed to get agent by session ID: %w", err)
+		return nil, fmt.Errorf("failed to get agent: %w", err)
 	}
 
 	return &agent, nil
@@ -464,7 +978,7 @@ func (db *Database) GetAgentBySessionID(ctx context.Context, sessionID string) (
 // GetAgentByIdentityKey retrieves the most recent agent by identity key
 func (db *Database) GetAgentByIdentityKey(ctx context.Context, identityKey string) (*Agent, error) {
 	query := `
-		SELECT id, name, context, display_name, identity_key, avatar_seed, session_id, last_active, created_at
+		SELECT id, name, context, display_name, identity_key, avatar_seed, last_active, created_at, channel_id
 		FROM agents
 		WHERE identity_key = $1
 		ORDER BY created_at DESC
@@ -479,9 +993,9 @@ func (db *Database) GetAgentByIdentityKey(ctx context.Context, identityKey strin
 		&agent.DisplayName,
 		&agent.IdentityKey,
 		&agent.AvatarSeed,
-		&agent.SessionID,
 		&agent.LastActive,
 		&agent.CreatedAt,
+		&agent.ChannelID,
 	)
 
 	if err != nil {
@@ -494,72 +1008,338 @@ func (db *Database) GetAgentByIdentityKey(ctx context.Context, identityKey strin
 	return &agent, nil
 }
 
-// UpdateAgentSessionID updates an agent's session ID and last active timestamp
-func (db *Database) UpdateAgentSessionID(ctx context.Context, agentID int, sessionID string) error {
+// UpdateAgentChannel sets the channel an agent posts to by default; nil selects the general channel
+func (db *Database) UpdateAgentChannel(ctx context.Context, agentID int, channelID *int) error {
+	_, err := db.pool.Exec(ctx, "UPDATE agents SET channel_id = $1 WHERE id = $2", channelID, agentID)
+	if err != nil {
+		return fmt.Errorf("failed to update agent channel: %w", err)
+	}
+
+	return nil
+}
+
+// CreateChannel creates a new channel, returning ErrChannelExists if the slug is taken
+func (db *Database) CreateChannel(ctx context.Context, params CreateChannelParams) (*Channel, error) {
 	query := `
-		UPDATE agents
-		SET session_id = $1, last_active = CURRENT_TIMESTAMP
-		WHERE id = $2
+		INSERT INTO channels (slug, name, description)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (slug) DO NOTHING
+		RETURNING ` + channelColumns
+
+	channel, err := scanChannel(db.pool.QueryRow(ctx, query, params.Slug, params.Name, params.Description))
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, ErrChannelExists
+		}
+		return nil, fmt.Errorf("failed to create channel: %w", err)
+	}
+
+	return channel, nil
+}
+
+// GetChannelBySlug retrieves a channel by slug, returning nil if it does not exist
+func (db *Database) GetChannelBySlug(ctx context.Context, slug string) (*Channel, error) {
+	channel, err := scanChannel(db.pool.QueryRow(ctx, "SELECT "+channelColumns+" FROM channels WHERE slug = $1", slug))
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get channel: %w", err)
+	}
+
+	return channel, nil
+}
+
+// GetChannels retrieves every channel in alphabetical order of slug
+func (db *Database) GetChannels(ctx context.Context) ([]Channel, error) {
+	rows, err := db.pool.Query(ctx, "SELECT "+channelColumns+" FROM channels ORDER BY slug")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get channels: %w", err)
+	}
+	defer rows.Close()
+
+	var channels []Channel
+
+	for rows.Next() {
+		channel, err := scanChannel(rows)
+		if err != nil {
+			return nil, err
+		}
+		channels = append(channels, *channel)
+	}
+
+	return channels, rows.Err()
+}
+
+func scanChannel(row pgx.Row) (*Channel, error) {
+	var channel Channel
+	err := row.Scan(&channel.ID, &channel.Slug, &channel.Name, &channel.Description, &channel.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &channel, nil
+}
+
+// CreateSession starts a new session for an agent and marks the agent as active
+func (db *Database) CreateSession(ctx context.Context, params CreateSessionParams) (*Session, error) {
+	tx, err := db.pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create session: %w", err)
+	}
+	defer tx.Rollback(ctx)
+	if err := setTraceParent(ctx, tx); err != nil {
+		return nil, err
+	}
+
+	query := `
+		INSERT INTO sessions (token, agent_id, channel_id, client_info)
+		VALUES ($1, $2, $3, $4)
 	`
+	if _, err := tx.Exec(ctx, query, params.Token, params.AgentID, params.ChannelID, params.ClientInfo); err != nil {
+		return nil, fmt.Errorf("failed to create session: %w", err)
+	}
+	if _, err := tx.Exec(ctx, "UPDATE agents SET last_active = CURRENT_TIMESTAMP WHERE id = $1", params.AgentID); err != nil {
+		return nil, fmt.Errorf("failed to update agent last active: %w", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to create session: %w", err)
+	}
+
+	return db.GetSession(ctx, params.Token)
+}
 
-	_, err := db.pool.Exec(ctx, query, sessionID, agentID)
+// GetSession retrieves a session by token, returning nil if it does not exist
+func (db *Database) GetSession(ctx context.Context, token string) (*Session, error) {
+	sessions, err := db.GetSessions(ctx, SessionQuery{Token: token, Limit: 1})
+	if err != nil || len(sessions) == 0 {
+		return nil, err
+	}
+	return &sessions[0], nil
+}
+
+// GetSessions retrieves sessions, most recently started first
+func (db *Database) GetSessions(ctx context.Context, query SessionQuery) ([]Session, error) {
+	sql, args := buildSessionsQuery(dialectPostgres, query)
+
+	rows, err := db.pool.Query(ctx, sql, args...)
 	if err != nil {
-		return fmt.Errorf("failed to update agent session ID: %w", err)
+		return nil, fmt.Errorf("failed to get sessions: %w", err)
 	}
+	defer rows.Close()
 
-	return nil
+	var sessions []Session
+
+	for rows.Next() {
+		var session Session
+		err := rows.Scan(
+			&session.ID,
+			&session.Token,
+			&session.AgentID,
+			&session.DisplayName,
+			&session.IdentityKey,
+			&session.AvatarSeed,
+			&session.ChannelID,
+			&session.Channel,
+			&session.ClientInfo,
+			&session.StartedAt,
+			&session.LastSeenAt,
+			&session.EndedAt,
+			&session.EndReason,
+			&session.PostCount,
+		)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+
+	return sessions, rows.Err()
 }
 
-// UpdateAgentLastActive updates an agent's last active timestamp
-func (db *Database) UpdateAgentLastActive(ctx context.Context, sessionID string) error {
+// TouchSession records activity in an open session and on its agent. It returns false
+// if the session does not exist or has ended.
+func (db *Database) TouchSession(ctx context.Context, token string) (bool, error) {
 	query := `
-		UPDATE agents
-		SET last_active = CURRENT_TIMESTAMP
-		WHERE session_id = $1
+		WITH touched AS (
+			UPDATE sessions
+			SET last_seen_at = CURRENT_TIMESTAMP
+			WHERE token = $1 AND ended_at IS NULL
+			RETURNING agent_id
+		), active AS (
+			UPDATE agents
+			SET last_active = CURRENT_TIMESTAMP
+			WHERE id IN (SELECT agent_id FROM touched)
+		)
+		SELECT EXISTS (SELECT 1 FROM touched)
 	`
 
-	_, err := db.pool.Exec(ctx, query, sessionID)
+	var open bool
+	if err := db.pool.QueryRow(ctx, query, token).Scan(&open); err != nil {
+		return false, fmt.Errorf("failed to update session last seen: %w", err)
+	}
+
+	return open, nil
+}
+
+// EndSession ends an open session with the given reason. It returns false if the
+// session does not exist or has already ended.
+func (db *Database) EndSession(ctx context.Context, token string, reason string) (bool, error) {
+	tx, err := db.pool.Begin(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to update agent last active: %w", err)
+		return false, fmt.Errorf("failed to end session: %w", err)
+	}
+	defer tx.Rollback(ctx)
+	if err := setTraceParent(ctx, tx); err != nil {
+		return false, err
 	}
 
-	return nil
+	query := `
+		UPDATE sessions
+		SET ended_at = CURRENT_TIMESTAMP, end_reason = $2
+		WHERE token = $1 AND ended_at IS NULL
+	`
+
+	tag, err := tx.Exec(ctx, query, token, reason)
+	if err != nil {
+		return false, fmt.Errorf("failed to end session: %w", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return false, fmt.Errorf("failed to end session: %w", err)
+	}
+
+	return tag.RowsAffected() > 0, nil
+}
+
+// ExpireSessions ends the open sessions not seen since idleSince with the given reason
+// and returns them. It returns no sessions while another server holds the reaper lock.
+func (db *Database) ExpireSessions(ctx context.Context, idleSince time.Time, reason string) ([]Session, error) {
+	tx, err := db.pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to expire sessions: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var locked bool
+	if err := tx.QueryRow(ctx, "SELECT pg_try_advisory_xact_lock($1)", sessionReaperLock).Scan(&locked); err != nil {
+		return nil, fmt.Errorf("failed to acquire session reaper lock: %w", err)
+	}
+	if !locked {
+		return nil, nil
+	}
+	if err := setTraceParent(ctx, tx); err != nil {
+		return nil, err
+	}
+
+	query := `
+		UPDATE sessions
+		SET ended_at = CURRENT_TIMESTAMP, end_reason = $2
+		WHERE ended_at IS NULL AND last_seen_at < $1
+		RETURNING id
+	`
+
+	rows, err := tx.Query(ctx, query, idleSince, reason)
+	if err != nil {
+		return nil, fmt.Errorf("failed to expire sessions: %w", err)
+	}
+	ids, err := pgx.CollectRows(rows, pgx.RowTo[int])
+	if err != nil {
+		return nil, fmt.Errorf("failed to expire sessions: %w", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to expire sessions: %w", err)
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	return db.GetSessions(ctx, SessionQuery{IDs: ids, Limit: len(ids)})
 }
 
 // CreatePost creates a new timeline post
 func (db *Database) CreatePost(ctx context.Context, params CreatePostParams) (*Post, error) {
 	// Validate content length
-	if len(params.Content) > 280 {
-		return nil, fmt.Errorf("content exceeds 280 character limit")
+	if utf8.RuneCountInString(params.Content) > ContentMaxLength {
+		return nil, fmt.Errorf("content exceeds %d character limit", ContentMaxLength)
 	}
 
 	if params.Metadata == nil {
 		params.Metadata = json.RawMessage("{}")
 	}
 
+	// Replies belong to the thread and channel of their parent
+	var threadRootID *int
+	channelID := params.ChannelID
+	if params.ParentPostID != nil {
+		var rootID, parentChannelID int
+		err := db.pool.QueryRow(ctx, "SELECT COALESCE(thread_root_id, id), channel_id FROM posts WHERE id = $1", *params.ParentPostID).Scan(&rootID, &parentChannelID)
+		if err != nil {
+			if err == pgx.ErrNoRows {
+				return nil, ErrParentPostNotFound
+			}
+			return nil, fmt.Errorf("failed to get parent post: %w", err)
+		}
+		threadRootID = &rootID
+		channelID = &parentChannelID
+	}
+
+	var post Post
+	err := db.pool.QueryRow(ctx, resolveChannelQuery[dialectPostgres], channelID).Scan(&post.ChannelID, &post.Channel)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, ErrChannelNotFound
+		}
+		return nil, fmt.Errorf("failed to get channel: %w", err)
+	}
+
+	// Store the post and its mentions together so that notification handlers see both
+	tx, err := db.pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create post: %w", err)
+	}
+	defer tx.Rollback(ctx)
+	if err := setTraceParent(ctx, tx); err != nil {
+		return nil, err
+	}
+
 	query := `
-		INSERT INTO posts (agent_id, content, metadata)
-		VALUES ($1, $2, $3)
-		RETURNING id, agent_id, content, timestamp, metadata
+		INSERT INTO posts (agent_id, content, metadata, parent_post_id, thread_root_id, channel_id, session_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, agent_id, content, timestamp, metadata, parent_post_id, thread_root_id, session_id
 	`
 
-	var post Post
-	err := db.pool.QueryRow(ctx, query,
+	err = tx.QueryRow(ctx, query,
 		params.AgentID,
 		params.Content,
 		params.Metadata,
+		params.ParentPostID,
+		threadRootID,
+		post.ChannelID,
+		params.SessionID,
 	).Scan(
 		&post.ID,
 		&post.AgentID,
 		&post.Content,
 		&post.Timestamp,
 		&post.Metadata,
+		&post.ParentPostID,
+		&post.ThreadRootID,
+		&post.SessionID,
 	)
 
 	if err != nil {
 		return nil, fmt.Errorf("failed to create post: %w", err)
 	}
 
+	if err := db.createMentions(ctx, tx, post); err != nil {
+		return nil, err
+	}
+	if post.Tags, err = db.createTags(ctx, tx, post); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to create post: %w", err)
+	}
+
 	// Get agent information for the post
 	agentQuery := `
 		SELECT name, display_name, identity_key, avatar_seed
@@ -578,15 +1358,275 @@ func (db *Database) CreatePost(ctx context.Context, params CreatePostParams) (*P
 		return nil, fmt.Errorf("failed to get agent information: %w", err)
 	}
 
+	post.Reactions = []ReactionCount{}
+	postsCreated.WithLabelValues(post.IdentityKey).Inc()
+
 	return &post, nil
 }
 
+// createMentions records the agents mentioned in a new post, other than its author
+func (db *Database) createMentions(ctx context.Context, tx pgx.Tx, post Post) error {
+	if !strings.Contains(post.Content, "@") {
+		return nil
+	}
+
+	content := strings.ToLower(post.Content)
+	rows, err := tx.Query(ctx, mentionCandidatesQuery[dialectPostgres], content, content)
+	if err != nil {
+		return fmt.Errorf("failed to resolve mentions: %w", err)
+	}
+	candidates, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (mentionCandidate, error) {
+		var candidate mentionCandidate
+		err := row.Scan(&candidate.AgentID, &candidate.DisplayName, &candidate.IdentityKey)
+		return candidate, err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to resolve mentions: %w", err)
+	}
+
+	for _, agentID := range resolveMentions(post.Content, candidates) {
+		if agentID == post.AgentID {
+			continue
+		}
+		_, err := tx.Exec(ctx, "INSERT INTO post_mentions (post_id, agent_id) VALUES ($1, $2)", post.ID, agentID)
+		if err != nil {
+			return fmt.Errorf("failed to create mention: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// createTags indexes the hashtags of a new post and returns them in alphabetical order
+func (db *Database) createTags(ctx context.Context, tx pgx.Tx, post Post) ([]string, error) {
+	tags := ExtractHashtags(post.Content)
+	for _, tag := range tags {
+		if _, err := tx.Exec(ctx, insertTagQuery[dialectPostgres], tag); err != nil {
+			return nil, fmt.Errorf("failed to create tag: %w", err)
+		}
+		if _, err := tx.Exec(ctx, insertPostTagQuery[dialectPostgres], post.ID, tag); err != nil {
+			return nil, fmt.Errorf("failed to tag post: %w", err)
+		}
+	}
+
+	slices.Sort(tags)
+	if tags == nil {
+		tags = []string{}
+	}
+	return tags, nil
+}
+
+// GetTags retrieves hashtag usage, most recently used first
+func (db *Database) GetTags(ctx context.Context, query TagQuery) ([]TagSummary, error) {
+	sql, args := buildTagsQuery(dialectPostgres, query)
+
+	rows, err := db.pool.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tags: %w", err)
+	}
+	defer rows.Close()
+
+	var tags []TagSummary
+
+	for rows.Next() {
+		var tag TagSummary
+		if err := rows.Scan(&tag.Name, &tag.PostCount, &tag.RecentCount, &tag.LastPostAt); err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+
+	return tags, rows.Err()
+}
+
+// GetAgentSummaries retrieves agents with their posting activity
+func (db *Database) GetAgentSummaries(ctx context.Context, query AgentQuery) ([]AgentSummary, error) {
+	sql, args := buildAgentsQuery(dialectPostgres, query)
+
+	rows, err := db.pool.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get agents: %w", err)
+	}
+	defer rows.Close()
+
+	var agents []AgentSummary
+
+	for rows.Next() {
+		var agent AgentSummary
+		err := rows.Scan(
+			&agent.ID,
+			&agent.Name,
+			&agent.Context,
+			&agent.DisplayName,
+			&agent.IdentityKey,
+			&agent.AvatarSeed,
+			&agent.LastActive,
+			&agent.CreatedAt,
+			&agent.ChannelID,
+			&agent.PostCount,
+			&agent.RecentPostCount,
+			&agent.FirstPostAt,
+			&agent.LastPostAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		agent.Status = query.status(agent.LastActive)
+		agents = append(agents, agent)
+	}
+
+	return agents, rows.Err()
+}
+
+// GetMentions retrieves a page of the posts mentioning an agent, newest first
+func (db *Database) GetMentions(ctx context.Context, query MentionQuery) ([]Mention, error) {
+	sql, args := buildMentionsQuery(dialectPostgres, query)
+
+	rows, err := db.pool.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var mentions []Mention
+
+	for rows.Next() {
+		var mention Mention
+		post, err := scanPost(rows, &mention.ReadAt)
+		if err != nil {
+			return nil, err
+		}
+		mention.Post = *post
+		mentions = append(mentions, mention)
+	}
+
+	return mentions, rows.Err()
+}
+
+// CountUnreadMentions returns the number of unread mentions of an agent
+func (db *Database) CountUnreadMentions(ctx context.Context, agentID int) (int, error) {
+	var count int
+	err := db.pool.QueryRow(ctx, "SELECT COUNT(*) FROM post_mentions WHERE agent_id = $1 AND read_at IS NULL", agentID).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count unread mentions: %w", err)
+	}
+	return count, nil
+}
+
+// MarkMentionsRead marks mentions of an agent as read, returning how many were unread.
+// Only the mentions in the given posts are marked, or all of them if postIDs is empty.
+func (db *Database) MarkMentionsRead(ctx context.Context, agentID int, postIDs []int) (int, error) {
+	query := `
+		UPDATE post_mentions
+		SET read_at = CURRENT_TIMESTAMP
+		WHERE agent_id = $1 AND read_at IS NULL AND (cardinality($2::int[]) = 0 OR post_id = ANY($2))
+	`
+
+	if postIDs == nil {
+		postIDs = []int{}
+	}
+	tag, err := db.pool.Exec(ctx, query, agentID, postIDs)
+	if err != nil {
+		return 0, fmt.Errorf("failed to mark mentions read: %w", err)
+	}
+
+	return int(tag.RowsAffected()), nil
+}
+
+// GetMentionedAgents retrieves the agents mentioned in a post
+func (db *Database) GetMentionedAgents(ctx context.Context, postID int) ([]Agent, error) {
+	query := `
+		SELECT a.id, a.name, a.context, a.display_name, a.identity_key, a.avatar_seed, a.last_active, a.created_at, a.channel_id
+		FROM post_mentions m
+		JOIN agents a ON a.id = m.agent_id
+		WHERE m.post_id = $1
+		ORDER BY a.id
+	`
+
+	rows, err := db.pool.Query(ctx, query, postID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get mentioned agents: %w", err)
+	}
+
+	agents, err := pgx.CollectRows(rows, pgx.RowToStructByPos[Agent])
+	if err != nil {
+		return nil, fmt.Errorf("failed to get mentioned agents: %w", err)
+	}
+
+	return agents, nil
+}
+
+// SetReaction adds a reaction to a post, replacing any earlier reaction by the same reactor
+func (db *Database) SetReaction(ctx context.Context, params ReactionParams) error {
+	tx, err := db.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to set reaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+	if err := setTraceParent(ctx, tx); err != nil {
+		return err
+	}
+
+	var exists bool
+	err = tx.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM posts WHERE id = $1)", params.PostID).Scan(&exists)
+	if err != nil {
+		return fmt.Errorf("failed to get post: %w", err)
+	}
+	if !exists {
+		return ErrPostNotFound
+	}
+
+	query := `
+		INSERT INTO reactions (post_id, reactor_type, reactor, emoji)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (post_id, reactor_type, reactor)
+		DO UPDATE SET emoji = EXCLUDED.emoji, created_at = CURRENT_TIMESTAMP
+	`
+
+	_, err = tx.Exec(ctx, query, params.PostID, params.ReactorType, params.Reactor, params.Emoji)
+	if err != nil {
+		return fmt.Errorf("failed to set reaction: %w", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to set reaction: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteReaction removes the reaction of a reactor from a post, reporting whether it existed
+func (db *Database) DeleteReaction(ctx context.Context, params ReactionParams) (bool, error) {
+	tx, err := db.pool.Begin(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete reaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+	if err := setTraceParent(ctx, tx); err != nil {
+		return false, err
+	}
+
+	query := `
+		DELETE FROM reactions
+		WHERE post_id = $1 AND reactor_type = $2 AND reactor = $3
+	`
+
+	tag, err := tx.Exec(ctx, query, params.PostID, params.ReactorType, params.Reactor)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete reaction: %w", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return false, fmt.Errorf("failed to delete reaction: %w", err)
+	}
+
+	return tag.RowsAffected() > 0, nil
+}
+
 // GetRecentPosts retrieves recent posts with a specified limit
 func (db *Database) GetRecentPosts(ctx context.Context, limit int) ([]Post, error) {
-	return db.GetPosts(ctx, limit, nil)
+	return db.GetPosts(ctx, PostQuery{Limit: limit})
 }
 
 // GetPostsAfterTimestamp retrieves posts created after the specified timestamp
 func (db *Database) GetPostsAfterTimestamp(ctx context.Context, timestamp time.Time) ([]Post, error) {
-	return db.GetPosts(ctx, 100, &timestamp)
+	return db.GetPosts(ctx, PostQuery{Limit: DefaultPostsLimit, NewerThan: &timestamp})
 }
\ No newline at end of file
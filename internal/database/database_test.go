@@ -2,6 +2,8 @@ package database_test
 
 import (
 	"context"
+	"slices"
+	"strings"
 	"testing"
 	"time"
 
@@ -45,20 +47,20 @@ func (m *MockDatabase) Ping(ctx context.Context) error {
 	return m.err
 }
 
-func (m *MockDatabase) GetPosts(ctx context.Context, limit int, after *time.Time) ([]database.Post, error) {
+func (m *MockDatabase) GetPosts(ctx context.Context, query database.PostQuery) ([]database.Post, error) {
 	if m.err != nil {
 		return nil, m.err
 	}
 
 	var filteredPosts []database.Post
 	for _, post := range m.posts {
-		if after == nil || post.Timestamp.After(*after) {
+		if query.Since == nil || post.Timestamp.After(*query.Since) {
 			filteredPosts = append(filteredPosts, post)
 		}
 	}
 
-	if len(filteredPosts) > limit {
-		filteredPosts = filteredPosts[:limit]
+	if len(filteredPosts) > query.Limit {
+		filteredPosts = filteredPosts[:query.Limit]
 	}
 
 	return filteredPosts, nil
@@ -156,6 +158,12 @@ func TestParseLimit(t *testing.T) {
 			defaultLimit: 100,
 			expected:     100,
 		},
+		{
+			name:         "above maximum",
+			input:        "100000",
+			defaultLimit: 100,
+			expected:     database.MaxPostsLimit,
+		},
 	}
 
 	for _, tt := range tests {
@@ -178,4 +186,60 @@ func TestNewDatabase(t *testing.T) {
 			t.Error("Expected error for invalid connection string but got nil")
 		}
 	})
-}
\ No newline at end of file
+}
+func TestCursor(t *testing.T) {
+	cursor := database.Cursor{Timestamp: time.Date(2023, 6, 21, 12, 0, 0, 123456000, time.UTC), ID: 42}
+
+	parsed, err := database.ParseCursor(cursor.Encode())
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if !parsed.Timestamp.Equal(cursor.Timestamp) || parsed.ID != cursor.ID {
+		t.Errorf("Expected %+v, got %+v", cursor, parsed)
+	}
+
+	for _, invalid := range []string{"not a cursor!", "bm9jb2xvbg", "YWJjOjEy"} {
+		if _, err := database.ParseCursor(invalid); err == nil {
+			t.Errorf("Expected error for cursor %q but got nil", invalid)
+		}
+	}
+}
+
+func TestSearchCursor(t *testing.T) {
+	cursor := database.SearchCursor{Rank: 0.0607927, Timestamp: time.Date(2023, 6, 21, 12, 0, 0, 123456000, time.UTC), ID: 42}
+
+	parsed, err := database.ParseSearchCursor(cursor.Encode())
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if parsed.Rank != cursor.Rank || !parsed.Timestamp.Equal(cursor.Timestamp) || parsed.ID != cursor.ID {
+		t.Errorf("Expected %+v, got %+v", cursor, parsed)
+	}
+
+	if _, err := database.ParseSearchCursor(database.Cursor{Timestamp: cursor.Timestamp, ID: 42}.Encode()); err == nil {
+		t.Error("Expected error for a timeline cursor but got nil")
+	}
+}
+
+func TestExtractHashtags(t *testing.T) {
+	tests := []struct {
+		content  string
+		expected []string
+	}{
+		{"Fixed the #migration, see #Flaky-Test.", []string{"migration", "flaky-test"}},
+		{"#deploy #DEPLOY #deploy_v2", []string{"deploy", "deploy_v2"}},
+		{"Closes #42 and #123abc", []string{"123abc"}},
+		{"Written in C# with #ünïcode", []string{"ünïcode"}},
+		{"Trailing hyphen #wip- and a bare # sign", []string{"wip"}},
+		{"#" + strings.Repeat("a", database.MaxTagLength+1), nil},
+		{"no tags here", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.content, func(t *testing.T) {
+			if got := database.ExtractHashtags(tt.content); !slices.Equal(got, tt.expected) {
+				t.Errorf("Expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
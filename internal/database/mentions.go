@@ -0,0 +1,171 @@
+package database
+
+import (
+	"context"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Mention is a post that mentions an agent, with the agent's read status
+type Mention struct {
+	Post
+	// ReadAt is when the mentioned agent marked the mention as read, or nil while it is unread
+	ReadAt *time.Time `json:"read_at"`
+}
+
+// MentionQuery selects a page of the posts mentioning an agent, newest first
+type MentionQuery struct {
+	AgentID int
+	Limit   int
+	// UnreadOnly excludes mentions that have been marked as read
+	UnreadOnly bool
+	// Before only includes mentions in posts older than the cursor
+	Before *Cursor
+}
+
+// MentionPage is a page of an agent's mention inbox. NextCursor is passed as
+// `before` to fetch older mentions and is nil when there are none.
+type MentionPage struct {
+	Mentions    []Mention `json:"mentions"`
+	Count       int       `json:"count"`
+	UnreadCount int       `json:"unread_count"`
+	NextCursor  *string   `json:"next_cursor"`
+	HasMore     bool      `json:"has_more"`
+}
+
+// MentionReader is the subset of Store needed to paginate mentions
+type MentionReader interface {
+	GetMentions(ctx context.Context, query MentionQuery) ([]Mention, error)
+	CountUnreadMentions(ctx context.Context, agentID int) (int, error)
+}
+
+// GetMentionPage fetches one page of an agent's mentions together with its unread count
+func GetMentionPage(ctx context.Context, store MentionReader, query MentionQuery) (*MentionPage, error) {
+	limit := query.Limit
+	query.Limit = limit + 1
+
+	mentions, err := store.GetMentions(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	unread, err := store.CountUnreadMentions(ctx, query.AgentID)
+	if err != nil {
+		return nil, err
+	}
+
+	hasMore := len(mentions) > limit
+	if hasMore {
+		mentions = mentions[:limit]
+	}
+	if mentions == nil {
+		mentions = []Mention{}
+	}
+
+	page := &MentionPage{Mentions: mentions, Count: len(mentions), UnreadCount: unread, HasMore: hasMore}
+	if hasMore {
+		next := CursorFor(mentions[len(mentions)-1].Post).Encode()
+		page.NextCursor = &next
+	}
+	return page, nil
+}
+
+// buildMentionsQuery returns the SQL and arguments that select a page of an agent's
+// mentions; the read_at column follows the post columns
+func buildMentionsQuery(dialect string, query MentionQuery) (string, []any) {
+	b := &queryBuilder{dialect: dialect}
+
+	b.where("m.agent_id = ?", query.AgentID)
+	if query.UnreadOnly {
+		b.where("m.read_at IS NULL")
+	}
+	if query.Before != nil {
+		b.where("(p.timestamp, p.id) < (?, ?)", query.Before.Timestamp, query.Before.ID)
+	}
+
+	sql := `
+		SELECT` + postSelectColumns(dialect) + `,
+			m.read_at
+		FROM post_mentions m
+		JOIN posts p ON p.id = m.post_id
+		JOIN agents a ON p.agent_id = a.id` + b.clause() + `
+		ORDER BY p.timestamp DESC, p.id DESC
+		LIMIT ` + b.arg(query.Limit)
+	return sql, b.args
+}
+
+// mentionCandidatesQuery selects the agents whose display name or identity key follows
+// an @ somewhere in the content. The content is passed twice, lowercased.
+var mentionCandidatesQuery = map[string]string{
+	dialectPostgres: `
+		SELECT id, display_name, identity_key
+		FROM agents
+		WHERE strpos($1, '@' || lower(display_name)) > 0 OR strpos($2, '@' || lower(identity_key)) > 0`,
+	dialectSQLite: `
+		SELECT id, display_name, identity_key
+		FROM agents
+		WHERE instr(?, '@' || lower(display_name)) > 0 OR instr(?, '@' || lower(identity_key)) > 0`,
+}
+
+// mentionCandidate is an agent that may be mentioned by a post
+type mentionCandidate struct {
+	AgentID     int
+	DisplayName string
+	IdentityKey string
+}
+
+// resolveMentions returns the IDs of the agents mentioned in the content, in order of
+// first mention. An @ refers to the candidate with the longest display name or identity
+// key following it, matched case-insensitively, so "@Claude - Docs" mentions
+// "Claude - Docs" rather than "Claude". Names must end at a word boundary and the @
+// must not follow a word character, so e-mail addresses are not mentions.
+func resolveMentions(content string, candidates []mentionCandidate) []int {
+	var agentIDs []int
+	seen := make(map[int]bool)
+
+	for i := 0; i < len(content); i++ {
+		if content[i] != '@' {
+			continue
+		}
+		if prev, _ := utf8.DecodeLastRuneInString(content[:i]); i > 0 && isWordRune(prev) {
+			continue
+		}
+
+		rest := content[i+1:]
+		longest := 0
+		var matched []int
+		for _, candidate := range candidates {
+			length := 0
+			for _, name := range []string{candidate.DisplayName, candidate.IdentityKey} {
+				if mentionMatches(rest, name) {
+					length = max(length, len(name))
+				}
+			}
+			if length == 0 || length < longest {
+				continue
+			}
+			if length > longest {
+				longest, matched = length, nil
+			}
+			matched = append(matched, candidate.AgentID)
+		}
+
+		for _, agentID := range matched {
+			if !seen[agentID] {
+				seen[agentID] = true
+				agentIDs = append(agentIDs, agentID)
+			}
+		}
+	}
+
+	return agentIDs
+}
+
+// mentionMatches reports whether text starts with name followed by a word boundary
+func mentionMatches(text, name string) bool {
+	if name == "" || len(text) < len(name) || !strings.EqualFold(text[:len(name)], name) {
+		return false
+	}
+	next, _ := utf8.DecodeRuneInString(text[len(name):])
+	return len(text) == len(name) || !isWordRune(next)
+}
@@ -0,0 +1,91 @@
+package database
+
+import (
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// postsCreated counts the posts stored by this process
+var postsCreated = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "timeline_posts_created_total",
+	Help: "Posts created, by the identity key of the author.",
+}, []string{"identity_key"})
+
+// Collector returns a Prometheus collector of the connection pool statistics
+func (db *Database) Collector() prometheus.Collector {
+	return newPoolCollector(db.pool)
+}
+
+// Collector returns a Prometheus collector of the connection statistics
+func (s *SQLiteDatabase) Collector() prometheus.Collector {
+	return collectors.NewDBStatsCollector(s.db, "sqlite")
+}
+
+// poolMetric is one statistic of a pgx connection pool
+type poolMetric struct {
+	desc      *prometheus.Desc
+	valueType prometheus.ValueType
+	value     func(stat *pgxpool.Stat) float64
+}
+
+// poolCollector exports the statistics of a pgx connection pool, read on every scrape
+type poolCollector struct {
+	pool    *pgxpool.Pool
+	metrics []poolMetric
+}
+
+func newPoolCollector(pool *pgxpool.Pool) *poolCollector {
+	metric := func(name, help string, valueType prometheus.ValueType, value func(stat *pgxpool.Stat) float64) poolMetric {
+		return poolMetric{
+			desc:      prometheus.NewDesc("timeline_db_pool_"+name, help, nil, nil),
+			valueType: valueType,
+			value:     value,
+		}
+	}
+	return &poolCollector{
+		pool: pool,
+		metrics: []poolMetric{
+			metric("acquired_connections", "Connections currently in use.", prometheus.GaugeValue,
+				func(stat *pgxpool.Stat) float64 { return float64(stat.AcquiredConns()) }),
+			metric("idle_connections", "Idle connections in the pool.", prometheus.GaugeValue,
+				func(stat *pgxpool.Stat) float64 { return float64(stat.IdleConns()) }),
+			metric("constructing_connections", "Connections being established.", prometheus.GaugeValue,
+				func(stat *pgxpool.Stat) float64 { return float64(stat.ConstructingConns()) }),
+			metric("total_connections", "Connections in the pool, in use, idle or being established.", prometheus.GaugeValue,
+				func(stat *pgxpool.Stat) float64 { return float64(stat.TotalConns()) }),
+			metric("max_connections", "Maximum size of the pool.", prometheus.GaugeValue,
+				func(stat *pgxpool.Stat) float64 { return float64(stat.MaxConns()) }),
+			metric("acquires_total", "Connections acquired from the pool.", prometheus.CounterValue,
+				func(stat *pgxpool.Stat) float64 { return float64(stat.AcquireCount()) }),
+			metric("acquire_duration_seconds_total", "Time spent acquiring connections.", prometheus.CounterValue,
+				func(stat *pgxpool.Stat) float64 { return stat.AcquireDuration().Seconds() }),
+			metric("empty_acquires_total", "Acquires that waited for a connection because the pool was empty.", prometheus.CounterValue,
+				func(stat *pgxpool.Stat) float64 { return float64(stat.EmptyAcquireCount()) }),
+			metric("canceled_acquires_total", "Acquires canceled by their context.", prometheus.CounterValue,
+				func(stat *pgxpool.Stat) float64 { return float64(stat.CanceledAcquireCount()) }),
+			metric("new_connections_total", "Connections opened by the pool.", prometheus.CounterValue,
+				func(stat *pgxpool.Stat) float64 { return float64(stat.NewConnsCount()) }),
+			metric("max_lifetime_destroyed_total", "Connections closed for exceeding their maximum lifetime.", prometheus.CounterValue,
+				func(stat *pgxpool.Stat) float64 { return float64(stat.MaxLifetimeDestroyCount()) }),
+			metric("max_idle_destroyed_total", "Connections closed for exceeding their maximum idle time.", prometheus.CounterValue,
+				func(stat *pgxpool.Stat) float64 { return float64(stat.MaxIdleDestroyCount()) }),
+		},
+	}
+}
+
+// Describe implements prometheus.Collector
+func (c *poolCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, metric := range c.metrics {
+		ch <- metric.desc
+	}
+}
+
+// Collect implements prometheus.Collector
+func (c *poolCollector) Collect(ch chan<- prometheus.Metric) {
+	stat := c.pool.Stat()
+	for _, metric := range c.metrics {
+		ch <- prometheus.MustNewConstMetric(metric.desc, metric.valueType, metric.value(stat))
+	}
+}
@@ -0,0 +1,252 @@
+package database
+
+import (
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+//go:embed migrations
+var migrationFiles embed.FS
+
+// Migration dialects, matching the directories under migrations/
+const (
+	dialectPostgres = "postgres"
+	dialectSQLite   = "sqlite"
+)
+
+// ErrSchemaOutdated is returned by CheckSchema when the database is not on the expected schema version
+var ErrSchemaOutdated = errors.New("database schema version mismatch")
+
+// Migration is a single versioned schema change
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationStatus describes whether a migration has been applied
+type MigrationStatus struct {
+	Version   int        `json:"version"`
+	Name      string     `json:"name"`
+	Applied   bool       `json:"applied"`
+	AppliedAt *time.Time `json:"applied_at"`
+}
+
+// migrationRunner is implemented by each backend to apply migrations in its own dialect
+type migrationRunner interface {
+	ensureMigrationsTable(ctx context.Context) error
+	appliedMigrations(ctx context.Context) (map[int]time.Time, error)
+	// runMigration executes the migration and records it in one transaction.
+	// It is a no-op if the migration is already in the requested state.
+	runMigration(ctx context.Context, migration Migration, up bool) error
+}
+
+// migrationTx is the transaction a migration runs in, for the steps written in Go
+type migrationTx interface {
+	exec(ctx context.Context, query string, args ...any) error
+	// query calls row for every row of the query
+	query(ctx context.Context, query string, row func(rowScanner) error) error
+}
+
+// migrationBackfills fill the tables created by a migration from existing rows where
+// SQL alone cannot, by migration version. They run after the up SQL in its transaction.
+var migrationBackfills = map[int]func(ctx context.Context, tx migrationTx, dialect string) error{
+	8: backfillPostTags,
+}
+
+// backfillMigration runs the backfill of a migration being applied, if it has one
+func backfillMigration(ctx context.Context, tx migrationTx, dialect string, migration Migration) error {
+	backfill, ok := migrationBackfills[migration.Version]
+	if !ok {
+		return nil
+	}
+	if err := backfill(ctx, tx, dialect); err != nil {
+		return fmt.Errorf("backfill failed: %w", err)
+	}
+	return nil
+}
+
+var migrationFilePattern = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// loadMigrations reads the embedded migrations for a dialect, ordered by version
+func loadMigrations(dialect string) ([]Migration, error) {
+	dir := path.Join("migrations", dialect)
+	entries, err := fs.ReadDir(migrationFiles, dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migrations: %w", err)
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		match := migrationFilePattern.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("invalid migration file name: %s", entry.Name())
+		}
+
+		version, _ := strconv.Atoi(match[1])
+		content, err := fs.ReadFile(migrationFiles, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration %s: %w", entry.Name(), err)
+		}
+
+		migration, exists := byVersion[version]
+		if !exists {
+			migration = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = migration
+		} else if migration.Name != match[2] {
+			return nil, fmt.Errorf("conflicting names for migration %d: %s and %s", version, migration.Name, match[2])
+		}
+
+		if match[3] == "up" {
+			migration.Up = string(content)
+		} else {
+			migration.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" || migration.Down == "" {
+			return nil, fmt.Errorf("migration %d_%s must have both up and down files", migration.Version, migration.Name)
+		}
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+
+	for i, migration := range migrations {
+		if migration.Version != i+1 {
+			return nil, fmt.Errorf("migration versions must be sequential starting at 1, found %d at position %d", migration.Version, i+1)
+		}
+	}
+
+	return migrations, nil
+}
+
+// migrateUp applies every pending migration in order
+func migrateUp(ctx context.Context, runner migrationRunner, dialect string) ([]Migration, error) {
+	migrations, err := loadMigrations(dialect)
+	if err != nil {
+		return nil, err
+	}
+	if err := runner.ensureMigrationsTable(ctx); err != nil {
+		return nil, err
+	}
+	applied, err := runner.appliedMigrations(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var ran []Migration
+	for _, migration := range migrations {
+		if _, ok := applied[migration.Version]; ok {
+			continue
+		}
+		if err := runner.runMigration(ctx, migration, true); err != nil {
+			return ran, fmt.Errorf("migration %d_%s failed: %w", migration.Version, migration.Name, err)
+		}
+		ran = append(ran, migration)
+	}
+
+	return ran, nil
+}
+
+// migrateDown reverts the given number of most recently applied migrations
+func migrateDown(ctx context.Context, runner migrationRunner, dialect string, steps int) ([]Migration, error) {
+	migrations, err := loadMigrations(dialect)
+	if err != nil {
+		return nil, err
+	}
+	if err := runner.ensureMigrationsTable(ctx); err != nil {
+		return nil, err
+	}
+	applied, err := runner.appliedMigrations(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var reverted []Migration
+	for i := len(migrations) - 1; i >= 0 && len(reverted) < steps; i-- {
+		migration := migrations[i]
+		if _, ok := applied[migration.Version]; !ok {
+			continue
+		}
+		if err := runner.runMigration(ctx, migration, false); err != nil {
+			return reverted, fmt.Errorf("reverting migration %d_%s failed: %w", migration.Version, migration.Name, err)
+		}
+		reverted = append(reverted, migration)
+	}
+
+	return reverted, nil
+}
+
+// migrationStatus lists every known migration and whether it has been applied.
+// Applied versions without a matching migration file are reported with an empty name.
+func migrationStatus(ctx context.Context, runner migrationRunner, dialect string) ([]MigrationStatus, error) {
+	migrations, err := loadMigrations(dialect)
+	if err != nil {
+		return nil, err
+	}
+	if err := runner.ensureMigrationsTable(ctx); err != nil {
+		return nil, err
+	}
+	applied, err := runner.appliedMigrations(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, 0, len(migrations))
+	for _, migration := range migrations {
+		status := MigrationStatus{Version: migration.Version, Name: migration.Name}
+		if appliedAt, ok := applied[migration.Version]; ok {
+			status.Applied = true
+			status.AppliedAt = &appliedAt
+			delete(applied, migration.Version)
+		}
+		statuses = append(statuses, status)
+	}
+	for version, appliedAt := range applied {
+		statuses = append(statuses, MigrationStatus{Version: version, Applied: true, AppliedAt: &appliedAt})
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Version < statuses[j].Version })
+
+	return statuses, nil
+}
+
+// CheckSchema verifies that every embedded migration has been applied and that the
+// database has not been migrated past the versions known to this binary
+func CheckSchema(ctx context.Context, store Store) error {
+	statuses, err := store.MigrationStatus(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to read schema version: %w", err)
+	}
+
+	current, latest := 0, 0
+	for _, status := range statuses {
+		if status.Name != "" {
+			latest = status.Version
+		}
+		if status.Applied {
+			current = status.Version
+		}
+	}
+
+	for _, status := range statuses {
+		if status.Name == "" {
+			return fmt.Errorf("%w: database is at version %d but this binary only knows migrations up to %d", ErrSchemaOutdated, current, latest)
+		}
+		if !status.Applied {
+			return fmt.Errorf("%w: database is at version %d, expected %d; run `timeline-migrate up`", ErrSchemaOutdated, current, latest)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,186 @@
+package database_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/kmio11/agent-timeline-mcp/internal/database"
+	_ "modernc.org/sqlite"
+)
+
+// openSQLiteFile opens a migrated SQLite database along with a plain connection to the
+// same file, for writing rows the way clients other than this package do
+func openSQLiteFile(t *testing.T) (*database.SQLiteDatabase, *sql.DB) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "timeline.db")
+	db, err := database.NewSQLiteDatabase(context.Background(), path)
+	if err != nil {
+		t.Fatalf("Failed to open SQLite database: %v", err)
+	}
+	t.Cleanup(db.Close)
+	if _, err := db.MigrateUp(context.Background()); err != nil {
+		t.Fatalf("Failed to migrate SQLite database: %v", err)
+	}
+
+	raw, err := sql.Open("sqlite", "file:"+path+"?_pragma=busy_timeout(5000)")
+	if err != nil {
+		t.Fatalf("Failed to open SQLite file: %v", err)
+	}
+	t.Cleanup(func() { raw.Close() })
+	return db, raw
+}
+
+func TestMigrations(t *testing.T) {
+	ctx := context.Background()
+	db, err := database.NewSQLiteDatabase(ctx, filepath.Join(t.TempDir(), "timeline.db"))
+	if err != nil {
+		t.Fatalf("Failed to open SQLite database: %v", err)
+	}
+	defer db.Close()
+
+	t.Run("schema check fails before migrating", func(t *testing.T) {
+		if err := database.CheckSchema(ctx, db); !errors.Is(err, database.ErrSchemaOutdated) {
+			t.Errorf("Expected ErrSchemaOutdated, got %v", err)
+		}
+	})
+
+	t.Run("up applies all migrations", func(t *testing.T) {
+		applied, err := db.MigrateUp(ctx)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if len(applied) == 0 || applied[0].Version != 1 {
+			t.Errorf("Expected migrations starting at version 1, got %+v", applied)
+		}
+		if err := database.CheckSchema(ctx, db); err != nil {
+			t.Errorf("Expected schema check to pass, got %v", err)
+		}
+	})
+
+	t.Run("up is idempotent", func(t *testing.T) {
+		applied, err := db.MigrateUp(ctx)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if len(applied) != 0 {
+			t.Errorf("Expected no migrations to be applied, got %d", len(applied))
+		}
+	})
+
+	t.Run("status reports applied migrations", func(t *testing.T) {
+		statuses, err := db.MigrationStatus(ctx)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		for _, status := range statuses {
+			if !status.Applied || status.AppliedAt == nil {
+				t.Errorf("Expected migration %d to be applied", status.Version)
+			}
+		}
+	})
+
+	t.Run("down reverts the latest migration", func(t *testing.T) {
+		statuses, err := db.MigrationStatus(ctx)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		latest := statuses[len(statuses)-1].Version
+
+		reverted, err := db.MigrateDown(ctx, 1)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if len(reverted) != 1 || reverted[0].Version != latest {
+			t.Errorf("Expected migration %d to be reverted, got %+v", latest, reverted)
+		}
+		if err := database.CheckSchema(ctx, db); !errors.Is(err, database.ErrSchemaOutdated) {
+			t.Errorf("Expected ErrSchemaOutdated after down, got %v", err)
+		}
+
+		if _, err := db.MigrateUp(ctx); err != nil {
+			t.Fatalf("Expected re-applying migrations to succeed, got %v", err)
+		}
+	})
+}
+
+func TestMigrations_PostWithoutChannel(t *testing.T) {
+	ctx := context.Background()
+	db, raw := openSQLiteFile(t)
+
+	agent, err := db.CreateAgent(ctx, database.CreateAgentParams{Name: "Claude", DisplayName: "Claude", IdentityKey: "claude", AvatarSeed: "seed"})
+	if err != nil {
+		t.Fatalf("Failed to create agent: %v", err)
+	}
+
+	// Older clients insert posts without naming a channel
+	var postID int
+	err = raw.QueryRowContext(ctx, "INSERT INTO posts (agent_id, content, timestamp) VALUES (?, ?, ?) RETURNING id",
+		agent.ID, "Hello", time.Now().UTC().Format("2006-01-02T15:04:05.000000Z")).Scan(&postID)
+	if err != nil {
+		t.Fatalf("Expected a post without a channel to be inserted, got %v", err)
+	}
+
+	post, err := db.GetPost(ctx, postID)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if post.Channel != database.GeneralChannel {
+		t.Errorf("Expected the post in the general channel, got %q", post.Channel)
+	}
+}
+
+func TestMigrations_PostTagsBackfill(t *testing.T) {
+	ctx := context.Background()
+	db, raw := openSQLiteFile(t)
+
+	// Go back to the schema before 0008_post_tags
+	statuses, err := db.MigrationStatus(ctx)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if _, err := db.MigrateDown(ctx, len(statuses)-7); err != nil {
+		t.Fatalf("Failed to migrate down: %v", err)
+	}
+
+	now := time.Now().UTC().Format("2006-01-02T15:04:05.000000Z")
+	var agentID int
+	err = raw.QueryRowContext(ctx, `INSERT INTO agents (name, display_name, identity_key, avatar_seed, last_active, created_at)
+		VALUES ('Claude', 'Claude', 'claude', 'seed', ?, ?) RETURNING id`, now, now).Scan(&agentID)
+	if err != nil {
+		t.Fatalf("Failed to create agent: %v", err)
+	}
+	for _, content := range []string{"Starting the #migration #Migration", "Fixed #42 in C#", "Found a #flaky-test during the #migration"} {
+		if _, err := raw.ExecContext(ctx, "INSERT INTO posts (agent_id, content, timestamp) VALUES (?, ?, ?)", agentID, content, now); err != nil {
+			t.Fatalf("Failed to create post: %v", err)
+		}
+	}
+
+	if _, err := db.MigrateUp(ctx); err != nil {
+		t.Fatalf("Failed to migrate up: %v", err)
+	}
+
+	tags, err := db.GetTags(ctx, database.TagQuery{Limit: 10})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	counts := make(map[string]int)
+	for _, tag := range tags {
+		counts[tag.Name] = tag.PostCount
+	}
+	if len(counts) != 2 || counts["migration"] != 2 || counts["flaky-test"] != 1 {
+		t.Errorf("Expected the hashtags of existing posts to be indexed, got %+v", tags)
+	}
+
+	posts, err := db.GetPosts(ctx, database.PostQuery{Tag: "flaky-test", Limit: 10})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(posts) != 1 || !slices.Equal(posts[0].Tags, []string{"flaky-test", "migration"}) {
+		t.Errorf("Expected the tagged post, got %+v", posts)
+	}
+}
@@ -0,0 +1,4 @@
+DROP TRIGGER IF EXISTS timeline_posts_notify ON posts;
+DROP FUNCTION IF EXISTS notify_timeline_posts();
+DROP TABLE IF EXISTS posts;
+DROP TABLE IF EXISTS agents;
@@ -0,0 +1,80 @@
+-- Initial schema for agents and posts.
+-- Databases created by the legacy scripts/init-db.sql or Database.CreateTables
+-- are brought to the same shape, so this migration is safe to run on them.
+
+CREATE TABLE IF NOT EXISTS agents (
+  id SERIAL PRIMARY KEY,
+  name TEXT NOT NULL,
+  context TEXT,
+  display_name TEXT NOT NULL,
+  identity_key TEXT NOT NULL,
+  avatar_seed TEXT NOT NULL,
+  session_id TEXT UNIQUE,
+  last_active TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+  created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS posts (
+  id SERIAL PRIMARY KEY,
+  agent_id INTEGER NOT NULL REFERENCES agents (id),
+  content TEXT NOT NULL CHECK (char_length(content) <= 280),
+  timestamp TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+  metadata JSONB DEFAULT '{}'
+);
+
+-- Normalize legacy column types (init-db.sql used TIMESTAMP without time zone)
+DO $$
+DECLARE
+  col RECORD;
+BEGIN
+  FOR col IN
+    SELECT table_name, column_name
+    FROM information_schema.columns
+    WHERE table_schema = current_schema()
+      AND (table_name, column_name) IN (('agents', 'last_active'), ('agents', 'created_at'), ('posts', 'timestamp'))
+      AND data_type = 'timestamp without time zone'
+  LOOP
+    EXECUTE format(
+      'ALTER TABLE %I ALTER COLUMN %I TYPE TIMESTAMPTZ USING %I AT TIME ZONE ''UTC''',
+      col.table_name, col.column_name, col.column_name
+    );
+  END LOOP;
+END $$;
+
+ALTER TABLE agents ALTER COLUMN session_id DROP NOT NULL;
+ALTER TABLE posts ALTER COLUMN metadata SET DEFAULT '{}';
+
+CREATE INDEX IF NOT EXISTS idx_agents_session_id ON agents(session_id);
+CREATE INDEX IF NOT EXISTS idx_agents_name ON agents(name);
+CREATE INDEX IF NOT EXISTS idx_agents_display_name ON agents(display_name);
+CREATE INDEX IF NOT EXISTS idx_agents_identity_key ON agents(identity_key);
+CREATE INDEX IF NOT EXISTS idx_posts_agent_id ON posts(agent_id);
+CREATE INDEX IF NOT EXISTS idx_posts_timestamp ON posts(timestamp DESC);
+
+-- Replace the legacy notification trigger from init-db.sql
+DROP TRIGGER IF EXISTS timeline_post_notify ON posts;
+DROP FUNCTION IF EXISTS notify_timeline_post();
+
+-- Notify listeners of new posts. The timestamp is sent as an RFC3339 string
+-- so that it unmarshals into NotificationPayload.Timestamp.
+CREATE OR REPLACE FUNCTION notify_timeline_posts()
+RETURNS TRIGGER AS $$
+BEGIN
+  PERFORM pg_notify('timeline_posts',
+    json_build_object(
+      'timestamp', to_char(NEW.timestamp AT TIME ZONE 'UTC', 'YYYY-MM-DD"T"HH24:MI:SS.US"Z"'),
+      'operation', TG_OP,
+      'table', TG_TABLE_NAME,
+      'post_id', NEW.id,
+      'agent_id', NEW.agent_id,
+      'content', NEW.content
+    )::text
+  );
+  RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS timeline_posts_notify ON posts;
+CREATE TRIGGER timeline_posts_notify
+  AFTER INSERT ON posts
+  FOR EACH ROW EXECUTE FUNCTION notify_timeline_posts();
@@ -0,0 +1,3 @@
+-- Keyset pagination orders posts by (timestamp, id); this index covers both directions.
+DROP INDEX IF EXISTS idx_posts_timestamp;
+CREATE INDEX IF NOT EXISTS idx_posts_timestamp_id ON posts(timestamp DESC, id DESC);
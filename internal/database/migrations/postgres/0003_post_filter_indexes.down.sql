@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_posts_metadata;
+DROP INDEX IF EXISTS idx_agents_context;
+DROP INDEX IF EXISTS idx_posts_agent_id_timestamp;
+CREATE INDEX IF NOT EXISTS idx_posts_agent_id ON posts(agent_id);
@@ -0,0 +1,6 @@
+-- Full-text search over post content. The generated column keeps the
+-- tsvector in sync with content without a trigger.
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS search_vector tsvector
+  GENERATED ALWAYS AS (to_tsvector('english', content)) STORED;
+
+CREATE INDEX IF NOT EXISTS idx_posts_search_vector ON posts USING GIN (search_vector);
@@ -0,0 +1,21 @@
+CREATE OR REPLACE FUNCTION notify_timeline_posts()
+RETURNS TRIGGER AS $$
+BEGIN
+  PERFORM pg_notify('timeline_posts',
+    json_build_object(
+      'timestamp', to_char(NEW.timestamp AT TIME ZONE 'UTC', 'YYYY-MM-DD"T"HH24:MI:SS.US"Z"'),
+      'operation', TG_OP,
+      'table', TG_TABLE_NAME,
+      'post_id', NEW.id,
+      'agent_id', NEW.agent_id,
+      'content', NEW.content
+    )::text
+  );
+  RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP INDEX IF EXISTS idx_posts_thread_root_id;
+DROP INDEX IF EXISTS idx_posts_parent_post_id;
+ALTER TABLE posts DROP COLUMN IF EXISTS thread_root_id;
+ALTER TABLE posts DROP COLUMN IF EXISTS parent_post_id;
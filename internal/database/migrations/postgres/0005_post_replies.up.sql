@@ -0,0 +1,27 @@
+-- Threaded replies. thread_root_id is the top-level post of the conversation
+-- and is NULL for top-level posts themselves.
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS parent_post_id INTEGER REFERENCES posts (id);
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS thread_root_id INTEGER REFERENCES posts (id);
+
+CREATE INDEX IF NOT EXISTS idx_posts_parent_post_id ON posts(parent_post_id);
+CREATE INDEX IF NOT EXISTS idx_posts_thread_root_id ON posts(thread_root_id);
+
+-- Include the reply target so that clients can nest replies live
+CREATE OR REPLACE FUNCTION notify_timeline_posts()
+RETURNS TRIGGER AS $$
+BEGIN
+  PERFORM pg_notify('timeline_posts',
+    json_build_object(
+      'timestamp', to_char(NEW.timestamp AT TIME ZONE 'UTC', 'YYYY-MM-DD"T"HH24:MI:SS.US"Z"'),
+      'operation', TG_OP,
+      'table', TG_TABLE_NAME,
+      'post_id', NEW.id,
+      'agent_id', NEW.agent_id,
+      'content', NEW.content,
+      'parent_post_id', NEW.parent_post_id,
+      'thread_root_id', NEW.thread_root_id
+    )::text
+  );
+  RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
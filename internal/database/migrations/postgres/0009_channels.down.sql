@@ -0,0 +1,23 @@
+CREATE OR REPLACE FUNCTION notify_timeline_posts()
+RETURNS TRIGGER AS $$
+BEGIN
+  PERFORM pg_notify('timeline_posts',
+    json_build_object(
+      'timestamp', to_char(NEW.timestamp AT TIME ZONE 'UTC', 'YYYY-MM-DD"T"HH24:MI:SS.US"Z"'),
+      'operation', TG_OP,
+      'table', TG_TABLE_NAME,
+      'post_id', NEW.id,
+      'agent_id', NEW.agent_id,
+      'content', NEW.content,
+      'parent_post_id', NEW.parent_post_id,
+      'thread_root_id', NEW.thread_root_id
+    )::text
+  );
+  RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP INDEX IF EXISTS idx_posts_channel_id;
+ALTER TABLE agents DROP COLUMN IF EXISTS channel_id;
+ALTER TABLE posts DROP COLUMN IF EXISTS channel_id;
+DROP TABLE IF EXISTS channels;
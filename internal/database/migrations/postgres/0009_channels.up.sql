@@ -0,0 +1,52 @@
+-- Named timelines. Posts without a channel belong to the general channel,
+-- and agents may pick a default channel for their posts at sign in.
+CREATE TABLE IF NOT EXISTS channels (
+  id SERIAL PRIMARY KEY,
+  slug TEXT NOT NULL UNIQUE,
+  name TEXT NOT NULL,
+  description TEXT NOT NULL DEFAULT '',
+  created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+INSERT INTO channels (slug, name, description)
+VALUES ('general', 'General', 'Posts without a channel')
+ON CONFLICT (slug) DO NOTHING;
+
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS channel_id INTEGER REFERENCES channels (id);
+UPDATE posts SET channel_id = (SELECT id FROM channels WHERE slug = 'general') WHERE channel_id IS NULL;
+ALTER TABLE posts ALTER COLUMN channel_id SET NOT NULL;
+
+-- Posts inserted without a channel, such as by the TypeScript MCP server, belong to
+-- the general channel, as in the SQLite schema
+DO $$
+BEGIN
+  EXECUTE format('ALTER TABLE posts ALTER COLUMN channel_id SET DEFAULT %s',
+    (SELECT id FROM channels WHERE slug = 'general'));
+END
+$$;
+
+ALTER TABLE agents ADD COLUMN IF NOT EXISTS channel_id INTEGER REFERENCES channels (id);
+
+CREATE INDEX IF NOT EXISTS idx_posts_channel_id ON posts(channel_id, timestamp DESC, id DESC);
+
+-- Include the channel so that listeners can route posts to per-channel streams
+CREATE OR REPLACE FUNCTION notify_timeline_posts()
+RETURNS TRIGGER AS $$
+BEGIN
+  PERFORM pg_notify('timeline_posts',
+    json_build_object(
+      'timestamp', to_char(NEW.timestamp AT TIME ZONE 'UTC', 'YYYY-MM-DD"T"HH24:MI:SS.US"Z"'),
+      'operation', TG_OP,
+      'table', TG_TABLE_NAME,
+      'post_id', NEW.id,
+      'agent_id', NEW.agent_id,
+      'content', NEW.content,
+      'parent_post_id', NEW.parent_post_id,
+      'thread_root_id', NEW.thread_root_id,
+      'channel_id', NEW.channel_id,
+      'channel', (SELECT slug FROM channels WHERE id = NEW.channel_id)
+    )::text
+  );
+  RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_posts_session_id;
+ALTER TABLE posts DROP COLUMN IF EXISTS session_id;
+
+DROP TABLE IF EXISTS sessions;
@@ -0,0 +1,28 @@
+-- Sessions replace agents.session_id, so that one identity can hold several
+-- concurrent sessions and sign-in history is kept. agents.session_id is left in
+-- place for the TypeScript MCP server; the Go server no longer reads it.
+CREATE TABLE IF NOT EXISTS sessions (
+  id SERIAL PRIMARY KEY,
+  token TEXT NOT NULL UNIQUE,
+  agent_id INTEGER NOT NULL REFERENCES agents (id) ON DELETE CASCADE,
+  channel_id INTEGER REFERENCES channels (id),
+  client_info TEXT NOT NULL DEFAULT '',
+  started_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  last_seen_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  ended_at TIMESTAMPTZ,
+  end_reason TEXT
+);
+
+CREATE INDEX IF NOT EXISTS idx_sessions_agent_id ON sessions(agent_id, started_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS idx_sessions_open ON sessions(last_seen_at) WHERE ended_at IS NULL;
+
+-- Carry over the current session of every agent
+INSERT INTO sessions (token, agent_id, channel_id, started_at, last_seen_at)
+SELECT session_id, id, channel_id, last_active, last_active
+FROM agents
+WHERE session_id IS NOT NULL
+ON CONFLICT (token) DO NOTHING;
+
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS session_id INTEGER REFERENCES sessions (id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS idx_posts_session_id ON posts(session_id);
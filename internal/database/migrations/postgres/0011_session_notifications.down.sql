@@ -0,0 +1,2 @@
+DROP TRIGGER IF EXISTS timeline_sessions_notify ON sessions;
+DROP FUNCTION IF EXISTS notify_timeline_sessions();
@@ -0,0 +1,30 @@
+-- Announce new sessions on the timeline_posts channel, so that listeners can
+-- push agent_signed_in events for sign-ins made by any server process
+CREATE OR REPLACE FUNCTION notify_timeline_sessions()
+RETURNS TRIGGER AS $$
+DECLARE
+  channel RECORD;
+BEGIN
+  SELECT id, slug INTO channel
+  FROM channels
+  WHERE id = NEW.channel_id OR (NEW.channel_id IS NULL AND slug = 'general');
+
+  PERFORM pg_notify('timeline_posts',
+    json_build_object(
+      'timestamp', to_char(NEW.started_at AT TIME ZONE 'UTC', 'YYYY-MM-DD"T"HH24:MI:SS.US"Z"'),
+      'operation', TG_OP,
+      'table', TG_TABLE_NAME,
+      'session_id', NEW.id,
+      'agent_id', NEW.agent_id,
+      'channel_id', channel.id,
+      'channel', channel.slug
+    )::text
+  );
+  RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS timeline_sessions_notify ON sessions;
+CREATE TRIGGER timeline_sessions_notify
+  AFTER INSERT ON sessions
+  FOR EACH ROW EXECUTE FUNCTION notify_timeline_sessions();
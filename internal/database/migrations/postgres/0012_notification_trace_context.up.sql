@@ -0,0 +1,48 @@
+-- Carry the trace context of the inserting request to the listeners. The API server
+-- stores it in the transaction setting timeline.traceparent; other writers leave it unset.
+CREATE OR REPLACE FUNCTION notify_timeline_posts()
+RETURNS TRIGGER AS $$
+BEGIN
+  PERFORM pg_notify('timeline_posts',
+    json_build_object(
+      'timestamp', to_char(NEW.timestamp AT TIME ZONE 'UTC', 'YYYY-MM-DD"T"HH24:MI:SS.US"Z"'),
+      'operation', TG_OP,
+      'table', TG_TABLE_NAME,
+      'post_id', NEW.id,
+      'agent_id', NEW.agent_id,
+      'content', NEW.content,
+      'parent_post_id', NEW.parent_post_id,
+      'thread_root_id', NEW.thread_root_id,
+      'channel_id', NEW.channel_id,
+      'channel', (SELECT slug FROM channels WHERE id = NEW.channel_id),
+      'traceparent', NULLIF(current_setting('timeline.traceparent', true), '')
+    )::text
+  );
+  RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION notify_timeline_sessions()
+RETURNS TRIGGER AS $$
+DECLARE
+  channel RECORD;
+BEGIN
+  SELECT id, slug INTO channel
+  FROM channels
+  WHERE id = NEW.channel_id OR (NEW.channel_id IS NULL AND slug = 'general');
+
+  PERFORM pg_notify('timeline_posts',
+    json_build_object(
+      'timestamp', to_char(NEW.started_at AT TIME ZONE 'UTC', 'YYYY-MM-DD"T"HH24:MI:SS.US"Z"'),
+      'operation', TG_OP,
+      'table', TG_TABLE_NAME,
+      'session_id', NEW.id,
+      'agent_id', NEW.agent_id,
+      'channel_id', channel.id,
+      'channel', channel.slug,
+      'traceparent', NULLIF(current_setting('timeline.traceparent', true), '')
+    )::text
+  );
+  RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
@@ -0,0 +1,35 @@
+-- Announce ended sessions as well, so that every server process pushes the
+-- agent_signed_out event and drops the session from its cache, whichever process
+-- signed the session out or expired it
+CREATE OR REPLACE FUNCTION notify_timeline_sessions()
+RETURNS TRIGGER AS $$
+DECLARE
+  channel RECORD;
+BEGIN
+  SELECT id, slug INTO channel
+  FROM channels
+  WHERE id = NEW.channel_id OR (NEW.channel_id IS NULL AND slug = 'general');
+
+  PERFORM pg_notify('timeline_posts',
+    json_build_object(
+      'timestamp', to_char(COALESCE(NEW.ended_at, NEW.started_at) AT TIME ZONE 'UTC', 'YYYY-MM-DD"T"HH24:MI:SS.US"Z"'),
+      'operation', TG_OP,
+      'table', TG_TABLE_NAME,
+      'session_id', NEW.id,
+      'agent_id', NEW.agent_id,
+      'channel_id', channel.id,
+      'channel', channel.slug,
+      'end_reason', NEW.end_reason,
+      'traceparent', NULLIF(current_setting('timeline.traceparent', true), '')
+    )::text
+  );
+  RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS timeline_sessions_ended_notify ON sessions;
+CREATE TRIGGER timeline_sessions_ended_notify
+  AFTER UPDATE OF ended_at ON sessions
+  FOR EACH ROW
+  WHEN (OLD.ended_at IS NULL AND NEW.ended_at IS NOT NULL)
+  EXECUTE FUNCTION notify_timeline_sessions();
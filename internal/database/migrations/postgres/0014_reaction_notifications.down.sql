@@ -0,0 +1,2 @@
+DROP TRIGGER IF EXISTS timeline_reactions_notify ON reactions;
+DROP FUNCTION IF EXISTS notify_timeline_reactions();
@@ -0,0 +1,33 @@
+-- Announce added, replaced and removed reactions, so that every server process
+-- pushes the post_updated event, whichever process changed the reaction
+CREATE OR REPLACE FUNCTION notify_timeline_reactions()
+RETURNS TRIGGER AS $$
+DECLARE
+  reaction RECORD;
+BEGIN
+  IF TG_OP = 'DELETE' THEN
+    reaction := OLD;
+  ELSE
+    reaction := NEW;
+  END IF;
+
+  PERFORM pg_notify('timeline_posts',
+    json_build_object(
+      'timestamp', to_char(clock_timestamp() AT TIME ZONE 'UTC', 'YYYY-MM-DD"T"HH24:MI:SS.US"Z"'),
+      'operation', TG_OP,
+      'table', TG_TABLE_NAME,
+      'post_id', reaction.post_id,
+      'reactor_type', reaction.reactor_type,
+      'reactor', reaction.reactor,
+      'emoji', CASE WHEN TG_OP = 'DELETE' THEN NULL ELSE reaction.emoji END,
+      'traceparent', NULLIF(current_setting('timeline.traceparent', true), '')
+    )::text
+  );
+  RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS timeline_reactions_notify ON reactions;
+CREATE TRIGGER timeline_reactions_notify
+  AFTER INSERT OR UPDATE OR DELETE ON reactions
+  FOR EACH ROW EXECUTE FUNCTION notify_timeline_reactions();
@@ -0,0 +1,29 @@
+-- Initial schema for agents and posts.
+-- Timestamps are stored as fixed-width RFC3339 TEXT in UTC so they sort chronologically.
+
+CREATE TABLE IF NOT EXISTS agents (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  name TEXT NOT NULL,
+  context TEXT,
+  display_name TEXT NOT NULL,
+  identity_key TEXT NOT NULL,
+  avatar_seed TEXT NOT NULL,
+  session_id TEXT UNIQUE,
+  last_active TEXT NOT NULL,
+  created_at TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS posts (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  agent_id INTEGER NOT NULL REFERENCES agents (id),
+  content TEXT NOT NULL CHECK (length(content) <= 280),
+  timestamp TEXT NOT NULL,
+  metadata TEXT NOT NULL DEFAULT '{}'
+);
+
+CREATE INDEX IF NOT EXISTS idx_agents_session_id ON agents(session_id);
+CREATE INDEX IF NOT EXISTS idx_agents_name ON agents(name);
+CREATE INDEX IF NOT EXISTS idx_agents_display_name ON agents(display_name);
+CREATE INDEX IF NOT EXISTS idx_agents_identity_key ON agents(identity_key);
+CREATE INDEX IF NOT EXISTS idx_posts_agent_id ON posts(agent_id);
+CREATE INDEX IF NOT EXISTS idx_posts_timestamp ON posts(timestamp DESC);
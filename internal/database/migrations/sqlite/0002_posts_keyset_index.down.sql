@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_posts_timestamp_id;
+CREATE INDEX IF NOT EXISTS idx_posts_timestamp ON posts(timestamp DESC);
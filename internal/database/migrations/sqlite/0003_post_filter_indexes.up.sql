@@ -0,0 +1,4 @@
+-- Indexes for filtering the timeline by agent, agent context and time range.
+DROP INDEX IF EXISTS idx_posts_agent_id;
+CREATE INDEX IF NOT EXISTS idx_posts_agent_id_timestamp ON posts(agent_id, timestamp DESC, id DESC);
+CREATE INDEX IF NOT EXISTS idx_agents_context ON agents(context);
@@ -0,0 +1,23 @@
+-- Full-text search over post content using an FTS5 index kept in sync by triggers.
+CREATE VIRTUAL TABLE IF NOT EXISTS posts_fts USING fts5(
+  content,
+  content = 'posts',
+  content_rowid = 'id',
+  tokenize = 'porter unicode61'
+);
+
+-- Index posts written before this migration
+INSERT INTO posts_fts(posts_fts) VALUES ('rebuild');
+
+CREATE TRIGGER IF NOT EXISTS posts_fts_insert AFTER INSERT ON posts BEGIN
+  INSERT INTO posts_fts(rowid, content) VALUES (new.id, new.content);
+END;
+
+CREATE TRIGGER IF NOT EXISTS posts_fts_delete AFTER DELETE ON posts BEGIN
+  INSERT INTO posts_fts(posts_fts, rowid, content) VALUES ('delete', old.id, old.content);
+END;
+
+CREATE TRIGGER IF NOT EXISTS posts_fts_update AFTER UPDATE OF content ON posts BEGIN
+  INSERT INTO posts_fts(posts_fts, rowid, content) VALUES ('delete', old.id, old.content);
+  INSERT INTO posts_fts(rowid, content) VALUES (new.id, new.content);
+END;
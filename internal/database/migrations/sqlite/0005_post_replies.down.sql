@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_posts_thread_root_id;
+DROP INDEX IF EXISTS idx_posts_parent_post_id;
+ALTER TABLE posts DROP COLUMN thread_root_id;
+ALTER TABLE posts DROP COLUMN parent_post_id;
@@ -0,0 +1,8 @@
+-- Threaded replies. thread_root_id is the top-level post of the conversation
+-- and is NULL for top-level posts themselves. The columns carry no foreign key
+-- so that the down migration can drop them; CreatePost checks the parent exists.
+ALTER TABLE posts ADD COLUMN parent_post_id INTEGER;
+ALTER TABLE posts ADD COLUMN thread_root_id INTEGER;
+
+CREATE INDEX IF NOT EXISTS idx_posts_parent_post_id ON posts(parent_post_id);
+CREATE INDEX IF NOT EXISTS idx_posts_thread_root_id ON posts(thread_root_id);
@@ -0,0 +1,10 @@
+-- Emoji reactions on posts. Each reactor, an agent identity or a human,
+-- holds at most one reaction per post.
+CREATE TABLE IF NOT EXISTS reactions (
+  post_id INTEGER NOT NULL REFERENCES posts (id) ON DELETE CASCADE,
+  reactor_type TEXT NOT NULL CHECK (reactor_type IN ('agent', 'human')),
+  reactor TEXT NOT NULL,
+  emoji TEXT NOT NULL,
+  created_at TEXT NOT NULL,
+  PRIMARY KEY (post_id, reactor_type, reactor)
+);
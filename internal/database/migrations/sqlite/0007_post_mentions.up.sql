@@ -0,0 +1,10 @@
+-- Agents mentioned in posts with @display_name or @identity_key.
+-- read_at stays NULL until the mentioned agent marks the mention as read.
+CREATE TABLE IF NOT EXISTS post_mentions (
+  post_id INTEGER NOT NULL REFERENCES posts (id) ON DELETE CASCADE,
+  agent_id INTEGER NOT NULL REFERENCES agents (id) ON DELETE CASCADE,
+  read_at TEXT,
+  PRIMARY KEY (post_id, agent_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_post_mentions_agent_id ON post_mentions(agent_id, read_at);
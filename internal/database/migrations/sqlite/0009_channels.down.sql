@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_posts_channel_id;
+ALTER TABLE agents DROP COLUMN channel_id;
+ALTER TABLE posts DROP COLUMN channel_id;
+DROP TABLE IF EXISTS channels;
@@ -0,0 +1,21 @@
+-- Named timelines. Posts without a channel belong to the general channel,
+-- and agents may pick a default channel for their posts at sign in.
+CREATE TABLE IF NOT EXISTS channels (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  slug TEXT NOT NULL UNIQUE,
+  name TEXT NOT NULL,
+  description TEXT NOT NULL DEFAULT '',
+  created_at TEXT NOT NULL
+);
+
+-- general is the first channel, so existing posts and posts inserted without a
+-- channel default to channel 1
+INSERT INTO channels (slug, name, description, created_at)
+VALUES ('general', 'General', 'Posts without a channel', strftime('%Y-%m-%dT%H:%M:%f000Z', 'now'));
+
+-- The columns carry no foreign key so that the down migration can drop them;
+-- CreatePost and SignIn check the channel exists.
+ALTER TABLE posts ADD COLUMN channel_id INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE agents ADD COLUMN channel_id INTEGER;
+
+CREATE INDEX IF NOT EXISTS idx_posts_channel_id ON posts(channel_id, timestamp DESC, id DESC);
@@ -0,0 +1,28 @@
+-- Sessions replace agents.session_id, so that one identity can hold several
+-- concurrent sessions and sign-in history is kept. agents.session_id is left in
+-- place, as SQLite cannot drop a UNIQUE column; the server no longer reads it.
+CREATE TABLE IF NOT EXISTS sessions (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  token TEXT NOT NULL UNIQUE,
+  agent_id INTEGER NOT NULL REFERENCES agents (id) ON DELETE CASCADE,
+  channel_id INTEGER,
+  client_info TEXT NOT NULL DEFAULT '',
+  started_at TEXT NOT NULL,
+  last_seen_at TEXT NOT NULL,
+  ended_at TEXT,
+  end_reason TEXT
+);
+
+CREATE INDEX IF NOT EXISTS idx_sessions_agent_id ON sessions(agent_id, started_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS idx_sessions_open ON sessions(last_seen_at) WHERE ended_at IS NULL;
+
+-- Carry over the current session of every agent
+INSERT OR IGNORE INTO sessions (token, agent_id, channel_id, started_at, last_seen_at)
+SELECT session_id, id, channel_id, last_active, last_active
+FROM agents
+WHERE session_id IS NOT NULL;
+
+-- The column carries no foreign key so that the down migration can drop it
+ALTER TABLE posts ADD COLUMN session_id INTEGER;
+
+CREATE INDEX IF NOT EXISTS idx_posts_session_id ON posts(session_id);
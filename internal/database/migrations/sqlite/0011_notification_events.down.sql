@@ -0,0 +1,2 @@
+DROP TRIGGER IF EXISTS sessions_ended_notify;
+DROP TABLE IF EXISTS notification_events;
@@ -0,0 +1,21 @@
+-- Changes to existing rows, which the notification loop cannot find by polling for
+-- new IDs. Triggers record them here; every process dispatches the events newer than
+-- the last one it has seen and old events are pruned.
+CREATE TABLE IF NOT EXISTS notification_events (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  operation TEXT NOT NULL,
+  table_name TEXT NOT NULL,
+  row_id INTEGER NOT NULL,
+  created_at TEXT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_notification_events_created_at ON notification_events(created_at);
+
+-- Ended sessions, whether signed out or expired
+CREATE TRIGGER IF NOT EXISTS sessions_ended_notify
+AFTER UPDATE OF ended_at ON sessions
+FOR EACH ROW WHEN OLD.ended_at IS NULL AND NEW.ended_at IS NOT NULL
+BEGIN
+  INSERT INTO notification_events (operation, table_name, row_id, created_at)
+  VALUES ('UPDATE', 'sessions', NEW.id, NEW.ended_at);
+END;
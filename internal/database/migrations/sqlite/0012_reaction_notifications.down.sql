@@ -0,0 +1,4 @@
+DROP TRIGGER IF EXISTS reactions_delete_notify;
+DROP TRIGGER IF EXISTS reactions_update_notify;
+DROP TRIGGER IF EXISTS reactions_insert_notify;
+ALTER TABLE notification_events DROP COLUMN data;
@@ -0,0 +1,28 @@
+-- Added, replaced and removed reactions. data holds the payload fields that the
+-- row alone does not identify, as a JSON object.
+ALTER TABLE notification_events ADD COLUMN data TEXT;
+
+CREATE TRIGGER IF NOT EXISTS reactions_insert_notify
+AFTER INSERT ON reactions
+BEGIN
+  INSERT INTO notification_events (operation, table_name, row_id, created_at, data)
+  VALUES ('INSERT', 'reactions', NEW.post_id, NEW.created_at,
+    json_object('reactor_type', NEW.reactor_type, 'reactor', NEW.reactor, 'emoji', NEW.emoji));
+END;
+
+CREATE TRIGGER IF NOT EXISTS reactions_update_notify
+AFTER UPDATE ON reactions
+BEGIN
+  INSERT INTO notification_events (operation, table_name, row_id, created_at, data)
+  VALUES ('UPDATE', 'reactions', NEW.post_id, NEW.created_at,
+    json_object('reactor_type', NEW.reactor_type, 'reactor', NEW.reactor, 'emoji', NEW.emoji));
+END;
+
+-- Timestamps are stored with microseconds, in the format written by the server
+CREATE TRIGGER IF NOT EXISTS reactions_delete_notify
+AFTER DELETE ON reactions
+BEGIN
+  INSERT INTO notification_events (operation, table_name, row_id, created_at, data)
+  VALUES ('DELETE', 'reactions', OLD.post_id, strftime('%Y-%m-%dT%H:%M:%f000Z', 'now'),
+    json_object('reactor_type', OLD.reactor_type, 'reactor', OLD.reactor));
+END;
@@ -0,0 +1,215 @@
+package database
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultPostsLimit is the page size used when no limit is requested
+const DefaultPostsLimit = 100
+
+// MaxPostsLimit caps the number of posts returned in a single page
+const MaxPostsLimit = 500
+
+// Cursor identifies a position in the timeline. Posts are ordered by (timestamp, id),
+// so posts that share a timestamp are never skipped or repeated across pages.
+type Cursor struct {
+	Timestamp time.Time
+	ID        int
+}
+
+// CursorFor returns the cursor pointing at the given post
+func CursorFor(post Post) Cursor {
+	return Cursor{Timestamp: post.Timestamp, ID: post.ID}
+}
+
+// Encode returns the opaque string form of the cursor
+func (c Cursor) Encode() string {
+	raw := fmt.Sprintf("%d:%d", c.Timestamp.UnixMicro(), c.ID)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// ParseCursor decodes a cursor produced by Cursor.Encode
+func ParseCursor(value string) (*Cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+
+	micros, id, found := strings.Cut(string(raw), ":")
+	if !found {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	ts, err := strconv.ParseInt(micros, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	postID, err := strconv.Atoi(id)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+
+	return &Cursor{Timestamp: time.UnixMicro(ts).UTC(), ID: postID}, nil
+}
+
+// PostQuery selects a page of posts. Results are always ordered newest first.
+type PostQuery struct {
+	Limit int
+
+	// Filters; zero values match every post
+	AgentID     *int
+	IdentityKey string
+	AgentName   string
+	Context     string
+	// Since only includes posts at or after this time
+	Since *time.Time
+	// Until only includes posts before this time
+	Until *time.Time
+	// NewerThan only includes posts with a timestamp strictly after it
+	NewerThan *time.Time
+	// Metadata only includes posts whose metadata has every key set to the given value
+	Metadata map[string]string
+	// Channel only includes posts in the channel with this slug
+	Channel string
+	// Tag only includes posts with this normalized hashtag, see NormalizeTag
+	Tag string
+	// Text only includes posts whose content contains it, ignoring case
+	Text string
+	// Before only includes posts older than the cursor
+	Before *Cursor
+	// After only includes posts newer than the cursor. The posts closest to
+	// the cursor are returned, so repeated calls walk forward in time.
+	After *Cursor
+	// ID only includes the post with this ID
+	ID *int
+	// AfterID only includes posts with a greater ID, returned in ascending ID order.
+	// It is used to catch up on posts missed since a known post and cannot be
+	// combined with Before or After.
+	AfterID *int
+}
+
+// PostPage is a page of posts with the cursors needed to fetch its neighbours.
+// NextCursor is passed as `before` to fetch older posts and is nil when there are none;
+// PrevCursor is passed as `after` to fetch newer posts.
+type PostPage struct {
+	Posts      []Post  `json:"posts"`
+	Count      int     `json:"count"`
+	NextCursor *string `json:"next_cursor"`
+	PrevCursor *string `json:"prev_cursor"`
+	HasMore    bool    `json:"has_more"`
+}
+
+// PostReader is the subset of Store needed to paginate posts
+type PostReader interface {
+	GetPosts(ctx context.Context, query PostQuery) ([]Post, error)
+	GetPost(ctx context.Context, id int) (*Post, error)
+}
+
+// GetPostPage fetches one page of posts. HasMore reports whether further posts exist
+// in the direction of travel: newer posts when paging with After, older posts otherwise.
+func GetPostPage(ctx context.Context, store PostReader, query PostQuery) (*PostPage, error) {
+	limit := query.Limit
+	query.Limit = limit + 1
+
+	posts, err := store.GetPosts(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	hasMore := len(posts) > limit
+	if query.After != nil {
+		if hasMore {
+			// The extra post is the newest one, furthest from the cursor
+			posts = posts[1:]
+		}
+		page := newPostPage(posts, true)
+		page.HasMore = hasMore
+		if page.PrevCursor == nil {
+			// Nothing newer yet; keep polling from the same position
+			cursor := query.After.Encode()
+			page.PrevCursor = &cursor
+		}
+		return page, nil
+	}
+
+	if hasMore {
+		posts = posts[:limit]
+	}
+	page := newPostPage(posts, hasMore)
+	page.HasMore = hasMore
+	return page, nil
+}
+
+// GetPostsAround returns the post with the given ID together with up to query.Limit-1
+// surrounding posts matching the query filters, split between newer and older ones.
+// It returns nil if the post does not exist or does not match the filters itself.
+func GetPostsAround(ctx context.Context, store PostReader, postID int, query PostQuery) (*PostPage, error) {
+	anchorQuery := query
+	anchorQuery.Limit, anchorQuery.ID, anchorQuery.Before, anchorQuery.After = 1, &postID, nil, nil
+	anchor, err := store.GetPosts(ctx, anchorQuery)
+	if err != nil || len(anchor) == 0 {
+		return nil, err
+	}
+	post := &anchor[0]
+
+	cursor := CursorFor(*post)
+	olderLimit := (query.Limit - 1) / 2
+	newerLimit := query.Limit - 1 - olderLimit
+
+	var newer []Post
+	if newerLimit > 0 {
+		newerQuery := query
+		newerQuery.Limit, newerQuery.Before, newerQuery.After = newerLimit, nil, &cursor
+		newer, err = store.GetPosts(ctx, newerQuery)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	olderQuery := query
+	olderQuery.Limit, olderQuery.Before, olderQuery.After = olderLimit+1, &cursor, nil
+	older, err := store.GetPosts(ctx, olderQuery)
+	if err != nil {
+		return nil, err
+	}
+	hasMore := len(older) > olderLimit
+	if hasMore {
+		older = older[:olderLimit]
+	}
+
+	posts := make([]Post, 0, len(newer)+1+len(older))
+	posts = append(posts, newer...)
+	posts = append(posts, *post)
+	posts = append(posts, older...)
+
+	page := newPostPage(posts, hasMore)
+	page.HasMore = hasMore
+	return page, nil
+}
+
+func newPostPage(posts []Post, hasOlder bool) *PostPage {
+	if posts == nil {
+		posts = []Post{}
+	}
+	page := &PostPage{Posts: posts, Count: len(posts)}
+	if len(posts) > 0 {
+		prev := CursorFor(posts[0]).Encode()
+		page.PrevCursor = &prev
+		if hasOlder {
+			next := CursorFor(posts[len(posts)-1]).Encode()
+			page.NextCursor = &next
+		}
+	}
+	return page
+}
+
+// reversePosts reverses posts in place, used to return ascending queries newest first
+func reversePosts(posts []Post) {
+	for i, j := 0, len(posts)-1; i < j; i, j = i+1, j-1 {
+		posts[i], posts[j] = posts[j], posts[i]
+	}
+}
@@ -0,0 +1,222 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+)
+
+// postColumns are the post and agent columns shared by every dialect
+const postColumns = `
+			p.id,
+			p.agent_id,
+			p.content,
+			p.timestamp,
+			p.metadata,
+			a.name as agent_name,
+			a.display_name,
+			a.identity_key,
+			a.avatar_seed,
+			p.parent_post_id,
+			p.thread_root_id,
+			(SELECT COUNT(*) FROM posts r WHERE r.parent_post_id = p.id) AS reply_count,
+			p.channel_id,
+			(SELECT c.slug FROM channels c WHERE c.id = p.channel_id) AS channel,
+			p.session_id`
+
+// reactionsColumn aggregates the reactions on a post into a JSON array of ReactionCount,
+// most used emoji first
+var reactionsColumn = map[string]string{
+	dialectPostgres: `
+			COALESCE((
+				SELECT json_agg(json_build_object('emoji', rc.emoji, 'count', rc.count) ORDER BY rc.count DESC, rc.emoji)
+				FROM (SELECT emoji, COUNT(*) AS count FROM reactions WHERE post_id = p.id GROUP BY emoji) rc
+			), '[]'::json) AS reactions`,
+	dialectSQLite: `
+			(
+				SELECT json_group_array(json_object('emoji', rc.emoji, 'count', rc.count))
+				FROM (SELECT emoji, COUNT(*) AS count FROM reactions WHERE post_id = p.id GROUP BY emoji ORDER BY count DESC, emoji) rc
+			) AS reactions`,
+}
+
+// tagsColumn aggregates the hashtags of a post into a JSON array of names in alphabetical order
+var tagsColumn = map[string]string{
+	dialectPostgres: `
+			COALESCE((
+				SELECT json_agg(t.name ORDER BY t.name)
+				FROM post_tags pt JOIN tags t ON t.id = pt.tag_id
+				WHERE pt.post_id = p.id
+			), '[]'::json) AS tags`,
+	dialectSQLite: `
+			(
+				SELECT json_group_array(pt.name)
+				FROM (SELECT t.name FROM post_tags pt JOIN tags t ON t.id = pt.tag_id WHERE pt.post_id = p.id ORDER BY t.name) pt
+			) AS tags`,
+}
+
+// postSelectColumns returns the columns read by scanPost and scanSQLitePost
+func postSelectColumns(dialect string) string {
+	return postColumns + "," + reactionsColumn[dialect] + "," + tagsColumn[dialect]
+}
+
+// postSelectQuery selects posts joined with their agent; callers append conditions and ordering
+func postSelectQuery(dialect string) string {
+	return `
+		SELECT` + postSelectColumns(dialect) + `
+		FROM posts p
+		JOIN agents a ON p.agent_id = a.id`
+}
+
+// queryBuilder accumulates WHERE conditions and arguments in the placeholder style of a dialect
+type queryBuilder struct {
+	dialect    string
+	conditions []string
+	args       []any
+}
+
+// arg records a value and returns its placeholder
+func (b *queryBuilder) arg(value any) string {
+	if t, ok := value.(time.Time); ok && b.dialect == dialectSQLite {
+		value = formatSQLiteTime(t)
+	}
+	b.args = append(b.args, value)
+	if b.dialect == dialectPostgres {
+		return fmt.Sprintf("$%d", len(b.args))
+	}
+	return "?"
+}
+
+// where adds a condition; each ? in the condition is bound to the next value
+func (b *queryBuilder) where(condition string, values ...any) {
+	for _, value := range values {
+		condition = strings.Replace(condition, "?", b.arg(value), 1)
+	}
+	b.conditions = append(b.conditions, condition)
+}
+
+// whereMetadata matches posts whose metadata has key set to value. The value matches
+// a JSON string, or the equivalent number or boolean when it parses as one.
+func (b *queryBuilder) whereMetadata(key, value string) {
+	candidates := []string{jsonString(value)}
+	var scalar any
+	if err := json.Unmarshal([]byte(value), &scalar); err == nil {
+		switch scalar.(type) {
+		case float64, bool:
+			candidates = append(candidates, value)
+		}
+	}
+
+	var matches []string
+	for _, candidate := range candidates {
+		if b.dialect == dialectPostgres {
+			// Containment is served by the GIN index on metadata
+			object := fmt.Sprintf("{%s:%s}", jsonString(key), candidate)
+			matches = append(matches, "p.metadata @> "+b.arg(object)+"::jsonb")
+		} else {
+			matches = append(matches, "p.metadata -> "+b.arg("$."+jsonString(key))+" = "+b.arg(candidate))
+		}
+	}
+	b.conditions = append(b.conditions, "("+strings.Join(matches, " OR ")+")")
+}
+
+// jsonString encodes a string as a JSON string literal
+func jsonString(value string) string {
+	encoded, _ := json.Marshal(value)
+	return string(encoded)
+}
+
+// clause returns the WHERE clause, or an empty string when there are no conditions
+func (b *queryBuilder) clause() string {
+	if len(b.conditions) == 0 {
+		return ""
+	}
+	return "\n\t\tWHERE " + strings.Join(b.conditions, " AND ")
+}
+
+// buildPostsQuery returns the SQL and arguments that select a page of posts.
+// Pages walking forward from an After cursor are selected in ascending order
+// and must be reversed by the caller. AfterID selects posts in ascending ID order.
+func buildPostsQuery(dialect string, query PostQuery) (string, []any) {
+	b := &queryBuilder{dialect: dialect}
+
+	b.wherePostFilters(query)
+	if query.Before != nil {
+		b.where("(p.timestamp, p.id) < (?, ?)", query.Before.Timestamp, query.Before.ID)
+	}
+	if query.After != nil {
+		b.where("(p.timestamp, p.id) > (?, ?)", query.After.Timestamp, query.After.ID)
+	}
+	if query.ID != nil {
+		b.where("p.id = ?", *query.ID)
+	}
+	if query.AfterID != nil {
+		b.where("p.id > ?", *query.AfterID)
+	}
+
+	ordering := "p.timestamp DESC, p.id DESC"
+	switch {
+	case query.AfterID != nil:
+		ordering = "p.id ASC"
+	case query.After != nil:
+		ordering = "p.timestamp ASC, p.id ASC"
+	}
+
+	sql := postSelectQuery(dialect) + b.clause() +
+		fmt.Sprintf("\n\t\tORDER BY %s\n\t\tLIMIT %s", ordering, b.arg(query.Limit))
+	return sql, b.args
+}
+
+// wherePostFilters adds the agent, time range, metadata, channel, tag and text filters of a query.
+// Its limit and cursors are left to the caller.
+func (b *queryBuilder) wherePostFilters(query PostQuery) {
+	if query.AgentID != nil {
+		b.where("p.agent_id = ?", *query.AgentID)
+	}
+	if query.IdentityKey != "" {
+		b.where("a.identity_key = ?", query.IdentityKey)
+	}
+	if query.AgentName != "" {
+		b.where("a.name = ?", query.AgentName)
+	}
+	if query.Context != "" {
+		b.where("a.context = ?", query.Context)
+	}
+	if query.Since != nil {
+		b.where("p.timestamp >= ?", *query.Since)
+	}
+	if query.Until != nil {
+		b.where("p.timestamp < ?", *query.Until)
+	}
+	if query.NewerThan != nil {
+		b.where("p.timestamp > ?", *query.NewerThan)
+	}
+	for _, key := range slices.Sorted(maps.Keys(query.Metadata)) {
+		b.whereMetadata(key, query.Metadata[key])
+	}
+	if query.Channel != "" {
+		b.where("p.channel_id = (SELECT c.id FROM channels c WHERE c.slug = ?)", query.Channel)
+	}
+	if query.Tag != "" {
+		b.where("p.id IN (SELECT pt.post_id FROM post_tags pt JOIN tags t ON t.id = pt.tag_id WHERE t.name = ?)", query.Tag)
+	}
+	if query.Text != "" {
+		b.where(`lower(p.content) LIKE ? ESCAPE '\'`, "%"+escapeLike(strings.ToLower(query.Text))+"%")
+	}
+}
+
+// buildThreadQuery returns the SQL and arguments that select every post in the thread
+// containing the given post, oldest first
+func buildThreadQuery(dialect string, postID int) (string, []any) {
+	b := &queryBuilder{dialect: dialect}
+
+	sql := `
+		WITH root AS (
+			SELECT COALESCE(thread_root_id, id) AS id FROM posts WHERE id = ` + b.arg(postID) + `
+		)` + postSelectQuery(dialect) + `
+		JOIN root ON p.id = root.id OR p.thread_root_id = root.id
+		ORDER BY p.timestamp ASC, p.id ASC`
+	return sql, b.args
+}
@@ -0,0 +1,187 @@
+package database
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Markers wrapped around matched terms in SearchResult.Highlight
+const (
+	HighlightStart = "<mark>"
+	HighlightStop  = "</mark>"
+)
+
+// SearchCursor identifies a position in ranked search results. Results are ordered by
+// (rank, timestamp, id), so results with the same rank keep a stable order across pages.
+type SearchCursor struct {
+	Rank      float64
+	Timestamp time.Time
+	ID        int
+}
+
+// SearchCursorFor returns the cursor pointing at the given result
+func SearchCursorFor(result SearchResult) SearchCursor {
+	return SearchCursor{Rank: result.Rank, Timestamp: result.Timestamp, ID: result.ID}
+}
+
+// Encode returns the opaque string form of the cursor
+func (c SearchCursor) Encode() string {
+	raw := fmt.Sprintf("%s:%d:%d", strconv.FormatFloat(c.Rank, 'g', -1, 64), c.Timestamp.UnixMicro(), c.ID)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// ParseSearchCursor decodes a cursor produced by SearchCursor.Encode
+func ParseSearchCursor(value string) (*SearchCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+
+	parts := strings.Split(string(raw), ":")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	rank, err := strconv.ParseFloat(parts[0], 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	ts, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	postID, err := strconv.Atoi(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+
+	return &SearchCursor{Rank: rank, Timestamp: time.UnixMicro(ts).UTC(), ID: postID}, nil
+}
+
+// SearchQuery selects a page of posts matching a full-text search, best match first.
+// Every word of Text must match; words are stemmed, so "failed" also matches "failing".
+type SearchQuery struct {
+	Text  string
+	Limit int
+	// Filter restricts results with the PostQuery filters; its limit and cursors are ignored
+	Filter PostQuery
+	// Before only includes results ranked after the cursor
+	Before *SearchCursor
+}
+
+// SearchResult is a post matching a search, with its relevance and highlighted content
+type SearchResult struct {
+	Post
+	// Rank is the relevance of the post; higher is better. Ranks are only
+	// comparable between results of the same search on the same backend.
+	Rank float64 `json:"rank"`
+	// Highlight is the post content with matched terms wrapped in HighlightStart and HighlightStop.
+	// The content is not escaped.
+	Highlight string `json:"highlight"`
+}
+
+// SearchPage is a page of search results. NextCursor is passed as `before`
+// to fetch the following results and is nil when there are none.
+type SearchPage struct {
+	Posts      []SearchResult `json:"posts"`
+	Count      int            `json:"count"`
+	NextCursor *string        `json:"next_cursor"`
+	HasMore    bool           `json:"has_more"`
+}
+
+// PostSearcher is the subset of Store needed to paginate search results
+type PostSearcher interface {
+	SearchPosts(ctx context.Context, query SearchQuery) ([]SearchResult, error)
+}
+
+// GetSearchPage fetches one page of search results
+func GetSearchPage(ctx context.Context, store PostSearcher, query SearchQuery) (*SearchPage, error) {
+	limit := query.Limit
+	query.Limit = limit + 1
+
+	results, err := store.SearchPosts(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	hasMore := len(results) > limit
+	if hasMore {
+		results = results[:limit]
+	}
+	if results == nil {
+		results = []SearchResult{}
+	}
+
+	page := &SearchPage{Posts: results, Count: len(results), HasMore: hasMore}
+	if hasMore {
+		next := SearchCursorFor(results[len(results)-1]).Encode()
+		page.NextCursor = &next
+	}
+	return page, nil
+}
+
+// searchSelectQuery selects matching posts joined with their agent, followed by the rank
+// and highlight columns; callers append conditions and ordering
+var searchSelectQuery = map[string]string{
+	dialectPostgres: `
+		WITH search AS (SELECT plainto_tsquery('english', $1) AS query)
+		SELECT` + postSelectColumns(dialectPostgres) + `,
+			ts_rank(p.search_vector, search.query)::float8 AS rank,
+			ts_headline('english', p.content, search.query,
+				'StartSel=` + HighlightStart + `, StopSel=` + HighlightStop + `, HighlightAll=true') AS highlight
+		FROM posts p
+		JOIN agents a ON p.agent_id = a.id
+		CROSS JOIN search`,
+	dialectSQLite: `
+		SELECT` + postSelectColumns(dialectSQLite) + `,
+			-bm25(posts_fts) AS rank,
+			highlight(posts_fts, 0, '` + HighlightStart + `', '` + HighlightStop + `') AS highlight
+		FROM posts_fts
+		JOIN posts p ON p.id = posts_fts.rowid
+		JOIN agents a ON p.agent_id = a.id`,
+}
+
+// searchRankExpression computes SearchResult.Rank. Conditions and ordering repeat the
+// expression instead of using the column alias, which FTS5 tables already define.
+var searchRankExpression = map[string]string{
+	dialectPostgres: "ts_rank(p.search_vector, search.query)::float8",
+	dialectSQLite:   "-bm25(posts_fts)",
+}
+
+// buildSearchQuery returns the SQL and arguments that select a page of search results.
+// The first argument is always the search text.
+func buildSearchQuery(dialect string, query SearchQuery) (string, []any) {
+	b := &queryBuilder{dialect: dialect}
+
+	if dialect == dialectPostgres {
+		b.arg(query.Text)
+		b.where("p.search_vector @@ search.query")
+	} else {
+		b.where("posts_fts MATCH ?", ftsQuery(query.Text))
+	}
+	b.wherePostFilters(query.Filter)
+	if query.Before != nil {
+		b.where(fmt.Sprintf("(%s, p.timestamp, p.id) < (?, ?, ?)", searchRankExpression[dialect]),
+			query.Before.Rank, query.Before.Timestamp, query.Before.ID)
+	}
+
+	sql := searchSelectQuery[dialect] + b.clause() +
+		fmt.Sprintf("\n\t\tORDER BY %s DESC, p.timestamp DESC, p.id DESC\n\t\tLIMIT %s", searchRankExpression[dialect], b.arg(query.Limit))
+	return sql, b.args
+}
+
+// ftsQuery converts search text into an FTS5 query matching every word.
+// Each word is quoted so that FTS5 operators in the text are matched literally.
+func ftsQuery(text string) string {
+	var terms []string
+	for _, word := range strings.Fields(text) {
+		word = strings.ReplaceAll(word, `"`, "")
+		if word != "" {
+			terms = append(terms, `"`+word+`"`)
+		}
+	}
+	return strings.Join(terms, " ")
+}
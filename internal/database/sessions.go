@@ -0,0 +1,95 @@
+package database
+
+import (
+	"strings"
+	"time"
+)
+
+// Reasons recorded when a session ends
+const (
+	SessionEndSignedOut   = "signed_out"
+	SessionEndIdleTimeout = "idle_timeout"
+)
+
+// sessionReaperLock is the Postgres advisory lock key held while idle sessions are
+// expired, so that only one server replica ends them at a time
+const sessionReaperLock int64 = 0x746c7265617065
+
+// Session is one sign in of an agent. An agent may hold several open sessions at once.
+type Session struct {
+	ID int `json:"id"`
+	// Token is the session_id handed to the agent at sign in. It grants posting
+	// rights, so it is never serialized.
+	Token       string `json:"-"`
+	AgentID     int    `json:"agent_id"`
+	DisplayName string `json:"display_name"`
+	IdentityKey string `json:"identity_key"`
+	AvatarSeed  string `json:"avatar_seed"`
+	// ChannelID is the channel chosen at sign in, or nil for the general channel
+	ChannelID  *int       `json:"channel_id"`
+	Channel    string     `json:"channel"`
+	ClientInfo string     `json:"client_info"`
+	StartedAt  time.Time  `json:"started_at"`
+	LastSeenAt time.Time  `json:"last_seen_at"`
+	EndedAt    *time.Time `json:"ended_at"`
+	EndReason  *string    `json:"end_reason"`
+	PostCount  int        `json:"post_count"`
+}
+
+// CreateSessionParams represents parameters for starting a new session
+type CreateSessionParams struct {
+	Token      string
+	AgentID    int
+	ChannelID  *int
+	ClientInfo string
+}
+
+// SessionQuery selects sessions, most recently started first
+type SessionQuery struct {
+	Limit int
+	// Token selects a single session
+	Token   string
+	AgentID *int
+	// OpenOnly excludes sessions that have ended
+	OpenOnly bool
+	// IDs selects the sessions with these IDs when not nil
+	IDs []int
+}
+
+// buildSessionsQuery returns the SQL and arguments that select sessions with their agent
+func buildSessionsQuery(dialect string, query SessionQuery) (string, []any) {
+	b := &queryBuilder{dialect: dialect}
+
+	if query.Token != "" {
+		b.where("s.token = ?", query.Token)
+	}
+	if query.AgentID != nil {
+		b.where("s.agent_id = ?", *query.AgentID)
+	}
+	if query.OpenOnly {
+		b.where("s.ended_at IS NULL")
+	}
+	if query.IDs != nil {
+		if dialect == dialectPostgres {
+			b.where("s.id = ANY(?)", query.IDs)
+		} else {
+			placeholders := make([]string, len(query.IDs))
+			for i, id := range query.IDs {
+				placeholders[i] = b.arg(id)
+			}
+			b.conditions = append(b.conditions, "s.id IN ("+strings.Join(placeholders, ", ")+")")
+		}
+	}
+
+	sql := `
+		SELECT
+			s.id, s.token, s.agent_id, a.display_name, a.identity_key, a.avatar_seed, s.channel_id,
+			COALESCE((SELECT c.slug FROM channels c WHERE c.id = s.channel_id), '` + GeneralChannel + `') AS channel,
+			s.client_info, s.started_at, s.last_seen_at, s.ended_at, s.end_reason,
+			(SELECT COUNT(*) FROM posts p WHERE p.session_id = s.id) AS post_count
+		FROM sessions s
+		JOIN agents a ON a.id = s.agent_id` + b.clause() + `
+		ORDER BY s.started_at DESC, s.id DESC
+		LIMIT ` + b.arg(query.Limit)
+	return sql, b.args
+}
@@ -0,0 +1,1331 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"go.opentelemetry.io/otel/codes"
+	_ "modernc.org/sqlite"
+)
+
+// sqliteTimeLayout is a fixed-width UTC layout so that timestamps stored as TEXT sort chronologically
+const sqliteTimeLayout = "2006-01-02T15:04:05.000000Z07:00"
+
+// sqlitePollInterval is how often the SQLite backend checks for posts written by other processes
+const sqlitePollInterval = time.Second
+
+// sqliteEventRetention is how long recorded notification events are kept for the
+// processes sharing the database file
+const sqliteEventRetention = time.Hour
+
+// SQLiteDatabase is an embedded storage backend for running the timeline without PostgreSQL.
+// Change notifications are delivered in-process; posts inserted by other processes sharing
+// the same file are picked up by polling.
+type SQLiteDatabase struct {
+	db             *sql.DB
+	notifyHandlers map[string][]NotificationHandler
+	notifyCancel   context.CancelFunc
+	notifyDone     chan struct{}
+	notifyWake     chan struct{}
+	notifyMutex    sync.RWMutex
+	lastNotifiedID int
+	// lastNotifiedSessionID is the latest session announced by the notification loop
+	lastNotifiedSessionID int
+	// lastNotifiedEventID is the latest notification event dispatched by the loop
+	lastNotifiedEventID int
+	// notifyStatus is guarded by notifyMutex
+	notifyStatus NotificationStatus
+}
+
+// NewSQLiteDatabase opens (or creates) the SQLite database at the given path.
+// The schema is managed by MigrateUp.
+func NewSQLiteDatabase(ctx context.Context, path string) (*SQLiteDatabase, error) {
+	dsn := fmt.Sprintf("file:%s?_pragma=busy_timeout(5000)&_pragma=foreign_keys(1)&_pragma=journal_mode(WAL)", path)
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	// SQLite allows a single writer; serializing access avoids SQLITE_BUSY errors
+	db.SetMaxOpenConns(1)
+
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	s := &SQLiteDatabase{
+		db:             db,
+		notifyHandlers: make(map[string][]NotificationHandler),
+		notifyDone:     make(chan struct{}),
+		notifyWake:     make(chan struct{}, 1),
+	}
+
+	return s, nil
+}
+
+// Close stops notifications and closes the database
+func (s *SQLiteDatabase) Close() {
+	s.StopNotifications()
+
+	if s.db != nil {
+		s.db.Close()
+	}
+}
+
+// Ping checks if the database is reachable
+func (s *SQLiteDatabase) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
+// MigrateUp applies all pending schema migrations
+func (s *SQLiteDatabase) MigrateUp(ctx context.Context) ([]Migration, error) {
+	return migrateUp(ctx, s, dialectSQLite)
+}
+
+// MigrateDown reverts the given number of most recently applied schema migrations
+func (s *SQLiteDatabase) MigrateDown(ctx context.Context, steps int) ([]Migration, error) {
+	return migrateDown(ctx, s, dialectSQLite, steps)
+}
+
+// MigrationStatus reports which schema migrations have been applied
+func (s *SQLiteDatabase) MigrationStatus(ctx context.Context) ([]MigrationStatus, error) {
+	return migrationStatus(ctx, s, dialectSQLite)
+}
+
+func (s *SQLiteDatabase) ensureMigrationsTable(ctx context.Context) error {
+	query := `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY,
+			name TEXT NOT NULL,
+			applied_at TEXT NOT NULL
+		)
+	`
+	if _, err := s.db.ExecContext(ctx, query); err != nil {
+		return fmt.Errorf("failed to create schema_migrations table: %w", err)
+	}
+	return nil
+}
+
+func (s *SQLiteDatabase) appliedMigrations(ctx context.Context) (map[int]time.Time, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema_migrations: %w", err)
+	}
+	defer rows.Close()
+
+	applied := make(map[int]time.Time)
+	for rows.Next() {
+		var version int
+		var appliedAt time.Time
+		if err := rows.Scan(&version, sqliteTime{&appliedAt}); err != nil {
+			return nil, err
+		}
+		applied[version] = appliedAt
+	}
+	return applied, rows.Err()
+}
+
+func (s *SQLiteDatabase) runMigration(ctx context.Context, migration Migration, up bool) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var applied bool
+	err = tx.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM schema_migrations WHERE version = ?)", migration.Version).Scan(&applied)
+	if err != nil {
+		return err
+	}
+	if applied == up {
+		return nil
+	}
+
+	if up {
+		if _, err := tx.ExecContext(ctx, migration.Up); err != nil {
+			return err
+		}
+		if err := backfillMigration(ctx, sqliteMigrationTx{tx}, dialectSQLite, migration); err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, "INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)",
+			migration.Version, migration.Name, formatSQLiteTime(time.Now()))
+	} else {
+		if _, err := tx.ExecContext(ctx, migration.Down); err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, "DELETE FROM schema_migrations WHERE version = ?", migration.Version)
+	}
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// sqliteMigrationTx runs the Go steps of a migration in its transaction
+type sqliteMigrationTx struct {
+	tx *sql.Tx
+}
+
+func (t sqliteMigrationTx) exec(ctx context.Context, query string, args ...any) error {
+	_, err := t.tx.ExecContext(ctx, query, args...)
+	return err
+}
+
+func (t sqliteMigrationTx) query(ctx context.Context, query string, row func(rowScanner) error) error {
+	rows, err := t.tx.QueryContext(ctx, query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		if err := row(rows); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// GetPosts retrieves a page of posts, newest first
+func (s *SQLiteDatabase) GetPosts(ctx context.Context, query PostQuery) ([]Post, error) {
+	sqlQuery, args := buildPostsQuery(dialectSQLite, query)
+
+	rows, err := s.db.QueryContext(ctx, sqlQuery, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var posts []Post
+
+	for rows.Next() {
+		post, err := scanSQLitePost(rows)
+		if err != nil {
+			return nil, err
+		}
+		posts = append(posts, *post)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if query.After != nil {
+		reversePosts(posts)
+	}
+
+	return posts, nil
+}
+
+// GetPost retrieves a single post by ID, returning nil if it does not exist
+func (s *SQLiteDatabase) GetPost(ctx context.Context, id int) (*Post, error) {
+	query := postSelectQuery(dialectSQLite) + `
+		WHERE p.id = ?`
+
+	post, err := scanSQLitePost(s.db.QueryRowContext(ctx, query, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get post: %w", err)
+	}
+
+	return post, nil
+}
+
+// GetThread retrieves every post in the thread containing the given post, oldest first.
+// It returns no posts if the post does not exist.
+func (s *SQLiteDatabase) GetThread(ctx context.Context, postID int) ([]Post, error) {
+	sqlQuery, args := buildThreadQuery(dialectSQLite, postID)
+
+	rows, err := s.db.QueryContext(ctx, sqlQuery, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get thread: %w", err)
+	}
+	defer rows.Close()
+
+	var posts []Post
+
+	for rows.Next() {
+		post, err := scanSQLitePost(rows)
+		if err != nil {
+			return nil, err
+		}
+		posts = append(posts, *post)
+	}
+
+	return posts, rows.Err()
+}
+
+// SearchPosts retrieves a page of posts matching a full-text search, best match first
+func (s *SQLiteDatabase) SearchPosts(ctx context.Context, query SearchQuery) ([]SearchResult, error) {
+	if ftsQuery(query.Text) == "" {
+		return nil, nil
+	}
+
+	sqlQuery, args := buildSearchQuery(dialectSQLite, query)
+
+	rows, err := s.db.QueryContext(ctx, sqlQuery, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []SearchResult
+
+	for rows.Next() {
+		var result SearchResult
+		post, err := scanSQLitePost(rows, &result.Rank, &result.Highlight)
+		if err != nil {
+			return nil, err
+		}
+		result.Post = *post
+		results = append(results, result)
+	}
+
+	return results, rows.Err()
+}
+
+// CreatePost creates a new timeline post and wakes the notification loop
+func (s *SQLiteDatabase) CreatePost(ctx context.Context, params CreatePostParams) (*Post, error) {
+	// Validate content length
+	if utf8.RuneCountInString(params.Content) > ContentMaxLength {
+		return nil, fmt.Errorf("content exceeds %d character limit", ContentMaxLength)
+	}
+
+	if params.Metadata == nil {
+		params.Metadata = json.RawMessage("{}")
+	}
+
+	post := Post{
+		AgentID:      params.AgentID,
+		Content:      params.Content,
+		Timestamp:    time.Now().UTC().Truncate(time.Microsecond),
+		Metadata:     params.Metadata,
+		ParentPostID: params.ParentPostID,
+		SessionID:    params.SessionID,
+	}
+
+	// Replies belong to the thread and channel of their parent
+	channelID := params.ChannelID
+	if params.ParentPostID != nil {
+		var rootID, parentChannelID int
+		err := s.db.QueryRowContext(ctx, "SELECT COALESCE(thread_root_id, id), channel_id FROM posts WHERE id = ?", *params.ParentPostID).Scan(&rootID, &parentChannelID)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return nil, ErrParentPostNotFound
+			}
+			return nil, fmt.Errorf("failed to get parent post: %w", err)
+		}
+		post.ThreadRootID = &rootID
+		channelID = &parentChannelID
+	}
+
+	err := s.db.QueryRowContext(ctx, resolveChannelQuery[dialectSQLite], channelID).Scan(&post.ChannelID, &post.Channel)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrChannelNotFound
+		}
+		return nil, fmt.Errorf("failed to get channel: %w", err)
+	}
+
+	// Store the post and its mentions together so that notification handlers see both
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create post: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO posts (agent_id, content, timestamp, metadata, parent_post_id, thread_root_id, channel_id, session_id)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		RETURNING id
+	`
+
+	err = tx.QueryRowContext(ctx, query,
+		post.AgentID,
+		post.Content,
+		formatSQLiteTime(post.Timestamp),
+		string(post.Metadata),
+		post.ParentPostID,
+		post.ThreadRootID,
+		post.ChannelID,
+		post.SessionID,
+	).Scan(&post.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create post: %w", err)
+	}
+
+	if err := createSQLiteMentions(ctx, tx, post); err != nil {
+		return nil, err
+	}
+	if post.Tags, err = createSQLiteTags(ctx, tx, post); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to create post: %w", err)
+	}
+
+	// Get agent information for the post
+	agentQuery := `
+		SELECT name, display_name, identity_key, avatar_seed
+		FROM agents
+		WHERE id = ?
+	`
+
+	err = s.db.QueryRowContext(ctx, agentQuery, post.AgentID).Scan(
+		&post.AgentName,
+		&post.DisplayName,
+		&post.IdentityKey,
+		&post.AvatarSeed,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get agent information: %w", err)
+	}
+
+	post.Reactions = []ReactionCount{}
+	postsCreated.WithLabelValues(post.IdentityKey).Inc()
+
+	s.wakeNotifications()
+
+	return &post, nil
+}
+
+// createSQLiteMentions records the agents mentioned in a new post, other than its author
+func createSQLiteMentions(ctx context.Context, tx *sql.Tx, post Post) error {
+	if !strings.Contains(post.Content, "@") {
+		return nil
+	}
+
+	content := strings.ToLower(post.Content)
+	rows, err := tx.QueryContext(ctx, mentionCandidatesQuery[dialectSQLite], content, content)
+	if err != nil {
+		return fmt.Errorf("failed to resolve mentions: %w", err)
+	}
+
+	var candidates []mentionCandidate
+	for rows.Next() {
+		var candidate mentionCandidate
+		if err := rows.Scan(&candidate.AgentID, &candidate.DisplayName, &candidate.IdentityKey); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to resolve mentions: %w", err)
+		}
+		candidates = append(candidates, candidate)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to resolve mentions: %w", err)
+	}
+
+	for _, agentID := range resolveMentions(post.Content, candidates) {
+		if agentID == post.AgentID {
+			continue
+		}
+		_, err := tx.ExecContext(ctx, "INSERT INTO post_mentions (post_id, agent_id) VALUES (?, ?)", post.ID, agentID)
+		if err != nil {
+			return fmt.Errorf("failed to create mention: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// createSQLiteTags indexes the hashtags of a new post and returns them in alphabetical order
+func createSQLiteTags(ctx context.Context, tx *sql.Tx, post Post) ([]string, error) {
+	tags := ExtractHashtags(post.Content)
+	for _, tag := range tags {
+		if _, err := tx.ExecContext(ctx, insertTagQuery[dialectSQLite], tag); err != nil {
+			return nil, fmt.Errorf("failed to create tag: %w", err)
+		}
+		if _, err := tx.ExecContext(ctx, insertPostTagQuery[dialectSQLite], post.ID, tag); err != nil {
+			return nil, fmt.Errorf("failed to tag post: %w", err)
+		}
+	}
+
+	slices.Sort(tags)
+	if tags == nil {
+		tags = []string{}
+	}
+	return tags, nil
+}
+
+// GetTags retrieves hashtag usage, most recently used first
+func (s *SQLiteDatabase) GetTags(ctx context.Context, query TagQuery) ([]TagSummary, error) {
+	sql, args := buildTagsQuery(dialectSQLite, query)
+
+	rows, err := s.db.QueryContext(ctx, sql, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tags: %w", err)
+	}
+	defer rows.Close()
+
+	var tags []TagSummary
+
+	for rows.Next() {
+		var tag TagSummary
+		if err := rows.Scan(&tag.Name, &tag.PostCount, &tag.RecentCount, sqliteTime{&tag.LastPostAt}); err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+
+	return tags, rows.Err()
+}
+
+// GetAgentSummaries retrieves agents with their posting activity
+func (s *SQLiteDatabase) GetAgentSummaries(ctx context.Context, query AgentQuery) ([]AgentSummary, error) {
+	sql, args := buildAgentsQuery(dialectSQLite, query)
+
+	rows, err := s.db.QueryContext(ctx, sql, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get agents: %w", err)
+	}
+	defer rows.Close()
+
+	var agents []AgentSummary
+
+	for rows.Next() {
+		var agent AgentSummary
+		err := rows.Scan(
+			&agent.ID,
+			&agent.Name,
+			&agent.Context,
+			&agent.DisplayName,
+			&agent.IdentityKey,
+			&agent.AvatarSeed,
+			sqliteTime{&agent.LastActive},
+			sqliteTime{&agent.CreatedAt},
+			&agent.ChannelID,
+			&agent.PostCount,
+			&agent.RecentPostCount,
+			sqliteNullTime{&agent.FirstPostAt},
+			sqliteNullTime{&agent.LastPostAt},
+		)
+		if err != nil {
+			return nil, err
+		}
+		agent.Status = query.status(agent.LastActive)
+		agents = append(agents, agent)
+	}
+
+	return agents, rows.Err()
+}
+
+// GetMentions retrieves a page of the posts mentioning an agent, newest first
+func (s *SQLiteDatabase) GetMentions(ctx context.Context, query MentionQuery) ([]Mention, error) {
+	sql, args := buildMentionsQuery(dialectSQLite, query)
+
+	rows, err := s.db.QueryContext(ctx, sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var mentions []Mention
+
+	for rows.Next() {
+		var mention Mention
+		post, err := scanSQLitePost(rows, sqliteNullTime{&mention.ReadAt})
+		if err != nil {
+			return nil, err
+		}
+		mention.Post = *post
+		mentions = append(mentions, mention)
+	}
+
+	return mentions, rows.Err()
+}
+
+// CountUnreadMentions returns the number of unread mentions of an agent
+func (s *SQLiteDatabase) CountUnreadMentions(ctx context.Context, agentID int) (int, error) {
+	var count int
+	err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM post_mentions WHERE agent_id = ? AND read_at IS NULL", agentID).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count unread mentions: %w", err)
+	}
+	return count, nil
+}
+
+// MarkMentionsRead marks mentions of an agent as read, returning how many were unread.
+// Only the mentions in the given posts are marked, or all of them if postIDs is empty.
+func (s *SQLiteDatabase) MarkMentionsRead(ctx context.Context, agentID int, postIDs []int) (int, error) {
+	b := &queryBuilder{dialect: dialectSQLite}
+	b.where("read_at IS NULL")
+	b.where("agent_id = ?", agentID)
+	if len(postIDs) > 0 {
+		placeholders := make([]string, len(postIDs))
+		for i, postID := range postIDs {
+			placeholders[i] = b.arg(postID)
+		}
+		b.where("post_id IN (" + strings.Join(placeholders, ", ") + ")")
+	}
+
+	// The read time is bound ahead of the condition arguments
+	query := "UPDATE post_mentions SET read_at = ?" + b.clause()
+	args := append([]any{formatSQLiteTime(time.Now())}, b.args...)
+
+	result, err := s.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to mark mentions read: %w", err)
+	}
+
+	marked, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to mark mentions read: %w", err)
+	}
+
+	return int(marked), nil
+}
+
+// GetMentionedAgents retrieves the agents mentioned in a post
+func (s *SQLiteDatabase) GetMentionedAgents(ctx context.Context, postID int) ([]Agent, error) {
+	query := `
+		SELECT a.id, a.name, a.context, a.display_name, a.identity_key, a.avatar_seed, a.last_active, a.created_at, a.channel_id
+		FROM post_mentions m
+		JOIN agents a ON a.id = m.agent_id
+		WHERE m.post_id = ?
+		ORDER BY a.id
+	`
+
+	rows, err := s.db.QueryContext(ctx, query, postID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get mentioned agents: %w", err)
+	}
+	defer rows.Close()
+
+	var agents []Agent
+	for rows.Next() {
+		agent, err := scanSQLiteAgent(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get mentioned agents: %w", err)
+		}
+		agents = append(agents, *agent)
+	}
+
+	return agents, rows.Err()
+}
+
+// SetReaction adds a reaction to a post, replacing any earlier reaction by the same reactor
+func (s *SQLiteDatabase) SetReaction(ctx context.Context, params ReactionParams) error {
+	var exists bool
+	err := s.db.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM posts WHERE id = ?)", params.PostID).Scan(&exists)
+	if err != nil {
+		return fmt.Errorf("failed to get post: %w", err)
+	}
+	if !exists {
+		return ErrPostNotFound
+	}
+
+	query := `
+		INSERT INTO reactions (post_id, reactor_type, reactor, emoji, created_at)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (post_id, reactor_type, reactor)
+		DO UPDATE SET emoji = excluded.emoji, created_at = excluded.created_at
+	`
+
+	_, err = s.db.ExecContext(ctx, query, params.PostID, params.ReactorType, params.Reactor, params.Emoji, formatSQLiteTime(time.Now()))
+	if err != nil {
+		return fmt.Errorf("failed to set reaction: %w", err)
+	}
+
+	s.wakeNotifications()
+	return nil
+}
+
+// DeleteReaction removes the reaction of a reactor from a post, reporting whether it existed
+func (s *SQLiteDatabase) DeleteReaction(ctx context.Context, params ReactionParams) (bool, error) {
+	query := `
+		DELETE FROM reactions
+		WHERE post_id = ? AND reactor_type = ? AND reactor = ?
+	`
+
+	result, err := s.db.ExecContext(ctx, query, params.PostID, params.ReactorType, params.Reactor)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete reaction: %w", err)
+	}
+
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to delete reaction: %w", err)
+	}
+	if deleted == 0 {
+		return false, nil
+	}
+
+	s.wakeNotifications()
+	return true, nil
+}
+
+// CreateAgent creates a new agent record
+func (s *SQLiteDatabase) CreateAgent(ctx context.Context, params CreateAgentParams) (*Agent, error) {
+	now := formatSQLiteTime(time.Now())
+	query := `
+		INSERT INTO agents (name, context, display_name, identity_key, avatar_seed, channel_id, last_active, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		RETURNING id, name, context, display_name, identity_key, avatar_seed, last_active, created_at, channel_id
+	`
+
+	agent, err := scanSQLiteAgent(s.db.QueryRowContext(ctx, query,
+		params.Name,
+		params.Context,
+		params.DisplayName,
+		params.IdentityKey,
+		params.AvatarSeed,
+		params.ChannelID,
+		now,
+		now,
+	))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create agent: %w", err)
+	}
+
+	return agent, nil
+}
+
+// GetAgent retrieves an agent by ID, returning nil if it does not exist
+func (s *SQLiteDatabase) GetAgent(ctx context.Context, id int) (*Agent, error) {
+	query := `
+		SELECT id, name, context, display_name, identity_key, avatar_seed, last_active, created_at, channel_id
+		FROM agents
+		WHERE id = ?
+	`
+
+	agent, err := scanSQLiteAgent(s.db.QueryRowContext(ctx, query, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get agent: %w", err)
+	}
+
+	return agent, nil
+}
+
+// GetAgentByIdentityKey retrieves the most recent agent by identity key
+func (s *SQLiteDatabase) GetAgentByIdentityKey(ctx context.Context, identityKey string) (*Agent, error) {
+	query := `
+		SELECT id, name, context, display_name, identity_key, avatar_seed, last_active, created_at, channel_id
+		FROM agents
+		WHERE identity_key = ?
+		ORDER BY created_at DESC, id DESC
+		LIMIT 1
+	`
+
+	agent, err := scanSQLiteAgent(s.db.QueryRowContext(ctx, query, identityKey))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get agent by identity key: %w", err)
+	}
+
+	return agent, nil
+}
+
+// UpdateAgentChannel sets the channel an agent posts to by default; nil selects the general channel
+func (s *SQLiteDatabase) UpdateAgentChannel(ctx context.Context, agentID int, channelID *int) error {
+	_, err := s.db.ExecContext(ctx, "UPDATE agents SET channel_id = ? WHERE id = ?", channelID, agentID)
+	if err != nil {
+		return fmt.Errorf("failed to update agent channel: %w", err)
+	}
+
+	return nil
+}
+
+// CreateChannel creates a new channel, returning ErrChannelExists if the slug is taken
+func (s *SQLiteDatabase) CreateChannel(ctx context.Context, params CreateChannelParams) (*Channel, error) {
+	query := `
+		INSERT INTO channels (slug, name, description, created_at)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT (slug) DO NOTHING
+		RETURNING ` + channelColumns
+
+	channel, err := scanSQLiteChannel(s.db.QueryRowContext(ctx, query, params.Slug, params.Name, params.Description, formatSQLiteTime(time.Now())))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrChannelExists
+		}
+		return nil, fmt.Errorf("failed to create channel: %w", err)
+	}
+
+	return channel, nil
+}
+
+// GetChannelBySlug retrieves a channel by slug, returning nil if it does not exist
+func (s *SQLiteDatabase) GetChannelBySlug(ctx context.Context, slug string) (*Channel, error) {
+	channel, err := scanSQLiteChannel(s.db.QueryRowContext(ctx, "SELECT "+channelColumns+" FROM channels WHERE slug = ?", slug))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get channel: %w", err)
+	}
+
+	return channel, nil
+}
+
+// GetChannels retrieves every channel in alphabetical order of slug
+func (s *SQLiteDatabase) GetChannels(ctx context.Context) ([]Channel, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT "+channelColumns+" FROM channels ORDER BY slug")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get channels: %w", err)
+	}
+	defer rows.Close()
+
+	var channels []Channel
+
+	for rows.Next() {
+		channel, err := scanSQLiteChannel(rows)
+		if err != nil {
+			return nil, err
+		}
+		channels = append(channels, *channel)
+	}
+
+	return channels, rows.Err()
+}
+
+func scanSQLiteChannel(row rowScanner) (*Channel, error) {
+	var channel Channel
+	err := row.Scan(&channel.ID, &channel.Slug, &channel.Name, &channel.Description, sqliteTime{&channel.CreatedAt})
+	if err != nil {
+		return nil, err
+	}
+	return &channel, nil
+}
+
+// CreateSession starts a new session for an agent and marks the agent as active
+func (s *SQLiteDatabase) CreateSession(ctx context.Context, params CreateSessionParams) (*Session, error) {
+	now := formatSQLiteTime(time.Now())
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create session: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO sessions (token, agent_id, channel_id, client_info, started_at, last_seen_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`
+	if _, err := tx.ExecContext(ctx, query, params.Token, params.AgentID, params.ChannelID, params.ClientInfo, now, now); err != nil {
+		return nil, fmt.Errorf("failed to create session: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, "UPDATE agents SET last_active = ? WHERE id = ?", now, params.AgentID); err != nil {
+		return nil, fmt.Errorf("failed to update agent last active: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to create session: %w", err)
+	}
+
+	s.wakeNotifications()
+
+	return s.GetSession(ctx, params.Token)
+}
+
+// GetSession retrieves a session by token, returning nil if it does not exist
+func (s *SQLiteDatabase) GetSession(ctx context.Context, token string) (*Session, error) {
+	sessions, err := s.GetSessions(ctx, SessionQuery{Token: token, Limit: 1})
+	if err != nil || len(sessions) == 0 {
+		return nil, err
+	}
+	return &sessions[0], nil
+}
+
+// GetSessions retrieves sessions, most recently started first
+func (s *SQLiteDatabase) GetSessions(ctx context.Context, query SessionQuery) ([]Session, error) {
+	sql, args := buildSessionsQuery(dialectSQLite, query)
+
+	rows, err := s.db.QueryContext(ctx, sql, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get sessions: %w", err)
+	}
+	defer rows.Close()
+
+	var sessions []Session
+
+	for rows.Next() {
+		var session Session
+		err := rows.Scan(
+			&session.ID,
+			&session.Token,
+			&session.AgentID,
+			&session.DisplayName,
+			&session.IdentityKey,
+			&session.AvatarSeed,
+			&session.ChannelID,
+			&session.Channel,
+			&session.ClientInfo,
+			sqliteTime{&session.StartedAt},
+			sqliteTime{&session.LastSeenAt},
+			sqliteNullTime{&session.EndedAt},
+			&session.EndReason,
+			&session.PostCount,
+		)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+
+	return sessions, rows.Err()
+}
+
+// TouchSession records activity in an open session and on its agent. It returns false
+// if the session does not exist or has ended.
+func (s *SQLiteDatabase) TouchSession(ctx context.Context, token string) (bool, error) {
+	now := formatSQLiteTime(time.Now())
+
+	var agentID int
+	err := s.db.QueryRowContext(ctx, `
+		UPDATE sessions
+		SET last_seen_at = ?
+		WHERE token = ? AND ended_at IS NULL
+		RETURNING agent_id
+	`, now, token).Scan(&agentID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to update session last seen: %w", err)
+	}
+
+	if _, err := s.db.ExecContext(ctx, "UPDATE agents SET last_active = ? WHERE id = ?", now, agentID); err != nil {
+		return false, fmt.Errorf("failed to update agent last active: %w", err)
+	}
+
+	return true, nil
+}
+
+// EndSession ends an open session with the given reason. It returns false if the
+// session does not exist or has already ended.
+func (s *SQLiteDatabase) EndSession(ctx context.Context, token string, reason string) (bool, error) {
+	query := `
+		UPDATE sessions
+		SET ended_at = ?, end_reason = ?
+		WHERE token = ? AND ended_at IS NULL
+	`
+
+	result, err := s.db.ExecContext(ctx, query, formatSQLiteTime(time.Now()), reason, token)
+	if err != nil {
+		return false, fmt.Errorf("failed to end session: %w", err)
+	}
+
+	ended, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to end session: %w", err)
+	}
+
+	if ended == 0 {
+		return false, nil
+	}
+
+	s.wakeNotifications()
+	return true, nil
+}
+
+// ExpireSessions ends the open sessions not seen since idleSince with the given reason
+// and returns them
+func (s *SQLiteDatabase) ExpireSessions(ctx context.Context, idleSince time.Time, reason string) ([]Session, error) {
+	query := `
+		UPDATE sessions
+		SET ended_at = ?, end_reason = ?
+		WHERE ended_at IS NULL AND last_seen_at < ?
+		RETURNING id
+	`
+
+	rows, err := s.db.QueryContext(ctx, query, formatSQLiteTime(time.Now()), reason, formatSQLiteTime(idleSince))
+	if err != nil {
+		return nil, fmt.Errorf("failed to expire sessions: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to expire sessions: %w", err)
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	s.wakeNotifications()
+	return s.GetSessions(ctx, SessionQuery{IDs: ids, Limit: len(ids)})
+}
+
+// StartNotifications begins delivering new post notifications to the registered handlers
+func (s *SQLiteDatabase) StartNotifications(ctx context.Context) error {
+	// Only posts, sessions and events created after this point are notified
+	err := s.db.QueryRowContext(ctx, "SELECT COALESCE(MAX(id), 0) FROM posts").Scan(&s.lastNotifiedID)
+	if err != nil {
+		return fmt.Errorf("failed to start notifications: %w", err)
+	}
+	err = s.db.QueryRowContext(ctx, "SELECT COALESCE(MAX(id), 0) FROM sessions").Scan(&s.lastNotifiedSessionID)
+	if err != nil {
+		return fmt.Errorf("failed to start notifications: %w", err)
+	}
+	err = s.db.QueryRowContext(ctx, "SELECT COALESCE(MAX(id), 0) FROM notification_events").Scan(&s.lastNotifiedEventID)
+	if err != nil {
+		return fmt.Errorf("failed to start notifications: %w", err)
+	}
+
+	notifyCtx, cancel := context.WithCancel(ctx)
+	s.notifyCancel = cancel
+
+	go s.notificationLoop(notifyCtx)
+
+	now := time.Now()
+	s.notifyMutex.Lock()
+	s.notifyStatus.Listening = true
+	s.notifyStatus.Since = &now
+	s.notifyMutex.Unlock()
+
+	slog.Info("SQLite notifications started", "channel", NotificationChannel)
+	return nil
+}
+
+// StopNotifications stops the notification loop
+func (s *SQLiteDatabase) StopNotifications() {
+	if s.notifyCancel != nil {
+		s.notifyCancel()
+		<-s.notifyDone // Wait for notification loop to finish
+
+		s.notifyMutex.Lock()
+		s.notifyStatus.Listening = false
+		s.notifyMutex.Unlock()
+	}
+}
+
+// NotificationStatus reports the state of the notification loop. Polling has no
+// connection to lose, so the loop listens from StartNotifications until it is stopped.
+func (s *SQLiteDatabase) NotificationStatus() NotificationStatus {
+	s.notifyMutex.RLock()
+	defer s.notifyMutex.RUnlock()
+	return s.notifyStatus
+}
+
+// AddNotificationHandler adds a handler for notifications on a specific channel
+func (s *SQLiteDatabase) AddNotificationHandler(channel string, handler NotificationHandler) {
+	s.notifyMutex.Lock()
+	defer s.notifyMutex.Unlock()
+	s.notifyHandlers[channel] = append(s.notifyHandlers[channel], handler)
+}
+
+// wakeNotifications signals the notification loop that new posts, sessions or events are available
+func (s *SQLiteDatabase) wakeNotifications() {
+	select {
+	case s.notifyWake <- struct{}{}:
+	default:
+		// A wake-up is already pending
+	}
+}
+
+// notificationLoop dispatches notifications for posts and sessions inserted and events
+// recorded since the last delivery
+func (s *SQLiteDatabase) notificationLoop(ctx context.Context) {
+	defer close(s.notifyDone)
+
+	ticker := time.NewTicker(sqlitePollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			slog.Info("Notification loop stopping")
+			return
+		case <-s.notifyWake:
+		case <-ticker.C:
+		}
+
+		if err := s.dispatchNewPosts(ctx); err != nil && ctx.Err() == nil {
+			slog.Error("Error dispatching notifications", "error", err)
+		}
+		if err := s.dispatchNewSessions(ctx); err != nil && ctx.Err() == nil {
+			slog.Error("Error dispatching session notifications", "error", err)
+		}
+		if err := s.dispatchEvents(ctx); err != nil && ctx.Err() == nil {
+			slog.Error("Error dispatching event notifications", "error", err)
+		}
+	}
+}
+
+// dispatchNewPosts calls the handlers for every post newer than the last notified post
+func (s *SQLiteDatabase) dispatchNewPosts(ctx context.Context) error {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT p.id, p.agent_id, p.content, p.timestamp, p.parent_post_id, p.thread_root_id, p.channel_id, c.slug
+		FROM posts p
+		JOIN channels c ON c.id = p.channel_id
+		WHERE p.id > ?
+		ORDER BY p.id ASC`, s.lastNotifiedID)
+	if err != nil {
+		return err
+	}
+
+	var payloads []NotificationPayload
+	for rows.Next() {
+		payload := NotificationPayload{Operation: NotificationInsert, Table: NotificationTablePosts}
+		if err := rows.Scan(&payload.PostID, &payload.AgentID, &payload.Content, sqliteTime{&payload.Timestamp}, &payload.ParentPostID, &payload.ThreadRootID, &payload.ChannelID, &payload.Channel); err != nil {
+			rows.Close()
+			return err
+		}
+		payloads = append(payloads, payload)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for i := range payloads {
+		s.notify(&payloads[i])
+		s.lastNotifiedID = payloads[i].PostID
+	}
+
+	return nil
+}
+
+// dispatchNewSessions calls the handlers for every session newer than the last notified session
+func (s *SQLiteDatabase) dispatchNewSessions(ctx context.Context) error {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT s.id, s.agent_id, s.started_at, c.id, c.slug
+		FROM sessions s
+		JOIN channels c ON c.id = s.channel_id OR (s.channel_id IS NULL AND c.slug = '`+GeneralChannel+`')
+		WHERE s.id > ?
+		ORDER BY s.id ASC`, s.lastNotifiedSessionID)
+	if err != nil {
+		return err
+	}
+
+	var payloads []NotificationPayload
+	for rows.Next() {
+		payload := NotificationPayload{Operation: NotificationInsert, Table: NotificationTableSessions}
+		if err := rows.Scan(&payload.SessionID, &payload.AgentID, sqliteTime{&payload.Timestamp}, &payload.ChannelID, &payload.Channel); err != nil {
+			rows.Close()
+			return err
+		}
+		payloads = append(payloads, payload)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for i := range payloads {
+		s.notify(&payloads[i])
+		s.lastNotifiedSessionID = payloads[i].SessionID
+	}
+
+	return nil
+}
+
+// dispatchEvents calls the handlers for every notification event newer than the last
+// dispatched event. Dispatching prunes the events older than sqliteEventRetention, so
+// that the table only grows with recent events.
+func (s *SQLiteDatabase) dispatchEvents(ctx context.Context) error {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT e.id, e.operation, e.table_name, e.row_id, e.created_at, e.data,
+			COALESCE(s.agent_id, 0), COALESCE(s.end_reason, ''), COALESCE(c.id, 0), COALESCE(c.slug, '')
+		FROM notification_events e
+		LEFT JOIN sessions s ON e.table_name = '`+NotificationTableSessions+`' AND s.id = e.row_id
+		LEFT JOIN channels c ON s.id IS NOT NULL AND (c.id = s.channel_id OR (s.channel_id IS NULL AND c.slug = '`+GeneralChannel+`'))
+		WHERE e.id > ?
+		ORDER BY e.id ASC`, s.lastNotifiedEventID)
+	if err != nil {
+		return err
+	}
+
+	var ids []int
+	var payloads []NotificationPayload
+	for rows.Next() {
+		var id, rowID int
+		var data sql.NullString
+		var payload NotificationPayload
+		if err := rows.Scan(&id, &payload.Operation, &payload.Table, &rowID, sqliteTime{&payload.Timestamp}, &data, &payload.AgentID, &payload.EndReason, &payload.ChannelID, &payload.Channel); err != nil {
+			rows.Close()
+			return err
+		}
+		if data.Valid {
+			if err := json.Unmarshal([]byte(data.String), &payload); err != nil {
+				rows.Close()
+				return fmt.Errorf("invalid notification event data: %w", err)
+			}
+		}
+		if payload.Table == NotificationTableSessions {
+			payload.SessionID = rowID
+		} else {
+			payload.PostID = rowID
+		}
+		ids = append(ids, id)
+		payloads = append(payloads, payload)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for i := range payloads {
+		s.notify(&payloads[i])
+		s.lastNotifiedEventID = ids[i]
+	}
+	if len(payloads) == 0 {
+		return nil
+	}
+
+	_, err = s.db.ExecContext(ctx, "DELETE FROM notification_events WHERE created_at < ?", formatSQLiteTime(time.Now().Add(-sqliteEventRetention)))
+	return err
+}
+
+// notify calls the handlers of the notification channel with a payload
+func (s *SQLiteDatabase) notify(payload *NotificationPayload) {
+	s.notifyMutex.RLock()
+	handlers := s.notifyHandlers[NotificationChannel]
+	s.notifyMutex.RUnlock()
+
+	ctx, span := startNotificationSpan(NotificationChannel, payload)
+	for _, handler := range handlers {
+		if err := handler(ctx, payload); err != nil {
+			slog.Error("Error in notification handler", "error", err, "channel", NotificationChannel, "table", payload.Table, "post_id", payload.PostID, "session_id", payload.SessionID)
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+	}
+	span.End()
+}
+
+// rowScanner is satisfied by *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanSQLiteAgent(row rowScanner) (*Agent, error) {
+	var agent Agent
+	err := row.Scan(
+		&agent.ID,
+		&agent.Name,
+		&agent.Context,
+		&agent.DisplayName,
+		&agent.IdentityKey,
+		&agent.AvatarSeed,
+		sqliteTime{&agent.LastActive},
+		sqliteTime{&agent.CreatedAt},
+		&agent.ChannelID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &agent, nil
+}
+
+// scanSQLitePost scans the columns of postSelectQuery followed by any extra columns
+func scanSQLitePost(row rowScanner, extra ...any) (*Post, error) {
+	var post Post
+	var metadata string
+	dest := []any{
+		&post.ID,
+		&post.AgentID,
+		&post.Content,
+		sqliteTime{&post.Timestamp},
+		&metadata,
+		&post.AgentName,
+		&post.DisplayName,
+		&post.IdentityKey,
+		&post.AvatarSeed,
+		&post.ParentPostID,
+		&post.ThreadRootID,
+		&post.ReplyCount,
+		&post.ChannelID,
+		&post.Channel,
+		&post.SessionID,
+		sqliteJSON{&post.Reactions},
+		sqliteJSON{&post.Tags},
+	}
+	err := row.Scan(append(dest, extra...)...)
+	if err != nil {
+		return nil, err
+	}
+	post.Metadata = json.RawMessage(metadata)
+	return &post, nil
+}
+
+// sqliteJSON scans a JSON document stored as TEXT into the value it points to
+type sqliteJSON struct {
+	v any
+}
+
+func (sj sqliteJSON) Scan(value any) error {
+	switch v := value.(type) {
+	case string:
+		return json.Unmarshal([]byte(v), sj.v)
+	case []byte:
+		return json.Unmarshal(v, sj.v)
+	default:
+		return fmt.Errorf("unsupported JSON type %T", value)
+	}
+}
+
+func formatSQLiteTime(t time.Time) string {
+	return t.UTC().Format(sqliteTimeLayout)
+}
+
+// sqliteTime scans a timestamp stored as TEXT into a time.Time
+type sqliteTime struct {
+	t *time.Time
+}
+
+func (st sqliteTime) Scan(value any) error {
+	switch v := value.(type) {
+	case time.Time:
+		*st.t = v
+		return nil
+	case string:
+		return st.parse(v)
+	case []byte:
+		return st.parse(string(v))
+	default:
+		return fmt.Errorf("unsupported timestamp type %T", value)
+	}
+}
+
+func (st sqliteTime) parse(value string) error {
+	t, err := time.Parse(sqliteTimeLayout, value)
+	if err != nil {
+		return fmt.Errorf("invalid timestamp %q: %w", value, err)
+	}
+	*st.t = t
+	return nil
+}
+
+// sqliteNullTime scans a nullable timestamp stored as TEXT into a *time.Time
+type sqliteNullTime struct {
+	t **time.Time
+}
+
+func (st sqliteNullTime) Scan(value any) error {
+	if value == nil {
+		*st.t = nil
+		return nil
+	}
+	var t time.Time
+	if err := (sqliteTime{&t}).Scan(value); err != nil {
+		return err
+	}
+	*st.t = &t
+	return nil
+}
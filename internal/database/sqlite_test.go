@@ -0,0 +1,1196 @@
+package database_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kmio11/agent-timeline-mcp/internal/database"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func newTestSQLiteDatabase(t *testing.T) *database.SQLiteDatabase {
+	t.Helper()
+	db, err := database.NewSQLiteDatabase(context.Background(), filepath.Join(t.TempDir(), "timeline.db"))
+	if err != nil {
+		t.Fatalf("Failed to open SQLite database: %v", err)
+	}
+	t.Cleanup(db.Close)
+	if _, err := db.MigrateUp(context.Background()); err != nil {
+		t.Fatalf("Failed to migrate SQLite database: %v", err)
+	}
+	return db
+}
+
+func TestOpen(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("sqlite URL selects the SQLite backend", func(t *testing.T) {
+		store, err := database.Open(ctx, "sqlite://"+filepath.Join(t.TempDir(), "timeline.db"))
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		defer store.Close()
+
+		if _, ok := store.(*database.SQLiteDatabase); !ok {
+			t.Errorf("Expected *database.SQLiteDatabase, got %T", store)
+		}
+	})
+
+	t.Run("sqlite URL without path", func(t *testing.T) {
+		if _, err := database.Open(ctx, "sqlite://"); err == nil {
+			t.Error("Expected error for missing sqlite path but got nil")
+		}
+	})
+}
+
+func TestSQLiteDatabase_Agents(t *testing.T) {
+	ctx := context.Background()
+	db := newTestSQLiteDatabase(t)
+
+	agentContext := "Docs"
+	created, err := db.CreateAgent(ctx, database.CreateAgentParams{
+		Name:        "Claude",
+		Context:     &agentContext,
+		DisplayName: "Claude - Docs",
+		IdentityKey: "claude:docs",
+		AvatarSeed:  "00p9p209",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create agent: %v", err)
+	}
+	if created.Context == nil || *created.Context != "Docs" {
+		t.Errorf("Expected context Docs, got %v", created.Context)
+	}
+
+	byIdentity, err := db.GetAgentByIdentityKey(ctx, "claude:docs")
+	if err != nil || byIdentity == nil || byIdentity.ID != created.ID {
+		t.Fatalf("Expected agent %d by identity key, got %v (err: %v)", created.ID, byIdentity, err)
+	}
+}
+
+func TestSQLiteDatabase_Sessions(t *testing.T) {
+	ctx := context.Background()
+	db := newTestSQLiteDatabase(t)
+
+	agent, err := db.CreateAgent(ctx, database.CreateAgentParams{
+		Name:        "Claude",
+		DisplayName: "Claude",
+		IdentityKey: "claude",
+		AvatarSeed:  "00p9p209",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create agent: %v", err)
+	}
+	docs, err := db.CreateChannel(ctx, database.CreateChannelParams{Slug: "docs", Name: "Docs"})
+	if err != nil {
+		t.Fatalf("Failed to create channel: %v", err)
+	}
+
+	first, err := db.CreateSession(ctx, database.CreateSessionParams{Token: "session-1", AgentID: agent.ID, ClientInfo: "cli 1.0"})
+	if err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+	if first.AgentID != agent.ID || first.DisplayName != "Claude" || first.Channel != database.GeneralChannel || first.ClientInfo != "cli 1.0" || first.EndedAt != nil {
+		t.Errorf("Unexpected session %+v", first)
+	}
+	second, err := db.CreateSession(ctx, database.CreateSessionParams{Token: "session-2", AgentID: agent.ID, ChannelID: &docs.ID})
+	if err != nil {
+		t.Fatalf("Failed to create second session: %v", err)
+	}
+	if second.Channel != "docs" {
+		t.Errorf("Expected the docs channel, got %q", second.Channel)
+	}
+
+	// Both sessions stay open
+	if open, err := db.TouchSession(ctx, "session-1"); err != nil || !open {
+		t.Fatalf("Failed to touch session: %v %v", open, err)
+	}
+	for _, token := range []string{"session-1", "session-2"} {
+		session, err := db.GetSession(ctx, token)
+		if err != nil || session == nil || session.EndedAt != nil {
+			t.Errorf("Expected open session %s, got %+v (err: %v)", token, session, err)
+		}
+	}
+
+	if _, err := db.CreatePost(ctx, database.CreatePostParams{AgentID: agent.ID, Content: "Hello", SessionID: &first.ID}); err != nil {
+		t.Fatalf("Failed to create post: %v", err)
+	}
+	posts, err := db.GetPosts(ctx, database.PostQuery{Limit: 10})
+	if err != nil || len(posts) != 1 || posts[0].SessionID == nil || *posts[0].SessionID != first.ID {
+		t.Fatalf("Expected a post in session %d, got %+v (err: %v)", first.ID, posts, err)
+	}
+
+	ended, err := db.EndSession(ctx, "session-1", database.SessionEndSignedOut)
+	if err != nil || !ended {
+		t.Fatalf("Expected the session to end, got %v (err: %v)", ended, err)
+	}
+	if ended, err := db.EndSession(ctx, "session-1", database.SessionEndSignedOut); err != nil || ended {
+		t.Errorf("Expected an ended session not to end again, got %v (err: %v)", ended, err)
+	}
+
+	history, err := db.GetSessions(ctx, database.SessionQuery{AgentID: &agent.ID, Limit: 10})
+	if err != nil || len(history) != 2 {
+		t.Fatalf("Expected 2 sessions, got %+v (err: %v)", history, err)
+	}
+	if history[0].ID != second.ID || history[1].ID != first.ID {
+		t.Errorf("Expected the latest session first, got %+v", history)
+	}
+	if history[1].EndedAt == nil || history[1].EndReason == nil || *history[1].EndReason != database.SessionEndSignedOut || history[1].PostCount != 1 {
+		t.Errorf("Unexpected ended session %+v", history[1])
+	}
+
+	open, err := db.GetSessions(ctx, database.SessionQuery{OpenOnly: true, Limit: 10})
+	if err != nil || len(open) != 1 || open[0].ID != second.ID {
+		t.Errorf("Expected only session %d open, got %+v (err: %v)", second.ID, open, err)
+	}
+
+	missing, err := db.GetSession(ctx, "unknown")
+	if err != nil || missing != nil {
+		t.Errorf("Expected no session, got %v (err: %v)", missing, err)
+	}
+}
+
+func TestSQLiteDatabase_ExpireSessions(t *testing.T) {
+	ctx := context.Background()
+	db := newTestSQLiteDatabase(t)
+
+	agent, err := db.CreateAgent(ctx, database.CreateAgentParams{
+		Name:        "Claude",
+		DisplayName: "Claude",
+		IdentityKey: "claude",
+		AvatarSeed:  "00p9p209",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create agent: %v", err)
+	}
+	for _, token := range []string{"idle", "ended", "active"} {
+		if _, err := db.CreateSession(ctx, database.CreateSessionParams{Token: token, AgentID: agent.ID}); err != nil {
+			t.Fatalf("Failed to create session: %v", err)
+		}
+	}
+	if _, err := db.EndSession(ctx, "ended", database.SessionEndSignedOut); err != nil {
+		t.Fatalf("Failed to end session: %v", err)
+	}
+	cutoff := time.Now()
+	time.Sleep(10 * time.Millisecond)
+	if open, err := db.TouchSession(ctx, "active"); err != nil || !open {
+		t.Fatalf("Failed to touch session: %v %v", open, err)
+	}
+	if open, err := db.TouchSession(ctx, "ended"); err != nil || open {
+		t.Errorf("Expected the ended session not to be touched, got %v %v", open, err)
+	}
+
+	expired, err := db.ExpireSessions(ctx, cutoff, database.SessionEndIdleTimeout)
+	if err != nil {
+		t.Fatalf("Failed to expire sessions: %v", err)
+	}
+	if len(expired) != 1 || expired[0].Token != "idle" || expired[0].EndedAt == nil || *expired[0].EndReason != database.SessionEndIdleTimeout {
+		t.Fatalf("Expected only the idle session to expire, got %+v", expired)
+	}
+	if expired[0].DisplayName != "Claude" {
+		t.Errorf("Expected the agent of the expired session, got %+v", expired[0])
+	}
+
+	ended, err := db.GetSession(ctx, "ended")
+	if err != nil || ended == nil || *ended.EndReason != database.SessionEndSignedOut {
+		t.Errorf("Expected the signed out session to keep its reason, got %+v (err: %v)", ended, err)
+	}
+	if expired, err := db.ExpireSessions(ctx, cutoff, database.SessionEndIdleTimeout); err != nil || len(expired) != 0 {
+		t.Errorf("Expected no sessions to expire again, got %+v (err: %v)", expired, err)
+	}
+}
+
+func TestSQLiteDatabase_Posts(t *testing.T) {
+	ctx := context.Background()
+	db := newTestSQLiteDatabase(t)
+
+	agent, err := db.CreateAgent(ctx, database.CreateAgentParams{
+		Name:        "Claude",
+		DisplayName: "Claude",
+		IdentityKey: "claude:default",
+		AvatarSeed:  "00huo523",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create agent: %v", err)
+	}
+
+	first, err := db.CreatePost(ctx, database.CreatePostParams{AgentID: agent.ID, Content: "First"})
+	if err != nil {
+		t.Fatalf("Failed to create post: %v", err)
+	}
+	if first.DisplayName != "Claude" || string(first.Metadata) != "{}" {
+		t.Errorf("Unexpected post %+v", first)
+	}
+	if _, err := db.CreatePost(ctx, database.CreatePostParams{AgentID: agent.ID, Content: "Second"}); err != nil {
+		t.Fatalf("Failed to create post: %v", err)
+	}
+
+	posts, err := db.GetPosts(ctx, database.PostQuery{Limit: 10})
+	if err != nil {
+		t.Fatalf("Failed to get posts: %v", err)
+	}
+	if len(posts) != 2 || posts[0].Content != "Second" || posts[1].Content != "First" {
+		t.Fatalf("Expected posts newest first, got %+v", posts)
+	}
+
+	after := first.Timestamp
+	posts, err = db.GetPosts(ctx, database.PostQuery{Limit: 10, NewerThan: &after})
+	if err != nil {
+		t.Fatalf("Failed to get posts: %v", err)
+	}
+	if len(posts) != 1 || posts[0].Content != "Second" {
+		t.Errorf("Expected only the second post, got %+v", posts)
+	}
+
+	if _, err := db.CreatePost(ctx, database.CreatePostParams{AgentID: agent.ID, Content: "Third"}); err != nil {
+		t.Fatalf("Failed to create post: %v", err)
+	}
+	posts, err = db.GetPosts(ctx, database.PostQuery{Limit: 10, AfterID: &first.ID})
+	if err != nil {
+		t.Fatalf("Failed to get posts: %v", err)
+	}
+	if len(posts) != 2 || posts[0].Content != "Second" || posts[1].Content != "Third" {
+		t.Errorf("Expected the posts after the first one oldest first, got %+v", posts)
+	}
+
+	posts, err = db.GetPosts(ctx, database.PostQuery{Limit: 10, Text: "THIR"})
+	if err != nil || len(posts) != 1 || posts[0].Content != "Third" {
+		t.Errorf("Expected only the third post to match the text, got %+v (err: %v)", posts, err)
+	}
+	if posts, err := db.GetPosts(ctx, database.PostQuery{Limit: 10, Text: "%"}); err != nil || len(posts) != 0 {
+		t.Errorf("Expected LIKE wildcards to match literally, got %+v (err: %v)", posts, err)
+	}
+
+	if _, err := db.CreatePost(ctx, database.CreatePostParams{AgentID: agent.ID, Content: strings.Repeat("a", 281)}); err == nil {
+		t.Error("Expected error for content over 280 characters but got nil")
+	}
+
+	post, err := db.GetPost(ctx, first.ID)
+	if err != nil || post == nil || post.Content != "First" {
+		t.Errorf("Expected first post by ID, got %+v (err: %v)", post, err)
+	}
+	missing, err := db.GetPost(ctx, 9999)
+	if err != nil || missing != nil {
+		t.Errorf("Expected no post for unknown ID, got %+v (err: %v)", missing, err)
+	}
+}
+
+func TestSQLiteDatabase_Pagination(t *testing.T) {
+	ctx := context.Background()
+	db := newTestSQLiteDatabase(t)
+
+	agent, err := db.CreateAgent(ctx, database.CreateAgentParams{
+		Name:        "Claude",
+		DisplayName: "Claude",
+		IdentityKey: "claude:default",
+		AvatarSeed:  "00huo523",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create agent: %v", err)
+	}
+
+	var ids []int
+	for i := 0; i < 5; i++ {
+		post, err := db.CreatePost(ctx, database.CreatePostParams{AgentID: agent.ID, Content: "Post"})
+		if err != nil {
+			t.Fatalf("Failed to create post: %v", err)
+		}
+		ids = append([]int{post.ID}, ids...)
+	}
+
+	var seen []int
+	query := database.PostQuery{Limit: 2}
+	for {
+		page, err := database.GetPostPage(ctx, db, query)
+		if err != nil {
+			t.Fatalf("Failed to get page: %v", err)
+		}
+		for _, post := range page.Posts {
+			seen = append(seen, post.ID)
+		}
+		if !page.HasMore {
+			break
+		}
+		query.Before, err = database.ParseCursor(*page.NextCursor)
+		if err != nil {
+			t.Fatalf("Failed to parse next_cursor: %v", err)
+		}
+	}
+	if !slices.Equal(seen, ids) {
+		t.Errorf("Expected posts %v, got %v", ids, seen)
+	}
+
+	newer, err := db.GetPosts(ctx, database.PostQuery{Limit: 2, After: &database.Cursor{Timestamp: time.Time{}, ID: 0}})
+	if err != nil {
+		t.Fatalf("Failed to get posts: %v", err)
+	}
+	if len(newer) != 2 || newer[0].ID != ids[3] || newer[1].ID != ids[4] {
+		t.Errorf("Expected the two oldest posts newest first, got %+v", newer)
+	}
+
+	around, err := database.GetPostsAround(ctx, db, ids[2], database.PostQuery{Limit: 3})
+	if err != nil || around == nil {
+		t.Fatalf("Failed to get posts around: %v", err)
+	}
+	if around.Count != 3 || around.Posts[0].ID != ids[1] || around.Posts[1].ID != ids[2] || around.Posts[2].ID != ids[3] {
+		t.Errorf("Expected posts %v, got %+v", ids[1:4], around.Posts)
+	}
+
+	otherAgent := agent.ID + 1
+	filtered, err := database.GetPostsAround(ctx, db, ids[2], database.PostQuery{Limit: 3, AgentID: &otherAgent})
+	if err != nil || filtered != nil {
+		t.Errorf("Expected no page for a post outside the filters, got %+v (err: %v)", filtered, err)
+	}
+}
+
+func TestSQLiteDatabase_Threads(t *testing.T) {
+	ctx := context.Background()
+	db := newTestSQLiteDatabase(t)
+
+	agent, err := db.CreateAgent(ctx, database.CreateAgentParams{
+		Name:        "Claude",
+		DisplayName: "Claude",
+		IdentityKey: "claude:default",
+		AvatarSeed:  "00huo523",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create agent: %v", err)
+	}
+
+	createPost := func(content string, parentPostID *int) *database.Post {
+		t.Helper()
+		post, err := db.CreatePost(ctx, database.CreatePostParams{AgentID: agent.ID, Content: content, ParentPostID: parentPostID})
+		if err != nil {
+			t.Fatalf("Failed to create post: %v", err)
+		}
+		return post
+	}
+
+	root := createPost("Root", nil)
+	first := createPost("First reply", &root.ID)
+	nested := createPost("Nested reply", &first.ID)
+	second := createPost("Second reply", &root.ID)
+	createPost("Unrelated", nil)
+
+	if nested.ThreadRootID == nil || *nested.ThreadRootID != root.ID {
+		t.Errorf("Expected thread root %d, got %v", root.ID, nested.ThreadRootID)
+	}
+
+	missing := 9999
+	if _, err := db.CreatePost(ctx, database.CreatePostParams{AgentID: agent.ID, Content: "Reply", ParentPostID: &missing}); !errors.Is(err, database.ErrParentPostNotFound) {
+		t.Errorf("Expected ErrParentPostNotFound, got %v", err)
+	}
+
+	fetched, err := db.GetPost(ctx, root.ID)
+	if err != nil || fetched == nil {
+		t.Fatalf("Failed to get post: %v", err)
+	}
+	if fetched.ReplyCount != 2 {
+		t.Errorf("Expected 2 direct replies, got %d", fetched.ReplyCount)
+	}
+
+	posts, err := db.GetThread(ctx, nested.ID)
+	if err != nil {
+		t.Fatalf("Failed to get thread: %v", err)
+	}
+	thread := database.NewThread(posts)
+	if thread == nil || thread.Count != 4 || thread.Root.ID != root.ID {
+		t.Fatalf("Expected a 4 post thread rooted at %d, got %+v", root.ID, thread)
+	}
+	if len(thread.Root.Replies) != 2 || thread.Root.Replies[0].ID != first.ID || thread.Root.Replies[1].ID != second.ID {
+		t.Errorf("Expected replies %d and %d, got %+v", first.ID, second.ID, thread.Root.Replies)
+	}
+	if len(thread.Root.Replies[0].Replies) != 1 || thread.Root.Replies[0].Replies[0].ID != nested.ID {
+		t.Errorf("Expected nested reply %d, got %+v", nested.ID, thread.Root.Replies[0].Replies)
+	}
+
+	posts, err = db.GetThread(ctx, missing)
+	if err != nil || len(posts) != 0 {
+		t.Errorf("Expected no posts for unknown post, got %+v (err: %v)", posts, err)
+	}
+}
+
+func TestSQLiteDatabase_Reactions(t *testing.T) {
+	ctx := context.Background()
+	db := newTestSQLiteDatabase(t)
+
+	agent, err := db.CreateAgent(ctx, database.CreateAgentParams{
+		Name:        "Claude",
+		DisplayName: "Claude",
+		IdentityKey: "claude:default",
+		AvatarSeed:  "00huo523",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create agent: %v", err)
+	}
+
+	post, err := db.CreatePost(ctx, database.CreatePostParams{AgentID: agent.ID, Content: "React to me"})
+	if err != nil {
+		t.Fatalf("Failed to create post: %v", err)
+	}
+	if post.Reactions == nil || len(post.Reactions) != 0 {
+		t.Errorf("Expected no reactions on a new post, got %v", post.Reactions)
+	}
+
+	for _, params := range []database.ReactionParams{
+		{PostID: post.ID, ReactorType: database.ReactorAgent, Reactor: agent.IdentityKey, Emoji: "👍"},
+		{PostID: post.ID, ReactorType: database.ReactorHuman, Reactor: "alice", Emoji: "🎉"},
+		{PostID: post.ID, ReactorType: database.ReactorHuman, Reactor: "bob", Emoji: "🎉"},
+		// Reacting again replaces the previous reaction
+		{PostID: post.ID, ReactorType: database.ReactorHuman, Reactor: "bob", Emoji: "👀"},
+		{PostID: post.ID, ReactorType: database.ReactorHuman, Reactor: "carol", Emoji: "🎉"},
+	} {
+		if err := db.SetReaction(ctx, params); err != nil {
+			t.Fatalf("Failed to set reaction: %v", err)
+		}
+	}
+
+	if err := db.SetReaction(ctx, database.ReactionParams{PostID: 9999, ReactorType: database.ReactorHuman, Reactor: "alice", Emoji: "👍"}); !errors.Is(err, database.ErrPostNotFound) {
+		t.Errorf("Expected ErrPostNotFound, got %v", err)
+	}
+
+	posts, err := db.GetPosts(ctx, database.PostQuery{Limit: 10})
+	if err != nil || len(posts) != 1 {
+		t.Fatalf("Failed to get posts: %v", err)
+	}
+	want := []database.ReactionCount{{Emoji: "🎉", Count: 2}, {Emoji: "👀", Count: 1}, {Emoji: "👍", Count: 1}}
+	if !reflect.DeepEqual(posts[0].Reactions, want) {
+		t.Errorf("Expected reactions %v, got %v", want, posts[0].Reactions)
+	}
+
+	deleted, err := db.DeleteReaction(ctx, database.ReactionParams{PostID: post.ID, ReactorType: database.ReactorHuman, Reactor: "alice"})
+	if err != nil || !deleted {
+		t.Fatalf("Expected reaction to be deleted, got %v, %v", deleted, err)
+	}
+	deleted, err = db.DeleteReaction(ctx, database.ReactionParams{PostID: post.ID, ReactorType: database.ReactorHuman, Reactor: "alice"})
+	if err != nil || deleted {
+		t.Errorf("Expected no reaction to delete, got %v, %v", deleted, err)
+	}
+
+	fetched, err := db.GetPost(ctx, post.ID)
+	if err != nil || fetched == nil {
+		t.Fatalf("Failed to get post: %v", err)
+	}
+	if len(fetched.Reactions) != 3 || fetched.Reactions[0] != (database.ReactionCount{Emoji: "🎉", Count: 1}) {
+		t.Errorf("Expected one 🎉 reaction left, got %v", fetched.Reactions)
+	}
+}
+
+func TestSQLiteDatabase_Mentions(t *testing.T) {
+	ctx := context.Background()
+	db := newTestSQLiteDatabase(t)
+
+	createAgent := func(name, displayName, identityKey string) *database.Agent {
+		t.Helper()
+		agent, err := db.CreateAgent(ctx, database.CreateAgentParams{
+			Name:        name,
+			DisplayName: displayName,
+			IdentityKey: identityKey,
+			AvatarSeed:  "seed",
+		})
+		if err != nil {
+			t.Fatalf("Failed to create agent: %v", err)
+		}
+		return agent
+	}
+	claude := createAgent("Claude", "Claude", "claude:default")
+	docs := createAgent("Claude", "Claude - Docs", "claude:docs")
+	gpt := createAgent("GPT", "GPT", "gpt:default")
+
+	createPost := func(agent *database.Agent, content string) *database.Post {
+		t.Helper()
+		post, err := db.CreatePost(ctx, database.CreatePostParams{AgentID: agent.ID, Content: content})
+		if err != nil {
+			t.Fatalf("Failed to create post: %v", err)
+		}
+		return post
+	}
+
+	mentionedIDs := func(post *database.Post) []int {
+		t.Helper()
+		agents, err := db.GetMentionedAgents(ctx, post.ID)
+		if err != nil {
+			t.Fatalf("Failed to get mentioned agents: %v", err)
+		}
+		var ids []int
+		for _, agent := range agents {
+			ids = append(ids, agent.ID)
+		}
+		return ids
+	}
+
+	tests := []struct {
+		name     string
+		author   *database.Agent
+		content  string
+		expected []int
+	}{
+		{"longest display name wins", gpt, "@Claude - Docs please review", []int{docs.ID}},
+		{"identity key", gpt, "cc @claude:default and @CLAUDE:DOCS", []int{claude.ID, docs.ID}},
+		{"display name at word boundary", gpt, "@Claude, thoughts?", []int{claude.ID}},
+		{"no partial names", gpt, "@Claudette @GPTs", nil},
+		{"e-mail addresses are not mentions", gpt, "mail gpt@claude.example", nil},
+		{"authors do not mention themselves", claude, "@Claude and @GPT", []int{gpt.ID}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			post := createPost(tt.author, tt.content)
+			if got := mentionedIDs(post); !slices.Equal(got, tt.expected) {
+				t.Errorf("Expected mentions %v, got %v", tt.expected, got)
+			}
+		})
+	}
+
+	// Claude is mentioned by the first "identity key" post and the "display name" post
+	page, err := database.GetMentionPage(ctx, db, database.MentionQuery{AgentID: claude.ID, Limit: 1})
+	if err != nil {
+		t.Fatalf("Failed to get mentions: %v", err)
+	}
+	if page.Count != 1 || !page.HasMore || page.UnreadCount != 2 || page.Mentions[0].Content != "@Claude, thoughts?" {
+		t.Fatalf("Unexpected first page %+v", page)
+	}
+	if page.Mentions[0].ReadAt != nil {
+		t.Errorf("Expected an unread mention, got read at %v", page.Mentions[0].ReadAt)
+	}
+
+	before, err := database.ParseCursor(*page.NextCursor)
+	if err != nil {
+		t.Fatalf("Failed to parse cursor: %v", err)
+	}
+	older, err := db.GetMentions(ctx, database.MentionQuery{AgentID: claude.ID, Limit: 10, Before: before})
+	if err != nil || len(older) != 1 || older[0].Content != "cc @claude:default and @CLAUDE:DOCS" {
+		t.Fatalf("Unexpected older mentions %v (%v)", older, err)
+	}
+
+	marked, err := db.MarkMentionsRead(ctx, claude.ID, []int{older[0].ID})
+	if err != nil || marked != 1 {
+		t.Fatalf("Expected 1 mention marked read, got %d (%v)", marked, err)
+	}
+	unread, err := db.GetMentions(ctx, database.MentionQuery{AgentID: claude.ID, Limit: 10, UnreadOnly: true})
+	if err != nil || len(unread) != 1 || unread[0].ID != page.Mentions[0].ID {
+		t.Errorf("Expected only the newest mention to be unread, got %v (%v)", unread, err)
+	}
+	all, err := db.GetMentions(ctx, database.MentionQuery{AgentID: claude.ID, Limit: 10})
+	if err != nil || len(all) != 2 || all[1].ReadAt == nil {
+		t.Errorf("Expected the older mention to have a read time, got %v (%v)", all, err)
+	}
+
+	marked, err = db.MarkMentionsRead(ctx, claude.ID, nil)
+	if err != nil || marked != 1 {
+		t.Errorf("Expected the remaining mention marked read, got %d (%v)", marked, err)
+	}
+	if count, err := db.CountUnreadMentions(ctx, claude.ID); err != nil || count != 0 {
+		t.Errorf("Expected no unread mentions, got %d (%v)", count, err)
+	}
+}
+
+func TestSQLiteDatabase_Tags(t *testing.T) {
+	ctx := context.Background()
+	db := newTestSQLiteDatabase(t)
+
+	agent, err := db.CreateAgent(ctx, database.CreateAgentParams{
+		Name:        "Claude",
+		DisplayName: "Claude",
+		IdentityKey: "claude:default",
+		AvatarSeed:  "00huo523",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create agent: %v", err)
+	}
+
+	var last *database.Post
+	for _, content := range []string{
+		"#migration started",
+		"No tags in this one",
+		"#Migration done, #flaky-test again",
+	} {
+		last, err = db.CreatePost(ctx, database.CreatePostParams{AgentID: agent.ID, Content: content})
+		if err != nil {
+			t.Fatalf("Failed to create post: %v", err)
+		}
+	}
+	if !slices.Equal(last.Tags, []string{"flaky-test", "migration"}) {
+		t.Errorf("Expected tags [flaky-test migration], got %v", last.Tags)
+	}
+
+	posts, err := db.GetPosts(ctx, database.PostQuery{Limit: 10, Tag: "migration"})
+	if err != nil {
+		t.Fatalf("Failed to get posts: %v", err)
+	}
+	if len(posts) != 2 || posts[0].ID != last.ID || !slices.Equal(posts[0].Tags, last.Tags) {
+		t.Errorf("Expected the 2 #migration posts with their tags, got %v", posts)
+	}
+
+	all, err := db.GetPosts(ctx, database.PostQuery{Limit: 10})
+	if err != nil || len(all) != 3 || all[1].Tags == nil || len(all[1].Tags) != 0 {
+		t.Errorf("Expected an empty tag list on the untagged post, got %v (%v)", all, err)
+	}
+
+	tags, err := db.GetTags(ctx, database.TagQuery{Limit: 10, Since: last.Timestamp})
+	if err != nil {
+		t.Fatalf("Failed to get tags: %v", err)
+	}
+	if len(tags) != 2 {
+		t.Fatalf("Expected 2 tags, got %v", tags)
+	}
+	// Both tags were last used by the same post, so they are ordered by name
+	if tags[0].Name != "flaky-test" || tags[0].PostCount != 1 || tags[1].Name != "migration" || tags[1].PostCount != 2 {
+		t.Errorf("Unexpected tag counts %+v", tags)
+	}
+	if tags[1].RecentCount != 1 || !tags[1].LastPostAt.Equal(last.Timestamp) {
+		t.Errorf("Expected 1 recent #migration post at %v, got %+v", last.Timestamp, tags[1])
+	}
+}
+
+func TestSQLiteDatabase_Channels(t *testing.T) {
+	ctx := context.Background()
+	db := newTestSQLiteDatabase(t)
+
+	general, err := db.GetChannelBySlug(ctx, database.GeneralChannel)
+	if err != nil || general == nil {
+		t.Fatalf("Expected the general channel to exist, got %v (%v)", general, err)
+	}
+
+	docs, err := db.CreateChannel(ctx, database.CreateChannelParams{Slug: "docs", Name: "Docs", Description: "Documentation rewrite"})
+	if err != nil {
+		t.Fatalf("Failed to create channel: %v", err)
+	}
+	if _, err := db.CreateChannel(ctx, database.CreateChannelParams{Slug: "docs", Name: "Docs again"}); !errors.Is(err, database.ErrChannelExists) {
+		t.Errorf("Expected ErrChannelExists, got %v", err)
+	}
+
+	channels, err := db.GetChannels(ctx)
+	if err != nil || len(channels) != 2 || channels[0].Slug != "docs" || channels[1].Slug != database.GeneralChannel {
+		t.Errorf("Expected the docs and general channels, got %v (%v)", channels, err)
+	}
+
+	agent, err := db.CreateAgent(ctx, database.CreateAgentParams{
+		Name:        "Claude",
+		DisplayName: "Claude",
+		IdentityKey: "claude:default",
+		AvatarSeed:  "00huo523",
+		ChannelID:   &docs.ID,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create agent: %v", err)
+	}
+	if agent.ChannelID == nil || *agent.ChannelID != docs.ID {
+		t.Errorf("Expected agent channel %d, got %v", docs.ID, agent.ChannelID)
+	}
+	if err := db.UpdateAgentChannel(ctx, agent.ID, nil); err != nil {
+		t.Fatalf("Failed to update agent channel: %v", err)
+	}
+	if agent, _ = db.GetAgent(ctx, agent.ID); agent.ChannelID != nil {
+		t.Errorf("Expected no agent channel, got %v", *agent.ChannelID)
+	}
+
+	generalPost, err := db.CreatePost(ctx, database.CreatePostParams{AgentID: agent.ID, Content: "Hello everyone"})
+	if err != nil {
+		t.Fatalf("Failed to create post: %v", err)
+	}
+	if generalPost.ChannelID != general.ID || generalPost.Channel != database.GeneralChannel {
+		t.Errorf("Expected a post in the general channel, got %d %q", generalPost.ChannelID, generalPost.Channel)
+	}
+
+	docsPost, err := db.CreatePost(ctx, database.CreatePostParams{AgentID: agent.ID, Content: "Docs update", ChannelID: &docs.ID})
+	if err != nil {
+		t.Fatalf("Failed to create post: %v", err)
+	}
+	// Replies stay in the channel of their parent
+	reply, err := db.CreatePost(ctx, database.CreatePostParams{AgentID: agent.ID, Content: "Reply", ParentPostID: &docsPost.ID, ChannelID: &general.ID})
+	if err != nil {
+		t.Fatalf("Failed to create reply: %v", err)
+	}
+	if reply.Channel != "docs" {
+		t.Errorf("Expected the reply in the docs channel, got %q", reply.Channel)
+	}
+
+	missing := 9999
+	if _, err := db.CreatePost(ctx, database.CreatePostParams{AgentID: agent.ID, Content: "Lost", ChannelID: &missing}); !errors.Is(err, database.ErrChannelNotFound) {
+		t.Errorf("Expected ErrChannelNotFound, got %v", err)
+	}
+
+	posts, err := db.GetPosts(ctx, database.PostQuery{Limit: 10, Channel: "docs"})
+	if err != nil {
+		t.Fatalf("Failed to get posts: %v", err)
+	}
+	if len(posts) != 2 || posts[0].ID != reply.ID || posts[1].ID != docsPost.ID || posts[1].Channel != "docs" {
+		t.Errorf("Expected the 2 docs posts, got %v", posts)
+	}
+
+	all, err := db.GetPosts(ctx, database.PostQuery{Limit: 10})
+	if err != nil || len(all) != 3 {
+		t.Errorf("Expected posts of every channel without a filter, got %d (%v)", len(all), err)
+	}
+}
+
+func TestSQLiteDatabase_Notifications(t *testing.T) {
+	ctx := context.Background()
+	db := newTestSQLiteDatabase(t)
+
+	agent, err := db.CreateAgent(ctx, database.CreateAgentParams{
+		Name:        "Claude",
+		DisplayName: "Claude",
+		IdentityKey: "claude:default",
+		AvatarSeed:  "00huo523",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create agent: %v", err)
+	}
+
+	received := make(chan *database.NotificationPayload, 1)
+	db.AddNotificationHandler(database.NotificationChannel, func(_ context.Context, payload *database.NotificationPayload) error {
+		received <- payload
+		return nil
+	})
+	if status := db.NotificationStatus(); status.Listening || status.Since != nil {
+		t.Errorf("Expected the listener to be idle before starting, got %+v", status)
+	}
+	if err := db.StartNotifications(ctx); err != nil {
+		t.Fatalf("Failed to start notifications: %v", err)
+	}
+	if status := db.NotificationStatus(); !status.Listening || status.Since == nil {
+		t.Errorf("Expected the listener to be listening, got %+v", status)
+	}
+
+	post, err := db.CreatePost(ctx, database.CreatePostParams{AgentID: agent.ID, Content: "Notify me"})
+	if err != nil {
+		t.Fatalf("Failed to create post: %v", err)
+	}
+
+	select {
+	case payload := <-received:
+		if payload.PostID != post.ID || payload.Content != "Notify me" || payload.Operation != "INSERT" || payload.Channel != database.GeneralChannel {
+			t.Errorf("Unexpected payload %+v", payload)
+		}
+		if !payload.Timestamp.Equal(post.Timestamp) {
+			t.Errorf("Expected timestamp %v, got %v", post.Timestamp, payload.Timestamp)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for notification")
+	}
+
+	session, err := db.CreateSession(ctx, database.CreateSessionParams{Token: "notify-session", AgentID: agent.ID})
+	if err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+
+	select {
+	case payload := <-received:
+		if payload.Table != database.NotificationTableSessions || payload.SessionID != session.ID || payload.AgentID != agent.ID || payload.Channel != database.GeneralChannel {
+			t.Errorf("Unexpected session payload %+v", payload)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for session notification")
+	}
+
+	// Ending a session is notified as an update, once
+	for range 2 {
+		if _, err := db.EndSession(ctx, session.Token, database.SessionEndSignedOut); err != nil {
+			t.Fatalf("Failed to end session: %v", err)
+		}
+	}
+
+	select {
+	case payload := <-received:
+		if payload.Table != database.NotificationTableSessions || payload.Operation != database.NotificationUpdate || payload.SessionID != session.ID ||
+			payload.EndReason != database.SessionEndSignedOut || payload.Channel != database.GeneralChannel {
+			t.Errorf("Unexpected session end payload %+v", payload)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for session end notification")
+	}
+
+	if _, err := db.CreateSession(ctx, database.CreateSessionParams{Token: "idle-session", AgentID: agent.ID}); err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+	<-received
+	expired, err := db.ExpireSessions(ctx, time.Now().Add(time.Minute), database.SessionEndIdleTimeout)
+	if err != nil || len(expired) != 1 {
+		t.Fatalf("Expected one expired session, got %d (%v)", len(expired), err)
+	}
+
+	select {
+	case payload := <-received:
+		if payload.Operation != database.NotificationUpdate || payload.SessionID != expired[0].ID || payload.EndReason != database.SessionEndIdleTimeout {
+			t.Errorf("Unexpected session expiry payload %+v", payload)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for session expiry notification")
+	}
+	select {
+	case payload := <-received:
+		t.Errorf("Expected no further notification, got %+v", payload)
+	case <-time.After(1500 * time.Millisecond):
+	}
+
+	// Reactions are notified when added, replaced and removed
+	reaction := database.ReactionParams{PostID: post.ID, ReactorType: database.ReactorHuman, Reactor: "alice", Emoji: "👍"}
+	for _, expected := range []struct{ operation, emoji string }{
+		{database.NotificationInsert, "👍"},
+		{database.NotificationUpdate, "🎉"},
+		{database.NotificationDelete, ""},
+	} {
+		reaction.Emoji = expected.emoji
+		if expected.operation == database.NotificationDelete {
+			if deleted, err := db.DeleteReaction(ctx, reaction); err != nil || !deleted {
+				t.Fatalf("Failed to delete reaction: %v %v", deleted, err)
+			}
+		} else if err := db.SetReaction(ctx, reaction); err != nil {
+			t.Fatalf("Failed to set reaction: %v", err)
+		}
+
+		select {
+		case payload := <-received:
+			if payload.Table != database.NotificationTableReactions || payload.Operation != expected.operation || payload.PostID != post.ID ||
+				payload.ReactorType != database.ReactorHuman || payload.Reactor != "alice" || payload.Emoji != expected.emoji || payload.Timestamp.IsZero() {
+				t.Errorf("Unexpected reaction payload %+v", payload)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Timed out waiting for reaction %s notification", expected.operation)
+		}
+	}
+
+	db.StopNotifications()
+	if status := db.NotificationStatus(); status.Listening {
+		t.Errorf("Expected the listener to stop, got %+v", status)
+	}
+}
+
+func TestSQLiteDatabase_Filters(t *testing.T) {
+	ctx := context.Background()
+	db := newTestSQLiteDatabase(t)
+
+	docs := "Docs"
+	writer, err := db.CreateAgent(ctx, database.CreateAgentParams{
+		Name:        "Writer",
+		Context:     &docs,
+		DisplayName: "Writer - Docs",
+		IdentityKey: "writer:docs",
+		AvatarSeed:  "seed1",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create agent: %v", err)
+	}
+	reviewer, err := db.CreateAgent(ctx, database.CreateAgentParams{
+		Name:        "Reviewer",
+		DisplayName: "Reviewer",
+		IdentityKey: "reviewer:default",
+		AvatarSeed:  "seed2",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create agent: %v", err)
+	}
+
+	posts := []database.CreatePostParams{
+		{AgentID: writer.ID, Content: "Drafting", Metadata: json.RawMessage(`{"project":"docs","step":1}`)},
+		{AgentID: reviewer.ID, Content: "Reviewing", Metadata: json.RawMessage(`{"project":"docs","step":2}`)},
+		{AgentID: writer.ID, Content: "Elsewhere", Metadata: json.RawMessage(`{"project":"api"}`)},
+	}
+	var created []*database.Post
+	for _, params := range posts {
+		post, err := db.CreatePost(ctx, params)
+		if err != nil {
+			t.Fatalf("Failed to create post: %v", err)
+		}
+		created = append(created, post)
+	}
+
+	tests := []struct {
+		name     string
+		query    database.PostQuery
+		expected []string
+	}{
+		{
+			name:     "agent ID",
+			query:    database.PostQuery{AgentID: &reviewer.ID},
+			expected: []string{"Reviewing"},
+		},
+		{
+			name:     "identity key",
+			query:    database.PostQuery{IdentityKey: "writer:docs"},
+			expected: []string{"Elsewhere", "Drafting"},
+		},
+		{
+			name:     "agent name and context",
+			query:    database.PostQuery{AgentName: "Writer", Context: "Docs"},
+			expected: []string{"Elsewhere", "Drafting"},
+		},
+		{
+			name:     "time range",
+			query:    database.PostQuery{Since: &created[1].Timestamp, Until: &created[2].Timestamp},
+			expected: []string{"Reviewing"},
+		},
+		{
+			name:     "metadata string value",
+			query:    database.PostQuery{Metadata: map[string]string{"project": "docs"}},
+			expected: []string{"Reviewing", "Drafting"},
+		},
+		{
+			name:     "metadata numeric value",
+			query:    database.PostQuery{Metadata: map[string]string{"project": "docs", "step": "2"}},
+			expected: []string{"Reviewing"},
+		},
+		{
+			name:     "no match",
+			query:    database.PostQuery{Metadata: map[string]string{"project": "missing"}},
+			expected: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.query.Limit = 10
+			result, err := db.GetPosts(ctx, tt.query)
+			if err != nil {
+				t.Fatalf("Failed to get posts: %v", err)
+			}
+			var contents []string
+			for _, post := range result {
+				contents = append(contents, post.Content)
+			}
+			if !slices.Equal(contents, tt.expected) {
+				t.Errorf("Expected %v, got %v", tt.expected, contents)
+			}
+		})
+	}
+}
+
+func TestSQLiteDatabase_Search(t *testing.T) {
+	ctx := context.Background()
+	db := newTestSQLiteDatabase(t)
+
+	agent, err := db.CreateAgent(ctx, database.CreateAgentParams{
+		Name:        "Claude",
+		DisplayName: "Claude",
+		IdentityKey: "claude:default",
+		AvatarSeed:  "00huo523",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create agent: %v", err)
+	}
+
+	contents := []string{
+		"The migration failed on staging",
+		"Retrying the failing migration, migration logs attached",
+		"Deploy finished",
+		`Special characters "quoted" AND -dashes`,
+	}
+	for _, content := range contents {
+		if _, err := db.CreatePost(ctx, database.CreatePostParams{AgentID: agent.ID, Content: content}); err != nil {
+			t.Fatalf("Failed to create post: %v", err)
+		}
+	}
+
+	t.Run("stemmed words match and results are ranked", func(t *testing.T) {
+		results, err := db.SearchPosts(ctx, database.SearchQuery{Text: "migration fail", Limit: 10})
+		if err != nil {
+			t.Fatalf("Failed to search posts: %v", err)
+		}
+		if len(results) != 2 {
+			t.Fatalf("Expected 2 results, got %+v", results)
+		}
+		if results[0].Rank < results[1].Rank {
+			t.Errorf("Expected results ordered by rank, got %v then %v", results[0].Rank, results[1].Rank)
+		}
+		if results[0].AgentName != "Claude" {
+			t.Errorf("Expected agent info on results, got %+v", results[0].Post)
+		}
+		for _, result := range results {
+			if !strings.Contains(result.Highlight, database.HighlightStart+"migration"+database.HighlightStop) {
+				t.Errorf("Expected highlighted match, got %q", result.Highlight)
+			}
+		}
+	})
+
+	t.Run("query operators are matched literally", func(t *testing.T) {
+		results, err := db.SearchPosts(ctx, database.SearchQuery{Text: `"quoted" AND -dashes`, Limit: 10})
+		if err != nil {
+			t.Fatalf("Failed to search posts: %v", err)
+		}
+		if len(results) != 1 || results[0].Content != contents[3] {
+			t.Errorf("Expected the special characters post, got %+v", results)
+		}
+	})
+
+	t.Run("filters apply to results", func(t *testing.T) {
+		results, err := db.SearchPosts(ctx, database.SearchQuery{
+			Text:   "migration",
+			Limit:  10,
+			Filter: database.PostQuery{AgentName: "Someone else"},
+		})
+		if err != nil {
+			t.Fatalf("Failed to search posts: %v", err)
+		}
+		if len(results) != 0 {
+			t.Errorf("Expected no results, got %+v", results)
+		}
+	})
+
+	t.Run("pages with next_cursor", func(t *testing.T) {
+		var seen []string
+		query := database.SearchQuery{Text: "migration", Limit: 1}
+		for {
+			page, err := database.GetSearchPage(ctx, db, query)
+			if err != nil {
+				t.Fatalf("Failed to get search page: %v", err)
+			}
+			for _, result := range page.Posts {
+				seen = append(seen, result.Content)
+			}
+			if !page.HasMore {
+				break
+			}
+			query.Before, err = database.ParseSearchCursor(*page.NextCursor)
+			if err != nil {
+				t.Fatalf("Failed to parse next_cursor: %v", err)
+			}
+		}
+		if len(seen) != 2 || seen[0] == seen[1] {
+			t.Errorf("Expected both migration posts once, got %v", seen)
+		}
+	})
+}
+
+func TestSQLiteDatabase_AgentSummaries(t *testing.T) {
+	ctx := context.Background()
+	db := newTestSQLiteDatabase(t)
+
+	var agents []*database.Agent
+	for _, name := range []string{"Claude", "Gemini", "Codex_Bot"} {
+		agent, err := db.CreateAgent(ctx, database.CreateAgentParams{
+			Name:        name,
+			DisplayName: name,
+			IdentityKey: strings.ToLower(name) + ":default",
+			AvatarSeed:  "seed",
+		})
+		if err != nil {
+			t.Fatalf("Failed to create agent: %v", err)
+		}
+		agents = append(agents, agent)
+	}
+
+	var first, last *database.Post
+	for i, agentID := range []int{agents[0].ID, agents[0].ID, agents[1].ID} {
+		post, err := db.CreatePost(ctx, database.CreatePostParams{AgentID: agentID, Content: "Post " + strconv.Itoa(i)})
+		if err != nil {
+			t.Fatalf("Failed to create post: %v", err)
+		}
+		if first == nil {
+			first = post
+		}
+		last = post
+	}
+
+	query := database.AgentQuery{
+		Limit:       10,
+		ActiveSince: time.Now().Add(-time.Hour),
+		RecentSince: last.Timestamp,
+		Sort:        database.AgentSortPostCount,
+	}
+	summaries, err := db.GetAgentSummaries(ctx, query)
+	if err != nil {
+		t.Fatalf("Failed to get agents: %v", err)
+	}
+	if len(summaries) != 3 || summaries[0].ID != agents[0].ID || summaries[1].ID != agents[1].ID {
+		t.Fatalf("Expected agents ordered by post count, got %+v", summaries)
+	}
+	claude := summaries[0]
+	if claude.PostCount != 2 || claude.RecentPostCount != 0 || !claude.FirstPostAt.Equal(first.Timestamp) || claude.Status != database.AgentStatusActive {
+		t.Errorf("Unexpected summary %+v", claude)
+	}
+	if summaries[1].RecentPostCount != 1 || !summaries[1].LastPostAt.Equal(last.Timestamp) {
+		t.Errorf("Expected 1 recent post at %v, got %+v", last.Timestamp, summaries[1])
+	}
+	if summaries[2].PostCount != 0 || summaries[2].FirstPostAt != nil || summaries[2].LastPostAt != nil {
+		t.Errorf("Expected an agent without posts, got %+v", summaries[2])
+	}
+
+	query.Sort = database.AgentSortLastPostAt
+	query.Ascending = true
+	summaries, err = db.GetAgentSummaries(ctx, query)
+	if err != nil || len(summaries) != 3 || summaries[0].ID != agents[0].ID || summaries[2].ID != agents[2].ID {
+		t.Errorf("Expected agents without posts last, got %+v (%v)", summaries, err)
+	}
+
+	// _ is not a wildcard in the search text
+	summaries, err = db.GetAgentSummaries(ctx, database.AgentQuery{Limit: 10, Search: "X_b"})
+	if err != nil || len(summaries) != 1 || summaries[0].ID != agents[2].ID {
+		t.Errorf("Expected only Codex_Bot, got %+v (%v)", summaries, err)
+	}
+	summaries, err = db.GetAgentSummaries(ctx, database.AgentQuery{Limit: 10, Search: "x_"})
+	if err != nil || len(summaries) != 1 {
+		t.Errorf("Expected a case-insensitive match, got %+v (%v)", summaries, err)
+	}
+
+	query = database.AgentQuery{Limit: 10, ActiveSince: time.Now().Add(time.Hour), Status: database.AgentStatusIdle}
+	summaries, err = db.GetAgentSummaries(ctx, query)
+	if err != nil || len(summaries) != 3 || summaries[0].Status != database.AgentStatusIdle {
+		t.Errorf("Expected every agent to be idle, got %+v (%v)", summaries, err)
+	}
+	query.Status = database.AgentStatusActive
+	if summaries, err = db.GetAgentSummaries(ctx, query); err != nil || len(summaries) != 0 {
+		t.Errorf("Expected no active agents, got %+v (%v)", summaries, err)
+	}
+
+	summaries, err = db.GetAgentSummaries(ctx, database.AgentQuery{Limit: 1, ID: &agents[1].ID})
+	if err != nil || len(summaries) != 1 || summaries[0].IdentityKey != "gemini:default" {
+		t.Errorf("Expected the agent with ID %d, got %+v (%v)", agents[1].ID, summaries, err)
+	}
+}
+
+func TestSQLiteDatabase_Metrics(t *testing.T) {
+	ctx := context.Background()
+	db := newTestSQLiteDatabase(t)
+
+	agent, err := db.CreateAgent(ctx, database.CreateAgentParams{
+		Name:        "Claude",
+		DisplayName: "Claude - Metrics",
+		IdentityKey: "claude:metrics",
+		AvatarSeed:  "00huo523",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create agent: %v", err)
+	}
+
+	postsCreated := func(t *testing.T) float64 {
+		t.Helper()
+		families, err := prometheus.DefaultGatherer.Gather()
+		if err != nil {
+			t.Fatalf("Failed to gather metrics: %v", err)
+		}
+		for _, family := range families {
+			if family.GetName() != "timeline_posts_created_total" {
+				continue
+			}
+			for _, metric := range family.GetMetric() {
+				if label := metric.GetLabel(); len(label) == 1 && label[0].GetValue() == agent.IdentityKey {
+					return metric.GetCounter().GetValue()
+				}
+			}
+		}
+		return 0
+	}
+
+	for range 2 {
+		if _, err := db.CreatePost(ctx, database.CreatePostParams{AgentID: agent.ID, Content: "Counted"}); err != nil {
+			t.Fatalf("Failed to create post: %v", err)
+		}
+	}
+	if count := postsCreated(t); count != 2 {
+		t.Errorf("Expected 2 posts created by %s, got %v", agent.IdentityKey, count)
+	}
+
+	if count := testutil.CollectAndCount(db.Collector(), "go_sql_open_connections"); count != 1 {
+		t.Errorf("Expected the collector to report open connections, got %d series", count)
+	}
+}
@@ -0,0 +1,109 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// NotificationChannel is the channel on which new post and session notifications are delivered
+const NotificationChannel = "timeline_posts"
+
+// NotificationStatus describes the state of the notification listener
+type NotificationStatus struct {
+	// Listening is false before StartNotifications and while the listener reconnects
+	Listening bool `json:"listening"`
+	// Since is when the listener last started listening or lost its connection
+	Since *time.Time `json:"since"`
+	// Reconnects counts the times the listener restored a lost connection
+	Reconnects int `json:"reconnects"`
+	// LastError is the error that broke the connection or failed the latest reconnect attempt
+	LastError string `json:"last_error,omitempty"`
+	// Backfilled counts the notifications recovered from the tables after reconnecting
+	Backfilled int `json:"backfilled"`
+}
+
+// Store defines the storage operations for posts, agents and change notifications.
+// It is implemented by the PostgreSQL backend (Database) and the SQLite backend (SQLiteDatabase).
+type Store interface {
+	Ping(ctx context.Context) error
+	Close()
+
+	// Posts
+	GetPosts(ctx context.Context, query PostQuery) ([]Post, error)
+	GetPost(ctx context.Context, id int) (*Post, error)
+	CreatePost(ctx context.Context, params CreatePostParams) (*Post, error)
+	SearchPosts(ctx context.Context, query SearchQuery) ([]SearchResult, error)
+	GetThread(ctx context.Context, postID int) ([]Post, error)
+	GetTags(ctx context.Context, query TagQuery) ([]TagSummary, error)
+
+	// Reactions
+	SetReaction(ctx context.Context, params ReactionParams) error
+	DeleteReaction(ctx context.Context, params ReactionParams) (bool, error)
+
+	// Mentions
+	GetMentions(ctx context.Context, query MentionQuery) ([]Mention, error)
+	CountUnreadMentions(ctx context.Context, agentID int) (int, error)
+	MarkMentionsRead(ctx context.Context, agentID int, postIDs []int) (int, error)
+	GetMentionedAgents(ctx context.Context, postID int) ([]Agent, error)
+
+	// Agents
+	CreateAgent(ctx context.Context, params CreateAgentParams) (*Agent, error)
+	GetAgent(ctx context.Context, id int) (*Agent, error)
+	GetAgentSummaries(ctx context.Context, query AgentQuery) ([]AgentSummary, error)
+	GetAgentByIdentityKey(ctx context.Context, identityKey string) (*Agent, error)
+	UpdateAgentChannel(ctx context.Context, agentID int, channelID *int) error
+
+	// Sessions
+	CreateSession(ctx context.Context, params CreateSessionParams) (*Session, error)
+	GetSession(ctx context.Context, token string) (*Session, error)
+	GetSessions(ctx context.Context, query SessionQuery) ([]Session, error)
+	TouchSession(ctx context.Context, token string) (bool, error)
+	EndSession(ctx context.Context, token string, reason string) (bool, error)
+	ExpireSessions(ctx context.Context, idleSince time.Time, reason string) ([]Session, error)
+
+	// Channels
+	CreateChannel(ctx context.Context, params CreateChannelParams) (*Channel, error)
+	GetChannelBySlug(ctx context.Context, slug string) (*Channel, error)
+	GetChannels(ctx context.Context) ([]Channel, error)
+
+	// Notifications
+	StartNotifications(ctx context.Context) error
+	StopNotifications()
+	AddNotificationHandler(channel string, handler NotificationHandler)
+	NotificationStatus() NotificationStatus
+
+	// Schema migrations
+	MigrateUp(ctx context.Context) ([]Migration, error)
+	MigrateDown(ctx context.Context, steps int) ([]Migration, error)
+	MigrationStatus(ctx context.Context) ([]MigrationStatus, error)
+
+	// Monitoring
+	Collector() prometheus.Collector
+}
+
+// Ensure that both backends implement the Store interface
+var (
+	_ Store = (*Database)(nil)
+	_ Store = (*SQLiteDatabase)(nil)
+)
+
+// sqliteScheme is the DATABASE_URL prefix that selects the SQLite backend
+const sqliteScheme = "sqlite://"
+
+// Open connects to the backend selected by the database URL.
+// URLs of the form sqlite:///path/to/file.db use the embedded SQLite backend,
+// any other URL is treated as a PostgreSQL connection string.
+func Open(ctx context.Context, databaseURL string) (Store, error) {
+	if strings.HasPrefix(databaseURL, sqliteScheme) {
+		path := strings.TrimPrefix(databaseURL, sqliteScheme)
+		if path == "" {
+			return nil, fmt.Errorf("sqlite database path is required")
+		}
+		return NewSQLiteDatabase(ctx, path)
+	}
+	return NewDatabase(ctx, databaseURL)
+}
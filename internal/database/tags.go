@@ -0,0 +1,142 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// MaxTagLength is the longest hashtag that is indexed; longer ones are ignored
+const MaxTagLength = 50
+
+// RecentTagWindow is the period counted by TagSummary.RecentCount when no start is given
+const RecentTagWindow = 24 * time.Hour
+
+// TagSummary describes how often a hashtag is used
+type TagSummary struct {
+	Name      string `json:"name"`
+	PostCount int    `json:"post_count"`
+	// RecentCount is the number of posts with the tag since TagQuery.Since
+	RecentCount int       `json:"recent_count"`
+	LastPostAt  time.Time `json:"last_post_at"`
+}
+
+// TagQuery selects the most recently used hashtags
+type TagQuery struct {
+	Limit int
+	// Since is the start of the period counted by TagSummary.RecentCount
+	Since time.Time
+}
+
+// NormalizeTag returns the stored form of a hashtag: lower case without the leading #
+func NormalizeTag(tag string) string {
+	return strings.ToLower(strings.TrimPrefix(strings.TrimSpace(tag), "#"))
+}
+
+// ExtractHashtags returns the normalized hashtags in the content, in order of first use.
+// A hashtag is a # followed by letters, digits, underscores and hyphens, such as
+// #migration or #flaky-test. It must contain a letter, so issue references like #42
+// are not tags, and the # must not follow a word character, so C# is not a tag either.
+func ExtractHashtags(content string) []string {
+	var tags []string
+	seen := make(map[string]bool)
+
+	for i := 0; i < len(content); i++ {
+		if content[i] != '#' {
+			continue
+		}
+		if prev, _ := utf8.DecodeLastRuneInString(content[:i]); i > 0 && isWordRune(prev) {
+			continue
+		}
+
+		end := i + 1
+		hasLetter := false
+		for end < len(content) {
+			r, size := utf8.DecodeRuneInString(content[end:])
+			if !isWordRune(r) && r != '-' {
+				break
+			}
+			hasLetter = hasLetter || unicode.IsLetter(r)
+			end += size
+		}
+
+		tag := NormalizeTag(strings.TrimRight(content[i:end], "-"))
+		i = end - 1
+		if !hasLetter || utf8.RuneCountInString(tag) > MaxTagLength || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		tags = append(tags, tag)
+	}
+
+	return tags
+}
+
+// insertTagQuery adds a tag unless it exists; insertPostTagQuery then links it to a
+// post and takes the post ID followed by the tag name
+var (
+	insertTagQuery = map[string]string{
+		dialectPostgres: "INSERT INTO tags (name) VALUES ($1) ON CONFLICT (name) DO NOTHING",
+		dialectSQLite:   "INSERT INTO tags (name) VALUES (?) ON CONFLICT (name) DO NOTHING",
+	}
+	insertPostTagQuery = map[string]string{
+		dialectPostgres: "INSERT INTO post_tags (post_id, tag_id) SELECT $1, id FROM tags WHERE name = $2",
+		dialectSQLite:   "INSERT INTO post_tags (post_id, tag_id) SELECT ?, id FROM tags WHERE name = ?",
+	}
+)
+
+// backfillPostTags indexes the hashtags of the posts created before the tags tables,
+// as migration 0008_post_tags. Posts are read before indexing since a transaction
+// cannot run statements while a query is open.
+func backfillPostTags(ctx context.Context, tx migrationTx, dialect string) error {
+	var posts []Post
+	err := tx.query(ctx, "SELECT id, content FROM posts WHERE content LIKE '%#%' ORDER BY id", func(row rowScanner) error {
+		var post Post
+		if err := row.Scan(&post.ID, &post.Content); err != nil {
+			return err
+		}
+		posts = append(posts, post)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to read posts: %w", err)
+	}
+
+	for _, post := range posts {
+		for _, tag := range ExtractHashtags(post.Content) {
+			if err := tx.exec(ctx, insertTagQuery[dialect], tag); err != nil {
+				return fmt.Errorf("failed to create tag: %w", err)
+			}
+			if err := tx.exec(ctx, insertPostTagQuery[dialect], post.ID, tag); err != nil {
+				return fmt.Errorf("failed to tag post: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+// buildTagsQuery returns the SQL and arguments that select tag summaries, most recently used first
+func buildTagsQuery(dialect string, query TagQuery) (string, []any) {
+	b := &queryBuilder{dialect: dialect}
+
+	sql := `
+		SELECT
+			t.name,
+			COUNT(*) AS post_count,
+			SUM(CASE WHEN p.timestamp >= ` + b.arg(query.Since) + ` THEN 1 ELSE 0 END) AS recent_count,
+			MAX(p.timestamp) AS last_post_at
+		FROM tags t
+		JOIN post_tags pt ON pt.tag_id = t.id
+		JOIN posts p ON p.id = pt.post_id
+		GROUP BY t.id, t.name
+		ORDER BY last_post_at DESC, t.name ASC
+		LIMIT ` + b.arg(query.Limit)
+	return sql, b.args
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'
+}
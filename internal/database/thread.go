@@ -0,0 +1,40 @@
+package database
+
+// ThreadNode is a post together with its direct replies, oldest first
+type ThreadNode struct {
+	Post
+	Replies []*ThreadNode `json:"replies"`
+}
+
+// Thread is a conversation tree rooted at a top-level post
+type Thread struct {
+	Root  *ThreadNode `json:"root"`
+	Count int         `json:"count"`
+}
+
+// NewThread builds the conversation tree from the posts returned by GetThread.
+// Posts must be ordered oldest first so that replies keep their order.
+// It returns nil if the posts do not include the thread root.
+func NewThread(posts []Post) *Thread {
+	nodes := make(map[int]*ThreadNode, len(posts))
+	for _, post := range posts {
+		nodes[post.ID] = &ThreadNode{Post: post, Replies: []*ThreadNode{}}
+	}
+
+	var root *ThreadNode
+	for _, post := range posts {
+		node := nodes[post.ID]
+		if post.ParentPostID == nil {
+			root = node
+			continue
+		}
+		if parent, ok := nodes[*post.ParentPostID]; ok {
+			parent.Replies = append(parent.Replies, node)
+		}
+	}
+	if root == nil {
+		return nil
+	}
+
+	return &Thread{Root: root, Count: len(posts)}
+}
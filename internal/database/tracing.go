@@ -0,0 +1,94 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.39.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer creates the spans of database queries and notifications. It uses the global
+// tracer provider, so spans are only recorded once the server has configured one.
+var tracer = otel.Tracer("github.com/kmio11/agent-timeline-mcp/internal/database")
+
+// traceParentSetting is the transaction setting from which the notification triggers
+// copy the trace context of the inserting request into the payload
+const traceParentSetting = "timeline.traceparent"
+
+// queryTracer records a span for every query of the PostgreSQL connection pool
+type queryTracer struct{}
+
+// TraceQueryStart implements pgx.QueryTracer
+func (queryTracer) TraceQueryStart(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	operation := queryOperation(data.SQL)
+	ctx, _ = tracer.Start(ctx, operation,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.DBSystemNamePostgreSQL,
+			semconv.DBOperationName(operation),
+			semconv.DBQueryText(data.SQL),
+		),
+	)
+	return ctx
+}
+
+// TraceQueryEnd implements pgx.QueryTracer
+func (queryTracer) TraceQueryEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryEndData) {
+	span := trace.SpanFromContext(ctx)
+	if data.Err != nil {
+		span.RecordError(data.Err)
+		span.SetStatus(codes.Error, data.Err.Error())
+	}
+	span.End()
+}
+
+// queryOperation returns the SQL command of a query, such as SELECT, for the span name
+func queryOperation(sql string) string {
+	fields := strings.Fields(sql)
+	if len(fields) == 0 {
+		return "QUERY"
+	}
+	return strings.ToUpper(fields[0])
+}
+
+// setTraceParent stores the trace context of ctx in the transaction, so that the
+// notifications sent by its writes carry it to the listeners. Every write whose
+// trigger notifies calls it first.
+func setTraceParent(ctx context.Context, tx pgx.Tx) error {
+	carrier := propagation.MapCarrier{}
+	propagation.TraceContext{}.Inject(ctx, carrier)
+	traceParent := carrier.Get("traceparent")
+	if traceParent == "" {
+		return nil
+	}
+	if _, err := tx.Exec(ctx, "SELECT set_config($1, $2, true)", traceParentSetting, traceParent); err != nil {
+		return fmt.Errorf("failed to set trace context: %w", err)
+	}
+	return nil
+}
+
+// startNotificationSpan starts the span in which the handlers of a notification run.
+// It continues the trace of the request that created the row, when the payload carries one.
+func startNotificationSpan(channel string, payload *NotificationPayload) (context.Context, trace.Span) {
+	ctx := context.Background()
+	if payload.TraceParent != "" {
+		ctx = propagation.TraceContext{}.Extract(ctx, propagation.MapCarrier{"traceparent": payload.TraceParent})
+	}
+	name := payload.Table
+	if payload.Operation == NotificationResync {
+		name = "resync"
+	}
+	return tracer.Start(ctx, "notification "+name,
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(
+			semconv.MessagingOperationTypeProcess,
+			semconv.MessagingDestinationName(channel),
+		),
+	)
+}
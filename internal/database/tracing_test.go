@@ -0,0 +1,168 @@
+package database_test
+
+import (
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgproto3"
+	"github.com/kmio11/agent-timeline-mcp/internal/database"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// fakePostgres is a PostgreSQL server that records the statements it receives over the
+// simple query protocol and answers them with empty results. It stands in for a database
+// in tests of which statements the PostgreSQL backend sends.
+type fakePostgres struct {
+	listener net.Listener
+	mutex    sync.Mutex
+	queries  []string
+}
+
+func newFakePostgres(t *testing.T) *fakePostgres {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	server := &fakePostgres{listener: listener}
+	t.Cleanup(func() { listener.Close() })
+	go server.serve()
+	return server
+}
+
+// URL returns the connection string of the server
+func (s *fakePostgres) URL() string {
+	return "postgres://agent_user@" + s.listener.Addr().String() + "/agent_timeline?sslmode=disable&default_query_exec_mode=simple_protocol"
+}
+
+// Queries returns the statements received so far, in order
+func (s *fakePostgres) Queries() []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]string(nil), s.queries...)
+}
+
+func (s *fakePostgres) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *fakePostgres) handle(conn net.Conn) {
+	defer conn.Close()
+	backend := pgproto3.NewBackend(conn, conn)
+	if _, err := backend.ReceiveStartupMessage(); err != nil {
+		return
+	}
+	backend.Send(&pgproto3.AuthenticationOk{})
+	backend.Send(&pgproto3.ParameterStatus{Name: "standard_conforming_strings", Value: "on"})
+	backend.Send(&pgproto3.ParameterStatus{Name: "client_encoding", Value: "UTF8"})
+	backend.Send(&pgproto3.BackendKeyData{ProcessID: 1, SecretKey: 1})
+	backend.Send(&pgproto3.ReadyForQuery{TxStatus: 'I'})
+	if err := backend.Flush(); err != nil {
+		return
+	}
+
+	txStatus := byte('I')
+	for {
+		msg, err := backend.Receive()
+		if err != nil {
+			return
+		}
+		query, ok := msg.(*pgproto3.Query)
+		if !ok {
+			return
+		}
+		sql := strings.TrimSpace(query.String)
+		s.mutex.Lock()
+		s.queries = append(s.queries, sql)
+		s.mutex.Unlock()
+
+		upper := strings.ToUpper(sql)
+		switch {
+		case strings.HasPrefix(upper, "--"):
+			backend.Send(&pgproto3.EmptyQueryResponse{})
+		case strings.HasPrefix(upper, "BEGIN"):
+			txStatus = 'T'
+			backend.Send(&pgproto3.CommandComplete{CommandTag: []byte("BEGIN")})
+		case strings.HasPrefix(upper, "COMMIT"), strings.HasPrefix(upper, "ROLLBACK"):
+			txStatus = 'I'
+			backend.Send(&pgproto3.CommandComplete{CommandTag: []byte(strings.Fields(upper)[0])})
+		case strings.HasPrefix(upper, "SELECT EXISTS"):
+			backend.Send(&pgproto3.RowDescription{Fields: []pgproto3.FieldDescription{{Name: []byte("exists"), DataTypeOID: 16, DataTypeSize: 1, TypeModifier: -1}}})
+			backend.Send(&pgproto3.DataRow{Values: [][]byte{[]byte("t")}})
+			backend.Send(&pgproto3.CommandComplete{CommandTag: []byte("SELECT 1")})
+		case strings.HasPrefix(upper, "SELECT"):
+			backend.Send(&pgproto3.RowDescription{Fields: []pgproto3.FieldDescription{{Name: []byte("value"), DataTypeOID: 25, DataTypeSize: -1, TypeModifier: -1}}})
+			backend.Send(&pgproto3.DataRow{Values: [][]byte{[]byte("")}})
+			backend.Send(&pgproto3.CommandComplete{CommandTag: []byte("SELECT 1")})
+		default:
+			tag := strings.Fields(upper)[0] + " 1"
+			if strings.HasPrefix(tag, "INSERT") {
+				tag = "INSERT 0 1"
+			}
+			backend.Send(&pgproto3.CommandComplete{CommandTag: []byte(tag)})
+		}
+		backend.Send(&pgproto3.ReadyForQuery{TxStatus: txStatus})
+		if err := backend.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+func TestDatabase_TraceParent(t *testing.T) {
+	ctx := context.Background()
+	server := newFakePostgres(t)
+	db, err := database.NewDatabase(ctx, server.URL())
+	if err != nil {
+		t.Fatalf("Failed to connect to the fake server: %v", err)
+	}
+	defer db.Close()
+
+	ctx, span := sdktrace.NewTracerProvider().Tracer("test").Start(ctx, "POST /api/posts/:id/reactions")
+	defer span.End()
+	traceID := span.SpanContext().TraceID().String()
+
+	if err := db.SetReaction(ctx, database.ReactionParams{PostID: 1, ReactorType: database.ReactorHuman, Reactor: "alice", Emoji: "👍"}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	// The trace context is set in the transaction before the write whose trigger notifies
+	var statements []string
+	for _, query := range server.Queries() {
+		switch lower := strings.ToLower(query); {
+		case lower == "begin", lower == "commit":
+			statements = append(statements, strings.ToUpper(query))
+		case strings.Contains(query, "set_config") && strings.Contains(query, traceID):
+			statements = append(statements, "set_config")
+		case strings.Contains(query, "INSERT INTO reactions"):
+			statements = append(statements, "INSERT")
+		}
+	}
+	if strings.Join(statements, " ") != "BEGIN set_config INSERT COMMIT" {
+		t.Errorf("Expected the reaction to be inserted in a transaction carrying trace %s, got %v", traceID, server.Queries())
+	}
+
+	if _, err := db.DeleteReaction(ctx, database.ReactionParams{PostID: 1, ReactorType: database.ReactorHuman, Reactor: "alice"}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if _, err := db.EndSession(ctx, "session-1", database.SessionEndSignedOut); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	traced := 0
+	for _, query := range server.Queries() {
+		if strings.Contains(query, "set_config") && strings.Contains(query, traceID) {
+			traced++
+		}
+	}
+	if traced != 3 {
+		t.Errorf("Expected every write to set the trace context, got %d of 3", traced)
+	}
+}
@@ -0,0 +1,26 @@
+package mcpserver
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// SessionIDHeader is the header carrying the MCP session ID on the Streamable HTTP transport
+const SessionIDHeader = "Mcp-Session-Id"
+
+// NewStreamableHTTPHandler returns an http.Handler serving the MCP Streamable HTTP transport.
+// Every MCP session shares the given server, and idle MCP sessions are closed after
+// sessionTimeout, the idle timeout of timeline sessions. Events are kept in memory so that
+// clients can resume SSE streams.
+func NewStreamableHTTPHandler(server *mcp.Server, sessionTimeout time.Duration) http.Handler {
+	return mcp.NewStreamableHTTPHandler(func(*http.Request) *mcp.Server {
+		return server
+	}, &mcp.StreamableHTTPOptions{
+		Logger:         slog.Default(),
+		EventStore:     mcp.NewMemoryEventStore(nil),
+		SessionTimeout: sessionTimeout,
+	})
+}
@@ -0,0 +1,87 @@
+package mcpserver
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kmio11/agent-timeline-mcp/internal/timeline"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+func newTestHTTPServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	handler := NewStreamableHTTPHandler(NewServer(timeline.NewService(&MockStore{})), timeline.SessionTimeout)
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestStreamableHTTPHandler_Initialize(t *testing.T) {
+	server := newTestHTTPServer(t)
+
+	body := `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2025-06-18","capabilities":{},"clientInfo":{"name":"test-client","version":"1.0.0"}}}`
+	req, err := http.NewRequest(http.MethodPost, server.URL, strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json, text/event-stream")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", resp.StatusCode)
+	}
+	if resp.Header.Get(SessionIDHeader) == "" {
+		t.Errorf("Expected %s header to be set", SessionIDHeader)
+	}
+	if contentType := resp.Header.Get("Content-Type"); !strings.HasPrefix(contentType, "text/event-stream") {
+		t.Errorf("Expected SSE response, got %s", contentType)
+	}
+
+	reader := bufio.NewReader(resp.Body)
+	line, err := reader.ReadString('\n')
+	for err == nil && !strings.HasPrefix(line, "data: ") {
+		line, err = reader.ReadString('\n')
+	}
+	if !strings.Contains(line, ServerName) {
+		t.Errorf("Expected initialize result to contain server name, got %q", line)
+	}
+}
+
+func TestStreamableHTTPHandler_ToolFlow(t *testing.T) {
+	server := newTestHTTPServer(t)
+	ctx := context.Background()
+
+	client := mcp.NewClient(&mcp.Implementation{Name: "test-client", Version: "1.0.0"}, nil)
+	session, err := client.Connect(ctx, &mcp.StreamableClientTransport{Endpoint: server.URL}, nil)
+	if err != nil {
+		t.Fatalf("Failed to connect client: %v", err)
+	}
+	defer session.Close()
+
+	if session.ID() == "" {
+		t.Errorf("Expected a session ID to be assigned")
+	}
+
+	result, body := callTool(t, session, ToolSignIn, map[string]any{"agent_name": "Remote Agent"})
+	if result.IsError {
+		t.Fatalf("Expected sign_in to succeed, got %v", body)
+	}
+
+	result, body = callTool(t, session, ToolPostTimeline, map[string]any{
+		"content":    "Posted over HTTP",
+		"session_id": body["session_id"],
+	})
+	if result.IsError {
+		t.Fatalf("Expected post_timeline to succeed, got %v", body)
+	}
+}
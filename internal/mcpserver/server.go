@@ -0,0 +1,119 @@
+package mcpserver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/kmio11/agent-timeline-mcp/internal/timeline"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// Server identification reported during MCP initialization
+const (
+	ServerName    = "agent-timeline-mcp-server"
+	ServerVersion = "1.0.0"
+)
+
+// Tool names shared with the TypeScript MCP server (shared/constants.ts)
+const (
+	ToolSignIn       = "sign_in"
+	ToolPostTimeline = "post_timeline"
+	ToolSignOut      = "sign_out"
+)
+
+// SignInParams are the arguments of the sign_in tool
+type SignInParams struct {
+	AgentName string `json:"agent_name" jsonschema:"Name of the AI agent"`
+	Context   string `json:"context,omitempty" jsonschema:"Optional work context/task description"`
+	Channel   string `json:"channel,omitempty" jsonschema:"Optional slug of the channel to post to by default, general when omitted"`
+}
+
+// PostTimelineParams are the arguments of the post_timeline tool
+type PostTimelineParams struct {
+	Content      string `json:"content" jsonschema:"Post content text"`
+	SessionID    string `json:"session_id" jsonschema:"Session ID from sign_in response"`
+	ParentPostID *int   `json:"parent_post_id,omitempty" jsonschema:"Optional ID of the post to reply to"`
+	Channel      string `json:"channel,omitempty" jsonschema:"Optional channel slug overriding the channel chosen at sign in"`
+}
+
+// SignOutParams are the arguments of the sign_out tool
+type SignOutParams struct {
+	SessionID string `json:"session_id" jsonschema:"Session ID to sign out"`
+}
+
+// NewServer creates an MCP server exposing the timeline tools backed by the given service
+func NewServer(service *timeline.Service) *mcp.Server {
+	server := mcp.NewServer(&mcp.Implementation{
+		Name:    ServerName,
+		Version: ServerVersion,
+	}, nil)
+
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        ToolSignIn,
+		Description: "Authenticate an AI agent and start a session. Supports multiple parallel sessions for the same agent by specifying different contexts.",
+	}, func(ctx context.Context, req *mcp.CallToolRequest, params SignInParams) (*mcp.CallToolResult, any, error) {
+		ctx = timeline.WithClientInfo(ctx, clientInfo(req))
+		return toolResult(service.SignIn(ctx, params.AgentName, params.Context, params.Channel))
+	})
+
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        ToolPostTimeline,
+		Description: "Create a new timeline post from the signed-in agent, optionally as a reply to another post",
+	}, func(ctx context.Context, req *mcp.CallToolRequest, params PostTimelineParams) (*mcp.CallToolResult, any, error) {
+		return toolResult(service.PostTimeline(ctx, params.SessionID, params.Content, params.ParentPostID, params.Channel))
+	})
+
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        ToolSignOut,
+		Description: "End the agent session (optional cleanup)",
+	}, func(ctx context.Context, req *mcp.CallToolRequest, params SignOutParams) (*mcp.CallToolResult, any, error) {
+		return toolResult(service.SignOut(ctx, params.SessionID))
+	})
+
+	return server
+}
+
+// clientInfo describes the MCP client of a request as "name version"
+func clientInfo(req *mcp.CallToolRequest) string {
+	if req == nil || req.Session == nil {
+		return ""
+	}
+	params := req.Session.InitializeParams()
+	if params == nil || params.ClientInfo == nil {
+		return ""
+	}
+	return strings.TrimSpace(params.ClientInfo.Name + " " + params.ClientInfo.Version)
+}
+
+// toolResult converts a service response into an MCP tool result.
+// Errors are reported as tool results with isError set, carrying the structured error as JSON text.
+func toolResult[T any](response *T, err error) (*mcp.CallToolResult, any, error) {
+	if err != nil {
+		var timelineErr *timeline.Error
+		if !errors.As(err, &timelineErr) {
+			timelineErr = &timeline.Error{
+				Code:    timeline.CodeDatabaseError,
+				Message: fmt.Sprintf("Unexpected error: %v", err),
+			}
+		}
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{&mcp.TextContent{Text: marshalIndent(timelineErr)}},
+			IsError: true,
+		}, nil, nil
+	}
+
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{&mcp.TextContent{Text: marshalIndent(response)}},
+	}, response, nil
+}
+
+func marshalIndent(v any) string {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Sprintf(`{"error":%q,"message":%q}`, timeline.CodeDatabaseError, err.Error())
+	}
+	return string(data)
+}
@@ -0,0 +1,256 @@
+package mcpserver
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/kmio11/agent-timeline-mcp/internal/database"
+	"github.com/kmio11/agent-timeline-mcp/internal/timeline"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// MockStore implements timeline.Store for testing
+type MockStore struct {
+	agents   []*database.Agent
+	sessions []*database.Session
+}
+
+func (m *MockStore) CreateAgent(ctx context.Context, params database.CreateAgentParams) (*database.Agent, error) {
+	agent := &database.Agent{
+		ID:          len(m.agents) + 1,
+		Name:        params.Name,
+		Context:     params.Context,
+		DisplayName: params.DisplayName,
+		IdentityKey: params.IdentityKey,
+		AvatarSeed:  params.AvatarSeed,
+		LastActive:  time.Now(),
+		CreatedAt:   time.Now(),
+	}
+	m.agents = append(m.agents, agent)
+	return agent, nil
+}
+
+func (m *MockStore) GetAgent(ctx context.Context, id int) (*database.Agent, error) {
+	for _, agent := range m.agents {
+		if agent.ID == id {
+			return agent, nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *MockStore) GetAgentByIdentityKey(ctx context.Context, identityKey string) (*database.Agent, error) {
+	return nil, nil
+}
+
+func (m *MockStore) CreateSession(ctx context.Context, params database.CreateSessionParams) (*database.Session, error) {
+	session := &database.Session{
+		ID:         len(m.sessions) + 1,
+		Token:      params.Token,
+		AgentID:    params.AgentID,
+		ClientInfo: params.ClientInfo,
+		StartedAt:  time.Now(),
+		LastSeenAt: time.Now(),
+	}
+	m.sessions = append(m.sessions, session)
+	return session, nil
+}
+
+func (m *MockStore) GetSession(ctx context.Context, token string) (*database.Session, error) {
+	for _, session := range m.sessions {
+		if session.Token == token {
+			return session, nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *MockStore) TouchSession(ctx context.Context, token string) (bool, error) {
+	return true, nil
+}
+
+func (m *MockStore) EndSession(ctx context.Context, token string, reason string) (bool, error) {
+	return true, nil
+}
+
+func (m *MockStore) ExpireSessions(ctx context.Context, idleSince time.Time, reason string) ([]database.Session, error) {
+	return nil, nil
+}
+
+func (m *MockStore) UpdateAgentChannel(ctx context.Context, agentID int, channelID *int) error {
+	return nil
+}
+
+func (m *MockStore) CreateChannel(ctx context.Context, params database.CreateChannelParams) (*database.Channel, error) {
+	return &database.Channel{ID: 2, Slug: params.Slug, Name: params.Name, Description: params.Description}, nil
+}
+
+func (m *MockStore) GetChannelBySlug(ctx context.Context, slug string) (*database.Channel, error) {
+	if slug != database.GeneralChannel {
+		return nil, nil
+	}
+	return &database.Channel{ID: 1, Slug: database.GeneralChannel, Name: "General"}, nil
+}
+
+func (m *MockStore) CreatePost(ctx context.Context, params database.CreatePostParams) (*database.Post, error) {
+	return &database.Post{
+		ID:        1,
+		AgentID:   params.AgentID,
+		Content:   params.Content,
+		Timestamp: time.Date(2023, 6, 21, 12, 0, 0, 0, time.UTC),
+		ChannelID: 1,
+		Channel:   database.GeneralChannel,
+	}, nil
+}
+
+func connect(t *testing.T, store *MockStore) *mcp.ClientSession {
+	t.Helper()
+	ctx := context.Background()
+
+	server := NewServer(timeline.NewService(store))
+	serverTransport, clientTransport := mcp.NewInMemoryTransports()
+	serverSession, err := server.Connect(ctx, serverTransport, nil)
+	if err != nil {
+		t.Fatalf("Failed to connect server: %v", err)
+	}
+	t.Cleanup(func() { serverSession.Close() })
+
+	client := mcp.NewClient(&mcp.Implementation{Name: "test-client", Version: "1.0.0"}, nil)
+	clientSession, err := client.Connect(ctx, clientTransport, nil)
+	if err != nil {
+		t.Fatalf("Failed to connect client: %v", err)
+	}
+	t.Cleanup(func() { clientSession.Close() })
+
+	return clientSession
+}
+
+func callTool(t *testing.T, session *mcp.ClientSession, name string, args map[string]any) (*mcp.CallToolResult, map[string]any) {
+	t.Helper()
+
+	result, err := session.CallTool(context.Background(), &mcp.CallToolParams{Name: name, Arguments: args})
+	if err != nil {
+		t.Fatalf("CallTool %s failed: %v", name, err)
+	}
+	if len(result.Content) != 1 {
+		t.Fatalf("Expected 1 content block, got %d", len(result.Content))
+	}
+	text, ok := result.Content[0].(*mcp.TextContent)
+	if !ok {
+		t.Fatalf("Expected text content, got %T", result.Content[0])
+	}
+
+	var body map[string]any
+	if err := json.Unmarshal([]byte(text.Text), &body); err != nil {
+		t.Fatalf("Failed to unmarshal tool output: %v", err)
+	}
+	return result, body
+}
+
+func TestServer_ListTools(t *testing.T) {
+	session := connect(t, &MockStore{})
+
+	result, err := session.ListTools(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("ListTools failed: %v", err)
+	}
+
+	names := map[string]bool{}
+	for _, tool := range result.Tools {
+		names[tool.Name] = true
+	}
+	for _, expected := range []string{ToolSignIn, ToolPostTimeline, ToolSignOut} {
+		if !names[expected] {
+			t.Errorf("Expected tool %s to be registered", expected)
+		}
+	}
+}
+
+func TestServer_ToolFlow(t *testing.T) {
+	store := &MockStore{}
+	session := connect(t, store)
+
+	result, body := callTool(t, session, ToolSignIn, map[string]any{"agent_name": "Claude", "context": "Docs"})
+	if result.IsError {
+		t.Fatalf("Expected sign_in to succeed, got %v", body)
+	}
+	sessionID, _ := body["session_id"].(string)
+	if sessionID == "" {
+		t.Fatalf("Expected session_id in response, got %v", body)
+	}
+	if body["display_name"] != "Claude - Docs" {
+		t.Errorf("Expected display name 'Claude - Docs', got %v", body["display_name"])
+	}
+	if store.sessions[0].ClientInfo != "test-client 1.0.0" {
+		t.Errorf("Expected the MCP client to be recorded, got %q", store.sessions[0].ClientInfo)
+	}
+
+	result, body = callTool(t, session, ToolPostTimeline, map[string]any{"content": "Hello", "session_id": sessionID})
+	if result.IsError {
+		t.Fatalf("Expected post_timeline to succeed, got %v", body)
+	}
+	if body["post_id"] != float64(1) {
+		t.Errorf("Expected post_id 1, got %v", body["post_id"])
+	}
+	if body["channel"] != database.GeneralChannel {
+		t.Errorf("Expected channel general, got %v", body["channel"])
+	}
+
+	result, body = callTool(t, session, ToolSignOut, map[string]any{"session_id": sessionID})
+	if result.IsError {
+		t.Fatalf("Expected sign_out to succeed, got %v", body)
+	}
+	if body["message"] != "Signed out successfully" {
+		t.Errorf("Unexpected message %v", body["message"])
+	}
+}
+
+func TestServer_ToolErrors(t *testing.T) {
+	session := connect(t, &MockStore{})
+
+	tests := []struct {
+		name         string
+		tool         string
+		args         map[string]any
+		expectedCode string
+	}{
+		{
+			name:         "empty agent name",
+			tool:         ToolSignIn,
+			args:         map[string]any{"agent_name": ""},
+			expectedCode: timeline.CodeValidationError,
+		},
+		{
+			name:         "unknown channel",
+			tool:         ToolSignIn,
+			args:         map[string]any{"agent_name": "Claude", "channel": "unknown"},
+			expectedCode: timeline.CodeValidationError,
+		},
+		{
+			name:         "invalid session",
+			tool:         ToolPostTimeline,
+			args:         map[string]any{"content": "Hello", "session_id": "invalid-session"},
+			expectedCode: timeline.CodeSessionError,
+		},
+		{
+			name:         "empty session on sign out",
+			tool:         ToolSignOut,
+			args:         map[string]any{"session_id": ""},
+			expectedCode: timeline.CodeSessionError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, body := callTool(t, session, tt.tool, tt.args)
+			if !result.IsError {
+				t.Errorf("Expected isError to be set")
+			}
+			if body["error"] != tt.expectedCode {
+				t.Errorf("Expected error %s, got %v", tt.expectedCode, body["error"])
+			}
+		})
+	}
+}
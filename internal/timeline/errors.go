@@ -0,0 +1,35 @@
+package timeline
+
+import "fmt"
+
+// Error codes shared with the TypeScript MCP server (shared/constants.ts)
+const (
+	CodeValidationError = "ValidationError"
+	CodeSessionError    = "SessionError"
+	CodeDatabaseError   = "DatabaseError"
+)
+
+// Error is a structured error returned by timeline operations.
+// It serializes to the same shape as the ErrorResponse used by the MCP tools.
+type Error struct {
+	Code      string         `json:"error"`
+	Message   string         `json:"message"`
+	Details   map[string]any `json:"details,omitempty"`
+	SessionID string         `json:"session_id,omitempty"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %s", e.Code, e.Message)
+}
+
+func validationError(message string, details map[string]any) *Error {
+	return &Error{Code: CodeValidationError, Message: message, Details: details}
+}
+
+func sessionError(message, sessionID string) *Error {
+	return &Error{Code: CodeSessionError, Message: message, SessionID: sessionID}
+}
+
+func databaseError(prefix string, err error) *Error {
+	return &Error{Code: CodeDatabaseError, Message: fmt.Sprintf("%s: %v", prefix, err)}
+}
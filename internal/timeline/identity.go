@@ -0,0 +1,58 @@
+package timeline
+
+import (
+	"crypto/rand"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// GenerateDisplayName builds the display name shown on the timeline
+func GenerateDisplayName(agentName string, context string) string {
+	if context == "" {
+		return agentName
+	}
+	return fmt.Sprintf("%s - %s", agentName, context)
+}
+
+// GenerateIdentityKey builds the identity key used to reuse agents across sessions.
+// It must stay in sync with generateIdentityKey in shared/types.ts.
+func GenerateIdentityKey(agentName string, context string) string {
+	base := strings.ToLower(strings.TrimSpace(agentName))
+	ctx := strings.ToLower(strings.TrimSpace(context))
+	if ctx == "" {
+		ctx = "default"
+	}
+	return base + ":" + ctx
+}
+
+// GenerateAvatarSeed derives a stable 8 character avatar seed from an identity key.
+// It reproduces the JavaScript hash in shared/types.ts, including its 32-bit shift semantics.
+func GenerateAvatarSeed(identityKey string) string {
+	var hash int64
+	for _, unit := range utf16.Encode([]rune(identityKey)) {
+		shifted := int64(int32(uint32(hash) << 5))
+		hash = int64(unit) + shifted - hash
+	}
+	if hash < 0 {
+		hash = -hash
+	}
+
+	seed := strconv.FormatInt(hash, 36)
+	if len(seed) < 8 {
+		seed = strings.Repeat("0", 8-len(seed)) + seed
+	}
+	return seed[:8]
+}
+
+// newSessionID generates a random UUID v4 session identifier
+func newSessionID() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16]), nil
+}
@@ -0,0 +1,110 @@
+package timeline
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/kmio11/agent-timeline-mcp/internal/database"
+)
+
+// ReaperConfig controls the background job that expires idle sessions
+type ReaperConfig struct {
+	// Interval is the time between runs, SessionReapInterval when zero
+	Interval time.Duration
+	// SystemPosts makes the reaper post a sign out notice for every expired session
+	SystemPosts bool
+}
+
+// SystemPostMetadata is the metadata of the posts made by the server on behalf of an agent
+type SystemPostMetadata struct {
+	System    bool   `json:"system"`
+	Event     string `json:"event"`
+	SessionID int    `json:"session_id"`
+}
+
+// SystemEventSessionExpired marks the system post made when a session expires
+const SystemEventSessionExpired = "session_expired"
+
+// ExpireIdleSessions ends the sessions without activity for longer than the idle timeout
+// and returns them. With systemPosts set, a sign out notice is posted for each of them
+// in the channel of the session. The store notifies every process of the ended
+// sessions, which announce them to their clients.
+func (s *Service) ExpireIdleSessions(ctx context.Context, systemPosts bool) ([]database.Session, error) {
+	s.mutex.Lock()
+	idleTimeout := s.idleTimeout
+	s.mutex.Unlock()
+
+	expired, err := s.store.ExpireSessions(ctx, s.now().Add(-idleTimeout), database.SessionEndIdleTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mutex.Lock()
+	for _, session := range expired {
+		delete(s.sessions, session.Token)
+	}
+	s.mutex.Unlock()
+
+	if systemPosts {
+		for _, session := range expired {
+			if err := s.postSessionExpired(ctx, session, idleTimeout); err != nil {
+				slog.Error("Failed to post session expiry", "error", err, "session", session.ID)
+			}
+		}
+	}
+
+	return expired, nil
+}
+
+// postSessionExpired posts a sign out notice for an expired session on behalf of its agent
+func (s *Service) postSessionExpired(ctx context.Context, session database.Session, idleTimeout time.Duration) error {
+	metadata, err := json.Marshal(SystemPostMetadata{
+		System:    true,
+		Event:     SystemEventSessionExpired,
+		SessionID: session.ID,
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = s.store.CreatePost(ctx, database.CreatePostParams{
+		AgentID:   session.AgentID,
+		Content:   fmt.Sprintf("Signed out after %s without activity", idleTimeout),
+		Metadata:  metadata,
+		ChannelID: session.ChannelID,
+		SessionID: &session.ID,
+	})
+	return err
+}
+
+// StartSessionReaper periodically expires idle sessions until the context is cancelled
+func (s *Service) StartSessionReaper(ctx context.Context, config ReaperConfig) {
+	interval := config.Interval
+	if interval <= 0 {
+		interval = SessionReapInterval
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				expired, err := s.ExpireIdleSessions(ctx, config.SystemPosts)
+				if err != nil {
+					slog.Error("Failed to expire idle sessions", "error", err)
+					continue
+				}
+				if len(expired) > 0 {
+					slog.Info("Expired idle sessions", "count", len(expired))
+				}
+			}
+		}
+	}()
+}
@@ -0,0 +1,551 @@
+package timeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/kmio11/agent-timeline-mcp/internal/database"
+)
+
+// Validation limits shared with the TypeScript MCP server (shared/constants.ts).
+// ContentMaxLength is the limit of the posts table, so SetContentMaxLength can only
+// lower it.
+const (
+	ContentMaxLength   = database.ContentMaxLength
+	AgentNameMaxLength = 100
+	ContextMaxLength   = 200
+)
+
+// Channel limits
+const (
+	ChannelNameMaxLength        = 100
+	ChannelDescriptionMaxLength = 200
+)
+
+// Session lifetime settings
+const (
+	SessionTimeout         = 30 * time.Minute
+	SessionCleanupInterval = 5 * time.Minute
+	SessionReapInterval    = time.Minute
+)
+
+// ClientInfoMaxLength is the number of characters of client information kept per session
+const ClientInfoMaxLength = 200
+
+// Store defines the database operations required by the timeline service
+type Store interface {
+	CreateAgent(ctx context.Context, params database.CreateAgentParams) (*database.Agent, error)
+	GetAgent(ctx context.Context, id int) (*database.Agent, error)
+	GetAgentByIdentityKey(ctx context.Context, identityKey string) (*database.Agent, error)
+	UpdateAgentChannel(ctx context.Context, agentID int, channelID *int) error
+	CreateSession(ctx context.Context, params database.CreateSessionParams) (*database.Session, error)
+	GetSession(ctx context.Context, token string) (*database.Session, error)
+	TouchSession(ctx context.Context, token string) (bool, error)
+	EndSession(ctx context.Context, token string, reason string) (bool, error)
+	ExpireSessions(ctx context.Context, idleSince time.Time, reason string) ([]database.Session, error)
+	CreatePost(ctx context.Context, params database.CreatePostParams) (*database.Post, error)
+	CreateChannel(ctx context.Context, params database.CreateChannelParams) (*database.Channel, error)
+	GetChannelBySlug(ctx context.Context, slug string) (*database.Channel, error)
+}
+
+// Ensure that *database.Database implements the Store interface
+var _ Store = (*database.Database)(nil)
+
+// SessionData holds the cached state of a signed-in agent session
+type SessionData struct {
+	// SessionID is the ID of the session record, not the session_id token
+	SessionID   int
+	AgentID     int
+	AgentName   string
+	DisplayName string
+	IdentityKey string
+	AvatarSeed  string
+	// ChannelID is the channel chosen at sign in, or nil for the general channel
+	ChannelID  *int
+	LastActive time.Time
+}
+
+// SignInResponse is returned after a successful sign in
+type SignInResponse struct {
+	SessionID   string `json:"session_id"`
+	AgentID     int    `json:"agent_id"`
+	DisplayName string `json:"display_name"`
+	IdentityKey string `json:"identity_key"`
+	AvatarSeed  string `json:"avatar_seed"`
+	Channel     string `json:"channel"`
+	Message     string `json:"message"`
+}
+
+// PostTimelineResponse is returned after a post has been created
+type PostTimelineResponse struct {
+	PostID       int    `json:"post_id"`
+	Timestamp    string `json:"timestamp"`
+	AgentName    string `json:"agent_name"`
+	DisplayName  string `json:"display_name"`
+	IdentityKey  string `json:"identity_key"`
+	AvatarSeed   string `json:"avatar_seed"`
+	ParentPostID *int   `json:"parent_post_id,omitempty"`
+	ThreadRootID *int   `json:"thread_root_id,omitempty"`
+	Channel      string `json:"channel"`
+}
+
+// SignOutResponse is returned after a sign out
+type SignOutResponse struct {
+	Message string `json:"message"`
+}
+
+// Service implements agent sign in, posting and sign out on top of a Store
+type Service struct {
+	store       Store
+	sessions    map[string]*SessionData
+	mutex       sync.Mutex
+	now         func() time.Time
+	idleTimeout time.Duration
+	// contentMaxLength is the number of characters allowed in a post
+	contentMaxLength int
+}
+
+// NewService creates a new timeline service
+func NewService(store Store) *Service {
+	return &Service{
+		store:       store,
+		sessions:    make(map[string]*SessionData),
+		now:         time.Now,
+		idleTimeout: SessionTimeout,
+
+		contentMaxLength: ContentMaxLength,
+	}
+}
+
+// SetIdleTimeout sets how long a session may go without activity before it expires.
+// It defaults to SessionTimeout.
+func (s *Service) SetIdleTimeout(timeout time.Duration) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.idleTimeout = timeout
+}
+
+// IdleTimeout returns how long a session may go without activity before it expires
+func (s *Service) IdleTimeout() time.Duration {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.idleTimeout
+}
+
+// SetContentMaxLength sets the number of characters allowed in a post.
+// It defaults to ContentMaxLength, which it must not exceed.
+func (s *Service) SetContentMaxLength(length int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.contentMaxLength = length
+}
+
+// clientInfoKey is the context key of the client information recorded at sign in
+type clientInfoKey struct{}
+
+// WithClientInfo returns a context that makes SignIn record the given client
+// information, such as an MCP client name or an HTTP user agent, on the new session
+func WithClientInfo(ctx context.Context, info string) context.Context {
+	return context.WithValue(ctx, clientInfoKey{}, info)
+}
+
+// clientInfo returns the client information of the context, cut to ClientInfoMaxLength
+func clientInfo(ctx context.Context) string {
+	info, _ := ctx.Value(clientInfoKey{}).(string)
+	info = strings.TrimSpace(info)
+	if utf8.RuneCountInString(info) > ClientInfoMaxLength {
+		info = string([]rune(info)[:ClientInfoMaxLength])
+	}
+	return info
+}
+
+// SignIn authenticates an agent and starts a new session.
+// An existing agent with the same identity key is reused; its other sessions stay valid.
+// The channel slug selects where the session posts by default; empty means the general channel.
+func (s *Service) SignIn(ctx context.Context, agentName string, agentContext string, channel string) (*SignInResponse, error) {
+	if strings.TrimSpace(agentName) == "" {
+		return nil, validationError("Agent name is required", nil)
+	}
+	if utf8.RuneCountInString(agentName) > AgentNameMaxLength {
+		return nil, validationError("Agent name must be 100 characters or less", nil)
+	}
+	if utf8.RuneCountInString(agentContext) > ContextMaxLength {
+		return nil, validationError("Context must be 200 characters or less", nil)
+	}
+
+	selected, err := s.resolveChannel(ctx, channel)
+	if err != nil {
+		return nil, err
+	}
+	var channelID *int
+	channelSlug := database.GeneralChannel
+	if selected != nil {
+		channelID = &selected.ID
+		channelSlug = selected.Slug
+	}
+
+	sessionID, err := newSessionID()
+	if err != nil {
+		return nil, databaseError("Failed to create session", err)
+	}
+
+	agent, err := s.getOrCreateAgent(ctx, agentName, agentContext, channelID)
+	if err != nil {
+		return nil, databaseError("Failed to create session", err)
+	}
+
+	session, err := s.store.CreateSession(ctx, database.CreateSessionParams{
+		Token:      sessionID,
+		AgentID:    agent.ID,
+		ChannelID:  channelID,
+		ClientInfo: clientInfo(ctx),
+	})
+	if err != nil {
+		return nil, databaseError("Failed to create session", err)
+	}
+
+	s.mutex.Lock()
+	s.sessions[sessionID] = &SessionData{
+		SessionID:   session.ID,
+		AgentID:     agent.ID,
+		AgentName:   agent.Name,
+		DisplayName: agent.DisplayName,
+		IdentityKey: agent.IdentityKey,
+		AvatarSeed:  agent.AvatarSeed,
+		ChannelID:   channelID,
+		LastActive:  s.now(),
+	}
+	s.mutex.Unlock()
+
+	return &SignInResponse{
+		SessionID:   sessionID,
+		AgentID:     agent.ID,
+		DisplayName: agent.DisplayName,
+		IdentityKey: agent.IdentityKey,
+		AvatarSeed:  agent.AvatarSeed,
+		Channel:     channelSlug,
+		Message:     "Signed in successfully",
+	}, nil
+}
+
+// resolveChannel looks up a channel by slug, returning nil for an empty slug
+func (s *Service) resolveChannel(ctx context.Context, slug string) (*database.Channel, error) {
+	slug = strings.ToLower(strings.TrimSpace(slug))
+	if slug == "" {
+		return nil, nil
+	}
+
+	channel, err := s.store.GetChannelBySlug(ctx, slug)
+	if err != nil {
+		return nil, databaseError("Failed to get channel", err)
+	}
+	if channel == nil {
+		return nil, validationError("Channel not found", map[string]any{"channel": slug})
+	}
+	return channel, nil
+}
+
+// getOrCreateAgent reuses the agent registered for the identity key or creates a new one
+func (s *Service) getOrCreateAgent(ctx context.Context, agentName string, agentContext string, channelID *int) (*database.Agent, error) {
+	name := strings.TrimSpace(agentName)
+	trimmedContext := strings.TrimSpace(agentContext)
+	identityKey := GenerateIdentityKey(name, trimmedContext)
+
+	existing, err := s.store.GetAgentByIdentityKey(ctx, identityKey)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		if !sameChannel(existing.ChannelID, channelID) {
+			if err := s.store.UpdateAgentChannel(ctx, existing.ID, channelID); err != nil {
+				return nil, err
+			}
+			existing.ChannelID = channelID
+		}
+		existing.LastActive = s.now()
+		return existing, nil
+	}
+
+	var contextPtr *string
+	if trimmedContext != "" {
+		contextPtr = &trimmedContext
+	}
+
+	return s.store.CreateAgent(ctx, database.CreateAgentParams{
+		Name:        name,
+		Context:     contextPtr,
+		DisplayName: GenerateDisplayName(name, trimmedContext),
+		IdentityKey: identityKey,
+		AvatarSeed:  GenerateAvatarSeed(identityKey),
+		ChannelID:   channelID,
+	})
+}
+
+func sameChannel(a, b *int) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// ValidateSession returns the session data for an active session and refreshes its activity
+func (s *Service) ValidateSession(ctx context.Context, sessionID string) (*SessionData, error) {
+	if sessionID == "" {
+		return nil, sessionError("Session ID is required", "")
+	}
+
+	now := s.now()
+
+	s.mutex.Lock()
+	session, cached := s.sessions[sessionID]
+	idleTimeout := s.idleTimeout
+	if cached && now.Sub(session.LastActive) > idleTimeout {
+		delete(s.sessions, sessionID)
+		s.mutex.Unlock()
+		return nil, sessionError("Session has expired", sessionID)
+	}
+	s.mutex.Unlock()
+
+	if !cached {
+		loaded, err := s.loadSession(ctx, sessionID)
+		if err != nil {
+			return nil, err
+		}
+		if now.Sub(loaded.LastActive) > idleTimeout {
+			return nil, sessionError("Session has expired", sessionID)
+		}
+		session = loaded
+	}
+
+	// Sessions may have been ended by another process, such as the reaper of the HTTP
+	// server while this one serves stdio, without this cache being told
+	open, err := s.store.TouchSession(ctx, sessionID)
+	if err != nil {
+		slog.Error("Failed to update session last seen", "error", err, "session_id", sessionID)
+	} else if !open {
+		s.mutex.Lock()
+		delete(s.sessions, sessionID)
+		s.mutex.Unlock()
+		return nil, sessionError("Invalid or expired session", sessionID)
+	}
+
+	s.mutex.Lock()
+	session.LastActive = now
+	s.sessions[sessionID] = session
+	snapshot := *session
+	s.mutex.Unlock()
+
+	return &snapshot, nil
+}
+
+// loadSession reads an open session and its agent from the store
+func (s *Service) loadSession(ctx context.Context, sessionID string) (*SessionData, error) {
+	record, err := s.store.GetSession(ctx, sessionID)
+	if err != nil {
+		slog.Error("Failed to get session from database", "error", err)
+		return nil, sessionError("Invalid or expired session", sessionID)
+	}
+	if record == nil || record.EndedAt != nil {
+		return nil, sessionError("Invalid or expired session", sessionID)
+	}
+
+	agent, err := s.store.GetAgent(ctx, record.AgentID)
+	if err != nil {
+		slog.Error("Failed to get session agent from database", "error", err)
+		return nil, sessionError("Invalid or expired session", sessionID)
+	}
+	if agent == nil {
+		return nil, sessionError("Invalid or expired session", sessionID)
+	}
+
+	return &SessionData{
+		SessionID:   record.ID,
+		AgentID:     agent.ID,
+		AgentName:   agent.Name,
+		DisplayName: agent.DisplayName,
+		IdentityKey: agent.IdentityKey,
+		AvatarSeed:  agent.AvatarSeed,
+		ChannelID:   record.ChannelID,
+		LastActive:  record.LastSeenAt,
+	}, nil
+}
+
+// PostTimeline creates a new timeline post for the agent of the given session.
+// A non-nil parentPostID makes the post a reply to that post, in the parent's channel.
+// Otherwise the post goes to the given channel slug, or to the session's channel when it is empty.
+func (s *Service) PostTimeline(ctx context.Context, sessionID string, content string, parentPostID *int, channel string) (*PostTimelineResponse, error) {
+	if strings.TrimSpace(content) == "" {
+		return nil, validationError("content cannot be empty", nil)
+	}
+	s.mutex.Lock()
+	maxLength := s.contentMaxLength
+	s.mutex.Unlock()
+	if length := utf8.RuneCountInString(content); length > maxLength {
+		return nil, validationError(fmt.Sprintf("content must be %d characters or less", maxLength), map[string]any{
+			"length": length,
+			"max":    maxLength,
+		})
+	}
+	if sessionID == "" {
+		return nil, sessionError("session_id is required. Please provide session_id from sign_in response.", "")
+	}
+
+	session, err := s.ValidateSession(ctx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	channelID := session.ChannelID
+	selected, err := s.resolveChannel(ctx, channel)
+	if err != nil {
+		return nil, err
+	}
+	if selected != nil {
+		channelID = &selected.ID
+	}
+
+	post, err := s.store.CreatePost(ctx, database.CreatePostParams{
+		AgentID:      session.AgentID,
+		Content:      strings.TrimSpace(content),
+		ParentPostID: parentPostID,
+		ChannelID:    channelID,
+		SessionID:    &session.SessionID,
+	})
+	if errors.Is(err, database.ErrParentPostNotFound) {
+		return nil, validationError("Parent post not found", map[string]any{"parent_post_id": *parentPostID})
+	}
+	if errors.Is(err, database.ErrChannelNotFound) {
+		return nil, validationError("Channel not found", map[string]any{"channel_id": channelID})
+	}
+	if err != nil {
+		return nil, databaseError("Post creation failed", err)
+	}
+
+	return &PostTimelineResponse{
+		PostID:       post.ID,
+		Timestamp:    post.Timestamp.UTC().Format("2006-01-02T15:04:05.000Z07:00"),
+		AgentName:    session.AgentName,
+		DisplayName:  session.DisplayName,
+		IdentityKey:  session.IdentityKey,
+		AvatarSeed:   session.AvatarSeed,
+		ParentPostID: post.ParentPostID,
+		ThreadRootID: post.ThreadRootID,
+		Channel:      post.Channel,
+	}, nil
+}
+
+// CreateChannel validates and creates a new channel. The slug is lowercased before it is checked.
+func (s *Service) CreateChannel(ctx context.Context, params database.CreateChannelParams) (*database.Channel, error) {
+	params.Slug = strings.ToLower(strings.TrimSpace(params.Slug))
+	params.Name = strings.TrimSpace(params.Name)
+	params.Description = strings.TrimSpace(params.Description)
+
+	if !database.ChannelSlugPattern.MatchString(params.Slug) {
+		return nil, validationError("Channel slug must be 1-50 lowercase letters, digits or hyphens and start with a letter or digit", map[string]any{"slug": params.Slug})
+	}
+	if params.Name == "" {
+		return nil, validationError("Channel name is required", nil)
+	}
+	if utf8.RuneCountInString(params.Name) > ChannelNameMaxLength {
+		return nil, validationError("Channel name must be 100 characters or less", nil)
+	}
+	if utf8.RuneCountInString(params.Description) > ChannelDescriptionMaxLength {
+		return nil, validationError("Channel description must be 200 characters or less", nil)
+	}
+
+	channel, err := s.store.CreateChannel(ctx, params)
+	if errors.Is(err, database.ErrChannelExists) {
+		return nil, validationError("Channel already exists", map[string]any{"slug": params.Slug})
+	}
+	if err != nil {
+		return nil, databaseError("Channel creation failed", err)
+	}
+	return channel, nil
+}
+
+// SignOut ends the given session
+func (s *Service) SignOut(ctx context.Context, sessionID string) (*SignOutResponse, error) {
+	if sessionID == "" {
+		return nil, sessionError("session_id is required. Please provide session_id to sign out from.", "")
+	}
+
+	s.mutex.Lock()
+	delete(s.sessions, sessionID)
+	s.mutex.Unlock()
+
+	if _, err := s.store.EndSession(ctx, sessionID, database.SessionEndSignedOut); err != nil {
+		slog.Error("Failed to end session", "error", err, "session_id", sessionID)
+		return &SignOutResponse{Message: "Signed out successfully (with cleanup warnings)"}, nil
+	}
+
+	return &SignOutResponse{Message: "Signed out successfully"}, nil
+}
+
+// HandleNotification removes ended sessions from the cache. It is registered as a
+// notification handler, so that sessions signed out or expired by another process
+// are not accepted from a stale cache entry.
+func (s *Service) HandleNotification(_ context.Context, payload *database.NotificationPayload) error {
+	if payload.Table != database.NotificationTableSessions || payload.Operation != database.NotificationUpdate {
+		return nil
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for sessionID, session := range s.sessions {
+		if session.SessionID == payload.SessionID {
+			delete(s.sessions, sessionID)
+		}
+	}
+	return nil
+}
+
+// CleanupExpiredSessions removes cached sessions that exceeded the idle timeout
+func (s *Service) CleanupExpiredSessions() int {
+	now := s.now()
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	removed := 0
+	for sessionID, session := range s.sessions {
+		if now.Sub(session.LastActive) > s.idleTimeout {
+			delete(s.sessions, sessionID)
+			removed++
+		}
+	}
+
+	if removed > 0 {
+		slog.Info("Cleaned up expired sessions", "count", removed)
+	}
+	return removed
+}
+
+// StartSessionCleanup periodically removes expired sessions until the context is cancelled
+func (s *Service) StartSessionCleanup(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				s.CleanupExpiredSessions()
+			}
+		}
+	}()
+}
+
+// ActiveSessionCount returns the number of cached sessions
+func (s *Service) ActiveSessionCount() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return len(s.sessions)
+}
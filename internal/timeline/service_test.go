@@ -0,0 +1,733 @@
+package timeline
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kmio11/agent-timeline-mcp/internal/database"
+)
+
+// MockStore is an in-memory implementation of Store for testing
+type MockStore struct {
+	agents   []*database.Agent
+	sessions []*database.Session
+	posts    []database.Post
+	channels []database.Channel
+	err      error
+}
+
+func NewMockStore() *MockStore {
+	return &MockStore{
+		channels: []database.Channel{{ID: 1, Slug: database.GeneralChannel, Name: "General"}},
+	}
+}
+
+func (m *MockStore) CreateAgent(ctx context.Context, params database.CreateAgentParams) (*database.Agent, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	agent := &database.Agent{
+		ID:          len(m.agents) + 1,
+		Name:        params.Name,
+		Context:     params.Context,
+		DisplayName: params.DisplayName,
+		IdentityKey: params.IdentityKey,
+		AvatarSeed:  params.AvatarSeed,
+		ChannelID:   params.ChannelID,
+		LastActive:  time.Now(),
+		CreatedAt:   time.Now(),
+	}
+	m.agents = append(m.agents, agent)
+	copied := *agent
+	return &copied, nil
+}
+
+func (m *MockStore) GetAgent(ctx context.Context, id int) (*database.Agent, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	for _, agent := range m.agents {
+		if agent.ID == id {
+			copied := *agent
+			return &copied, nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *MockStore) GetAgentByIdentityKey(ctx context.Context, identityKey string) (*database.Agent, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	for _, agent := range m.agents {
+		if agent.IdentityKey == identityKey {
+			copied := *agent
+			return &copied, nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *MockStore) UpdateAgentChannel(ctx context.Context, agentID int, channelID *int) error {
+	if m.err != nil {
+		return m.err
+	}
+	for _, agent := range m.agents {
+		if agent.ID == agentID {
+			agent.ChannelID = channelID
+		}
+	}
+	return nil
+}
+
+func (m *MockStore) CreateSession(ctx context.Context, params database.CreateSessionParams) (*database.Session, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	session := &database.Session{
+		ID:         len(m.sessions) + 1,
+		Token:      params.Token,
+		AgentID:    params.AgentID,
+		ChannelID:  params.ChannelID,
+		ClientInfo: params.ClientInfo,
+		StartedAt:  time.Now(),
+		LastSeenAt: time.Now(),
+	}
+	m.sessions = append(m.sessions, session)
+	copied := *session
+	return &copied, nil
+}
+
+func (m *MockStore) GetSession(ctx context.Context, token string) (*database.Session, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	for _, session := range m.sessions {
+		if session.Token == token {
+			copied := *session
+			return &copied, nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *MockStore) TouchSession(ctx context.Context, token string) (bool, error) {
+	if m.err != nil {
+		return false, m.err
+	}
+	for _, session := range m.sessions {
+		if session.Token == token && session.EndedAt == nil {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (m *MockStore) EndSession(ctx context.Context, token string, reason string) (bool, error) {
+	if m.err != nil {
+		return false, m.err
+	}
+	for _, session := range m.sessions {
+		if session.Token == token && session.EndedAt == nil {
+			now := time.Now()
+			session.EndedAt = &now
+			session.EndReason = &reason
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (m *MockStore) ExpireSessions(ctx context.Context, idleSince time.Time, reason string) ([]database.Session, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	var expired []database.Session
+	for _, session := range m.sessions {
+		if session.EndedAt == nil && session.LastSeenAt.Before(idleSince) {
+			now := time.Now()
+			session.EndedAt = &now
+			session.EndReason = &reason
+			expired = append(expired, *session)
+		}
+	}
+	return expired, nil
+}
+
+func (m *MockStore) CreateChannel(ctx context.Context, params database.CreateChannelParams) (*database.Channel, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	for _, channel := range m.channels {
+		if channel.Slug == params.Slug {
+			return nil, database.ErrChannelExists
+		}
+	}
+	channel := database.Channel{ID: len(m.channels) + 1, Slug: params.Slug, Name: params.Name, Description: params.Description}
+	m.channels = append(m.channels, channel)
+	return &channel, nil
+}
+
+func (m *MockStore) GetChannelBySlug(ctx context.Context, slug string) (*database.Channel, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	for _, channel := range m.channels {
+		if channel.Slug == slug {
+			return &channel, nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *MockStore) CreatePost(ctx context.Context, params database.CreatePostParams) (*database.Post, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	post := database.Post{
+		ID:           len(m.posts) + 1,
+		AgentID:      params.AgentID,
+		Content:      params.Content,
+		Timestamp:    time.Date(2023, 6, 21, 12, 0, 0, 0, time.UTC),
+		ParentPostID: params.ParentPostID,
+		Metadata:     params.Metadata,
+		ChannelID:    1,
+		SessionID:    params.SessionID,
+	}
+	if params.ChannelID != nil {
+		post.ChannelID = *params.ChannelID
+	}
+	if params.ParentPostID != nil {
+		if *params.ParentPostID < 1 || *params.ParentPostID > len(m.posts) {
+			return nil, database.ErrParentPostNotFound
+		}
+		parent := m.posts[*params.ParentPostID-1]
+		post.ThreadRootID = parent.ThreadRootID
+		if post.ThreadRootID == nil {
+			post.ThreadRootID = &parent.ID
+		}
+		post.ChannelID = parent.ChannelID
+	}
+	if post.ChannelID < 1 || post.ChannelID > len(m.channels) {
+		return nil, database.ErrChannelNotFound
+	}
+	post.Channel = m.channels[post.ChannelID-1].Slug
+	m.posts = append(m.posts, post)
+	return &post, nil
+}
+
+func (m *MockStore) SetError(err error) {
+	m.err = err
+}
+
+func expectTimelineError(t *testing.T, err error, code string, message string) {
+	t.Helper()
+	var timelineErr *Error
+	if !errors.As(err, &timelineErr) {
+		t.Fatalf("Expected *Error, got %v", err)
+	}
+	if timelineErr.Code != code {
+		t.Errorf("Expected code %s, got %s", code, timelineErr.Code)
+	}
+	if message != "" && timelineErr.Message != message {
+		t.Errorf("Expected message %q, got %q", message, timelineErr.Message)
+	}
+}
+
+func TestGenerateIdentityKey(t *testing.T) {
+	tests := []struct {
+		name      string
+		agentName string
+		context   string
+		expected  string
+	}{
+		{name: "without context", agentName: "Claude", context: "", expected: "claude:default"},
+		{name: "with context", agentName: " Claude ", context: " Docs ", expected: "claude:docs"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if result := GenerateIdentityKey(tt.agentName, tt.context); result != tt.expected {
+				t.Errorf("Expected %s, got %s", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestGenerateAvatarSeed(t *testing.T) {
+	// Expected values are produced by generateAvatarSeed in shared/types.ts
+	tests := []struct {
+		identityKey string
+		expected    string
+	}{
+		{identityKey: "claude:default", expected: "00huo523"},
+		{identityKey: "claude:docs", expected: "00p9p209"},
+		{identityKey: "a:b", expected: "000021e1"},
+		{identityKey: "gpt-4o:refactoring the authentication module for the api gateway", expected: "01z7m7kw"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.identityKey, func(t *testing.T) {
+			if result := GenerateAvatarSeed(tt.identityKey); result != tt.expected {
+				t.Errorf("Expected %s, got %s", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestService_SignIn(t *testing.T) {
+	t.Run("creates a new agent", func(t *testing.T) {
+		store := NewMockStore()
+		service := NewService(store)
+
+		response, err := service.SignIn(context.Background(), "Claude", "Docs", "")
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if response.DisplayName != "Claude - Docs" {
+			t.Errorf("Expected display name 'Claude - Docs', got %s", response.DisplayName)
+		}
+		if response.IdentityKey != "claude:docs" {
+			t.Errorf("Expected identity key 'claude:docs', got %s", response.IdentityKey)
+		}
+		if len(response.SessionID) != 36 {
+			t.Errorf("Expected UUID session ID, got %s", response.SessionID)
+		}
+		if service.ActiveSessionCount() != 1 {
+			t.Errorf("Expected 1 active session, got %d", service.ActiveSessionCount())
+		}
+	})
+
+	t.Run("reuses agent with the same identity", func(t *testing.T) {
+		store := NewMockStore()
+		service := NewService(store)
+
+		first, err := service.SignIn(context.Background(), "Claude", "Docs", "")
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		second, err := service.SignIn(context.Background(), "claude", "docs", "")
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if first.AgentID != second.AgentID {
+			t.Errorf("Expected agent %d to be reused, got %d", first.AgentID, second.AgentID)
+		}
+		if first.SessionID == second.SessionID {
+			t.Errorf("Expected a new session ID")
+		}
+
+		// Both sessions stay valid, also when they are loaded from the store
+		for _, svc := range []*Service{service, NewService(store)} {
+			for _, sessionID := range []string{first.SessionID, second.SessionID} {
+				if _, err := svc.ValidateSession(context.Background(), sessionID); err != nil {
+					t.Errorf("Expected session %s to be valid, got %v", sessionID, err)
+				}
+			}
+		}
+	})
+
+	t.Run("records client info", func(t *testing.T) {
+		store := NewMockStore()
+		service := NewService(store)
+
+		ctx := WithClientInfo(context.Background(), "  claude-code 1.0  ")
+		if _, err := service.SignIn(ctx, "Claude", "", ""); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if store.sessions[0].ClientInfo != "claude-code 1.0" {
+			t.Errorf("Expected client info 'claude-code 1.0', got %q", store.sessions[0].ClientInfo)
+		}
+
+		ctx = WithClientInfo(context.Background(), strings.Repeat("x", ClientInfoMaxLength+1))
+		if _, err := service.SignIn(ctx, "Claude", "", ""); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if length := len(store.sessions[1].ClientInfo); length != ClientInfoMaxLength {
+			t.Errorf("Expected client info cut to %d characters, got %d", ClientInfoMaxLength, length)
+		}
+	})
+
+	t.Run("selects a channel", func(t *testing.T) {
+		store := NewMockStore()
+		service := NewService(store)
+
+		response, err := service.SignIn(context.Background(), "Claude", "", "")
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if response.Channel != database.GeneralChannel {
+			t.Errorf("Expected channel general, got %s", response.Channel)
+		}
+
+		store.channels = append(store.channels, database.Channel{ID: 2, Slug: "docs", Name: "Docs"})
+		response, err = service.SignIn(context.Background(), "Claude", "", " Docs ")
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if response.Channel != "docs" {
+			t.Errorf("Expected channel docs, got %s", response.Channel)
+		}
+		if channelID := store.agents[0].ChannelID; channelID == nil || *channelID != 2 {
+			t.Errorf("Expected the agent channel to be updated to 2, got %v", channelID)
+		}
+
+		_, err = service.SignIn(context.Background(), "Claude", "", "unknown")
+		expectTimelineError(t, err, CodeValidationError, "Channel not found")
+	})
+
+	t.Run("validation errors", func(t *testing.T) {
+		service := NewService(NewMockStore())
+
+		_, err := service.SignIn(context.Background(), "  ", "", "")
+		expectTimelineError(t, err, CodeValidationError, "Agent name is required")
+
+		_, err = service.SignIn(context.Background(), strings.Repeat("a", 101), "", "")
+		expectTimelineError(t, err, CodeValidationError, "Agent name must be 100 characters or less")
+
+		_, err = service.SignIn(context.Background(), "Claude", strings.Repeat("c", 201), "")
+		expectTimelineError(t, err, CodeValidationError, "Context must be 200 characters or less")
+	})
+
+	t.Run("database error", func(t *testing.T) {
+		store := NewMockStore()
+		store.SetError(errors.New("connection refused"))
+		service := NewService(store)
+
+		_, err := service.SignIn(context.Background(), "Claude", "", "")
+		expectTimelineError(t, err, CodeDatabaseError, "Failed to create session: connection refused")
+	})
+}
+
+func TestService_PostTimeline(t *testing.T) {
+	store := NewMockStore()
+	service := NewService(store)
+
+	session, err := service.SignIn(context.Background(), "Claude", "", "")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	t.Run("creates trimmed post", func(t *testing.T) {
+		response, err := service.PostTimeline(context.Background(), session.SessionID, "  Hello timeline  ", nil, "")
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if response.AgentName != "Claude" {
+			t.Errorf("Expected agent name Claude, got %s", response.AgentName)
+		}
+		if response.Timestamp != "2023-06-21T12:00:00.000Z" {
+			t.Errorf("Unexpected timestamp %s", response.Timestamp)
+		}
+		if store.posts[len(store.posts)-1].Content != "Hello timeline" {
+			t.Errorf("Expected trimmed content, got %q", store.posts[len(store.posts)-1].Content)
+		}
+		if sessionID := store.posts[len(store.posts)-1].SessionID; sessionID == nil || *sessionID != store.sessions[0].ID {
+			t.Errorf("Expected the post to link to session %d, got %v", store.sessions[0].ID, sessionID)
+		}
+	})
+
+	t.Run("counts characters instead of bytes", func(t *testing.T) {
+		if _, err := service.PostTimeline(context.Background(), session.SessionID, strings.Repeat("あ", 280), nil, ""); err != nil {
+			t.Errorf("Expected no error, got %v", err)
+		}
+	})
+
+	t.Run("replies join the thread of their parent", func(t *testing.T) {
+		root, err := service.PostTimeline(context.Background(), session.SessionID, "Root", nil, "")
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		reply, err := service.PostTimeline(context.Background(), session.SessionID, "Reply", &root.PostID, "")
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		nested, err := service.PostTimeline(context.Background(), session.SessionID, "Nested reply", &reply.PostID, "")
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if root.ParentPostID != nil || root.ThreadRootID != nil {
+			t.Errorf("Expected a top-level post, got %+v", root)
+		}
+		if nested.ParentPostID == nil || *nested.ParentPostID != reply.PostID {
+			t.Errorf("Expected parent %d, got %v", reply.PostID, nested.ParentPostID)
+		}
+		if nested.ThreadRootID == nil || *nested.ThreadRootID != root.PostID {
+			t.Errorf("Expected thread root %d, got %v", root.PostID, nested.ThreadRootID)
+		}
+	})
+
+	t.Run("posts to the session or requested channel", func(t *testing.T) {
+		store.channels = append(store.channels, database.Channel{ID: 2, Slug: "docs", Name: "Docs"})
+		docsSession, err := service.SignIn(context.Background(), "Claude", "Docs", "docs")
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		response, err := service.PostTimeline(context.Background(), docsSession.SessionID, "In docs", nil, "")
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if response.Channel != "docs" {
+			t.Errorf("Expected channel docs, got %s", response.Channel)
+		}
+
+		response, err = service.PostTimeline(context.Background(), docsSession.SessionID, "In general", nil, "general")
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if response.Channel != database.GeneralChannel {
+			t.Errorf("Expected channel general, got %s", response.Channel)
+		}
+
+		reply, err := service.PostTimeline(context.Background(), docsSession.SessionID, "Reply", &response.PostID, "docs")
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if reply.Channel != database.GeneralChannel {
+			t.Errorf("Expected the reply to stay in the parent's channel, got %s", reply.Channel)
+		}
+
+		_, err = service.PostTimeline(context.Background(), docsSession.SessionID, "Hello", nil, "unknown")
+		expectTimelineError(t, err, CodeValidationError, "Channel not found")
+	})
+
+	t.Run("unknown parent post", func(t *testing.T) {
+		parentPostID := 9999
+		_, err := service.PostTimeline(context.Background(), session.SessionID, "Reply", &parentPostID, "")
+		expectTimelineError(t, err, CodeValidationError, "Parent post not found")
+	})
+
+	tests := []struct {
+		name      string
+		sessionID string
+		content   string
+		code      string
+		message   string
+	}{
+		{name: "empty content", sessionID: session.SessionID, content: "   ", code: CodeValidationError, message: "content cannot be empty"},
+		{name: "content too long", sessionID: session.SessionID, content: strings.Repeat("a", 281), code: CodeValidationError, message: "content must be 280 characters or less"},
+		{name: "missing session", sessionID: "", content: "Hello", code: CodeSessionError, message: "session_id is required. Please provide session_id from sign_in response."},
+		{name: "unknown session", sessionID: "unknown", content: "Hello", code: CodeSessionError, message: "Invalid or expired session"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := service.PostTimeline(context.Background(), tt.sessionID, tt.content, nil, "")
+			expectTimelineError(t, err, tt.code, tt.message)
+		})
+	}
+
+	t.Run("lowered content limit", func(t *testing.T) {
+		service.SetContentMaxLength(10)
+		defer service.SetContentMaxLength(ContentMaxLength)
+
+		_, err := service.PostTimeline(context.Background(), session.SessionID, strings.Repeat("a", 11), nil, "")
+		expectTimelineError(t, err, CodeValidationError, "content must be 10 characters or less")
+	})
+}
+
+func TestService_SessionExpiry(t *testing.T) {
+	store := NewMockStore()
+	service := NewService(store)
+	now := time.Now()
+	service.now = func() time.Time { return now }
+
+	session, err := service.SignIn(context.Background(), "Claude", "", "")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	now = now.Add(SessionTimeout + time.Second)
+	if removed := service.CleanupExpiredSessions(); removed != 1 {
+		t.Errorf("Expected 1 expired session to be removed, got %d", removed)
+	}
+
+	_, err = service.ValidateSession(context.Background(), session.SessionID)
+	expectTimelineError(t, err, CodeSessionError, "Session has expired")
+}
+
+func TestService_ExpireIdleSessions(t *testing.T) {
+	store := NewMockStore()
+	service := NewService(store)
+	service.SetIdleTimeout(10 * time.Minute)
+
+	idle, err := service.SignIn(context.Background(), "Claude", "Docs", "")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	active, err := service.SignIn(context.Background(), "Claude", "Tests", "")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	store.sessions[0].LastSeenAt = time.Now().Add(-11 * time.Minute)
+	store.sessions[0].DisplayName = "Claude - Docs"
+
+	expired, err := service.ExpireIdleSessions(context.Background(), true)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(expired) != 1 || expired[0].Token != idle.SessionID || *expired[0].EndReason != database.SessionEndIdleTimeout {
+		t.Fatalf("Expected only the idle session to expire, got %+v", expired)
+	}
+	if service.ActiveSessionCount() != 1 {
+		t.Errorf("Expected the expired session to leave the cache, got %d sessions", service.ActiveSessionCount())
+	}
+
+	if len(store.posts) != 1 {
+		t.Fatalf("Expected a system post, got %+v", store.posts)
+	}
+	post := store.posts[0]
+	if post.AgentID != expired[0].AgentID || post.Content != "Signed out after 10m0s without activity" || *post.SessionID != expired[0].ID {
+		t.Errorf("Unexpected system post %+v", post)
+	}
+	var metadata SystemPostMetadata
+	if err := json.Unmarshal(post.Metadata, &metadata); err != nil || !metadata.System || metadata.Event != SystemEventSessionExpired {
+		t.Errorf("Expected system post metadata, got %s (err: %v)", post.Metadata, err)
+	}
+
+	_, err = NewService(store).ValidateSession(context.Background(), idle.SessionID)
+	expectTimelineError(t, err, CodeSessionError, "Invalid or expired session")
+	if _, err := service.ValidateSession(context.Background(), active.SessionID); err != nil {
+		t.Errorf("Expected the active session to stay valid, got %v", err)
+	}
+
+	t.Run("without system posts", func(t *testing.T) {
+		store.sessions[1].LastSeenAt = time.Now().Add(-11 * time.Minute)
+		expired, err := service.ExpireIdleSessions(context.Background(), false)
+		if err != nil || len(expired) != 1 {
+			t.Fatalf("Expected 1 expired session, got %+v (err: %v)", expired, err)
+		}
+		if len(store.posts) != 1 {
+			t.Errorf("Expected no new posts, got %d", len(store.posts))
+		}
+	})
+}
+
+func TestService_SignOut(t *testing.T) {
+	store := NewMockStore()
+	service := NewService(store)
+
+	session, err := service.SignIn(context.Background(), "Claude", "", "")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	other, err := service.SignIn(context.Background(), "Claude", "", "")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	response, err := service.SignOut(context.Background(), session.SessionID)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if response.Message != "Signed out successfully" {
+		t.Errorf("Unexpected message %s", response.Message)
+	}
+	if service.ActiveSessionCount() != 1 {
+		t.Errorf("Expected 1 active session, got %d", service.ActiveSessionCount())
+	}
+	if ended := store.sessions[0]; ended.EndedAt == nil || *ended.EndReason != database.SessionEndSignedOut {
+		t.Errorf("Expected the session to be ended, got %+v", ended)
+	}
+
+	// The signed out session can no longer be used; the other session of the agent can
+	_, err = NewService(store).ValidateSession(context.Background(), session.SessionID)
+	expectTimelineError(t, err, CodeSessionError, "Invalid or expired session")
+	if _, err := service.ValidateSession(context.Background(), other.SessionID); err != nil {
+		t.Errorf("Expected the other session to stay valid, got %v", err)
+	}
+
+	_, err = service.SignOut(context.Background(), "")
+	expectTimelineError(t, err, CodeSessionError, "session_id is required. Please provide session_id to sign out from.")
+}
+
+func TestService_HandleNotification(t *testing.T) {
+	store := NewMockStore()
+	service := NewService(store)
+
+	session, err := service.SignIn(context.Background(), "Claude", "", "")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	other, err := service.SignIn(context.Background(), "Claude", "", "")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	// Another process signs the session out
+	if _, err := NewService(store).SignOut(context.Background(), session.SessionID); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	payload := &database.NotificationPayload{
+		Operation: database.NotificationUpdate,
+		Table:     database.NotificationTableSessions,
+		SessionID: store.sessions[0].ID,
+	}
+	if err := service.HandleNotification(context.Background(), payload); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	_, err = service.ValidateSession(context.Background(), session.SessionID)
+	expectTimelineError(t, err, CodeSessionError, "Invalid or expired session")
+	if _, err := service.ValidateSession(context.Background(), other.SessionID); err != nil {
+		t.Errorf("Expected the other session to stay cached, got %v", err)
+	}
+}
+
+func TestService_SessionEndedElsewhere(t *testing.T) {
+	store := NewMockStore()
+	service := NewService(store)
+
+	session, err := service.SignIn(context.Background(), "Claude", "", "")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	// Another process, such as the HTTP server, ends the session without this one
+	// receiving a notification
+	if _, err := NewService(store).SignOut(context.Background(), session.SessionID); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	_, err = service.ValidateSession(context.Background(), session.SessionID)
+	expectTimelineError(t, err, CodeSessionError, "Invalid or expired session")
+	if _, err := service.PostTimeline(context.Background(), session.SessionID, "Still here", nil, ""); err == nil {
+		t.Error("Expected posting in the ended session to fail")
+	}
+}
+
+func TestService_CreateChannel(t *testing.T) {
+	service := NewService(NewMockStore())
+
+	channel, err := service.CreateChannel(context.Background(), database.CreateChannelParams{Slug: " Docs-Rewrite ", Name: " Docs rewrite "})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if channel.Slug != "docs-rewrite" || channel.Name != "Docs rewrite" {
+		t.Errorf("Expected normalized slug and name, got %+v", channel)
+	}
+
+	tests := []struct {
+		name    string
+		params  database.CreateChannelParams
+		message string
+	}{
+		{name: "invalid slug", params: database.CreateChannelParams{Slug: "docs rewrite", Name: "Docs"}, message: "Channel slug must be 1-50 lowercase letters, digits or hyphens and start with a letter or digit"},
+		{name: "missing name", params: database.CreateChannelParams{Slug: "docs", Name: " "}, message: "Channel name is required"},
+		{name: "name too long", params: database.CreateChannelParams{Slug: "docs", Name: strings.Repeat("a", 101)}, message: "Channel name must be 100 characters or less"},
+		{name: "description too long", params: database.CreateChannelParams{Slug: "docs", Name: "Docs", Description: strings.Repeat("a", 201)}, message: "Channel description must be 200 characters or less"},
+		{name: "duplicate slug", params: database.CreateChannelParams{Slug: "general", Name: "General"}, message: "Channel already exists"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := service.CreateChannel(context.Background(), tt.params)
+			expectTimelineError(t, err, CodeValidationError, tt.message)
+		})
+	}
+}
@@ -0,0 +1,375 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/kmio11/agent-timeline-mcp/internal/database"
+	"github.com/kmio11/agent-timeline-mcp/internal/timeline"
+	"go.yaml.in/yaml/v2"
+)
+
+// ConfigFileEnv names the configuration file when the --config flag is not given
+const ConfigFileEnv = "TL_SERVER_CONFIG"
+
+// Config is the configuration of the API server. Every setting can come from the
+// configuration file, an environment variable or a command line flag.
+type Config struct {
+	DatabaseURL string `yaml:"database_url" toml:"database_url"`
+	Port        int    `yaml:"port" toml:"port"`
+	BasePath    string `yaml:"base_path" toml:"base_path"`
+	MCPPath     string `yaml:"mcp_path" toml:"mcp_path"`
+	MetricsPath string `yaml:"metrics_path" toml:"metrics_path"`
+	// AutoMigrate applies pending migrations on startup
+	AutoMigrate bool `yaml:"auto_migrate" toml:"auto_migrate"`
+
+	CORS     CORSConfig     `yaml:"cors" toml:"cors"`
+	Events   EventsConfig   `yaml:"events" toml:"events"`
+	Sessions SessionsConfig `yaml:"sessions" toml:"sessions"`
+	Posts    PostsConfig    `yaml:"posts" toml:"posts"`
+	Traces   TracesConfig   `yaml:"traces" toml:"traces"`
+}
+
+// CORSConfig lists the origins allowed to call the API and open WebSocket connections
+type CORSConfig struct {
+	// AllowOrigins holds exact origins such as https://example.com, or * for any origin
+	AllowOrigins []string `yaml:"allow_origins" toml:"allow_origins"`
+}
+
+// EventsConfig configures the SSE and WebSocket event streams
+type EventsConfig struct {
+	QueueSize  int        `yaml:"queue_size" toml:"queue_size"`
+	DropPolicy DropPolicy `yaml:"drop_policy" toml:"drop_policy"`
+	// KeepaliveInterval is the time between keepalive comments on idle SSE streams
+	KeepaliveInterval time.Duration `yaml:"keepalive_interval" toml:"keepalive_interval"`
+}
+
+// SessionsConfig configures the expiry of idle agent sessions
+type SessionsConfig struct {
+	IdleTimeout  time.Duration `yaml:"idle_timeout" toml:"idle_timeout"`
+	ReapInterval time.Duration `yaml:"reap_interval" toml:"reap_interval"`
+	ReapPosts    bool          `yaml:"reap_posts" toml:"reap_posts"`
+	ReapEvents   bool          `yaml:"reap_events" toml:"reap_events"`
+}
+
+// PostsConfig configures the posts and the pages of posts served by the API
+type PostsConfig struct {
+	// DefaultLimit is the page size of requests without a limit
+	DefaultLimit int `yaml:"default_limit" toml:"default_limit"`
+	// MaxLength is the number of characters allowed in a post. It can only lower
+	// database.ContentMaxLength, the limit of the posts table.
+	MaxLength int `yaml:"max_length" toml:"max_length"`
+}
+
+// TracesConfig selects the exporter of OpenTelemetry spans
+type TracesConfig struct {
+	Exporter string `yaml:"exporter" toml:"exporter"`
+	File     string `yaml:"file" toml:"file"`
+}
+
+// defaultConfig returns the settings used when neither the configuration file, the
+// environment nor the flags set them
+func defaultConfig() Config {
+	return Config{
+		Port:        3001,
+		BasePath:    "/api",
+		MCPPath:     "/mcp",
+		MetricsPath: "/metrics",
+		CORS: CORSConfig{
+			AllowOrigins: []string{"*"},
+		},
+		Events: EventsConfig{
+			QueueSize:         SSEQueueSize,
+			DropPolicy:        DropOldest,
+			KeepaliveInterval: SSEKeepaliveInterval,
+		},
+		Sessions: SessionsConfig{
+			IdleTimeout:  timeline.SessionTimeout,
+			ReapInterval: timeline.SessionReapInterval,
+			ReapEvents:   true,
+		},
+		Posts: PostsConfig{
+			DefaultLimit: database.DefaultPostsLimit,
+			MaxLength:    database.ContentMaxLength,
+		},
+		Traces: TracesConfig{
+			Exporter: TracesExporterNone,
+			File:     "traces.jsonl",
+		},
+	}
+}
+
+// setting is a configuration setting that can be set from the environment and the flags
+type setting struct {
+	env   string
+	flag  string
+	usage string
+	// secret settings can also be read from the file named by the <env>_FILE variable
+	secret bool
+	field  func(cfg *Config) any
+}
+
+// settings lists the settings in the order of the Config fields
+var settings = []setting{
+	{env: "DATABASE_URL", flag: "database-url", usage: "PostgreSQL URL or sqlite:// path of the database", secret: true, field: func(cfg *Config) any { return &cfg.DatabaseURL }},
+	{env: "TL_SERVER_PORT", flag: "port", usage: "HTTP port", field: func(cfg *Config) any { return &cfg.Port }},
+	{env: "TL_SERVER_BASE_PATH", flag: "base-path", usage: "path prefix of the REST API", field: func(cfg *Config) any { return &cfg.BasePath }},
+	{env: "TL_SERVER_MCP_PATH", flag: "mcp-path", usage: "path of the MCP endpoint", field: func(cfg *Config) any { return &cfg.MCPPath }},
+	{env: "TL_SERVER_METRICS_PATH", flag: "metrics-path", usage: "path of the Prometheus metrics", field: func(cfg *Config) any { return &cfg.MetricsPath }},
+	{env: "TL_SERVER_AUTO_MIGRATE", flag: "auto-migrate", usage: "apply pending migrations on startup", field: func(cfg *Config) any { return &cfg.AutoMigrate }},
+	{env: "TL_SERVER_CORS_ALLOW_ORIGINS", flag: "cors-allow-origins", usage: "comma-separated origins allowed by CORS, or *", field: func(cfg *Config) any { return &cfg.CORS.AllowOrigins }},
+	{env: "TL_SERVER_EVENT_QUEUE_SIZE", flag: "event-queue-size", usage: "events queued per SSE or WebSocket client", field: func(cfg *Config) any { return &cfg.Events.QueueSize }},
+	{env: "TL_SERVER_EVENT_DROP_POLICY", flag: "event-drop-policy", usage: "drop policy of clients that fall behind: drop_oldest, coalesce or disconnect", field: func(cfg *Config) any { return &cfg.Events.DropPolicy }},
+	{env: "TL_SERVER_EVENT_KEEPALIVE_INTERVAL", flag: "event-keepalive-interval", usage: "time between keepalive comments on SSE streams", field: func(cfg *Config) any { return &cfg.Events.KeepaliveInterval }},
+	{env: "TL_SERVER_SESSION_IDLE_TIMEOUT", flag: "session-idle-timeout", usage: "inactivity after which a session expires", field: func(cfg *Config) any { return &cfg.Sessions.IdleTimeout }},
+	{env: "TL_SERVER_SESSION_REAP_INTERVAL", flag: "session-reap-interval", usage: "time between runs of the session reaper", field: func(cfg *Config) any { return &cfg.Sessions.ReapInterval }},
+	{env: "TL_SERVER_SESSION_REAP_POSTS", flag: "session-reap-posts", usage: "post a notice for every expired session", field: func(cfg *Config) any { return &cfg.Sessions.ReapPosts }},
+	{env: "TL_SERVER_SESSION_REAP_EVENTS", flag: "session-reap-events", usage: "send agent_signed_out events for expired sessions", field: func(cfg *Config) any { return &cfg.Sessions.ReapEvents }},
+	{env: "TL_SERVER_POSTS_DEFAULT_LIMIT", flag: "posts-default-limit", usage: "page size of requests without a limit", field: func(cfg *Config) any { return &cfg.Posts.DefaultLimit }},
+	{env: "TL_SERVER_POSTS_MAX_LENGTH", flag: "posts-max-length", usage: "characters allowed in a post, at most the database limit", field: func(cfg *Config) any { return &cfg.Posts.MaxLength }},
+	{env: "TL_SERVER_TRACES_EXPORTER", flag: "traces-exporter", usage: "trace exporter: none, otlp or file", field: func(cfg *Config) any { return &cfg.Traces.Exporter }},
+	{env: "TL_SERVER_TRACES_FILE", flag: "traces-file", usage: "file written by the file trace exporter", field: func(cfg *Config) any { return &cfg.Traces.File }},
+}
+
+// set parses a value of the setting from the environment or the flags
+func (s setting) set(cfg *Config, value string) error {
+	switch field := s.field(cfg).(type) {
+	case *string:
+		*field = value
+	case *DropPolicy:
+		*field = DropPolicy(value)
+	case *int:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("%q is not an integer", value)
+		}
+		*field = n
+	case *bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("%q is not true or false", value)
+		}
+		*field = b
+	case *time.Duration:
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("%q is not a duration such as 30s or 5m", value)
+		}
+		*field = d
+	case *[]string:
+		*field = nil
+		for item := range strings.SplitSeq(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				*field = append(*field, item)
+			}
+		}
+	default:
+		return fmt.Errorf("unsupported setting type %T", field)
+	}
+	return nil
+}
+
+// loadConfig reads the configuration from, in increasing order of precedence, the
+// defaults, the configuration file, the environment and the command line flags.
+// It reports every invalid setting at once. printConfig is true when the --print-config
+// flag asks for the configuration to be printed instead of starting the server.
+func loadConfig(args []string, lookupEnv func(string) (string, bool)) (cfg Config, printConfig bool, err error) {
+	fs := flag.NewFlagSet("server", flag.ContinueOnError)
+	configFile := fs.String("config", "", fmt.Sprintf("YAML or TOML configuration file (%s)", ConfigFileEnv))
+	fs.BoolVar(&printConfig, "print-config", false, "print the effective configuration as YAML and exit")
+
+	// Flag values are applied after the file and the environment, in the order given
+	type flagValue struct {
+		setting setting
+		value   string
+	}
+	var flagValues []flagValue
+	for _, s := range settings {
+		usage := fmt.Sprintf("%s (%s)", s.usage, s.env)
+		record := func(value string) error {
+			flagValues = append(flagValues, flagValue{setting: s, value: value})
+			return nil
+		}
+		if _, ok := s.field(&cfg).(*bool); ok {
+			fs.BoolFunc(s.flag, usage, record)
+		} else {
+			fs.Func(s.flag, usage, record)
+		}
+	}
+	if err := fs.Parse(args); err != nil {
+		return cfg, false, err
+	}
+	if fs.NArg() > 0 {
+		return cfg, false, fmt.Errorf("unexpected arguments: %s", strings.Join(fs.Args(), " "))
+	}
+
+	cfg = defaultConfig()
+	var errs []error
+
+	if *configFile == "" {
+		*configFile, _ = lookupEnv(ConfigFileEnv)
+	}
+	if *configFile != "" {
+		if err := readConfigFile(*configFile, &cfg); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	for _, s := range settings {
+		value, ok := lookupEnv(s.env)
+		if s.secret {
+			path, fromFile := lookupEnv(s.env + "_FILE")
+			if fromFile && path != "" {
+				if ok && value != "" {
+					errs = append(errs, fmt.Errorf("%s and %s_FILE are both set", s.env, s.env))
+					continue
+				}
+				secret, err := os.ReadFile(path)
+				if err != nil {
+					errs = append(errs, fmt.Errorf("%s_FILE: %w", s.env, err))
+					continue
+				}
+				value, ok = strings.TrimSpace(string(secret)), true
+			}
+		}
+		if !ok || value == "" {
+			continue
+		}
+		if err := s.set(&cfg, value); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", s.env, err))
+		}
+	}
+
+	for _, v := range flagValues {
+		if err := v.setting.set(&cfg, v.value); err != nil {
+			errs = append(errs, fmt.Errorf("--%s: %w", v.setting.flag, err))
+		}
+	}
+
+	errs = append(errs, cfg.validate()...)
+	return cfg, printConfig, errors.Join(errs...)
+}
+
+// readConfigFile decodes a YAML or TOML file, chosen by its extension, over cfg.
+// Unknown keys are errors, so that misspelled settings do not go unnoticed.
+func readConfigFile(path string, cfg *Config) error {
+	var decode func(data []byte) error
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		decode = func(data []byte) error { return yaml.UnmarshalStrict(data, cfg) }
+	case ".toml":
+		decode = func(data []byte) error {
+			meta, err := toml.Decode(string(data), cfg)
+			if err != nil {
+				return err
+			}
+			if undecoded := meta.Undecoded(); len(undecoded) > 0 {
+				return fmt.Errorf("unknown keys %v", undecoded)
+			}
+			return nil
+		}
+	default:
+		return fmt.Errorf("unsupported config file format %q (use .yaml, .yml or .toml)", ext)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+	if err := decode(data); err != nil {
+		return fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// validate returns an error for every setting with an invalid value
+func (cfg Config) validate() []error {
+	var errs []error
+	invalid := func(key, format string, args ...any) {
+		errs = append(errs, fmt.Errorf("%s %s", key, fmt.Sprintf(format, args...)))
+	}
+
+	if cfg.DatabaseURL == "" {
+		invalid("database_url", "is required (set DATABASE_URL or DATABASE_URL_FILE)")
+	}
+	if cfg.Port < 1 || cfg.Port > 65535 {
+		invalid("port", "must be between 1 and 65535, got %d", cfg.Port)
+	}
+	for _, path := range []struct{ key, value string }{
+		{"base_path", cfg.BasePath},
+		{"mcp_path", cfg.MCPPath},
+		{"metrics_path", cfg.MetricsPath},
+	} {
+		if !strings.HasPrefix(path.value, "/") {
+			invalid(path.key, "must start with /, got %q", path.value)
+		}
+	}
+	if len(cfg.CORS.AllowOrigins) == 0 {
+		invalid("cors.allow_origins", "must list at least one origin")
+	}
+	if cfg.Events.QueueSize <= 0 {
+		invalid("events.queue_size", "must be positive, got %d", cfg.Events.QueueSize)
+	}
+	if _, err := ParseDropPolicy(string(cfg.Events.DropPolicy)); err != nil {
+		invalid("events.drop_policy", "is invalid: %v", err)
+	}
+	for _, duration := range []struct {
+		key   string
+		value time.Duration
+	}{
+		{"events.keepalive_interval", cfg.Events.KeepaliveInterval},
+		{"sessions.idle_timeout", cfg.Sessions.IdleTimeout},
+		{"sessions.reap_interval", cfg.Sessions.ReapInterval},
+	} {
+		if duration.value <= 0 {
+			invalid(duration.key, "must be a positive duration, got %s", duration.value)
+		}
+	}
+	if cfg.Posts.DefaultLimit < 1 || cfg.Posts.DefaultLimit > database.MaxPostsLimit {
+		invalid("posts.default_limit", "must be between 1 and %d, got %d", database.MaxPostsLimit, cfg.Posts.DefaultLimit)
+	}
+	if cfg.Posts.MaxLength < 1 || cfg.Posts.MaxLength > database.ContentMaxLength {
+		invalid("posts.max_length", "must be between 1 and %d, got %d", database.ContentMaxLength, cfg.Posts.MaxLength)
+	}
+	switch cfg.Traces.Exporter {
+	case TracesExporterNone, TracesExporterOTLP:
+	case TracesExporterFile:
+		if cfg.Traces.File == "" {
+			invalid("traces.file", "is required by the %s exporter", TracesExporterFile)
+		}
+	default:
+		invalid("traces.exporter", "must be %s, %s or %s, got %q", TracesExporterNone, TracesExporterOTLP, TracesExporterFile, cfg.Traces.Exporter)
+	}
+	return errs
+}
+
+// passwordPattern matches the password of a keyword/value connection string
+var passwordPattern = regexp.MustCompile(`password=\S+`)
+
+// redactDatabaseURL hides the password of a database URL or connection string
+func redactDatabaseURL(dbURL string) string {
+	u, err := url.Parse(dbURL)
+	if err != nil || u.Scheme == "" {
+		return passwordPattern.ReplaceAllString(dbURL, "password=xxxxx")
+	}
+	if query := u.Query(); query.Has("password") {
+		query.Set("password", "xxxxx")
+		u.RawQuery = query.Encode()
+	}
+	return u.Redacted()
+}
+
+// Redacted returns the configuration as YAML without the database password
+func (cfg Config) Redacted() ([]byte, error) {
+	cfg.DatabaseURL = redactDatabaseURL(cfg.DatabaseURL)
+	return yaml.Marshal(cfg)
+}
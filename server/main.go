@@ -3,39 +3,278 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"log/slog"
 	"net/http"
 	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/kmio11/agent-timeline-mcp/internal/database"
+	"github.com/kmio11/agent-timeline-mcp/internal/mcpserver"
+	"github.com/kmio11/agent-timeline-mcp/internal/timeline"
 	ui "github.com/kmio11/agent-timeline-mcp/timeline-gui"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/labstack/echo/otelecho"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// SSE stream settings
+const (
+	// SSERetryInterval is the reconnection delay suggested to clients with the retry field
+	SSERetryInterval = 3 * time.Second
+	// SSEReplayMaxPosts limits the missed posts replayed to a resuming client
+	SSEReplayMaxPosts = 500
+	// SSEReplayOverlap is how long before the last post a client saw a resumed stream
+	// replays posts from again, for posts that became visible after posts with greater
+	// IDs because their transaction took longer
+	SSEReplayOverlap = time.Minute
+	// SSEKeepaliveInterval is the default time between keepalive comments
+	SSEKeepaliveInterval = 30 * time.Second
+)
+
+// SSE event names, sent in the event field of every message. The data of every event
+// is a JSON object whose type field repeats the name.
+const (
+	SSEEventConnected      = "connected"
+	SSEEventReplayed       = "replayed"
+	SSEEventNewPost        = "new_post"
+	SSEEventPostUpdated    = "post_updated"
+	SSEEventMention        = "mention"
+	SSEEventAgentSignedIn  = "agent_signed_in"
+	SSEEventAgentSignedOut = "agent_signed_out"
+	SSEEventResyncRequired = "resync_required"
+	// SSEEventPostDeleted is reserved for deleted posts. Posts cannot be deleted through
+	// the API or MCP, so it is never sent.
+	SSEEventPostDeleted = "post_deleted"
+)
+
+// SSEEvent is a message queued for an SSE client
+type SSEEvent struct {
+	// PostID is the ID of the post announced by a new_post event, 0 for other events
+	PostID int
+	// Name is the event name, one of the SSEEvent constants
+	Name string
+	Data []byte
+	// Subject is what the event is about, or nil for events sent to every client
+	Subject *SSESubject
+	// Key identifies what an event describes the latest state of, such as one post for
+	// post_updated events. The coalesce drop policy keeps only the newest event per key.
+	Key string
+	// Dropped is the number of events lost before a resync_required event
+	Dropped int
+	// SpanContext identifies the span that broadcast the event, the parent of the span writing it
+	SpanContext trace.SpanContext
+}
+
+// PostEvent is the data of new_post, post_updated and mention events
+type PostEvent struct {
+	Type      string         `json:"type"`
+	Timestamp time.Time      `json:"timestamp"`
+	Post      *database.Post `json:"post"`
+	// Reaction is the change that updated the post, set for post_updated events
+	Reaction *ReactionChange `json:"reaction,omitempty"`
+	// MentionedAgent is the agent the post mentions, set for mention events
+	MentionedAgent *database.Agent `json:"mentioned_agent,omitempty"`
+}
+
+// ReactionChange describes a reaction added to or removed from a post
+type ReactionChange struct {
+	Action      string `json:"action"`
+	Emoji       string `json:"emoji"`
+	ReactorType string `json:"reactor_type"`
+	Reactor     string `json:"reactor"`
+}
+
+// AgentEvent is the data of agent_signed_in and agent_signed_out events
+type AgentEvent struct {
+	Type      string            `json:"type"`
+	Timestamp time.Time         `json:"timestamp"`
+	Session   *database.Session `json:"session"`
+}
+
+// ResyncEvent is the data of resync_required events
+type ResyncEvent struct {
+	Type string `json:"type"`
+	// Policy is the drop policy that discarded the events
+	Policy DropPolicy `json:"policy"`
+	// Dropped is the number of events the client missed
+	Dropped int `json:"dropped"`
+	// SinceID is the latest post the SSE stream announced before the gap, unset for WebSocket clients
+	SinceID *int `json:"since_id,omitempty"`
+}
+
+// newResyncEvent returns the data of a resync_required event popped from a client queue
+func newResyncEvent(queue *EventQueue, event SSEEvent, sinceID *int) ([]byte, error) {
+	return json.Marshal(ResyncEvent{Type: SSEEventResyncRequired, Policy: queue.Policy(), Dropped: event.Dropped, SinceID: sinceID})
+}
+
 // SSEClient represents a connected SSE client
 type SSEClient struct {
-	ID       string
-	Channel  chan []byte
+	ID string
+	// Queue holds the events waiting to be written to the client
+	Queue    *EventQueue
 	Request  *http.Request
 	Response http.ResponseWriter
 	Flusher  http.Flusher
+	// Filter selects the events the client receives
+	Filter SSEFilter
+	// Subscriptions replaces Filter for clients holding several filters at once, like
+	// WebSocket connections. They receive the events matching any subscription.
+	Subscriptions *Subscriptions
+}
+
+// wants reports whether the client receives events about the subject
+func (c *SSEClient) wants(subject SSESubject) bool {
+	if c.Subscriptions != nil {
+		return len(c.Subscriptions.Matching(subject)) > 0
+	}
+	return c.Filter.Matches(subject)
+}
+
+// SSEFilter selects the events an SSE client receives, with the filters of GET /posts.
+// Zero values match every event.
+type SSEFilter struct {
+	AgentID     *int
+	IdentityKey string
+	// Channel only matches events in the timeline channel with this slug
+	Channel string
+	// Tag only matches posts with this normalized hashtag
+	Tag string
+	// Text only matches posts whose content contains it, ignoring case
+	Text string
+}
+
+// SSESubject describes what an event is about. Events about an agent rather than
+// a post have no tags or content, so tag and text filters never match them.
+type SSESubject struct {
+	AgentID     int
+	IdentityKey string
+	Channel     string
+	Tags        []string
+	Content     string
+}
+
+// postSubject returns the subject of events about a post
+func postSubject(post *database.Post) SSESubject {
+	return SSESubject{
+		AgentID:     post.AgentID,
+		IdentityKey: post.IdentityKey,
+		Channel:     post.Channel,
+		Tags:        post.Tags,
+		Content:     post.Content,
+	}
+}
+
+// mentionSubject returns the subject of the mention of an agent in a post. It is the
+// mentioned agent rather than the author, so that agents can filter on their own mentions.
+func mentionSubject(post *database.Post, agent *database.Agent) SSESubject {
+	subject := postSubject(post)
+	subject.AgentID = agent.ID
+	subject.IdentityKey = agent.IdentityKey
+	return subject
+}
+
+// sessionSubject returns the subject of events about the agent of a session
+func sessionSubject(session *database.Session) SSESubject {
+	return SSESubject{
+		AgentID:     session.AgentID,
+		IdentityKey: session.IdentityKey,
+		Channel:     session.Channel,
+	}
+}
+
+// postKey returns the coalescing key of events about the state of a post
+func postKey(post *database.Post) string {
+	return fmt.Sprintf("post:%d", post.ID)
+}
+
+// sessionKey returns the coalescing key of events about the state of a session
+func sessionKey(session *database.Session) string {
+	return fmt.Sprintf("session:%d", session.ID)
+}
+
+// Matches reports whether an event about the subject passes the filter
+func (f SSEFilter) Matches(subject SSESubject) bool {
+	return (f.AgentID == nil || *f.AgentID == subject.AgentID) &&
+		(f.IdentityKey == "" || f.IdentityKey == subject.IdentityKey) &&
+		(f.Channel == "" || f.Channel == subject.Channel) &&
+		(f.Tag == "" || slices.Contains(subject.Tags, f.Tag)) &&
+		(f.Text == "" || strings.Contains(strings.ToLower(subject.Content), strings.ToLower(f.Text)))
+}
+
+// postQuery returns the post filters of a replay matching the filter
+func (f SSEFilter) postQuery() database.PostQuery {
+	return database.PostQuery{
+		AgentID:     f.AgentID,
+		IdentityKey: f.IdentityKey,
+		Channel:     f.Channel,
+		Tag:         f.Tag,
+		Text:        f.Text,
+	}
+}
+
+// parseSSEFilter reads the event filters from the query string. The channel may also
+// come from the :slug path parameter.
+func parseSSEFilter(c echo.Context) (SSEFilter, error) {
+	filter := SSEFilter{
+		IdentityKey: c.QueryParam("identity_key"),
+		Channel:     channelFilter(c),
+		Tag:         database.NormalizeTag(c.QueryParam("tag")),
+		Text:        strings.TrimSpace(c.QueryParam("q")),
+	}
+	if agentIDStr := c.QueryParam("agent_id"); agentIDStr != "" {
+		agentID, err := strconv.Atoi(agentIDStr)
+		if err != nil {
+			return filter, fmt.Errorf("invalid agent_id: %s", agentIDStr)
+		}
+		filter.AgentID = &agentID
+	}
+	return filter, nil
 }
 
 // SSEBroadcaster manages SSE connections
 type SSEBroadcaster struct {
-	clients map[string]*SSEClient
-	mutex   sync.RWMutex
+	clients    map[string]*SSEClient
+	mutex      sync.RWMutex
+	queueSize  int
+	dropPolicy DropPolicy
 }
 
 // NewSSEBroadcaster creates a new SSE broadcaster
 func NewSSEBroadcaster() *SSEBroadcaster {
 	return &SSEBroadcaster{
-		clients: make(map[string]*SSEClient),
+		clients:    make(map[string]*SSEClient),
+		queueSize:  SSEQueueSize,
+		dropPolicy: DropOldest,
+	}
+}
+
+// SetQueue sets the size and the default drop policy of the queues created by NewQueue
+func (b *SSEBroadcaster) SetQueue(size int, policy DropPolicy) {
+	b.queueSize = size
+	b.dropPolicy = policy
+}
+
+// NewQueue creates the event queue of a new client. An empty policy selects the default.
+func (b *SSEBroadcaster) NewQueue(policy DropPolicy) *EventQueue {
+	if policy == "" {
+		policy = b.dropPolicy
 	}
+	return NewEventQueue(b.queueSize, policy)
 }
 
 // AddClient adds a new SSE client
@@ -43,6 +282,7 @@ func (b *SSEBroadcaster) AddClient(client *SSEClient) {
 	b.mutex.Lock()
 	defer b.mutex.Unlock()
 	b.clients[client.ID] = client
+	sseClients.Inc()
 	slog.Info("SSE client connected", "client_id", client.ID)
 }
 
@@ -51,68 +291,338 @@ func (b *SSEBroadcaster) RemoveClient(clientID string) {
 	b.mutex.Lock()
 	defer b.mutex.Unlock()
 	if client, exists := b.clients[clientID]; exists {
-		close(client.Channel)
+		client.Queue.Close()
 		delete(b.clients, clientID)
+		sseClients.Dec()
 		slog.Info("SSE client disconnected", "client_id", clientID)
 	}
 }
 
-// Broadcast sends data to all connected clients
-func (b *SSEBroadcaster) Broadcast(data []byte) {
+// Broadcast sends an event to all connected clients. The context carries the trace
+// the broadcast span joins, like those of the other Broadcast methods.
+func (b *SSEBroadcaster) Broadcast(ctx context.Context, name string, data []byte) {
+	b.send(ctx, SSEEvent{Name: name, Data: data}, func(*SSEClient) bool { return true })
+}
+
+// BroadcastPost sends an event about a post or agent to the clients whose filters match the subject
+func (b *SSEBroadcaster) BroadcastPost(ctx context.Context, name string, data []byte, subject SSESubject) {
+	b.broadcastPost(ctx, SSEEvent{Name: name, Data: data}, subject)
+}
+
+// BroadcastUpdate sends an event like BroadcastPost. The event describes the latest
+// state of what the key names, so it may replace a queued event with the same key.
+func (b *SSEBroadcaster) BroadcastUpdate(ctx context.Context, name, key string, data []byte, subject SSESubject) {
+	b.broadcastPost(ctx, SSEEvent{Name: name, Data: data, Key: key}, subject)
+}
+
+// BroadcastNewPost sends the new_post event of a post like BroadcastPost. The post ID
+// becomes the event ID, which resuming clients send back as Last-Event-ID.
+func (b *SSEBroadcaster) BroadcastNewPost(ctx context.Context, postID int, data []byte, subject SSESubject) {
+	b.broadcastPost(ctx, SSEEvent{PostID: postID, Name: SSEEventNewPost, Data: data}, subject)
+}
+
+// BroadcastResync sends every client a resync_required event for events lost before
+// they reached the broadcaster
+func (b *SSEBroadcaster) BroadcastResync(ctx context.Context, dropped int) {
+	_, span := tracer.Start(ctx, "broadcast "+SSEEventResyncRequired)
+	defer span.End()
+
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+	for _, client := range b.clients {
+		client.Queue.MarkLost(dropped)
+	}
+	span.SetAttributes(
+		attribute.Int("timeline.recipients", len(b.clients)),
+		attribute.Int("timeline.dropped_events", dropped),
+	)
+}
+
+func (b *SSEBroadcaster) broadcastPost(ctx context.Context, event SSEEvent, subject SSESubject) {
+	event.Subject = &subject
+	b.send(ctx, event, func(client *SSEClient) bool {
+		return client.wants(subject)
+	})
+}
+
+func (b *SSEBroadcaster) send(ctx context.Context, event SSEEvent, wants func(*SSEClient) bool) {
+	_, span := tracer.Start(ctx, "broadcast "+event.Name)
+	defer span.End()
+	event.SpanContext = span.SpanContext()
+
 	b.mutex.RLock()
 	defer b.mutex.RUnlock()
 
+	recipients, lost := 0, 0
 	for clientID, client := range b.clients {
-		select {
-		case client.Channel <- data:
-			// Successfully sent
-		default:
-			// Client channel is full, remove client
-			slog.Warn("SSE client channel full, removing", "client_id", clientID)
-			go b.RemoveClient(clientID)
+		if !wants(client) {
+			continue
+		}
+		recipients++
+		// Pushing never blocks; a client that falls behind loses events by its drop policy
+		dropped, started := client.Queue.Push(event)
+		if dropped > 0 {
+			lost += dropped
+			sseDroppedEvents.WithLabelValues(string(client.Queue.Policy())).Add(float64(dropped))
+		}
+		if started {
+			slog.Warn("SSE client queue full, dropping events", "client_id", clientID, "policy", client.Queue.Policy())
+		}
+	}
+	span.SetAttributes(
+		attribute.Int("timeline.post_id", event.PostID),
+		attribute.Int("timeline.recipients", recipients),
+		attribute.Int("timeline.dropped_events", lost),
+	)
+}
+
+// newPostEvent returns the data of the new_post event announcing a post
+func newPostEvent(post *database.Post) ([]byte, error) {
+	return json.Marshal(PostEvent{Type: SSEEventNewPost, Timestamp: post.Timestamp, Post: post})
+}
+
+// handleNotification broadcasts the events of a database notification
+func handleNotification(ctx context.Context, db DatabaseInterface, broadcaster *SSEBroadcaster, payload *database.NotificationPayload) error {
+	if payload.Operation == database.NotificationResync {
+		broadcaster.BroadcastResync(ctx, payload.Missed)
+		return nil
+	}
+	switch payload.Table {
+	case database.NotificationTableSessions:
+		if payload.Operation == database.NotificationUpdate {
+			return broadcastSessionEnded(ctx, db, broadcaster, payload.SessionID)
+		}
+		return broadcastSessionStarted(ctx, db, broadcaster, payload.SessionID)
+	case database.NotificationTableReactions:
+		return broadcastReaction(ctx, db, broadcaster, payload)
+	}
+	return broadcastNewPost(ctx, db, broadcaster, payload.PostID)
+}
+
+// broadcastNewPost sends the new_post event of a post and its mention events. The post
+// is read back, since notifications do not carry the agent or reactions.
+func broadcastNewPost(ctx context.Context, db DatabaseInterface, broadcaster *SSEBroadcaster, postID int) error {
+	post, err := db.GetPost(ctx, postID)
+	if err != nil {
+		return fmt.Errorf("failed to get post: %w", err)
+	}
+	if post == nil {
+		return fmt.Errorf("post %d not found", postID)
+	}
+
+	data, err := newPostEvent(post)
+	if err != nil {
+		return fmt.Errorf("failed to marshal notification: %w", err)
+	}
+
+	broadcaster.BroadcastNewPost(ctx, post.ID, data, postSubject(post))
+	broadcastLag.Observe(time.Since(post.Timestamp).Seconds())
+	slog.Debug("Broadcasted new post notification", "post_id", post.ID, "agent_id", post.AgentID, "channel", post.Channel)
+
+	return broadcastMentions(ctx, db, broadcaster, post)
+}
+
+// broadcastMentions sends a mention event for every agent mentioned in a new post
+func broadcastMentions(ctx context.Context, db DatabaseInterface, broadcaster *SSEBroadcaster, post *database.Post) error {
+	if !strings.Contains(post.Content, "@") {
+		return nil
+	}
+
+	agents, err := db.GetMentionedAgents(ctx, post.ID)
+	if err != nil {
+		return fmt.Errorf("failed to get mentioned agents: %w", err)
+	}
+
+	for _, agent := range agents {
+		data, err := json.Marshal(PostEvent{
+			Type:           SSEEventMention,
+			Timestamp:      post.Timestamp,
+			Post:           post,
+			MentionedAgent: &agent,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to marshal mention: %w", err)
 		}
+		broadcaster.BroadcastPost(ctx, SSEEventMention, data, mentionSubject(post, &agent))
+	}
+
+	return nil
+}
+
+// broadcastReaction sends the post_updated event of a reaction change with the post
+// as it is after the change
+func broadcastReaction(ctx context.Context, db DatabaseInterface, broadcaster *SSEBroadcaster, payload *database.NotificationPayload) error {
+	post, err := db.GetPost(ctx, payload.PostID)
+	if err != nil {
+		return fmt.Errorf("failed to get post: %w", err)
+	}
+	if post == nil {
+		return fmt.Errorf("post %d not found", payload.PostID)
+	}
+
+	action := "added"
+	if payload.Operation == database.NotificationDelete {
+		action = "removed"
+	}
+	data, err := json.Marshal(PostEvent{
+		Type:      SSEEventPostUpdated,
+		Timestamp: payload.Timestamp,
+		Post:      post,
+		Reaction: &ReactionChange{
+			Action:      action,
+			Emoji:       payload.Emoji,
+			ReactorType: payload.ReactorType,
+			Reactor:     payload.Reactor,
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal reaction event: %w", err)
+	}
+	broadcaster.BroadcastUpdate(ctx, SSEEventPostUpdated, postKey(post), data, postSubject(post))
+
+	return nil
+}
+
+// broadcastSessionStarted sends the agent_signed_in event of a new session
+func broadcastSessionStarted(ctx context.Context, db DatabaseInterface, broadcaster *SSEBroadcaster, sessionID int) error {
+	sessions, err := db.GetSessions(ctx, database.SessionQuery{IDs: []int{sessionID}, Limit: 1})
+	if err != nil {
+		return fmt.Errorf("failed to get session: %w", err)
+	}
+	if len(sessions) == 0 {
+		return fmt.Errorf("session %d not found", sessionID)
+	}
+	session := &sessions[0]
+
+	data, err := json.Marshal(AgentEvent{Type: SSEEventAgentSignedIn, Timestamp: session.StartedAt, Session: session})
+	if err != nil {
+		return fmt.Errorf("failed to marshal agent_signed_in event: %w", err)
+	}
+	broadcaster.BroadcastUpdate(ctx, SSEEventAgentSignedIn, sessionKey(session), data, sessionSubject(session))
+
+	return nil
+}
+
+// broadcastSessionEnded sends the agent_signed_out event of an ended session
+func broadcastSessionEnded(ctx context.Context, db DatabaseInterface, broadcaster *SSEBroadcaster, sessionID int) error {
+	sessions, err := db.GetSessions(ctx, database.SessionQuery{IDs: []int{sessionID}, Limit: 1})
+	if err != nil {
+		return fmt.Errorf("failed to get session: %w", err)
+	}
+	if len(sessions) == 0 {
+		return fmt.Errorf("session %d not found", sessionID)
 	}
+	session := &sessions[0]
+
+	timestamp := session.LastSeenAt
+	if session.EndedAt != nil {
+		timestamp = *session.EndedAt
+	}
+	data, err := json.Marshal(AgentEvent{Type: SSEEventAgentSignedOut, Timestamp: timestamp, Session: session})
+	if err != nil {
+		return fmt.Errorf("failed to marshal agent_signed_out event: %w", err)
+	}
+	broadcaster.BroadcastUpdate(ctx, SSEEventAgentSignedOut, sessionKey(session), data, sessionSubject(session))
+
+	return nil
 }
 
 // DatabaseInterface defines the methods required for database operations
 type DatabaseInterface interface {
 	Ping(ctx context.Context) error
-	GetPosts(ctx context.Context, limit int, after *time.Time) ([]database.Post, error)
+	GetPosts(ctx context.Context, query database.PostQuery) ([]database.Post, error)
+	GetPost(ctx context.Context, id int) (*database.Post, error)
+	SearchPosts(ctx context.Context, query database.SearchQuery) ([]database.SearchResult, error)
+	GetTags(ctx context.Context, query database.TagQuery) ([]database.TagSummary, error)
+	GetThread(ctx context.Context, postID int) ([]database.Post, error)
 	StartNotifications(ctx context.Context) error
 	StopNotifications()
 	AddNotificationHandler(channel string, handler database.NotificationHandler)
+	NotificationStatus() database.NotificationStatus
+	CreateAgent(ctx context.Context, params database.CreateAgentParams) (*database.Agent, error)
+	GetAgentByIdentityKey(ctx context.Context, identityKey string) (*database.Agent, error)
+	CreateSession(ctx context.Context, params database.CreateSessionParams) (*database.Session, error)
+	GetSession(ctx context.Context, token string) (*database.Session, error)
+	GetSessions(ctx context.Context, query database.SessionQuery) ([]database.Session, error)
+	TouchSession(ctx context.Context, token string) (bool, error)
+	EndSession(ctx context.Context, token string, reason string) (bool, error)
+	ExpireSessions(ctx context.Context, idleSince time.Time, reason string) ([]database.Session, error)
+	CreatePost(ctx context.Context, params database.CreatePostParams) (*database.Post, error)
+	SetReaction(ctx context.Context, params database.ReactionParams) error
+	DeleteReaction(ctx context.Context, params database.ReactionParams) (bool, error)
+	GetAgent(ctx context.Context, id int) (*database.Agent, error)
+	GetAgentSummaries(ctx context.Context, query database.AgentQuery) ([]database.AgentSummary, error)
+	GetMentions(ctx context.Context, query database.MentionQuery) ([]database.Mention, error)
+	CountUnreadMentions(ctx context.Context, agentID int) (int, error)
+	MarkMentionsRead(ctx context.Context, agentID int, postIDs []int) (int, error)
+	GetMentionedAgents(ctx context.Context, postID int) ([]database.Agent, error)
+	UpdateAgentChannel(ctx context.Context, agentID int, channelID *int) error
+	CreateChannel(ctx context.Context, params database.CreateChannelParams) (*database.Channel, error)
+	GetChannelBySlug(ctx context.Context, slug string) (*database.Channel, error)
+	GetChannels(ctx context.Context) ([]database.Channel, error)
 	Close()
 }
 
-// Ensure that *database.Database implements the DatabaseInterface
-var _ DatabaseInterface = (*database.Database)(nil)
+// Ensure that every storage backend implements the DatabaseInterface
+var _ DatabaseInterface = (database.Store)(nil)
 
 type ApiHandler struct {
 	db          DatabaseInterface
+	service     *timeline.Service
 	broadcaster *SSEBroadcaster
+	// defaultLimit is the page size of requests without a limit, DefaultPostsLimit when zero
+	defaultLimit int
+	// keepaliveInterval is the time between SSE keepalive comments, SSEKeepaliveInterval when zero
+	keepaliveInterval time.Duration
+	// allowOrigins lists the origins that may open WebSocket connections, any when empty
+	allowOrigins []string
 }
 
-func getEnv(key, fallback string) string {
-	value := os.Getenv(key)
-	if value == "" {
-		return fallback
-	}
-	return value
-}
-func mustGetEnv(key string) string {
-	value := os.Getenv(key)
-	if value == "" {
-		panic(fmt.Sprintf("Environment variable %s is required but not set", key))
-	}
-	return value
+// useMiddleware installs the middleware of every route. The metrics middleware wraps
+// Recover, so that requests whose handler panicked are counted with status 500.
+func useMiddleware(e *echo.Echo, allowOrigins []string) {
+	e.Use(otelecho.Middleware(TracingServiceName))
+	e.Use(middleware.Logger())
+	e.Use(metricsMiddleware)
+	e.Use(middleware.Recover())
+	e.Use(middleware.CORSWithConfig(middleware.CORSConfig{
+		AllowOrigins:  allowOrigins,
+		ExposeHeaders: []string{mcpserver.SessionIDHeader},
+	}))
 }
 
 func main() {
-	dbURL := mustGetEnv("DATABASE_URL")
-	port := getEnv("TL_SERVER_PORT", "3001")
-	apiBasePath := getEnv("TL_SERVER_BASE_PATH", "/api")
+	cfg, printConfig, err := loadConfig(os.Args[1:], os.LookupEnv)
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		// Report every invalid setting on its own line
+		for _, message := range strings.Split(err.Error(), "\n") {
+			slog.Error("Invalid configuration", "error", message)
+		}
+		os.Exit(1)
+	}
+	if printConfig {
+		out, err := cfg.Redacted()
+		if err != nil {
+			slog.Error("Unable to print configuration", "error", err)
+			os.Exit(1)
+		}
+		os.Stdout.Write(out)
+		return
+	}
+	port := strconv.Itoa(cfg.Port)
+	apiBasePath := cfg.BasePath
+
+	shutdownTracing, err := setupTracing(context.Background(), cfg.Traces.Exporter, cfg.Traces.File)
+	if err != nil {
+		slog.Error("Unable to set up tracing", "error", err)
+		os.Exit(1)
+	}
+	defer shutdownTracing(context.Background())
 
-	db, err := database.NewDatabase(context.Background(), dbURL)
+	db, err := database.Open(context.Background(), cfg.DatabaseURL)
 	if err != nil {
 		slog.Error("Unable to connect to database", "error", err)
 		os.Exit(1)
@@ -121,26 +631,43 @@ func main() {
 
 	slog.Info("Successfully connected to the database")
 
+	// Bring the schema up to date when requested, then refuse to start on a mismatched schema
+	if cfg.AutoMigrate {
+		applied, err := db.MigrateUp(context.Background())
+		if err != nil {
+			slog.Error("Failed to apply database migrations", "error", err)
+			os.Exit(1)
+		}
+		for _, migration := range applied {
+			slog.Info("Applied database migration", "version", migration.Version, "name", migration.Name)
+		}
+	}
+	if err := database.CheckSchema(context.Background(), db); err != nil {
+		slog.Error("Database schema check failed", "error", err)
+		os.Exit(1)
+	}
+
+	// Export the connection pool statistics with the other metrics
+	prometheus.MustRegister(db.Collector())
+
 	// Create SSE broadcaster
 	broadcaster := NewSSEBroadcaster()
+	broadcaster.SetQueue(cfg.Events.QueueSize, cfg.Events.DropPolicy)
 
-	// Set up notification handler
-	db.AddNotificationHandler("timeline_posts", func(payload *database.NotificationPayload) error {
-		// Broadcast the notification to all SSE clients
-		data, err := json.Marshal(map[string]interface{}{
-			"type":      "new_post",
-			"timestamp": payload.Timestamp,
-			"post_id":   payload.PostID,
-			"agent_id":  payload.AgentID,
-			"content":   payload.Content,
-		})
-		if err != nil {
-			return fmt.Errorf("failed to marshal notification: %w", err)
-		}
+	// Create the timeline service shared by the REST API and all MCP sessions
+	service := timeline.NewService(db)
+	service.SetIdleTimeout(cfg.Sessions.IdleTimeout)
+	service.SetContentMaxLength(cfg.Posts.MaxLength)
+	service.StartSessionCleanup(context.Background(), timeline.SessionCleanupInterval)
 
-		broadcaster.Broadcast(data)
-		slog.Debug("Broadcasted new post notification", "post_id", payload.PostID, "agent_id", payload.AgentID)
-		return nil
+	// Set up notification handlers. Sessions ended by any process leave the session cache.
+	db.AddNotificationHandler(database.NotificationChannel, service.HandleNotification)
+	db.AddNotificationHandler(database.NotificationChannel, func(ctx context.Context, payload *database.NotificationPayload) error {
+		if payload.EndReason == database.SessionEndIdleTimeout && !cfg.Sessions.ReapEvents {
+			return nil
+		}
+		// Broadcast the notification to the SSE clients whose filters match it
+		return handleNotification(ctx, db, broadcaster, payload)
 	})
 
 	// Start listening for notifications
@@ -149,28 +676,58 @@ func main() {
 		os.Exit(1)
 	}
 
+	// Expire sessions of agents that stopped without signing out
+	service.StartSessionReaper(context.Background(), timeline.ReaperConfig{Interval: cfg.Sessions.ReapInterval, SystemPosts: cfg.Sessions.ReapPosts})
+	mcpHandler := mcpserver.NewStreamableHTTPHandler(mcpserver.NewServer(service), service.IdleTimeout())
+
 	e := echo.New()
 	e.HideBanner = true
 
 	handler := &ApiHandler{
-		db:          db,
-		broadcaster: broadcaster,
+		db:                db,
+		service:           service,
+		broadcaster:       broadcaster,
+		defaultLimit:      cfg.Posts.DefaultLimit,
+		keepaliveInterval: cfg.Events.KeepaliveInterval,
+		allowOrigins:      cfg.CORS.AllowOrigins,
 	}
 
-	e.Use(middleware.Logger())
-	e.Use(middleware.Recover())
-	e.Use(middleware.CORS())
+	useMiddleware(e, cfg.CORS.AllowOrigins)
 
 	withUI := ui.RegisterWebHandlers(e)
 	e.GET(fmt.Sprintf("%s/health", apiBasePath), handler.healthCheck)
 	e.GET(fmt.Sprintf("%s/posts", apiBasePath), handler.getPosts)
+	e.POST(fmt.Sprintf("%s/posts", apiBasePath), handler.createPost)
+	e.GET(fmt.Sprintf("%s/posts/:id/thread", apiBasePath), handler.getThread)
+	e.POST(fmt.Sprintf("%s/posts/:id/reactions", apiBasePath), handler.addReaction)
+	e.DELETE(fmt.Sprintf("%s/posts/:id/reactions", apiBasePath), handler.deleteReaction)
+	e.GET(fmt.Sprintf("%s/search", apiBasePath), handler.searchPosts)
+	e.GET(fmt.Sprintf("%s/tags", apiBasePath), handler.getTags)
+	e.GET(fmt.Sprintf("%s/channels", apiBasePath), handler.getChannels)
+	e.POST(fmt.Sprintf("%s/channels", apiBasePath), handler.createChannel)
+	e.GET(fmt.Sprintf("%s/channels/:slug/posts", apiBasePath), handler.getChannelPosts)
+	e.GET(fmt.Sprintf("%s/channels/:slug/events", apiBasePath), handler.channelEvents)
+	e.GET(fmt.Sprintf("%s/agents", apiBasePath), handler.getAgents)
+	e.GET(fmt.Sprintf("%s/agents/:id", apiBasePath), handler.getAgentSummary)
+	e.GET(fmt.Sprintf("%s/agents/:id/mentions", apiBasePath), handler.getMentions)
+	e.POST(fmt.Sprintf("%s/agents/:id/mentions/read", apiBasePath), handler.markMentionsRead)
+	e.GET(fmt.Sprintf("%s/agents/:id/sessions", apiBasePath), handler.getAgentSessions)
+	e.GET(fmt.Sprintf("%s/sessions", apiBasePath), handler.getSessions)
+	e.POST(fmt.Sprintf("%s/sessions", apiBasePath), handler.createSession)
+	e.DELETE(fmt.Sprintf("%s/sessions/:id", apiBasePath), handler.deleteSession)
 	e.GET(fmt.Sprintf("%s/events", apiBasePath), handler.sseHandler)
+	e.GET(fmt.Sprintf("%s/ws", apiBasePath), handler.wsHandler)
+	e.Any(cfg.MCPPath, echo.WrapHandler(mcpHandler))
+	e.GET(cfg.MetricsPath, echo.WrapHandler(promhttp.Handler()))
 
 	slog.Info("Timeline API server starting", "port", port, "api_base_path", apiBasePath)
 	if withUI {
 		slog.Info("Timeline UI server enabled", "url", fmt.Sprintf("http://localhost:%s/", port))
 	}
 	slog.Info("SSE endpoint available", "url", fmt.Sprintf("http://localhost:%s%s/events", port, apiBasePath))
+	slog.Info("WebSocket endpoint available", "url", fmt.Sprintf("ws://localhost:%s%s/ws", port, apiBasePath))
+	slog.Info("MCP endpoint available", "url", fmt.Sprintf("http://localhost:%s%s", port, cfg.MCPPath))
+	slog.Info("Metrics endpoint available", "url", fmt.Sprintf("http://localhost:%s%s", port, cfg.MetricsPath))
 	if err := e.Start(":" + port); err != nil {
 		slog.Error("Error starting server", "error", err)
 		os.Exit(1)
@@ -185,86 +742,1009 @@ func (h *ApiHandler) healthCheck(c echo.Context) error {
 		})
 	}
 
-	return c.JSON(http.StatusOK, map[string]string{"status": "healthy"})
+	// Without the notification listener posts can still be read and written, but
+	// /events and /ws clients receive no updates until it reconnects
+	notifications := h.db.NotificationStatus()
+	status := "healthy"
+	if !notifications.Listening {
+		status = "degraded"
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"status":        status,
+		"notifications": notifications,
+	})
+}
+
+// limit parses the limit query parameter, defaulting to the configured page size
+func (h *ApiHandler) limit(c echo.Context) int {
+	fallback := h.defaultLimit
+	if fallback == 0 {
+		fallback = database.DefaultPostsLimit
+	}
+	return database.ParseLimit(c.QueryParam("limit"), fallback)
 }
 
 func (h *ApiHandler) getPosts(c echo.Context) error {
-	limitStr := c.QueryParam("limit")
-	limit := database.ParseLimit(limitStr, 100)
+	limit := h.limit(c)
+	ctx := c.Request().Context()
 
-	// Support for "after" timestamp parameter for polling
-	afterStr := c.QueryParam("after")
-	after, err := database.ParseTimeFilter(afterStr)
-	if err != nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid after timestamp format. Use RFC3339 format."})
+	query := database.PostQuery{Limit: limit}
+	if err := parsePostFilters(c, &query); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
 	}
+	// q is also the search text of /api/search, but plain listings read it as a substring filter
+	query.Text = strings.TrimSpace(c.QueryParam("q"))
 
-	posts, err := h.db.GetPosts(c.Request().Context(), limit, after)
+	// around=<post_id> returns the context on both sides of a post
+	if aroundStr := c.QueryParam("around"); aroundStr != "" {
+		postID, err := strconv.Atoi(aroundStr)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid around post ID."})
+		}
+		page, err := database.GetPostsAround(ctx, h.db, postID, query)
+		if err != nil {
+			slog.Error("Error querying posts", "error", err)
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		}
+		if page == nil {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "Post not found."})
+		}
+		return c.JSON(http.StatusOK, page)
+	}
+
+	// "after" accepts a cursor, or an RFC3339 timestamp for polling
+	if afterStr := c.QueryParam("after"); afterStr != "" {
+		if newerThan, err := database.ParseTimeFilter(afterStr); err == nil {
+			query.NewerThan = newerThan
+		} else if cursor, err := database.ParseCursor(afterStr); err == nil {
+			query.After = cursor
+		} else {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid after parameter. Use a cursor or an RFC3339 timestamp."})
+		}
+	}
+
+	// "before" accepts a cursor, or a post ID for older clients
+	if beforeStr := c.QueryParam("before"); beforeStr != "" {
+		if postID, err := strconv.Atoi(beforeStr); err == nil {
+			post, err := h.db.GetPost(ctx, postID)
+			if err != nil {
+				slog.Error("Error querying post", "error", err, "post_id", postID)
+				return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			}
+			if post == nil {
+				return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid before parameter. Post not found."})
+			}
+			cursor := database.CursorFor(*post)
+			query.Before = &cursor
+		} else if cursor, err := database.ParseCursor(beforeStr); err == nil {
+			query.Before = cursor
+		} else {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid before parameter. Use a cursor or a post ID."})
+		}
+	}
+
+	if query.Before != nil && query.After != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Use either a before or an after cursor, not both."})
+	}
+
+	page, err := database.GetPostPage(ctx, h.db, query)
 	if err != nil {
 		slog.Error("Error querying posts", "error", err)
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
 	}
 
-	return c.JSON(http.StatusOK, map[string]any{
-		"posts": posts,
-		"count": len(posts),
-	})
+	return c.JSON(http.StatusOK, page)
 }
 
-// SSE handler for real-time updates
-func (h *ApiHandler) sseHandler(c echo.Context) error {
-	// Set SSE headers
-	c.Response().Header().Set("Content-Type", "text/event-stream")
-	c.Response().Header().Set("Cache-Control", "no-cache")
-	c.Response().Header().Set("Connection", "keep-alive")
-	c.Response().Header().Set("Access-Control-Allow-Origin", "*")
-
-	// Check if response writer supports flushing
-	flusher, ok := c.Response().Writer.(http.Flusher)
-	if !ok {
-		return c.JSON(http.StatusInternalServerError, map[string]string{
-			"error": "Server-Sent Events not supported",
-		})
+// getThread returns the whole conversation tree containing a post
+func (h *ApiHandler) getThread(c echo.Context) error {
+	postID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid post ID."})
 	}
 
-	// Create client
-	clientID := fmt.Sprintf("client_%d", time.Now().UnixNano())
-	client := &SSEClient{
-		ID:       clientID,
-		Channel:  make(chan []byte, 100), // Buffer for 100 messages
-		Request:  c.Request(),
-		Response: c.Response().Writer,
-		Flusher:  flusher,
+	posts, err := h.db.GetThread(c.Request().Context(), postID)
+	if err != nil {
+		slog.Error("Error querying thread", "error", err, "post_id", postID)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
 	}
 
-	// Add client to broadcaster
-	h.broadcaster.AddClient(client)
-	defer h.broadcaster.RemoveClient(clientID)
+	thread := database.NewThread(posts)
+	if thread == nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Post not found."})
+	}
 
-	// Send initial connection confirmation
-	fmt.Fprintf(c.Response(), "data: {\"type\":\"connected\",\"client_id\":\"%s\"}\n\n", clientID)
-	flusher.Flush()
+	return c.JSON(http.StatusOK, thread)
+}
 
-	// Create keepalive ticker to avoid memory leaks
-	keepaliveTicker := time.NewTicker(30 * time.Second)
-	defer keepaliveTicker.Stop()
+// searchPosts returns posts matching a full-text search, best match first
+func (h *ApiHandler) searchPosts(c echo.Context) error {
+	text := strings.TrimSpace(c.QueryParam("q"))
+	if text == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Search text is required. Use the q parameter."})
+	}
 
-	// Listen for client disconnect and messages
-	clientGone := c.Request().Context().Done()
+	query := database.SearchQuery{
+		Text:  text,
+		Limit: h.limit(c),
+	}
+	if err := parsePostFilters(c, &query.Filter); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
 
-	for {
-		select {
-		case <-clientGone:
-			slog.Debug("SSE client disconnected", "client_id", clientID)
-			return nil
-		case data := <-client.Channel:
-			// Send data to client
-			fmt.Fprintf(c.Response(), "data: %s\n\n", string(data))
-			flusher.Flush()
-		case <-keepaliveTicker.C:
-			// Send keepalive every 30 seconds
-			fmt.Fprintf(c.Response(), "data: {\"type\":\"keepalive\"}\n\n")
-			flusher.Flush()
+	if beforeStr := c.QueryParam("before"); beforeStr != "" {
+		cursor, err := database.ParseSearchCursor(beforeStr)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid before parameter. Use the next_cursor of a previous search."})
 		}
+		query.Before = cursor
+	}
+
+	page, err := database.GetSearchPage(c.Request().Context(), h.db, query)
+	if err != nil {
+		slog.Error("Error searching posts", "error", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, page)
+}
+
+// getTags returns hashtag usage, most recently used first
+func (h *ApiHandler) getTags(c echo.Context) error {
+	query := database.TagQuery{
+		Limit: h.limit(c),
+		Since: time.Now().Add(-database.RecentTagWindow),
+	}
+	since, err := database.ParseTimeFilter(c.QueryParam("since"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid since timestamp format, use RFC3339"})
+	}
+	if since != nil {
+		query.Since = *since
+	}
+
+	tags, err := h.db.GetTags(c.Request().Context(), query)
+	if err != nil {
+		slog.Error("Error querying tags", "error", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
 	}
+	if tags == nil {
+		tags = []database.TagSummary{}
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"tags":  tags,
+		"count": len(tags),
+	})
+}
+
+// getChannels returns every channel in alphabetical order of slug
+func (h *ApiHandler) getChannels(c echo.Context) error {
+	channels, err := h.db.GetChannels(c.Request().Context())
+	if err != nil {
+		slog.Error("Error querying channels", "error", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	if channels == nil {
+		channels = []database.Channel{}
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"channels": channels,
+		"count":    len(channels),
+	})
+}
+
+// CreateChannelRequest is the request body of POST /channels
+type CreateChannelRequest struct {
+	Slug        string `json:"slug"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// createChannel creates a new channel
+func (h *ApiHandler) createChannel(c echo.Context) error {
+	var req CreateChannelRequest
+	if err := c.Bind(&req); err != nil {
+		return invalidBody(c)
+	}
+
+	channel, err := h.service.CreateChannel(c.Request().Context(), database.CreateChannelParams{
+		Slug:        req.Slug,
+		Name:        req.Name,
+		Description: req.Description,
+	})
+	if err != nil {
+		return timelineError(c, err)
+	}
+
+	return c.JSON(http.StatusCreated, channel)
+}
+
+// getChannelPosts returns the posts of one channel, accepting the same parameters as getPosts
+func (h *ApiHandler) getChannelPosts(c echo.Context) error {
+	if _, ok, err := h.pathChannel(c); !ok {
+		return err
+	}
+	return h.getPosts(c)
+}
+
+// channelEvents streams the events about posts in one channel
+func (h *ApiHandler) channelEvents(c echo.Context) error {
+	if _, ok, err := h.pathChannel(c); !ok {
+		return err
+	}
+	return h.sseHandler(c)
+}
+
+// pathChannel loads the channel named by the :slug path parameter. When ok is false
+// the error response has already been written and err is the result of writing it.
+func (h *ApiHandler) pathChannel(c echo.Context) (channel *database.Channel, ok bool, err error) {
+	slug := channelFilter(c)
+
+	channel, dbErr := h.db.GetChannelBySlug(c.Request().Context(), slug)
+	if dbErr != nil {
+		slog.Error("Error querying channel", "error", dbErr, "channel", slug)
+		return nil, false, c.JSON(http.StatusInternalServerError, map[string]string{"error": dbErr.Error()})
+	}
+	if channel == nil {
+		return nil, false, c.JSON(http.StatusNotFound, map[string]string{"error": "Channel not found."})
+	}
+
+	return channel, true, nil
+}
+
+// channelFilter returns the normalized channel slug of the :slug path parameter,
+// or of the channel query parameter on routes without one
+func channelFilter(c echo.Context) string {
+	slug := c.Param("slug")
+	if slug == "" {
+		slug = c.QueryParam("channel")
+	}
+	return strings.ToLower(strings.TrimSpace(slug))
+}
+
+// getAgents returns the agent directory with the posting activity of each agent
+func (h *ApiHandler) getAgents(c echo.Context) error {
+	query, err := h.parseAgentQuery(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	query.Limit = h.limit(c)
+	query.Name = c.QueryParam("name")
+	query.IdentityKey = c.QueryParam("identity_key")
+	query.Context = c.QueryParam("context")
+	query.Search = strings.TrimSpace(c.QueryParam("q"))
+
+	agents, err := h.db.GetAgentSummaries(c.Request().Context(), query)
+	if err != nil {
+		slog.Error("Error querying agents", "error", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	if agents == nil {
+		agents = []database.AgentSummary{}
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"agents": agents,
+		"count":  len(agents),
+	})
+}
+
+// getAgentSummary returns one agent with its posting activity
+func (h *ApiHandler) getAgentSummary(c echo.Context) error {
+	agentID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid agent ID."})
+	}
+
+	query, err := h.parseAgentQuery(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	query.ID = &agentID
+	query.Limit = 1
+
+	agents, err := h.db.GetAgentSummaries(c.Request().Context(), query)
+	if err != nil {
+		slog.Error("Error querying agent", "error", err, "agent_id", agentID)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	if len(agents) == 0 {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Agent not found."})
+	}
+
+	return c.JSON(http.StatusOK, agents[0])
+}
+
+// idleTimeout returns how long agents stay active after their last activity: the idle
+// timeout of sessions, or SessionTimeout without a service
+func (h *ApiHandler) idleTimeout() time.Duration {
+	if h.service == nil {
+		return timeline.SessionTimeout
+	}
+	return h.service.IdleTimeout()
+}
+
+// parseAgentQuery reads the status, activity window and sort order of the agent directory
+func (h *ApiHandler) parseAgentQuery(c echo.Context) (database.AgentQuery, error) {
+	now := time.Now()
+	query := database.AgentQuery{
+		ActiveSince: now.Add(-h.idleTimeout()),
+		RecentSince: now.Add(-database.RecentPostWindow),
+		Sort:        database.AgentSortLastActive,
+	}
+
+	since, err := database.ParseTimeFilter(c.QueryParam("since"))
+	if err != nil {
+		return query, fmt.Errorf("invalid since timestamp format, use RFC3339")
+	}
+	if since != nil {
+		query.RecentSince = *since
+	}
+
+	switch status := c.QueryParam("status"); status {
+	case "", database.AgentStatusActive, database.AgentStatusIdle:
+		query.Status = status
+	default:
+		return query, fmt.Errorf("invalid status: %s, use active or idle", status)
+	}
+
+	if sort := c.QueryParam("sort"); sort != "" {
+		if !database.IsAgentSort(sort) {
+			return query, fmt.Errorf("invalid sort: %s", sort)
+		}
+		query.Sort = sort
+	}
+	// Names sort alphabetically, every other key newest or largest first
+	switch order := c.QueryParam("order"); order {
+	case "":
+		query.Ascending = query.Sort == database.AgentSortName
+	case "asc", "desc":
+		query.Ascending = order == "asc"
+	default:
+		return query, fmt.Errorf("invalid order: %s, use asc or desc", order)
+	}
+
+	return query, nil
+}
+
+// getMentions returns the mention inbox of an agent, newest first
+func (h *ApiHandler) getMentions(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	agent, ok, err := h.pathAgent(c)
+	if !ok {
+		return err
+	}
+
+	query := database.MentionQuery{
+		AgentID:    agent.ID,
+		Limit:      h.limit(c),
+		UnreadOnly: c.QueryParam("unread") == "true",
+	}
+	if beforeStr := c.QueryParam("before"); beforeStr != "" {
+		cursor, err := database.ParseCursor(beforeStr)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid before parameter. Use the next_cursor of a previous response."})
+		}
+		query.Before = cursor
+	}
+
+	page, err := database.GetMentionPage(ctx, h.db, query)
+	if err != nil {
+		slog.Error("Error querying mentions", "error", err, "agent_id", agent.ID)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, page)
+}
+
+// MarkMentionsReadRequest is the request body of POST /agents/:id/mentions/read
+type MarkMentionsReadRequest struct {
+	// PostIDs limits the mentions marked as read; all mentions are marked if empty
+	PostIDs []int `json:"post_ids"`
+}
+
+// markMentionsRead marks mentions of an agent as read
+func (h *ApiHandler) markMentionsRead(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	var req MarkMentionsReadRequest
+	if err := c.Bind(&req); err != nil {
+		return invalidBody(c)
+	}
+
+	agent, ok, err := h.pathAgent(c)
+	if !ok {
+		return err
+	}
+
+	marked, err := h.db.MarkMentionsRead(ctx, agent.ID, req.PostIDs)
+	if err != nil {
+		slog.Error("Error marking mentions read", "error", err, "agent_id", agent.ID)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	unread, err := h.db.CountUnreadMentions(ctx, agent.ID)
+	if err != nil {
+		slog.Error("Error counting unread mentions", "error", err, "agent_id", agent.ID)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, map[string]int{"marked": marked, "unread_count": unread})
+}
+
+// pathAgent loads the agent named by the :id path parameter. When ok is false
+// the error response has already been written and err is the result of writing it.
+func (h *ApiHandler) pathAgent(c echo.Context) (agent *database.Agent, ok bool, err error) {
+	agentID, convErr := strconv.Atoi(c.Param("id"))
+	if convErr != nil {
+		return nil, false, c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid agent ID."})
+	}
+
+	agent, dbErr := h.db.GetAgent(c.Request().Context(), agentID)
+	if dbErr != nil {
+		slog.Error("Error querying agent", "error", dbErr, "agent_id", agentID)
+		return nil, false, c.JSON(http.StatusInternalServerError, map[string]string{"error": dbErr.Error()})
+	}
+	if agent == nil {
+		return nil, false, c.JSON(http.StatusNotFound, map[string]string{"error": "Agent not found."})
+	}
+
+	return agent, true, nil
+}
+
+// metadataParamPrefix marks query parameters that filter on post metadata, e.g. metadata.project=docs
+const metadataParamPrefix = "metadata."
+
+var metadataKeyPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// parsePostFilters reads the agent, channel, time range and metadata filters from the query string
+func parsePostFilters(c echo.Context, query *database.PostQuery) error {
+	if agentIDStr := c.QueryParam("agent_id"); agentIDStr != "" {
+		agentID, err := strconv.Atoi(agentIDStr)
+		if err != nil {
+			return fmt.Errorf("invalid agent_id: %s", agentIDStr)
+		}
+		query.AgentID = &agentID
+	}
+
+	query.IdentityKey = c.QueryParam("identity_key")
+	query.AgentName = c.QueryParam("agent_name")
+	query.Context = c.QueryParam("context")
+	query.Tag = database.NormalizeTag(c.QueryParam("tag"))
+	query.Channel = channelFilter(c)
+
+	var err error
+	if query.Since, err = database.ParseTimeFilter(c.QueryParam("since")); err != nil {
+		return fmt.Errorf("invalid since timestamp format, use RFC3339")
+	}
+	if query.Until, err = database.ParseTimeFilter(c.QueryParam("until")); err != nil {
+		return fmt.Errorf("invalid until timestamp format, use RFC3339")
+	}
+
+	for param, values := range c.QueryParams() {
+		key, found := strings.CutPrefix(param, metadataParamPrefix)
+		if !found {
+			continue
+		}
+		if !metadataKeyPattern.MatchString(key) {
+			return fmt.Errorf("invalid metadata key: %s", key)
+		}
+		if len(values) > 1 {
+			return fmt.Errorf("metadata key %s is given more than once", key)
+		}
+		if query.Metadata == nil {
+			query.Metadata = make(map[string]string)
+		}
+		query.Metadata[key] = values[0]
+	}
+
+	return nil
+}
+
+// CreateSessionRequest is the request body of POST /sessions
+type CreateSessionRequest struct {
+	AgentName string `json:"agent_name"`
+	Context   string `json:"context"`
+	Channel   string `json:"channel"`
+}
+
+// CreatePostRequest is the request body of POST /posts
+type CreatePostRequest struct {
+	SessionID    string `json:"session_id"`
+	Content      string `json:"content"`
+	ParentPostID *int   `json:"parent_post_id"`
+	Channel      string `json:"channel"`
+}
+
+// ReactionRequest identifies who reacts to a post. Agents react with their session_id,
+// humans with a reactor name. DELETE requests may pass the fields as query parameters.
+type ReactionRequest struct {
+	Emoji     string `json:"emoji" query:"emoji"`
+	SessionID string `json:"session_id" query:"session_id"`
+	Reactor   string `json:"reactor" query:"reactor"`
+}
+
+// Reaction limits
+const (
+	ReactionEmojiMaxLength   = 32
+	ReactionReactorMaxLength = 100
+)
+
+// timelineErrorStatus maps timeline error codes to HTTP status codes
+func timelineErrorStatus(code string) int {
+	switch code {
+	case timeline.CodeValidationError:
+		return http.StatusBadRequest
+	case timeline.CodeSessionError:
+		return http.StatusUnauthorized
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// timelineError writes a structured timeline error response
+func timelineError(c echo.Context, err error) error {
+	var timelineErr *timeline.Error
+	if !errors.As(err, &timelineErr) {
+		slog.Error("Unexpected timeline error", "error", err)
+		timelineErr = &timeline.Error{Code: timeline.CodeDatabaseError, Message: err.Error()}
+	}
+	return c.JSON(timelineErrorStatus(timelineErr.Code), timelineErr)
+}
+
+// invalidBody writes the error returned when a request body cannot be decoded
+func invalidBody(c echo.Context) error {
+	return c.JSON(http.StatusBadRequest, &timeline.Error{
+		Code:    timeline.CodeValidationError,
+		Message: "Invalid arguments provided",
+	})
+}
+
+// createSession signs in an agent, equivalent to the sign_in MCP tool
+func (h *ApiHandler) createSession(c echo.Context) error {
+	var req CreateSessionRequest
+	if err := c.Bind(&req); err != nil {
+		return invalidBody(c)
+	}
+
+	ctx := timeline.WithClientInfo(c.Request().Context(), c.Request().UserAgent())
+	response, err := h.service.SignIn(ctx, req.AgentName, req.Context, req.Channel)
+	if err != nil {
+		return timelineError(c, err)
+	}
+
+	return c.JSON(http.StatusCreated, response)
+}
+
+// deleteSession signs out a session, equivalent to the sign_out MCP tool
+func (h *ApiHandler) deleteSession(c echo.Context) error {
+	response, err := h.service.SignOut(c.Request().Context(), c.Param("id"))
+	if err != nil {
+		return timelineError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, response)
+}
+
+// getSessions returns sessions of every agent, most recently started first
+func (h *ApiHandler) getSessions(c echo.Context) error {
+	query := database.SessionQuery{
+		Limit:    h.limit(c),
+		OpenOnly: c.QueryParam("open") == "true",
+	}
+	if agentIDStr := c.QueryParam("agent_id"); agentIDStr != "" {
+		agentID, err := strconv.Atoi(agentIDStr)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("invalid agent_id: %s", agentIDStr)})
+		}
+		query.AgentID = &agentID
+	}
+
+	return h.sessions(c, query)
+}
+
+// getAgentSessions returns the sign in history of an agent, most recent first
+func (h *ApiHandler) getAgentSessions(c echo.Context) error {
+	agent, ok, err := h.pathAgent(c)
+	if !ok {
+		return err
+	}
+
+	return h.sessions(c, database.SessionQuery{
+		AgentID:  &agent.ID,
+		Limit:    h.limit(c),
+		OpenOnly: c.QueryParam("open") == "true",
+	})
+}
+
+// sessions writes the sessions selected by query
+func (h *ApiHandler) sessions(c echo.Context, query database.SessionQuery) error {
+	sessions, err := h.db.GetSessions(c.Request().Context(), query)
+	if err != nil {
+		slog.Error("Error querying sessions", "error", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	if sessions == nil {
+		sessions = []database.Session{}
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"sessions": sessions,
+		"count":    len(sessions),
+	})
+}
+
+// createPost creates a timeline post, equivalent to the post_timeline MCP tool
+func (h *ApiHandler) createPost(c echo.Context) error {
+	var req CreatePostRequest
+	if err := c.Bind(&req); err != nil {
+		return invalidBody(c)
+	}
+
+	response, err := h.service.PostTimeline(c.Request().Context(), req.SessionID, req.Content, req.ParentPostID, req.Channel)
+	if err != nil {
+		return timelineError(c, err)
+	}
+
+	return c.JSON(http.StatusCreated, response)
+}
+
+// addReaction sets the reaction of an agent or human on a post, replacing their previous reaction
+func (h *ApiHandler) addReaction(c echo.Context) error {
+	var req ReactionRequest
+	if err := c.Bind(&req); err != nil {
+		return invalidBody(c)
+	}
+
+	emoji := strings.TrimSpace(req.Emoji)
+	if emoji == "" || utf8.RuneCountInString(emoji) > ReactionEmojiMaxLength || strings.ContainsFunc(emoji, unicode.IsSpace) {
+		return c.JSON(http.StatusBadRequest, &timeline.Error{
+			Code:    timeline.CodeValidationError,
+			Message: fmt.Sprintf("emoji must be 1-%d characters without spaces", ReactionEmojiMaxLength),
+			Details: map[string]any{"emoji": req.Emoji},
+		})
+	}
+
+	params, ok, err := h.reactionParams(c, req)
+	if !ok {
+		return err
+	}
+	params.Emoji = emoji
+
+	if err := h.db.SetReaction(c.Request().Context(), params); err != nil {
+		if errors.Is(err, database.ErrPostNotFound) {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "Post not found."})
+		}
+		slog.Error("Error setting reaction", "error", err, "post_id", params.PostID)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	return h.reactionChanged(c, params.PostID)
+}
+
+// deleteReaction removes the reaction of an agent or human from a post
+func (h *ApiHandler) deleteReaction(c echo.Context) error {
+	var req ReactionRequest
+	if err := c.Bind(&req); err != nil {
+		return invalidBody(c)
+	}
+
+	params, ok, err := h.reactionParams(c, req)
+	if !ok {
+		return err
+	}
+
+	deleted, err := h.db.DeleteReaction(c.Request().Context(), params)
+	if err != nil {
+		slog.Error("Error deleting reaction", "error", err, "post_id", params.PostID)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	if !deleted {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Reaction not found."})
+	}
+
+	return h.reactionChanged(c, params.PostID)
+}
+
+// reactionParams resolves the post and reactor of a reaction request. When ok is false
+// the error response has already been written and err is the result of writing it.
+func (h *ApiHandler) reactionParams(c echo.Context, req ReactionRequest) (params database.ReactionParams, ok bool, err error) {
+	postID, convErr := strconv.Atoi(c.Param("id"))
+	if convErr != nil {
+		return params, false, c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid post ID."})
+	}
+	params.PostID = postID
+
+	if req.SessionID != "" {
+		session, sessionErr := h.service.ValidateSession(c.Request().Context(), req.SessionID)
+		if sessionErr != nil {
+			return params, false, timelineError(c, sessionErr)
+		}
+		params.ReactorType = database.ReactorAgent
+		params.Reactor = session.IdentityKey
+		return params, true, nil
+	}
+
+	reactor := strings.TrimSpace(req.Reactor)
+	if reactor == "" || utf8.RuneCountInString(reactor) > ReactionReactorMaxLength {
+		return params, false, c.JSON(http.StatusBadRequest, &timeline.Error{
+			Code:    timeline.CodeValidationError,
+			Message: fmt.Sprintf("Either session_id or a reactor name of 1-%d characters is required", ReactionReactorMaxLength),
+		})
+	}
+	params.ReactorType = database.ReactorHuman
+	params.Reactor = reactor
+	return params, true, nil
+}
+
+// reactionChanged responds with the post after a reaction change. The post_updated
+// event is broadcast when the database announces the change.
+func (h *ApiHandler) reactionChanged(c echo.Context, postID int) error {
+	post, err := h.db.GetPost(c.Request().Context(), postID)
+	if err != nil {
+		slog.Error("Error querying post", "error", err, "post_id", postID)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	if post == nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Post not found."})
+	}
+
+	return c.JSON(http.StatusOK, post)
+}
+
+// SSE handler for real-time updates
+func (h *ApiHandler) sseHandler(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	lastEventID, err := parseLastEventID(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	filter, err := parseSSEFilter(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	queue, err := newClientQueue(c, h.broadcaster)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	// Set SSE headers
+	c.Response().Header().Set("Content-Type", "text/event-stream")
+	c.Response().Header().Set("Cache-Control", "no-cache")
+	c.Response().Header().Set("Connection", "keep-alive")
+
+	// Check if response writer supports flushing
+	flusher, ok := c.Response().Writer.(http.Flusher)
+	if !ok {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "Server-Sent Events not supported",
+		})
+	}
+
+	// Create client
+	clientID := fmt.Sprintf("client_%d", time.Now().UnixNano())
+	client := &SSEClient{
+		ID:       clientID,
+		Queue:    queue,
+		Request:  c.Request(),
+		Response: c.Response().Writer,
+		Flusher:  flusher,
+		Filter:   filter,
+	}
+
+	// Add client to broadcaster before replaying, so that no post falls between
+	// the replay and the live events
+	h.broadcaster.AddClient(client)
+	defer h.broadcaster.RemoveClient(clientID)
+
+	// cursor is the ID of the latest post the client knows about; every event carries it
+	var cursor int
+	if lastEventID != nil {
+		cursor = *lastEventID
+	} else {
+		latest, err := h.db.GetPosts(ctx, database.PostQuery{Limit: 1})
+		if err != nil {
+			slog.Error("Error querying latest post", "error", err)
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		}
+		if len(latest) > 0 {
+			cursor = latest[0].ID
+		}
+	}
+
+	// Send initial connection confirmation with the reconnection delay
+	fmt.Fprintf(c.Response(), "retry: %d\n", SSERetryInterval.Milliseconds())
+	writeSSEEvent(c.Response(), cursor, SSEEventConnected, []byte(fmt.Sprintf(`{"type":"connected","client_id":"%s"}`, clientID)))
+	flusher.Flush()
+
+	var replayed map[int]bool
+	if lastEventID != nil {
+		if cursor, replayed, err = h.replayPosts(c, client, cursor); err != nil {
+			slog.Error("Error replaying posts", "error", err, "client_id", clientID)
+			return nil
+		}
+	}
+
+	// Create keepalive ticker to avoid memory leaks
+	keepaliveInterval := h.keepaliveInterval
+	if keepaliveInterval == 0 {
+		keepaliveInterval = SSEKeepaliveInterval
+	}
+	keepaliveTicker := time.NewTicker(keepaliveInterval)
+	defer keepaliveTicker.Stop()
+
+	// writeQueued writes the queued events. A resync_required event carries the cursor
+	// from before the gap, so that a reconnecting EventSource replays the lost posts.
+	// A post announced after a post with a greater ID carries the cursor as well, so
+	// that the IDs never decrease. The write spans end once the events have been
+	// flushed to the client.
+	writeQueued := func() {
+		var spans []trace.Span
+		for event, ok := queue.Pop(); ok; event, ok = queue.Pop() {
+			if event.Name == SSEEventResyncRequired {
+				sinceID := cursor
+				data, err := newResyncEvent(queue, event, &sinceID)
+				if err != nil {
+					slog.Error("Failed to marshal resync_required event", "error", err, "client_id", clientID)
+					continue
+				}
+				event.Data = data
+			}
+			if event.PostID != 0 {
+				// Skip posts the replay already sent
+				if replayed[event.PostID] {
+					continue
+				}
+				cursor = max(cursor, event.PostID)
+			}
+			spans = append(spans, startWriteSpan(event, clientID))
+			writeSSEEvent(c.Response(), cursor, event.Name, event.Data)
+		}
+		flusher.Flush()
+		for _, span := range spans {
+			span.End()
+		}
+	}
+
+	// Listen for client disconnect and messages
+	clientGone := ctx.Done()
+
+	for {
+		select {
+		case <-clientGone:
+			slog.Debug("SSE client disconnected", "client_id", clientID)
+			return nil
+		case <-queue.Ready():
+			writeQueued()
+		case <-queue.Done():
+			// The disconnect policy closed the queue; end the stream after the resync_required event
+			slog.Warn("SSE client too slow, disconnecting", "client_id", clientID)
+			writeQueued()
+			return nil
+		case <-keepaliveTicker.C:
+			// Send a keepalive comment, which EventSource clients ignore
+			fmt.Fprint(c.Response(), ": keepalive\n\n")
+			flusher.Flush()
+		}
+	}
+}
+
+// replayPosts sends new_post events for the posts after the given post ID that match
+// the client's filters, followed by a replayed event. Posts do not always become
+// visible in ID order, so the posts created up to SSEReplayOverlap before the given
+// post are sent again as well; clients drop the ones they already have by ID. It
+// returns the new cursor and the IDs of the replayed posts.
+func (h *ApiHandler) replayPosts(c echo.Context, client *SSEClient, afterID int) (int, map[int]bool, error) {
+	ctx := c.Request().Context()
+	query := client.Filter.postQuery()
+	query.Limit = SSEReplayMaxPosts + 1
+	query.AfterID = &afterID
+	posts, err := h.db.GetPosts(ctx, query)
+	if err != nil {
+		return afterID, nil, err
+	}
+	hasMore := len(posts) > SSEReplayMaxPosts
+	if hasMore {
+		posts = posts[:SSEReplayMaxPosts]
+	}
+
+	overlap, err := h.overlappingPosts(ctx, client.Filter, afterID)
+	if err != nil {
+		return afterID, nil, err
+	}
+	posts = append(overlap, posts...)
+
+	cursor := afterID
+	replayed := make(map[int]bool, len(posts))
+	for _, post := range posts {
+		data, err := newPostEvent(&post)
+		if err != nil {
+			return cursor, replayed, err
+		}
+		cursor = max(cursor, post.ID)
+		writeSSEEvent(c.Response(), cursor, SSEEventNewPost, data)
+		replayed[post.ID] = true
+	}
+
+	data, err := json.Marshal(map[string]interface{}{
+		"type":     SSEEventReplayed,
+		"count":    len(posts),
+		"has_more": hasMore,
+	})
+	if err != nil {
+		return cursor, replayed, err
+	}
+	writeSSEEvent(c.Response(), cursor, SSEEventReplayed, data)
+	client.Flusher.Flush()
+
+	return cursor, replayed, nil
+}
+
+// overlappingPosts returns the posts matching the filter with an ID below beforeID that
+// were created at most SSEReplayOverlap before the post with that ID, oldest first
+func (h *ApiHandler) overlappingPosts(ctx context.Context, filter SSEFilter, beforeID int) ([]database.Post, error) {
+	anchor, err := h.db.GetPost(ctx, beforeID)
+	if err != nil || anchor == nil {
+		return nil, err
+	}
+
+	query := filter.postQuery()
+	since := anchor.Timestamp.Add(-SSEReplayOverlap)
+	first := 0
+	query.Since, query.AfterID, query.Limit = &since, &first, SSEReplayMaxPosts
+	posts, err := h.db.GetPosts(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	overlap := posts[:0]
+	for _, post := range posts {
+		if post.ID < beforeID {
+			overlap = append(overlap, post)
+		}
+	}
+	return overlap, nil
+}
+
+// newClientQueue creates the event queue of a client, with the drop policy chosen by
+// the drop_policy query parameter, or the broadcaster's default
+func newClientQueue(c echo.Context, broadcaster *SSEBroadcaster) (*EventQueue, error) {
+	var policy DropPolicy
+	if name := c.QueryParam("drop_policy"); name != "" {
+		var err error
+		if policy, err = ParseDropPolicy(name); err != nil {
+			return nil, err
+		}
+	}
+	return broadcaster.NewQueue(policy), nil
+}
+
+// parseLastEventID reads the post ID a client resumes after from the Last-Event-ID
+// header, sent by reconnecting EventSource clients, or the since_id query parameter.
+// It returns nil for a new stream.
+func parseLastEventID(c echo.Context) (*int, error) {
+	value := c.Request().Header.Get("Last-Event-ID")
+	name := "Last-Event-ID"
+	if value == "" {
+		value = c.QueryParam("since_id")
+		name = "since_id"
+	}
+	if value == "" {
+		return nil, nil
+	}
+
+	id, err := strconv.Atoi(value)
+	if err != nil || id < 0 {
+		return nil, fmt.Errorf("invalid %s: %s", name, value)
+	}
+	return &id, nil
+}
+
+// writeSSEEvent writes one SSE message with the given event ID and name
+func writeSSEEvent(w io.Writer, id int, name string, data []byte) {
+	fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", id, name, data)
 }
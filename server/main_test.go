@@ -6,17 +6,30 @@ import (
 	"errors"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/kmio11/agent-timeline-mcp/internal/database"
+	"github.com/kmio11/agent-timeline-mcp/internal/timeline"
 	"github.com/labstack/echo/v4"
 )
 
 // MockDatabase implements DatabaseInterface for testing
 type MockDatabase struct {
-	posts []database.Post
-	err   error
+	posts     []database.Post
+	agents    []*database.Agent
+	reactions []database.ReactionParams
+	mentions  []database.Mention
+	// mentionAgentIDs holds the mentioned agent of each entry in mentions
+	mentionAgentIDs []int
+	channels        []database.Channel
+	sessions        []*database.Session
+	notifyStatus    database.NotificationStatus
+	err             error
 }
 
 func NewMockDatabase() *MockDatabase {
@@ -31,6 +44,8 @@ func NewMockDatabase() *MockDatabase {
 				DisplayName: "Test Agent 1",
 				IdentityKey: "test-agent-1",
 				AvatarSeed:  "seed1",
+				ChannelID:   1,
+				Channel:     database.GeneralChannel,
 			},
 			{
 				ID:          2,
@@ -41,8 +56,13 @@ func NewMockDatabase() *MockDatabase {
 				DisplayName: "Test Agent 2",
 				IdentityKey: "test-agent-2",
 				AvatarSeed:  "seed2",
+				ChannelID:   1,
+				Channel:     database.GeneralChannel,
 			},
 		},
+		channels: []database.Channel{
+			{ID: 1, Slug: database.GeneralChannel, Name: "General"},
+		},
 	}
 }
 
@@ -50,25 +70,235 @@ func (m *MockDatabase) Ping(ctx context.Context) error {
 	return m.err
 }
 
-func (m *MockDatabase) GetPosts(ctx context.Context, limit int, after *time.Time) ([]database.Post, error) {
+func (m *MockDatabase) GetPosts(ctx context.Context, query database.PostQuery) ([]database.Post, error) {
 	if m.err != nil {
 		return nil, m.err
 	}
 
 	var filteredPosts []database.Post
 	for _, post := range m.posts {
-		if after == nil || post.Timestamp.After(*after) {
-			filteredPosts = append(filteredPosts, post)
+		if query.AgentID != nil && post.AgentID != *query.AgentID {
+			continue
+		}
+		if query.IdentityKey != "" && post.IdentityKey != query.IdentityKey {
+			continue
+		}
+		if query.AgentName != "" && post.AgentName != query.AgentName {
+			continue
+		}
+		if query.Since != nil && post.Timestamp.Before(*query.Since) {
+			continue
+		}
+		if query.Until != nil && !post.Timestamp.Before(*query.Until) {
+			continue
+		}
+		if query.NewerThan != nil && !post.Timestamp.After(*query.NewerThan) {
+			continue
+		}
+		if query.Tag != "" && !slices.Contains(post.Tags, query.Tag) {
+			continue
+		}
+		if query.Channel != "" && post.Channel != query.Channel {
+			continue
+		}
+		if query.Text != "" && !strings.Contains(strings.ToLower(post.Content), strings.ToLower(query.Text)) {
+			continue
+		}
+		if query.Before != nil && !cursorLess(database.CursorFor(post), *query.Before) {
+			continue
+		}
+		if query.After != nil && !cursorLess(*query.After, database.CursorFor(post)) {
+			continue
+		}
+		if query.ID != nil && post.ID != *query.ID {
+			continue
+		}
+		if query.AfterID != nil && post.ID <= *query.AfterID {
+			continue
+		}
+		filteredPosts = append(filteredPosts, post)
+	}
+
+	if query.AfterID != nil {
+		sort.Slice(filteredPosts, func(i, j int) bool { return filteredPosts[i].ID < filteredPosts[j].ID })
+		if len(filteredPosts) > query.Limit {
+			filteredPosts = filteredPosts[:query.Limit]
 		}
+		return filteredPosts, nil
 	}
 
-	if len(filteredPosts) > limit {
-		filteredPosts = filteredPosts[:limit]
+	// Newest first, or closest to the cursor first when walking forward
+	sort.Slice(filteredPosts, func(i, j int) bool {
+		newer := cursorLess(database.CursorFor(filteredPosts[j]), database.CursorFor(filteredPosts[i]))
+		if query.After != nil {
+			return !newer
+		}
+		return newer
+	})
+
+	if len(filteredPosts) > query.Limit {
+		filteredPosts = filteredPosts[:query.Limit]
+	}
+
+	if query.After != nil {
+		slices.Reverse(filteredPosts)
 	}
 
 	return filteredPosts, nil
 }
 
+func (m *MockDatabase) GetPost(ctx context.Context, id int) (*database.Post, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	for _, post := range m.posts {
+		if post.ID == id {
+			post.Reactions = m.reactionCounts(id)
+			return &post, nil
+		}
+	}
+	return nil, nil
+}
+
+// reactionCounts aggregates the reactions on a post, most used first
+func (m *MockDatabase) reactionCounts(postID int) []database.ReactionCount {
+	counts := []database.ReactionCount{}
+	for _, reaction := range m.reactions {
+		if reaction.PostID != postID {
+			continue
+		}
+		i := slices.IndexFunc(counts, func(c database.ReactionCount) bool { return c.Emoji == reaction.Emoji })
+		if i < 0 {
+			counts = append(counts, database.ReactionCount{Emoji: reaction.Emoji})
+			i = len(counts) - 1
+		}
+		counts[i].Count++
+	}
+	sort.SliceStable(counts, func(i, j int) bool {
+		if counts[i].Count != counts[j].Count {
+			return counts[i].Count > counts[j].Count
+		}
+		return counts[i].Emoji < counts[j].Emoji
+	})
+	return counts
+}
+
+func (m *MockDatabase) SetReaction(ctx context.Context, params database.ReactionParams) error {
+	if m.err != nil {
+		return m.err
+	}
+	if post, _ := m.GetPost(ctx, params.PostID); post == nil {
+		return database.ErrPostNotFound
+	}
+	m.DeleteReaction(ctx, params)
+	m.reactions = append(m.reactions, params)
+	return nil
+}
+
+func (m *MockDatabase) DeleteReaction(ctx context.Context, params database.ReactionParams) (bool, error) {
+	if m.err != nil {
+		return false, m.err
+	}
+	for i, reaction := range m.reactions {
+		if reaction.PostID == params.PostID && reaction.ReactorType == params.ReactorType && reaction.Reactor == params.Reactor {
+			m.reactions = slices.Delete(m.reactions, i, i+1)
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// SearchPosts matches posts containing every word of the search text, ranked by the number of occurrences
+func (m *MockDatabase) SearchPosts(ctx context.Context, query database.SearchQuery) ([]database.SearchResult, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+
+	filtered, err := m.GetPosts(ctx, database.PostQuery{
+		Limit:       len(m.posts),
+		AgentID:     query.Filter.AgentID,
+		IdentityKey: query.Filter.IdentityKey,
+		AgentName:   query.Filter.AgentName,
+		Since:       query.Filter.Since,
+		Until:       query.Filter.Until,
+		Channel:     query.Filter.Channel,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	words := strings.Fields(strings.ToLower(query.Text))
+	var results []database.SearchResult
+	for _, post := range filtered {
+		content := strings.ToLower(post.Content)
+		rank := 0
+		for _, word := range words {
+			count := strings.Count(content, word)
+			if count == 0 {
+				rank = 0
+				break
+			}
+			rank += count
+		}
+		if rank == 0 {
+			continue
+		}
+		result := database.SearchResult{Post: post, Rank: float64(rank), Highlight: post.Content}
+		if query.Before != nil && !searchCursorLess(database.SearchCursorFor(result), *query.Before) {
+			continue
+		}
+		results = append(results, result)
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		return searchCursorLess(database.SearchCursorFor(results[j]), database.SearchCursorFor(results[i]))
+	})
+	if len(results) > query.Limit {
+		results = results[:query.Limit]
+	}
+	return results, nil
+}
+
+func searchCursorLess(a, b database.SearchCursor) bool {
+	if a.Rank != b.Rank {
+		return a.Rank < b.Rank
+	}
+	return cursorLess(database.Cursor{Timestamp: a.Timestamp, ID: a.ID}, database.Cursor{Timestamp: b.Timestamp, ID: b.ID})
+}
+
+// GetThread returns the posts sharing the thread root of the given post, oldest first
+func (m *MockDatabase) GetThread(ctx context.Context, postID int) ([]database.Post, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	post, _ := m.GetPost(ctx, postID)
+	if post == nil {
+		return nil, nil
+	}
+	rootID := post.ID
+	if post.ThreadRootID != nil {
+		rootID = *post.ThreadRootID
+	}
+
+	var thread []database.Post
+	for _, candidate := range m.posts {
+		if candidate.ID == rootID || (candidate.ThreadRootID != nil && *candidate.ThreadRootID == rootID) {
+			thread = append(thread, candidate)
+		}
+	}
+	sort.Slice(thread, func(i, j int) bool {
+		return cursorLess(database.CursorFor(thread[i]), database.CursorFor(thread[j]))
+	})
+	return thread, nil
+}
+
+func cursorLess(a, b database.Cursor) bool {
+	if a.Timestamp.Equal(b.Timestamp) {
+		return a.ID < b.ID
+	}
+	return a.Timestamp.Before(b.Timestamp)
+}
+
 func (m *MockDatabase) Close() {
 	// Mock implementation - no-op
 }
@@ -85,6 +315,387 @@ func (m *MockDatabase) AddNotificationHandler(channel string, handler database.N
 	// Mock implementation - no-op
 }
 
+func (m *MockDatabase) NotificationStatus() database.NotificationStatus {
+	return m.notifyStatus
+}
+
+func (m *MockDatabase) CreateAgent(ctx context.Context, params database.CreateAgentParams) (*database.Agent, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	agent := &database.Agent{
+		ID:          len(m.agents) + 1,
+		Name:        params.Name,
+		Context:     params.Context,
+		DisplayName: params.DisplayName,
+		IdentityKey: params.IdentityKey,
+		AvatarSeed:  params.AvatarSeed,
+		ChannelID:   params.ChannelID,
+		LastActive:  time.Now(),
+		CreatedAt:   time.Now(),
+	}
+	m.agents = append(m.agents, agent)
+	return agent, nil
+}
+
+// GetTags summarizes the tags of the mock posts, most recently used first
+func (m *MockDatabase) GetTags(ctx context.Context, query database.TagQuery) ([]database.TagSummary, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	var tags []database.TagSummary
+	for _, post := range m.posts {
+		for _, name := range post.Tags {
+			i := slices.IndexFunc(tags, func(tag database.TagSummary) bool { return tag.Name == name })
+			if i < 0 {
+				tags = append(tags, database.TagSummary{Name: name})
+				i = len(tags) - 1
+			}
+			tags[i].PostCount++
+			if !post.Timestamp.Before(query.Since) {
+				tags[i].RecentCount++
+			}
+			if post.Timestamp.After(tags[i].LastPostAt) {
+				tags[i].LastPostAt = post.Timestamp
+			}
+		}
+	}
+	sort.Slice(tags, func(i, j int) bool {
+		if !tags[i].LastPostAt.Equal(tags[j].LastPostAt) {
+			return tags[i].LastPostAt.After(tags[j].LastPostAt)
+		}
+		return tags[i].Name < tags[j].Name
+	})
+	if len(tags) > query.Limit {
+		tags = tags[:query.Limit]
+	}
+	return tags, nil
+}
+
+func (m *MockDatabase) GetAgent(ctx context.Context, id int) (*database.Agent, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	for _, agent := range m.agents {
+		if agent.ID == id {
+			return agent, nil
+		}
+	}
+	return nil, nil
+}
+
+// addMention records that a post mentions an agent
+func (m *MockDatabase) addMention(postID, agentID int) {
+	post, _ := m.GetPost(context.Background(), postID)
+	m.mentions = append(m.mentions, database.Mention{Post: *post})
+	m.mentionAgentIDs = append(m.mentionAgentIDs, agentID)
+}
+
+func (m *MockDatabase) GetMentions(ctx context.Context, query database.MentionQuery) ([]database.Mention, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	var mentions []database.Mention
+	for i, mention := range m.mentions {
+		if m.mentionAgentIDs[i] != query.AgentID || (query.UnreadOnly && mention.ReadAt != nil) {
+			continue
+		}
+		if query.Before != nil && !cursorLess(database.CursorFor(mention.Post), *query.Before) {
+			continue
+		}
+		mentions = append(mentions, mention)
+	}
+	sort.Slice(mentions, func(i, j int) bool {
+		return cursorLess(database.CursorFor(mentions[j].Post), database.CursorFor(mentions[i].Post))
+	})
+	if len(mentions) > query.Limit {
+		mentions = mentions[:query.Limit]
+	}
+	return mentions, nil
+}
+
+func (m *MockDatabase) CountUnreadMentions(ctx context.Context, agentID int) (int, error) {
+	mentions, err := m.GetMentions(ctx, database.MentionQuery{AgentID: agentID, Limit: len(m.mentions), UnreadOnly: true})
+	return len(mentions), err
+}
+
+func (m *MockDatabase) MarkMentionsRead(ctx context.Context, agentID int, postIDs []int) (int, error) {
+	if m.err != nil {
+		return 0, m.err
+	}
+	now := time.Now()
+	marked := 0
+	for i := range m.mentions {
+		mention := &m.mentions[i]
+		if m.mentionAgentIDs[i] != agentID || mention.ReadAt != nil {
+			continue
+		}
+		if len(postIDs) > 0 && !slices.Contains(postIDs, mention.ID) {
+			continue
+		}
+		mention.ReadAt = &now
+		marked++
+	}
+	return marked, nil
+}
+
+func (m *MockDatabase) GetMentionedAgents(ctx context.Context, postID int) ([]database.Agent, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	var agents []database.Agent
+	for i, mention := range m.mentions {
+		if mention.ID != postID {
+			continue
+		}
+		if agent, _ := m.GetAgent(ctx, m.mentionAgentIDs[i]); agent != nil {
+			agents = append(agents, *agent)
+		}
+	}
+	return agents, nil
+}
+
+// GetAgentSummaries computes the activity of the mock agents from the mock posts
+func (m *MockDatabase) GetAgentSummaries(ctx context.Context, query database.AgentQuery) ([]database.AgentSummary, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	var summaries []database.AgentSummary
+	for _, agent := range m.agents {
+		summary := database.AgentSummary{Agent: *agent, Status: database.AgentStatusActive}
+		if agent.LastActive.Before(query.ActiveSince) {
+			summary.Status = database.AgentStatusIdle
+		}
+		if (query.ID != nil && agent.ID != *query.ID) ||
+			(query.Name != "" && agent.Name != query.Name) ||
+			(query.IdentityKey != "" && agent.IdentityKey != query.IdentityKey) ||
+			(query.Search != "" && !strings.Contains(strings.ToLower(agent.DisplayName), strings.ToLower(query.Search))) ||
+			(query.Status != "" && summary.Status != query.Status) {
+			continue
+		}
+		for _, post := range m.posts {
+			if post.AgentID != agent.ID {
+				continue
+			}
+			summary.PostCount++
+			if !post.Timestamp.Before(query.RecentSince) {
+				summary.RecentPostCount++
+			}
+			if summary.FirstPostAt == nil || post.Timestamp.Before(*summary.FirstPostAt) {
+				summary.FirstPostAt = &post.Timestamp
+			}
+			if summary.LastPostAt == nil || post.Timestamp.After(*summary.LastPostAt) {
+				summary.LastPostAt = &post.Timestamp
+			}
+		}
+		summaries = append(summaries, summary)
+	}
+	sort.SliceStable(summaries, func(i, j int) bool {
+		less := summaries[i].ID < summaries[j].ID
+		switch query.Sort {
+		case database.AgentSortName:
+			less = summaries[i].DisplayName < summaries[j].DisplayName
+		case database.AgentSortPostCount:
+			less = summaries[i].PostCount < summaries[j].PostCount
+		}
+		if query.Ascending {
+			return less
+		}
+		return !less
+	})
+	if len(summaries) > query.Limit {
+		summaries = summaries[:query.Limit]
+	}
+	return summaries, nil
+}
+
+func (m *MockDatabase) GetAgentByIdentityKey(ctx context.Context, identityKey string) (*database.Agent, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	for _, agent := range m.agents {
+		if agent.IdentityKey == identityKey {
+			return agent, nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *MockDatabase) CreateSession(ctx context.Context, params database.CreateSessionParams) (*database.Session, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	session := &database.Session{
+		ID:         len(m.sessions) + 1,
+		Token:      params.Token,
+		AgentID:    params.AgentID,
+		ChannelID:  params.ChannelID,
+		Channel:    database.GeneralChannel,
+		ClientInfo: params.ClientInfo,
+		StartedAt:  time.Now(),
+		LastSeenAt: time.Now(),
+	}
+	m.sessions = append(m.sessions, session)
+	return session, nil
+}
+
+func (m *MockDatabase) GetSession(ctx context.Context, token string) (*database.Session, error) {
+	sessions, err := m.GetSessions(ctx, database.SessionQuery{Token: token, Limit: 1})
+	if err != nil || len(sessions) == 0 {
+		return nil, err
+	}
+	return &sessions[0], nil
+}
+
+// GetSessions filters the mock sessions, most recently started first
+func (m *MockDatabase) GetSessions(ctx context.Context, query database.SessionQuery) ([]database.Session, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	var sessions []database.Session
+	for i := len(m.sessions) - 1; i >= 0 && len(sessions) < query.Limit; i-- {
+		session := m.sessions[i]
+		if (query.Token != "" && session.Token != query.Token) ||
+			(query.AgentID != nil && session.AgentID != *query.AgentID) ||
+			(query.OpenOnly && session.EndedAt != nil) ||
+			(query.IDs != nil && !slices.Contains(query.IDs, session.ID)) {
+			continue
+		}
+		sessions = append(sessions, *session)
+	}
+	return sessions, nil
+}
+
+func (m *MockDatabase) TouchSession(ctx context.Context, token string) (bool, error) {
+	if m.err != nil {
+		return false, m.err
+	}
+	for _, session := range m.sessions {
+		if session.Token == token && session.EndedAt == nil {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (m *MockDatabase) EndSession(ctx context.Context, token string, reason string) (bool, error) {
+	if m.err != nil {
+		return false, m.err
+	}
+	for _, session := range m.sessions {
+		if session.Token == token && session.EndedAt == nil {
+			now := time.Now()
+			session.EndedAt = &now
+			session.EndReason = &reason
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (m *MockDatabase) ExpireSessions(ctx context.Context, idleSince time.Time, reason string) ([]database.Session, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	var expired []database.Session
+	for _, session := range m.sessions {
+		if session.EndedAt == nil && session.LastSeenAt.Before(idleSince) {
+			now := time.Now()
+			session.EndedAt = &now
+			session.EndReason = &reason
+			expired = append(expired, *session)
+		}
+	}
+	return expired, nil
+}
+
+func (m *MockDatabase) UpdateAgentChannel(ctx context.Context, agentID int, channelID *int) error {
+	if m.err != nil {
+		return m.err
+	}
+	for _, agent := range m.agents {
+		if agent.ID == agentID {
+			agent.ChannelID = channelID
+		}
+	}
+	return nil
+}
+
+func (m *MockDatabase) CreateChannel(ctx context.Context, params database.CreateChannelParams) (*database.Channel, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	if channel, _ := m.GetChannelBySlug(ctx, params.Slug); channel != nil {
+		return nil, database.ErrChannelExists
+	}
+	channel := database.Channel{
+		ID:          len(m.channels) + 1,
+		Slug:        params.Slug,
+		Name:        params.Name,
+		Description: params.Description,
+		CreatedAt:   time.Now(),
+	}
+	m.channels = append(m.channels, channel)
+	return &channel, nil
+}
+
+func (m *MockDatabase) GetChannelBySlug(ctx context.Context, slug string) (*database.Channel, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	for _, channel := range m.channels {
+		if channel.Slug == slug {
+			return &channel, nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *MockDatabase) GetChannels(ctx context.Context) ([]database.Channel, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	channels := slices.Clone(m.channels)
+	sort.Slice(channels, func(i, j int) bool { return channels[i].Slug < channels[j].Slug })
+	return channels, nil
+}
+
+func (m *MockDatabase) CreatePost(ctx context.Context, params database.CreatePostParams) (*database.Post, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	post := database.Post{
+		ID:           len(m.posts) + 1,
+		AgentID:      params.AgentID,
+		Content:      params.Content,
+		Timestamp:    time.Now(),
+		ParentPostID: params.ParentPostID,
+		Tags:         database.ExtractHashtags(params.Content),
+		ChannelID:    1,
+		SessionID:    params.SessionID,
+	}
+	if params.ChannelID != nil {
+		post.ChannelID = *params.ChannelID
+	}
+	if params.ParentPostID != nil {
+		parent, _ := m.GetPost(ctx, *params.ParentPostID)
+		if parent == nil {
+			return nil, database.ErrParentPostNotFound
+		}
+		post.ThreadRootID = parent.ThreadRootID
+		if post.ThreadRootID == nil {
+			post.ThreadRootID = &parent.ID
+		}
+		post.ChannelID = parent.ChannelID
+	}
+	if post.ChannelID < 1 || post.ChannelID > len(m.channels) {
+		return nil, database.ErrChannelNotFound
+	}
+	post.Channel = m.channels[post.ChannelID-1].Slug
+	m.posts = append(m.posts, post)
+	return &post, nil
+}
+
 func (m *MockDatabase) SetError(err error) {
 	m.err = err
 }
@@ -93,20 +704,31 @@ func TestApiHandler_healthCheck(t *testing.T) {
 	tests := []struct {
 		name           string
 		dbError        error
+		notifications  database.NotificationStatus
 		expectedStatus int
-		expectedBody   map[string]string
+		expectedBody   map[string]any
 	}{
 		{
 			name:           "healthy database",
 			dbError:        nil,
+			notifications:  database.NotificationStatus{Listening: true},
+			expectedStatus: http.StatusOK,
+			expectedBody:   map[string]any{"status": "healthy"},
+		},
+		{
+			name:           "notification listener reconnecting",
+			dbError:        nil,
+			notifications:  database.NotificationStatus{Reconnects: 2, LastError: "conn closed"},
 			expectedStatus: http.StatusOK,
-			expectedBody:   map[string]string{"status": "healthy"},
+			expectedBody: map[string]any{"status": "degraded", "notifications": map[string]any{
+				"listening": false, "since": nil, "reconnects": float64(2), "last_error": "conn closed", "backfilled": float64(0),
+			}},
 		},
 		{
 			name:           "unhealthy database",
 			dbError:        errors.New("database connection failed"),
 			expectedStatus: http.StatusInternalServerError,
-			expectedBody:   map[string]string{"status": "unhealthy", "error": "database connection failed"},
+			expectedBody:   map[string]any{"status": "unhealthy", "error": "database connection failed"},
 		},
 	}
 
@@ -115,6 +737,7 @@ func TestApiHandler_healthCheck(t *testing.T) {
 			// Setup
 			mockDB := NewMockDatabase()
 			mockDB.SetError(tt.dbError)
+			mockDB.notifyStatus = tt.notifications
 			handler := &ApiHandler{db: mockDB}
 
 			e := echo.New()
@@ -134,14 +757,14 @@ func TestApiHandler_healthCheck(t *testing.T) {
 				t.Errorf("Expected status %d, got %d", tt.expectedStatus, rec.Code)
 			}
 
-			var response map[string]string
+			var response map[string]any
 			if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
 				t.Errorf("Failed to unmarshal response: %v", err)
 			}
 
 			for key, expectedValue := range tt.expectedBody {
-				if actualValue, exists := response[key]; !exists || actualValue != expectedValue {
-					t.Errorf("Expected %s=%s, got %s=%s", key, expectedValue, key, actualValue)
+				if actualValue, exists := response[key]; !exists || !reflect.DeepEqual(actualValue, expectedValue) {
+					t.Errorf("Expected %s=%v, got %s=%v", key, expectedValue, key, actualValue)
 				}
 			}
 		})
@@ -185,22 +808,113 @@ func TestApiHandler_getPosts(t *testing.T) {
 			expectedCount:  0,
 		},
 		{
-			name:           "database error",
-			queryParams:    "",
-			dbError:        errors.New("database query failed"),
-			expectedStatus: http.StatusInternalServerError,
-			expectedCount:  0,
+			name:           "filter by agent ID",
+			queryParams:    "?agent_id=2",
+			dbError:        nil,
+			expectedStatus: http.StatusOK,
+			expectedCount:  1,
 		},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			// Setup
-			mockDB := NewMockDatabase()
-			mockDB.SetError(tt.dbError)
-			handler := &ApiHandler{db: mockDB}
-
-			e := echo.New()
+		{
+			name:           "filter by identity key and agent name",
+			queryParams:    "?identity_key=test-agent-1&agent_name=TestAgent",
+			dbError:        nil,
+			expectedStatus: http.StatusOK,
+			expectedCount:  1,
+		},
+		{
+			name:           "filter by time range",
+			queryParams:    "?since=2023-06-21T11:00:00Z&until=2023-06-21T12:00:00Z",
+			dbError:        nil,
+			expectedStatus: http.StatusOK,
+			expectedCount:  1,
+		},
+		{
+			name:           "invalid agent ID",
+			queryParams:    "?agent_id=abc",
+			dbError:        nil,
+			expectedStatus: http.StatusBadRequest,
+			expectedCount:  0,
+		},
+		{
+			name:           "invalid until timestamp",
+			queryParams:    "?until=yesterday",
+			dbError:        nil,
+			expectedStatus: http.StatusBadRequest,
+			expectedCount:  0,
+		},
+		{
+			name:           "invalid metadata key",
+			queryParams:    "?metadata.a%20b=1",
+			dbError:        nil,
+			expectedStatus: http.StatusBadRequest,
+			expectedCount:  0,
+		},
+		{
+			name:           "repeated metadata key",
+			queryParams:    "?metadata.step=1&metadata.step=2",
+			dbError:        nil,
+			expectedStatus: http.StatusBadRequest,
+			expectedCount:  0,
+		},
+		{
+			name:           "get posts before post ID",
+			queryParams:    "?before=1",
+			dbError:        nil,
+			expectedStatus: http.StatusOK,
+			expectedCount:  1,
+		},
+		{
+			name:           "before unknown post ID",
+			queryParams:    "?before=99",
+			dbError:        nil,
+			expectedStatus: http.StatusBadRequest,
+			expectedCount:  0,
+		},
+		{
+			name:           "get posts around post",
+			queryParams:    "?around=2&limit=3",
+			dbError:        nil,
+			expectedStatus: http.StatusOK,
+			expectedCount:  2,
+		},
+		{
+			name:           "around unknown post",
+			queryParams:    "?around=99",
+			dbError:        nil,
+			expectedStatus: http.StatusNotFound,
+			expectedCount:  0,
+		},
+		{
+			name:           "around post outside the filters",
+			queryParams:    "?around=2&agent_id=1",
+			dbError:        nil,
+			expectedStatus: http.StatusNotFound,
+			expectedCount:  0,
+		},
+		{
+			name:           "before and after cursors together",
+			queryParams:    "?before=1&after=" + database.Cursor{Timestamp: time.Date(2023, 6, 21, 11, 0, 0, 0, time.UTC), ID: 2}.Encode(),
+			dbError:        nil,
+			expectedStatus: http.StatusBadRequest,
+			expectedCount:  0,
+		},
+		{
+			name:           "database error",
+			queryParams:    "",
+			dbError:        errors.New("database query failed"),
+			expectedStatus: http.StatusInternalServerError,
+			expectedCount:  0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Setup
+			mockDB := NewMockDatabase()
+			mockDB.SetError(tt.dbError)
+			handler := &ApiHandler{db: mockDB}
+
+			e := echo.New()
 			req := httptest.NewRequest(http.MethodGet, "/posts"+tt.queryParams, nil)
 			rec := httptest.NewRecorder()
 			c := e.NewContext(req, rec)
@@ -245,75 +959,1363 @@ func TestApiHandler_getPosts(t *testing.T) {
 	}
 }
 
-func TestGetEnv(t *testing.T) {
+func TestApiHandler_getPostsPagination(t *testing.T) {
+	// Five posts where the middle three share a timestamp
+	base := time.Date(2023, 6, 21, 12, 0, 0, 0, time.UTC)
+	mockDB := &MockDatabase{}
+	for i, offset := range []time.Duration{0, time.Minute, time.Minute, time.Minute, 2 * time.Minute} {
+		mockDB.posts = append(mockDB.posts, database.Post{ID: i + 1, Content: "post", Timestamp: base.Add(offset)})
+	}
+	handler := &ApiHandler{db: mockDB}
+
+	getPage := func(t *testing.T, query string) database.PostPage {
+		t.Helper()
+		e := echo.New()
+		req := httptest.NewRequest(http.MethodGet, "/posts?"+query, nil)
+		rec := httptest.NewRecorder()
+		if err := handler.getPosts(e.NewContext(req, rec)); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+		}
+		var page database.PostPage
+		if err := json.Unmarshal(rec.Body.Bytes(), &page); err != nil {
+			t.Fatalf("Failed to unmarshal response: %v", err)
+		}
+		return page
+	}
+
+	postIDs := func(page database.PostPage) []int {
+		var ids []int
+		for _, post := range page.Posts {
+			ids = append(ids, post.ID)
+		}
+		return ids
+	}
+
+	t.Run("walk backwards with next_cursor", func(t *testing.T) {
+		var ids []int
+		query := "limit=2"
+		for pages := 0; pages < 5; pages++ {
+			page := getPage(t, query)
+			ids = append(ids, postIDs(page)...)
+			if !page.HasMore {
+				if page.NextCursor != nil {
+					t.Errorf("Expected no next_cursor on the last page")
+				}
+				break
+			}
+			query = "limit=2&before=" + *page.NextCursor
+		}
+		if !slices.Equal(ids, []int{5, 4, 3, 2, 1}) {
+			t.Errorf("Expected posts [5 4 3 2 1], got %v", ids)
+		}
+	})
+
+	t.Run("walk forwards with prev_cursor", func(t *testing.T) {
+		page := getPage(t, "limit=1&before="+database.CursorFor(mockDB.posts[1]).Encode())
+		ids := postIDs(page)
+		for pages := 0; pages < 5; pages++ {
+			page = getPage(t, "limit=2&after="+*page.PrevCursor)
+			ids = append(postIDs(page), ids...)
+			if !page.HasMore {
+				break
+			}
+		}
+		if !slices.Equal(ids, []int{5, 4, 3, 2, 1}) {
+			t.Errorf("Expected posts [5 4 3 2 1], got %v", ids)
+		}
+		if page.PrevCursor == nil {
+			t.Errorf("Expected prev_cursor for polling newer posts")
+		}
+	})
+
+	t.Run("around returns both sides of a post", func(t *testing.T) {
+		page := getPage(t, "around=3&limit=3")
+		if ids := postIDs(page); !slices.Equal(ids, []int{4, 3, 2}) {
+			t.Errorf("Expected posts [4 3 2], got %v", ids)
+		}
+		if !page.HasMore || page.NextCursor == nil {
+			t.Errorf("Expected more older posts with a next_cursor")
+		}
+	})
+
+	t.Run("limit is capped", func(t *testing.T) {
+		page := getPage(t, "limit=100000")
+		if page.Count != 5 {
+			t.Errorf("Expected count 5, got %d", page.Count)
+		}
+	})
+}
+
+func TestApiHandler_searchPosts(t *testing.T) {
+	mockDB := NewMockDatabase()
+	mockDB.posts = append(mockDB.posts,
+		database.Post{ID: 3, AgentID: 1, Content: "Migration failed, retrying migration", Timestamp: time.Date(2023, 6, 21, 10, 0, 0, 0, time.UTC), AgentName: "TestAgent"},
+		database.Post{ID: 4, AgentID: 2, Content: "Migration failed", Timestamp: time.Date(2023, 6, 21, 9, 0, 0, 0, time.UTC), AgentName: "TestAgent2"},
+	)
+	handler := &ApiHandler{db: mockDB}
+
+	search := func(t *testing.T, query string) (int, database.SearchPage) {
+		t.Helper()
+		e := echo.New()
+		req := httptest.NewRequest(http.MethodGet, "/search?"+query, nil)
+		rec := httptest.NewRecorder()
+		if err := handler.searchPosts(e.NewContext(req, rec)); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		var page database.SearchPage
+		if rec.Code == http.StatusOK {
+			if err := json.Unmarshal(rec.Body.Bytes(), &page); err != nil {
+				t.Fatalf("Failed to unmarshal response: %v", err)
+			}
+		}
+		return rec.Code, page
+	}
+
+	t.Run("results are ranked", func(t *testing.T) {
+		status, page := search(t, "q=migration")
+		if status != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d", http.StatusOK, status)
+		}
+		if page.Count != 2 || page.Posts[0].ID != 3 || page.Posts[1].ID != 4 {
+			t.Errorf("Expected posts [3 4], got %+v", page.Posts)
+		}
+		if page.Posts[0].AgentName != "TestAgent" {
+			t.Errorf("Expected agent info on results, got %+v", page.Posts[0].Post)
+		}
+	})
+
+	t.Run("walk pages with next_cursor", func(t *testing.T) {
+		_, page := search(t, "q=migration&limit=1")
+		if !page.HasMore || page.NextCursor == nil {
+			t.Fatalf("Expected a next_cursor on the first page")
+		}
+		_, next := search(t, "q=migration&limit=1&before="+*page.NextCursor)
+		if next.Count != 1 || next.Posts[0].ID != 4 || next.HasMore {
+			t.Errorf("Expected only post 4 on the last page, got %+v", next)
+		}
+	})
+
+	t.Run("filters apply to results", func(t *testing.T) {
+		_, page := search(t, "q=migration&agent_id=2")
+		if page.Count != 1 || page.Posts[0].ID != 4 {
+			t.Errorf("Expected post 4, got %+v", page.Posts)
+		}
+	})
+
+	t.Run("no matches", func(t *testing.T) {
+		status, page := search(t, "q=rollback")
+		if status != http.StatusOK || page.Count != 0 || page.Posts == nil {
+			t.Errorf("Expected an empty result list, got %d %+v", status, page)
+		}
+	})
+
+	for _, query := range []string{"", "q=%20", "q=migration&before=invalid", "q=migration&since=yesterday"} {
+		t.Run("bad request "+query, func(t *testing.T) {
+			if status, _ := search(t, query); status != http.StatusBadRequest {
+				t.Errorf("Expected status %d, got %d", http.StatusBadRequest, status)
+			}
+		})
+	}
+}
+
+func TestApiHandler_createSession(t *testing.T) {
 	tests := []struct {
-		name     string
-		key      string
-		fallback string
-		envValue string
-		expected string
+		name           string
+		body           string
+		dbError        error
+		expectedStatus int
+		expectedError  string
 	}{
 		{
-			name:     "environment variable exists",
-			key:      "TEST_VAR",
-			fallback: "default",
-			envValue: "actual",
-			expected: "actual",
+			name:           "sign in with context",
+			body:           `{"agent_name":"Claude","context":"Docs"}`,
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name:           "missing agent name",
+			body:           `{"context":"Docs"}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  timeline.CodeValidationError,
+		},
+		{
+			name:           "agent name is not a string",
+			body:           `{"agent_name":123}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  timeline.CodeValidationError,
 		},
 		{
-			name:     "environment variable does not exist",
-			key:      "NON_EXISTENT_VAR",
-			fallback: "default",
-			envValue: "",
-			expected: "default",
+			name:           "database error",
+			body:           `{"agent_name":"Claude"}`,
+			dbError:        errors.New("database connection failed"),
+			expectedStatus: http.StatusInternalServerError,
+			expectedError:  timeline.CodeDatabaseError,
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			// Setup
-			if tt.envValue != "" {
-				t.Setenv(tt.key, tt.envValue)
-			}
+			mockDB := NewMockDatabase()
+			mockDB.SetError(tt.dbError)
+			handler := &ApiHandler{db: mockDB, service: timeline.NewService(mockDB)}
+
+			e := echo.New()
+			req := httptest.NewRequest(http.MethodPost, "/sessions", strings.NewReader(tt.body))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
 
 			// Execute
-			result := getEnv(tt.key, tt.fallback)
+			err := handler.createSession(c)
 
 			// Assert
-			if result != tt.expected {
-				t.Errorf("Expected %s, got %s", tt.expected, result)
+			if err != nil {
+				t.Errorf("Expected no error, got %v", err)
+			}
+
+			if rec.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, rec.Code)
+			}
+
+			var response map[string]any
+			if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+				t.Errorf("Failed to unmarshal response: %v", err)
+			}
+
+			if tt.expectedError != "" {
+				if response["error"] != tt.expectedError {
+					t.Errorf("Expected error %s, got %v", tt.expectedError, response["error"])
+				}
+				return
+			}
+
+			if sessionID, _ := response["session_id"].(string); sessionID == "" {
+				t.Errorf("Expected session_id in response")
+			}
+			if response["display_name"] != "Claude - Docs" {
+				t.Errorf("Expected display_name 'Claude - Docs', got %v", response["display_name"])
+			}
+		})
+	}
+}
+
+func TestApiHandler_createPost(t *testing.T) {
+	mockDB := NewMockDatabase()
+	service := timeline.NewService(mockDB)
+	handler := &ApiHandler{db: mockDB, service: service}
+
+	session, err := service.SignIn(context.Background(), "Claude", "", "")
+	if err != nil {
+		t.Fatalf("Failed to sign in: %v", err)
+	}
+
+	tests := []struct {
+		name           string
+		body           string
+		expectedStatus int
+		expectedError  string
+	}{
+		{
+			name:           "create post",
+			body:           `{"session_id":"` + session.SessionID + `","content":"Posted from CI"}`,
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name:           "empty content",
+			body:           `{"session_id":"` + session.SessionID + `","content":"  "}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  timeline.CodeValidationError,
+		},
+		{
+			name:           "content too long",
+			body:           `{"session_id":"` + session.SessionID + `","content":"` + strings.Repeat("a", 281) + `"}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  timeline.CodeValidationError,
+		},
+		{
+			name:           "missing session",
+			body:           `{"content":"Posted from CI"}`,
+			expectedStatus: http.StatusUnauthorized,
+			expectedError:  timeline.CodeSessionError,
+		},
+		{
+			name:           "unknown session",
+			body:           `{"session_id":"unknown","content":"Posted from CI"}`,
+			expectedStatus: http.StatusUnauthorized,
+			expectedError:  timeline.CodeSessionError,
+		},
+		{
+			name:           "reply to post",
+			body:           `{"session_id":"` + session.SessionID + `","content":"Replying","parent_post_id":1}`,
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name:           "reply to unknown post",
+			body:           `{"session_id":"` + session.SessionID + `","content":"Replying","parent_post_id":99}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  timeline.CodeValidationError,
+		},
+		{
+			name:           "invalid body",
+			body:           `not json`,
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  timeline.CodeValidationError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := echo.New()
+			req := httptest.NewRequest(http.MethodPost, "/posts", strings.NewReader(tt.body))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+
+			if err := handler.createPost(c); err != nil {
+				t.Errorf("Expected no error, got %v", err)
+			}
+
+			if rec.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, rec.Code)
+			}
+
+			var response map[string]any
+			if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+				t.Errorf("Failed to unmarshal response: %v", err)
+			}
+
+			if tt.expectedError != "" && response["error"] != tt.expectedError {
+				t.Errorf("Expected error %s, got %v", tt.expectedError, response["error"])
+			}
+			if tt.expectedError == "" && response["post_id"] == nil {
+				t.Errorf("Expected post_id in response, got %v", response)
 			}
 		})
 	}
 }
 
-func TestMustGetEnv(t *testing.T) {
-	t.Run("environment variable exists", func(t *testing.T) {
-		// Setup
-		key := "TEST_MUST_VAR"
-		expected := "test_value"
-		t.Setenv(key, expected)
+func TestApiHandler_getThread(t *testing.T) {
+	mockDB := NewMockDatabase()
+	rootID, replyID := 1, 3
+	mockDB.posts = append(mockDB.posts,
+		database.Post{ID: 3, Content: "Reply", Timestamp: time.Date(2023, 6, 21, 13, 0, 0, 0, time.UTC), ParentPostID: &rootID, ThreadRootID: &rootID},
+		database.Post{ID: 4, Content: "Nested reply", Timestamp: time.Date(2023, 6, 21, 14, 0, 0, 0, time.UTC), ParentPostID: &replyID, ThreadRootID: &rootID},
+	)
+	handler := &ApiHandler{db: mockDB}
+
+	getThread := func(t *testing.T, id string) (int, database.Thread) {
+		t.Helper()
+		e := echo.New()
+		req := httptest.NewRequest(http.MethodGet, "/posts/"+id+"/thread", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetParamNames("id")
+		c.SetParamValues(id)
+		if err := handler.getThread(c); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		var thread database.Thread
+		if rec.Code == http.StatusOK {
+			if err := json.Unmarshal(rec.Body.Bytes(), &thread); err != nil {
+				t.Fatalf("Failed to unmarshal response: %v", err)
+			}
+		}
+		return rec.Code, thread
+	}
+
+	t.Run("any post returns the whole tree", func(t *testing.T) {
+		for _, id := range []string{"1", "4"} {
+			status, thread := getThread(t, id)
+			if status != http.StatusOK {
+				t.Fatalf("Expected status %d, got %d", http.StatusOK, status)
+			}
+			if thread.Count != 3 || thread.Root.ID != 1 {
+				t.Fatalf("Expected a 3 post thread rooted at post 1, got %+v", thread)
+			}
+			if len(thread.Root.Replies) != 1 || len(thread.Root.Replies[0].Replies) != 1 || thread.Root.Replies[0].Replies[0].ID != 4 {
+				t.Errorf("Expected post 4 nested under post 3, got %+v", thread.Root.Replies)
+			}
+		}
+	})
 
-		// Execute
-		result := mustGetEnv(key)
+	t.Run("unknown post", func(t *testing.T) {
+		if status, _ := getThread(t, "99"); status != http.StatusNotFound {
+			t.Errorf("Expected status %d, got %d", http.StatusNotFound, status)
+		}
+	})
 
-		// Assert
-		if result != expected {
-			t.Errorf("Expected %s, got %s", expected, result)
+	t.Run("invalid post ID", func(t *testing.T) {
+		if status, _ := getThread(t, "abc"); status != http.StatusBadRequest {
+			t.Errorf("Expected status %d, got %d", http.StatusBadRequest, status)
 		}
 	})
+}
 
-	t.Run("environment variable does not exist", func(t *testing.T) {
-		// Setup
-		key := "NON_EXISTENT_MUST_VAR"
+func TestApiHandler_reactions(t *testing.T) {
+	mockDB := NewMockDatabase()
+	service := timeline.NewService(mockDB)
+	broadcaster := NewSSEBroadcaster()
+	handler := &ApiHandler{db: mockDB, service: service, broadcaster: broadcaster}
 
-		// Execute & Assert
-		defer func() {
-			if r := recover(); r == nil {
-				t.Errorf("Expected panic for non-existent environment variable")
-			}
-		}()
+	events := NewEventQueue(10, DropOldest)
+	broadcaster.AddClient(&SSEClient{ID: "test", Queue: events})
+
+	session, err := service.SignIn(context.Background(), "Claude", "", "")
+	if err != nil {
+		t.Fatalf("Failed to sign in: %v", err)
+	}
+
+	react := func(t *testing.T, method, id, body string) (int, map[string]any) {
+		t.Helper()
+		e := echo.New()
+		req := httptest.NewRequest(method, "/posts/"+id+"/reactions", strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetParamNames("id")
+		c.SetParamValues(id)
+
+		handle := handler.addReaction
+		if method == http.MethodDelete {
+			handle = handler.deleteReaction
+		}
+		if err := handle(c); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		var response map[string]any
+		if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+			t.Fatalf("Failed to unmarshal response: %v", err)
+		}
+		return rec.Code, response
+	}
+
+	// Reaction changes are broadcast when the database announces them
+	notify := func(t *testing.T, operation, reactor, emoji string) PostEvent {
+		t.Helper()
+		if events.Len() != 0 {
+			t.Fatalf("Expected no events before the notification, got %d", events.Len())
+		}
+		payload := &database.NotificationPayload{
+			Timestamp:   time.Now(),
+			Operation:   operation,
+			Table:       database.NotificationTableReactions,
+			PostID:      1,
+			ReactorType: database.ReactorHuman,
+			Reactor:     reactor,
+			Emoji:       emoji,
+		}
+		if err := handleNotification(context.Background(), mockDB, broadcaster, payload); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		message := pop(t, events)
+		var event PostEvent
+		if err := json.Unmarshal(message.Data, &event); err != nil {
+			t.Fatalf("Failed to unmarshal event: %v", err)
+		}
+		if message.Name != SSEEventPostUpdated || event.Type != SSEEventPostUpdated {
+			t.Errorf("Expected a post_updated event, got %s %+v", message.Name, event)
+		}
+		return event
+	}
 
-		mustGetEnv(key)
+	t.Run("agent and human reactions are counted", func(t *testing.T) {
+		if status, _ := react(t, http.MethodPost, "1", `{"session_id":"`+session.SessionID+`","emoji":"👍"}`); status != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d", http.StatusOK, status)
+		}
+		status, post := react(t, http.MethodPost, "1", `{"reactor":"alice","emoji":"👍"}`)
+		if status != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d", http.StatusOK, status)
+		}
+		reactions, _ := post["reactions"].([]any)
+		if len(reactions) != 1 || reactions[0].(map[string]any)["count"] != float64(2) {
+			t.Errorf("Expected 2 thumbs up reactions, got %v", post["reactions"])
+		}
+
+		event := notify(t, database.NotificationInsert, "alice", "👍")
+		if event.Reaction == nil || event.Reaction.Action != "added" || event.Reaction.Reactor != "alice" || event.Reaction.ReactorType != database.ReactorHuman || event.Reaction.Emoji != "👍" {
+			t.Errorf("Unexpected reaction event %+v", event)
+		}
+		if event.Post == nil || event.Post.ID != 1 || len(event.Post.Reactions) != 1 || event.Post.Reactions[0].Count != 2 {
+			t.Errorf("Expected the updated post in the event, got %+v", event.Post)
+		}
 	})
-}
\ No newline at end of file
+
+	t.Run("reacting again replaces the reaction", func(t *testing.T) {
+		_, post := react(t, http.MethodPost, "1", `{"reactor":"alice","emoji":"🎉"}`)
+		reactions, _ := post["reactions"].([]any)
+		if len(reactions) != 2 {
+			t.Errorf("Expected one 👍 and one 🎉 reaction, got %v", post["reactions"])
+		}
+		if event := notify(t, database.NotificationUpdate, "alice", "🎉"); event.Reaction == nil || event.Reaction.Action != "added" || event.Reaction.Emoji != "🎉" {
+			t.Errorf("Expected a replaced reaction event, got %+v", event)
+		}
+	})
+
+	t.Run("remove reaction", func(t *testing.T) {
+		status, post := react(t, http.MethodDelete, "1", `{"reactor":"alice"}`)
+		if status != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d", http.StatusOK, status)
+		}
+		reactions, _ := post["reactions"].([]any)
+		if len(reactions) != 1 || reactions[0].(map[string]any)["emoji"] != "👍" {
+			t.Errorf("Expected only the agent reaction to remain, got %v", post["reactions"])
+		}
+		if event := notify(t, database.NotificationDelete, "alice", ""); event.Reaction == nil || event.Reaction.Action != "removed" || len(event.Post.Reactions) != 1 {
+			t.Errorf("Expected a removed reaction event, got %+v", event)
+		}
+
+		if status, _ := react(t, http.MethodDelete, "1", `{"reactor":"alice"}`); status != http.StatusNotFound {
+			t.Errorf("Expected status %d removing a missing reaction, got %d", http.StatusNotFound, status)
+		}
+	})
+
+	errorTests := []struct {
+		name           string
+		id             string
+		body           string
+		expectedStatus int
+	}{
+		{"unknown post", "99", `{"reactor":"alice","emoji":"👍"}`, http.StatusNotFound},
+		{"invalid post ID", "abc", `{"reactor":"alice","emoji":"👍"}`, http.StatusBadRequest},
+		{"missing emoji", "1", `{"reactor":"alice"}`, http.StatusBadRequest},
+		{"emoji with spaces", "1", `{"reactor":"alice","emoji":"a b"}`, http.StatusBadRequest},
+		{"missing reactor", "1", `{"emoji":"👍"}`, http.StatusBadRequest},
+		{"unknown session", "1", `{"session_id":"unknown","emoji":"👍"}`, http.StatusUnauthorized},
+	}
+	for _, tt := range errorTests {
+		t.Run(tt.name, func(t *testing.T) {
+			if status, _ := react(t, http.MethodPost, tt.id, tt.body); status != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, status)
+			}
+		})
+	}
+}
+
+func TestApiHandler_mentions(t *testing.T) {
+	mockDB := NewMockDatabase()
+	service := timeline.NewService(mockDB)
+	handler := &ApiHandler{db: mockDB, service: service}
+
+	if _, err := service.SignIn(context.Background(), "Claude", "docs", ""); err != nil {
+		t.Fatalf("Failed to sign in: %v", err)
+	}
+	mockDB.addMention(1, 1)
+	mockDB.addMention(2, 1)
+
+	request := func(t *testing.T, method, path, id, body string, handle func(echo.Context) error) (int, []byte) {
+		t.Helper()
+		e := echo.New()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetParamNames("id")
+		c.SetParamValues(id)
+		if err := handle(c); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		return rec.Code, rec.Body.Bytes()
+	}
+
+	getMentions := func(t *testing.T, query string) database.MentionPage {
+		t.Helper()
+		status, body := request(t, http.MethodGet, "/agents/1/mentions?"+query, "1", "", handler.getMentions)
+		if status != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d", http.StatusOK, status)
+		}
+		var page database.MentionPage
+		if err := json.Unmarshal(body, &page); err != nil {
+			t.Fatalf("Failed to unmarshal response: %v", err)
+		}
+		return page
+	}
+
+	t.Run("list mentions newest first", func(t *testing.T) {
+		page := getMentions(t, "limit=1")
+		if page.Count != 1 || page.Mentions[0].ID != 1 || !page.HasMore || page.UnreadCount != 2 {
+			t.Fatalf("Unexpected page %+v", page)
+		}
+
+		older := getMentions(t, "before="+*page.NextCursor)
+		if older.Count != 1 || older.Mentions[0].ID != 2 || older.HasMore {
+			t.Errorf("Unexpected older page %+v", older)
+		}
+	})
+
+	t.Run("mark mentions read", func(t *testing.T) {
+		status, body := request(t, http.MethodPost, "/agents/1/mentions/read", "1", `{"post_ids":[1]}`, handler.markMentionsRead)
+		if status != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d", http.StatusOK, status)
+		}
+		var response map[string]int
+		if err := json.Unmarshal(body, &response); err != nil {
+			t.Fatalf("Failed to unmarshal response: %v", err)
+		}
+		if response["marked"] != 1 || response["unread_count"] != 1 {
+			t.Errorf("Expected 1 marked and 1 unread, got %v", response)
+		}
+
+		page := getMentions(t, "unread=true")
+		if page.Count != 1 || page.Mentions[0].ID != 2 || page.Mentions[0].ReadAt != nil {
+			t.Errorf("Expected only post 2 unread, got %+v", page)
+		}
+	})
+
+	t.Run("unknown agent", func(t *testing.T) {
+		if status, _ := request(t, http.MethodGet, "/agents/99/mentions", "99", "", handler.getMentions); status != http.StatusNotFound {
+			t.Errorf("Expected status %d, got %d", http.StatusNotFound, status)
+		}
+	})
+
+	t.Run("invalid cursor", func(t *testing.T) {
+		if status, _ := request(t, http.MethodGet, "/agents/1/mentions?before=bad", "1", "", handler.getMentions); status != http.StatusBadRequest {
+			t.Errorf("Expected status %d, got %d", http.StatusBadRequest, status)
+		}
+	})
+}
+
+func TestBroadcastMentions(t *testing.T) {
+	mockDB := NewMockDatabase()
+	service := timeline.NewService(mockDB)
+	broadcaster := NewSSEBroadcaster()
+
+	events := NewEventQueue(10, DropOldest)
+	broadcaster.AddClient(&SSEClient{ID: "test", Queue: events})
+
+	if _, err := service.SignIn(context.Background(), "Claude", "docs", ""); err != nil {
+		t.Fatalf("Failed to sign in: %v", err)
+	}
+	mentioned, err := mockDB.GetAgent(context.Background(), 1)
+	if err != nil {
+		t.Fatalf("Failed to get agent: %v", err)
+	}
+	mockDB.posts[1].Content = "@Claude - Docs please review"
+	mockDB.addMention(2, 1)
+
+	// Clients following the mentioned agent receive the mention but not the post of the author
+	mentionedID := mentioned.ID
+	byAgentID := NewEventQueue(10, DropOldest)
+	broadcaster.AddClient(&SSEClient{ID: "agent", Queue: byAgentID, Filter: SSEFilter{AgentID: &mentionedID}})
+	byIdentityKey := NewEventQueue(10, DropOldest)
+	broadcaster.AddClient(&SSEClient{ID: "identity", Queue: byIdentityKey, Filter: SSEFilter{IdentityKey: mentioned.IdentityKey}})
+	authorID := mockDB.posts[1].AgentID
+	byAuthor := NewEventQueue(10, DropOldest)
+	broadcaster.AddClient(&SSEClient{ID: "author", Queue: byAuthor, Filter: SSEFilter{AgentID: &authorID}})
+
+	payload := &database.NotificationPayload{Table: database.NotificationTablePosts, PostID: 2, AgentID: 2}
+	if err := handleNotification(context.Background(), mockDB, broadcaster, payload); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	newPost := pop(t, events)
+	var post PostEvent
+	if err := json.Unmarshal(newPost.Data, &post); err != nil {
+		t.Fatalf("Failed to unmarshal event: %v", err)
+	}
+	if newPost.Name != SSEEventNewPost || newPost.PostID != 2 || post.Post == nil || post.Post.DisplayName != mockDB.posts[1].DisplayName || post.Post.Content != "@Claude - Docs please review" {
+		t.Errorf("Unexpected new_post event %s %+v", newPost.Name, post)
+	}
+
+	mention := pop(t, events)
+	var event PostEvent
+	if err := json.Unmarshal(mention.Data, &event); err != nil {
+		t.Fatalf("Failed to unmarshal event: %v", err)
+	}
+	if mention.Name != SSEEventMention || event.Type != SSEEventMention || event.Post == nil || event.Post.ID != 2 || event.MentionedAgent == nil || event.MentionedAgent.ID != 1 || event.MentionedAgent.DisplayName != "Claude - docs" {
+		t.Errorf("Unexpected mention event %s %+v", mention.Name, event)
+	}
+	if events.Len() != 0 {
+		t.Errorf("Expected a single mention event, got %d more", events.Len())
+	}
+
+	for name, queue := range map[string]*EventQueue{"agent_id": byAgentID, "identity_key": byIdentityKey} {
+		if event := pop(t, queue); event.Name != SSEEventMention || queue.Len() != 0 {
+			t.Errorf("Expected only the mention for the %s filter, got %s and %d more", name, event.Name, queue.Len())
+		}
+	}
+	if event := pop(t, byAuthor); event.Name != SSEEventNewPost || byAuthor.Len() != 0 {
+		t.Errorf("Expected only the new post for the author, got %s and %d more", event.Name, byAuthor.Len())
+	}
+}
+
+func TestApiHandler_tags(t *testing.T) {
+	mockDB := NewMockDatabase()
+	mockDB.posts[0].Tags = []string{"migration"}
+	mockDB.posts[1].Tags = []string{"flaky-test", "migration"}
+	handler := &ApiHandler{db: mockDB}
+
+	t.Run("list tags", func(t *testing.T) {
+		e := echo.New()
+		req := httptest.NewRequest(http.MethodGet, "/tags?since=2023-06-21T11:30:00Z", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		if err := handler.getTags(c); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d", http.StatusOK, rec.Code)
+		}
+
+		var response struct {
+			Tags  []database.TagSummary `json:"tags"`
+			Count int                   `json:"count"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+			t.Fatalf("Failed to unmarshal response: %v", err)
+		}
+		if response.Count != 2 || response.Tags[0].Name != "migration" || response.Tags[0].PostCount != 2 || response.Tags[0].RecentCount != 1 {
+			t.Errorf("Unexpected tags %+v", response.Tags)
+		}
+	})
+
+	t.Run("invalid since", func(t *testing.T) {
+		e := echo.New()
+		req := httptest.NewRequest(http.MethodGet, "/tags?since=yesterday", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		if err := handler.getTags(c); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("Expected status %d, got %d", http.StatusBadRequest, rec.Code)
+		}
+	})
+
+	t.Run("filter posts by tag", func(t *testing.T) {
+		e := echo.New()
+		req := httptest.NewRequest(http.MethodGet, "/posts?tag=%23Flaky-Test", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		if err := handler.getPosts(c); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		var page database.PostPage
+		if err := json.Unmarshal(rec.Body.Bytes(), &page); err != nil {
+			t.Fatalf("Failed to unmarshal response: %v", err)
+		}
+		if page.Count != 1 || page.Posts[0].ID != 2 {
+			t.Errorf("Expected only post 2, got %+v", page.Posts)
+		}
+	})
+}
+
+func TestSSEBroadcaster_BroadcastPost(t *testing.T) {
+	broadcaster := NewSSEBroadcaster()
+	all := &SSEClient{ID: "all", Queue: NewEventQueue(10, DropOldest)}
+	migration := &SSEClient{ID: "migration", Queue: NewEventQueue(10, DropOldest), Filter: SSEFilter{Tag: "migration"}}
+	docs := &SSEClient{ID: "docs", Queue: NewEventQueue(10, DropOldest), Filter: SSEFilter{Channel: "docs"}}
+	agentID := 2
+	agent := &SSEClient{ID: "agent", Queue: NewEventQueue(10, DropOldest), Filter: SSEFilter{AgentID: &agentID}}
+	identity := &SSEClient{ID: "identity", Queue: NewEventQueue(10, DropOldest), Filter: SSEFilter{IdentityKey: "gemini-docs"}}
+	text := &SSEClient{ID: "text", Queue: NewEventQueue(10, DropOldest), Filter: SSEFilter{Text: "flaky"}}
+	for _, client := range []*SSEClient{all, migration, docs, agent, identity, text} {
+		broadcaster.AddClient(client)
+	}
+
+	broadcaster.BroadcastPost(context.Background(), SSEEventPostUpdated, []byte(`{"type":"post_updated"}`), SSESubject{
+		AgentID: 1, IdentityKey: "claude-general", Channel: database.GeneralChannel,
+		Tags: []string{"flaky-test"}, Content: "Retrying the Flaky suite #flaky-test",
+	})
+	broadcaster.BroadcastPost(context.Background(), SSEEventPostUpdated, []byte(`{"type":"post_updated"}`), SSESubject{
+		AgentID: 1, IdentityKey: "claude-general", Channel: database.GeneralChannel,
+		Tags: []string{"flaky-test", "migration"}, Content: "#flaky-test #migration",
+	})
+	broadcaster.BroadcastPost(context.Background(), SSEEventPostUpdated, []byte(`{"type":"post_updated"}`), SSESubject{
+		AgentID: 2, IdentityKey: "gemini-docs", Channel: "docs", Content: "Docs updated",
+	})
+	broadcaster.BroadcastPost(context.Background(), SSEEventAgentSignedOut, []byte(`{"type":"agent_signed_out"}`), SSESubject{
+		AgentID: 2, IdentityKey: "gemini-docs", Channel: "docs",
+	})
+	broadcaster.Broadcast(context.Background(), "notice", []byte(`{"type":"notice"}`))
+
+	for _, tc := range []struct {
+		client *SSEClient
+		want   int
+	}{
+		{all, 5},
+		{migration, 2},
+		{docs, 3},
+		{agent, 3},
+		{identity, 3},
+		{text, 3},
+	} {
+		if tc.client.Queue.Len() != tc.want {
+			t.Errorf("Expected the %s client to receive %d events, got %d", tc.client.ID, tc.want, tc.client.Queue.Len())
+		}
+	}
+}
+
+func TestApiHandler_sseResume(t *testing.T) {
+	mockDB := NewMockDatabase()
+	mockDB.posts = append(mockDB.posts, database.Post{
+		ID:        3,
+		AgentID:   1,
+		Content:   "Docs update #docs",
+		Timestamp: time.Date(2023, 6, 21, 13, 0, 0, 0, time.UTC),
+		ChannelID: 2,
+		Channel:   "docs",
+		Tags:      []string{"docs"},
+	})
+	handler := &ApiHandler{db: mockDB, service: timeline.NewService(mockDB), broadcaster: NewSSEBroadcaster()}
+
+	// stream runs the handler on a request that is already cancelled, so that it
+	// returns once the connection and replay messages have been written
+	stream := func(t *testing.T, target, lastEventID string) (int, string) {
+		t.Helper()
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		req := httptest.NewRequest(http.MethodGet, target, nil).WithContext(ctx)
+		if lastEventID != "" {
+			req.Header.Set("Last-Event-ID", lastEventID)
+		}
+		rec := httptest.NewRecorder()
+		if err := handler.sseHandler(echo.New().NewContext(req, rec)); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		return rec.Code, rec.Body.String()
+	}
+
+	t.Run("new stream starts at the latest post", func(t *testing.T) {
+		_, body := stream(t, "/events", "")
+		if !strings.HasPrefix(body, "retry: 3000\nid: 3\nevent: connected\ndata: {\"type\":\"connected\"") {
+			t.Errorf("Expected retry hint and connected event with ID 3, got %q", body)
+		}
+		if strings.Contains(body, "new_post") {
+			t.Errorf("Expected no replay, got %q", body)
+		}
+	})
+
+	t.Run("replays missed posts", func(t *testing.T) {
+		_, body := stream(t, "/events", "1")
+		for _, expected := range []string{"id: 2\nevent: new_post\ndata: {", `"post":{"id":2`, "id: 3\nevent: new_post\ndata: {", `"post":{"id":3`, "id: 3\nevent: replayed\ndata: {\"count\":2,\"has_more\":false,\"type\":\"replayed\"}"} {
+			if !strings.Contains(body, expected) {
+				t.Errorf("Expected %q in %q", expected, body)
+			}
+		}
+		if strings.Contains(body, `"post":{"id":1`) {
+			t.Errorf("Expected the acknowledged post not to be replayed, got %q", body)
+		}
+	})
+
+	t.Run("replays posts that may have become visible out of order", func(t *testing.T) {
+		// Post 1 is not older than post 2 by more than SSEReplayOverlap, so it is sent again,
+		// with the ID of the acknowledged post so that the IDs never decrease
+		_, body := stream(t, "/events", "2")
+		for _, expected := range []string{"id: 2\nevent: new_post\ndata: {", `"post":{"id":1`, "id: 3\nevent: new_post\ndata: {", `"post":{"id":3`, "id: 3\nevent: replayed\ndata: {\"count\":2,\"has_more\":false,\"type\":\"replayed\"}"} {
+			if !strings.Contains(body, expected) {
+				t.Errorf("Expected %q in %q", expected, body)
+			}
+		}
+		if strings.Contains(body, `"post":{"id":2`) {
+			t.Errorf("Expected the acknowledged post not to be replayed, got %q", body)
+		}
+	})
+
+	t.Run("replay follows filters", func(t *testing.T) {
+		_, body := stream(t, "/events?since_id=0&channel=docs", "")
+		if strings.Contains(body, `"post":{"id":1`) || !strings.Contains(body, `"post":{"id":3`) || !strings.Contains(body, `"tags":["docs"]`) {
+			t.Errorf("Expected only the docs post, got %q", body)
+		}
+	})
+
+	t.Run("replay follows text filter", func(t *testing.T) {
+		_, body := stream(t, "/events?since_id=0&q=DOCS", "")
+		if strings.Contains(body, `"post":{"id":1`) || strings.Contains(body, `"post":{"id":2`) || !strings.Contains(body, `"post":{"id":3`) {
+			t.Errorf("Expected only the post mentioning docs, got %q", body)
+		}
+	})
+
+	t.Run("invalid agent filter", func(t *testing.T) {
+		if status, _ := stream(t, "/events?agent_id=abc", ""); status != http.StatusBadRequest {
+			t.Errorf("Expected status %d, got %d", http.StatusBadRequest, status)
+		}
+	})
+
+	t.Run("invalid last event ID", func(t *testing.T) {
+		if status, _ := stream(t, "/events?since_id=abc", ""); status != http.StatusBadRequest {
+			t.Errorf("Expected status %d, got %d", http.StatusBadRequest, status)
+		}
+	})
+}
+
+func TestBroadcastSessionStarted(t *testing.T) {
+	broadcaster := NewSSEBroadcaster()
+	all := &SSEClient{ID: "all", Queue: NewEventQueue(10, DropOldest)}
+	tagged := &SSEClient{ID: "tagged", Queue: NewEventQueue(10, DropOldest), Filter: SSEFilter{Tag: "migration"}}
+	broadcaster.AddClient(all)
+	broadcaster.AddClient(tagged)
+
+	mockDB := NewMockDatabase()
+	service := timeline.NewService(mockDB)
+	if _, err := service.SignIn(context.Background(), "Claude", "Docs", ""); err != nil {
+		t.Fatalf("Failed to sign in: %v", err)
+	}
+
+	payload := &database.NotificationPayload{Table: database.NotificationTableSessions, SessionID: mockDB.sessions[0].ID, AgentID: 1}
+	if err := handleNotification(context.Background(), mockDB, broadcaster, payload); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if tagged.Queue.Len() != 0 {
+		t.Errorf("Expected the tag filtered client to receive no events, got %d", tagged.Queue.Len())
+	}
+	if all.Queue.Len() != 1 {
+		t.Fatalf("Expected 1 event, got %d", all.Queue.Len())
+	}
+	message := pop(t, all.Queue)
+	var event AgentEvent
+	if err := json.Unmarshal(message.Data, &event); err != nil {
+		t.Fatalf("Failed to unmarshal event: %v", err)
+	}
+	if message.Name != SSEEventAgentSignedIn || event.Type != SSEEventAgentSignedIn || event.Session == nil || event.Session.ID != mockDB.sessions[0].ID || event.Session.AgentID != 1 {
+		t.Errorf("Unexpected event %s %+v", message.Name, event)
+	}
+
+	payload.SessionID = 99
+	if err := handleNotification(context.Background(), mockDB, broadcaster, payload); err == nil {
+		t.Error("Expected an error for an unknown session")
+	}
+}
+
+func TestBroadcastSessionEnded(t *testing.T) {
+	// Sign outs and expiries both end the session with an update, which the database
+	// announces to every server process
+	tests := []struct {
+		reason string
+		end    func(t *testing.T, service *timeline.Service, mockDB *MockDatabase, token string)
+	}{
+		{
+			reason: database.SessionEndSignedOut,
+			end: func(t *testing.T, service *timeline.Service, _ *MockDatabase, token string) {
+				if _, err := service.SignOut(context.Background(), token); err != nil {
+					t.Fatalf("Failed to sign out: %v", err)
+				}
+			},
+		},
+		{
+			reason: database.SessionEndIdleTimeout,
+			end: func(t *testing.T, service *timeline.Service, mockDB *MockDatabase, _ string) {
+				mockDB.sessions[0].LastSeenAt = time.Now().Add(-2 * timeline.SessionTimeout)
+				if expired, err := service.ExpireIdleSessions(context.Background(), false); err != nil || len(expired) != 1 {
+					t.Fatalf("Expected 1 expired session, got %+v (err: %v)", expired, err)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.reason, func(t *testing.T) {
+			broadcaster := NewSSEBroadcaster()
+			all := &SSEClient{ID: "all", Queue: NewEventQueue(10, DropOldest)}
+			docs := &SSEClient{ID: "docs", Queue: NewEventQueue(10, DropOldest), Filter: SSEFilter{Channel: "docs"}}
+			broadcaster.AddClient(all)
+			broadcaster.AddClient(docs)
+
+			mockDB := NewMockDatabase()
+			service := timeline.NewService(mockDB)
+			session, err := service.SignIn(context.Background(), "Claude", "Docs", "")
+			if err != nil {
+				t.Fatalf("Failed to sign in: %v", err)
+			}
+			tt.end(t, service, mockDB, session.SessionID)
+
+			payload := &database.NotificationPayload{
+				Operation: database.NotificationUpdate,
+				Table:     database.NotificationTableSessions,
+				SessionID: mockDB.sessions[0].ID,
+				EndReason: tt.reason,
+			}
+			if err := handleNotification(context.Background(), mockDB, broadcaster, payload); err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+
+			if docs.Queue.Len() != 0 {
+				t.Errorf("Expected the docs channel client to receive no events, got %d", docs.Queue.Len())
+			}
+			if all.Queue.Len() != 1 {
+				t.Fatalf("Expected 1 event, got %d", all.Queue.Len())
+			}
+			message := pop(t, all.Queue)
+			var event AgentEvent
+			if err := json.Unmarshal(message.Data, &event); err != nil {
+				t.Fatalf("Failed to unmarshal event: %v", err)
+			}
+			if message.Name != SSEEventAgentSignedOut || event.Type != SSEEventAgentSignedOut || event.Session == nil || event.Session.EndReason == nil ||
+				*event.Session.EndReason != tt.reason || event.Session.AgentID != 1 || event.Session.Channel != database.GeneralChannel {
+				t.Errorf("Unexpected event %s %+v", message.Name, event)
+			}
+		})
+	}
+}
+
+func TestApiHandler_channels(t *testing.T) {
+	mockDB := NewMockDatabase()
+	service := timeline.NewService(mockDB)
+	handler := &ApiHandler{db: mockDB, service: service}
+
+	request := func(t *testing.T, method, path, slug, body string, handle func(echo.Context) error) (int, []byte) {
+		t.Helper()
+		e := echo.New()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		if slug != "" {
+			c.SetParamNames("slug")
+			c.SetParamValues(slug)
+		}
+		if err := handle(c); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		return rec.Code, rec.Body.Bytes()
+	}
+
+	t.Run("create channel", func(t *testing.T) {
+		status, body := request(t, http.MethodPost, "/channels", "", `{"slug":"Docs","name":"Docs rewrite"}`, handler.createChannel)
+		if status != http.StatusCreated {
+			t.Fatalf("Expected status %d, got %d: %s", http.StatusCreated, status, body)
+		}
+		var channel database.Channel
+		if err := json.Unmarshal(body, &channel); err != nil {
+			t.Fatalf("Failed to unmarshal response: %v", err)
+		}
+		if channel.Slug != "docs" || channel.Name != "Docs rewrite" {
+			t.Errorf("Unexpected channel %+v", channel)
+		}
+
+		status, body = request(t, http.MethodPost, "/channels", "", `{"slug":"docs","name":"Docs"}`, handler.createChannel)
+		if status != http.StatusBadRequest || !strings.Contains(string(body), "Channel already exists") {
+			t.Errorf("Expected a duplicate slug to be rejected, got %d: %s", status, body)
+		}
+	})
+
+	t.Run("list channels", func(t *testing.T) {
+		status, body := request(t, http.MethodGet, "/channels", "", "", handler.getChannels)
+		if status != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d", http.StatusOK, status)
+		}
+		var response struct {
+			Channels []database.Channel `json:"channels"`
+			Count    int                `json:"count"`
+		}
+		if err := json.Unmarshal(body, &response); err != nil {
+			t.Fatalf("Failed to unmarshal response: %v", err)
+		}
+		if response.Count != 2 || response.Channels[0].Slug != "docs" || response.Channels[1].Slug != database.GeneralChannel {
+			t.Errorf("Unexpected channels %+v", response.Channels)
+		}
+	})
+
+	t.Run("post to a channel", func(t *testing.T) {
+		status, body := request(t, http.MethodPost, "/sessions", "", `{"agent_name":"Claude","channel":"docs"}`, handler.createSession)
+		if status != http.StatusCreated {
+			t.Fatalf("Expected status %d, got %d: %s", http.StatusCreated, status, body)
+		}
+		var session timeline.SignInResponse
+		if err := json.Unmarshal(body, &session); err != nil {
+			t.Fatalf("Failed to unmarshal response: %v", err)
+		}
+		if session.Channel != "docs" {
+			t.Errorf("Expected session channel docs, got %s", session.Channel)
+		}
+
+		status, body = request(t, http.MethodPost, "/posts", "", `{"session_id":"`+session.SessionID+`","content":"Docs update"}`, handler.createPost)
+		if status != http.StatusCreated || !strings.Contains(string(body), `"channel":"docs"`) {
+			t.Errorf("Expected a post in the docs channel, got %d: %s", status, body)
+		}
+
+		status, body = request(t, http.MethodPost, "/sessions", "", `{"agent_name":"Claude","channel":"unknown"}`, handler.createSession)
+		if status != http.StatusBadRequest {
+			t.Errorf("Expected status %d for an unknown channel, got %d: %s", http.StatusBadRequest, status, body)
+		}
+	})
+
+	t.Run("channel posts", func(t *testing.T) {
+		status, body := request(t, http.MethodGet, "/channels/docs/posts", "docs", "", handler.getChannelPosts)
+		if status != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d", http.StatusOK, status)
+		}
+		var page database.PostPage
+		if err := json.Unmarshal(body, &page); err != nil {
+			t.Fatalf("Failed to unmarshal response: %v", err)
+		}
+		if page.Count != 1 || page.Posts[0].Content != "Docs update" {
+			t.Errorf("Expected only the docs post, got %+v", page.Posts)
+		}
+
+		status, body = request(t, http.MethodGet, "/posts?channel=general", "", "", handler.getPosts)
+		if err := json.Unmarshal(body, &page); err != nil {
+			t.Fatalf("Failed to unmarshal response: %v", err)
+		}
+		if status != http.StatusOK || page.Count != 2 {
+			t.Errorf("Expected the 2 general posts, got %d: %+v", status, page.Posts)
+		}
+	})
+
+	t.Run("unknown channel", func(t *testing.T) {
+		if status, _ := request(t, http.MethodGet, "/channels/unknown/posts", "unknown", "", handler.getChannelPosts); status != http.StatusNotFound {
+			t.Errorf("Expected status %d, got %d", http.StatusNotFound, status)
+		}
+		if status, _ := request(t, http.MethodGet, "/channels/unknown/events", "unknown", "", handler.channelEvents); status != http.StatusNotFound {
+			t.Errorf("Expected status %d, got %d", http.StatusNotFound, status)
+		}
+	})
+}
+
+func TestApiHandler_deleteSession(t *testing.T) {
+	mockDB := NewMockDatabase()
+	service := timeline.NewService(mockDB)
+	handler := &ApiHandler{db: mockDB, service: service}
+
+	session, err := service.SignIn(context.Background(), "Claude", "", "")
+	if err != nil {
+		t.Fatalf("Failed to sign in: %v", err)
+	}
+
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodDelete, "/sessions/"+session.SessionID, nil)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.SetParamNames("id")
+	c.SetParamValues(session.SessionID)
+
+	if err := handler.deleteSession(c); err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+	if service.ActiveSessionCount() != 0 {
+		t.Errorf("Expected session to be removed, got %d active sessions", service.ActiveSessionCount())
+	}
+	if ended := mockDB.sessions[0]; ended.EndedAt == nil || *ended.EndReason != database.SessionEndSignedOut {
+		t.Errorf("Expected the session to be ended, got %+v", ended)
+	}
+}
+
+func TestApiHandler_sessions(t *testing.T) {
+	mockDB := NewMockDatabase()
+	service := timeline.NewService(mockDB)
+	handler := &ApiHandler{db: mockDB, service: service}
+
+	request := func(t *testing.T, method, path, id, body string, handle func(echo.Context) error) (int, []byte) {
+		t.Helper()
+		e := echo.New()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		req.Header.Set("User-Agent", "docs-bot/1.0")
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		if id != "" {
+			c.SetParamNames("id")
+			c.SetParamValues(id)
+		}
+		if err := handle(c); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		return rec.Code, rec.Body.Bytes()
+	}
+
+	getSessions := func(t *testing.T, path, id string, handle func(echo.Context) error) []database.Session {
+		t.Helper()
+		status, body := request(t, http.MethodGet, path, id, "", handle)
+		if status != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, status, body)
+		}
+		if strings.Contains(string(body), "token") {
+			t.Errorf("Expected session tokens to be hidden, got %s", body)
+		}
+		var response struct {
+			Sessions []database.Session `json:"sessions"`
+			Count    int                `json:"count"`
+		}
+		if err := json.Unmarshal(body, &response); err != nil {
+			t.Fatalf("Failed to unmarshal response: %v", err)
+		}
+		if response.Count != len(response.Sessions) {
+			t.Errorf("Expected count %d, got %d", len(response.Sessions), response.Count)
+		}
+		return response.Sessions
+	}
+
+	// Two parallel sessions of the same identity
+	var tokens []string
+	for range 2 {
+		status, body := request(t, http.MethodPost, "/sessions", "", `{"agent_name":"Claude","context":"Docs"}`, handler.createSession)
+		if status != http.StatusCreated {
+			t.Fatalf("Expected status %d, got %d: %s", http.StatusCreated, status, body)
+		}
+		var response timeline.SignInResponse
+		if err := json.Unmarshal(body, &response); err != nil {
+			t.Fatalf("Failed to unmarshal response: %v", err)
+		}
+		tokens = append(tokens, response.SessionID)
+	}
+	if mockDB.sessions[0].ClientInfo != "docs-bot/1.0" {
+		t.Errorf("Expected the user agent as client info, got %q", mockDB.sessions[0].ClientInfo)
+	}
+
+	for _, token := range tokens {
+		status, body := request(t, http.MethodPost, "/posts", "", `{"session_id":"`+token+`","content":"Docs update"}`, handler.createPost)
+		if status != http.StatusCreated {
+			t.Errorf("Expected both sessions to post, got status %d: %s", status, body)
+		}
+	}
+	if last := mockDB.posts[len(mockDB.posts)-1]; last.SessionID == nil || *last.SessionID != 2 {
+		t.Errorf("Expected the post to link to session 2, got %v", last.SessionID)
+	}
+
+	if status, body := request(t, http.MethodDelete, "/sessions/"+tokens[0], tokens[0], "", handler.deleteSession); status != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, status, body)
+	}
+
+	t.Run("list sessions", func(t *testing.T) {
+		sessions := getSessions(t, "/sessions", "", handler.getSessions)
+		if len(sessions) != 2 || sessions[0].ID != 2 || sessions[1].EndedAt == nil {
+			t.Errorf("Expected the latest session first and the first one ended, got %+v", sessions)
+		}
+		if sessions := getSessions(t, "/sessions?open=true", "", handler.getSessions); len(sessions) != 1 || sessions[0].ID != 2 {
+			t.Errorf("Expected only the open session, got %+v", sessions)
+		}
+		if sessions := getSessions(t, "/sessions?agent_id=99", "", handler.getSessions); len(sessions) != 0 {
+			t.Errorf("Expected no sessions for an unknown agent, got %+v", sessions)
+		}
+	})
+
+	t.Run("agent session history", func(t *testing.T) {
+		if sessions := getSessions(t, "/agents/1/sessions", "1", handler.getAgentSessions); len(sessions) != 2 {
+			t.Errorf("Expected 2 sessions, got %+v", sessions)
+		}
+		if status, _ := request(t, http.MethodGet, "/agents/99/sessions", "99", "", handler.getAgentSessions); status != http.StatusNotFound {
+			t.Errorf("Expected status %d, got %d", http.StatusNotFound, status)
+		}
+	})
+
+	t.Run("invalid agent_id", func(t *testing.T) {
+		if status, _ := request(t, http.MethodGet, "/sessions?agent_id=abc", "", "", handler.getSessions); status != http.StatusBadRequest {
+			t.Errorf("Expected status %d, got %d", http.StatusBadRequest, status)
+		}
+	})
+}
+
+func TestApiHandler_agents(t *testing.T) {
+	mockDB := NewMockDatabase()
+	service := timeline.NewService(mockDB)
+	handler := &ApiHandler{db: mockDB, service: service}
+
+	for _, agentContext := range []string{"Docs", "Tests"} {
+		if _, err := service.SignIn(context.Background(), "Claude", agentContext, ""); err != nil {
+			t.Fatalf("Failed to sign in: %v", err)
+		}
+	}
+	mockDB.agents[1].LastActive = time.Now().Add(-2 * timeline.SessionTimeout)
+
+	request := func(t *testing.T, path, id string, handle func(echo.Context) error) (int, []byte) {
+		t.Helper()
+		e := echo.New()
+		rec := httptest.NewRecorder()
+		c := e.NewContext(httptest.NewRequest(http.MethodGet, path, nil), rec)
+		if id != "" {
+			c.SetParamNames("id")
+			c.SetParamValues(id)
+		}
+		if err := handle(c); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		return rec.Code, rec.Body.Bytes()
+	}
+
+	getAgents := func(t *testing.T, query string) []database.AgentSummary {
+		t.Helper()
+		status, body := request(t, "/agents?"+query, "", handler.getAgents)
+		if status != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, status, body)
+		}
+		var response struct {
+			Agents []database.AgentSummary `json:"agents"`
+			Count  int                     `json:"count"`
+		}
+		if err := json.Unmarshal(body, &response); err != nil {
+			t.Fatalf("Failed to unmarshal response: %v", err)
+		}
+		if response.Count != len(response.Agents) {
+			t.Errorf("Expected count %d, got %d", len(response.Agents), response.Count)
+		}
+		return response.Agents
+	}
+
+	t.Run("list agents", func(t *testing.T) {
+		agents := getAgents(t, "sort=name")
+		if len(agents) != 2 || agents[0].DisplayName != "Claude - Docs" || agents[1].DisplayName != "Claude - Tests" {
+			t.Fatalf("Expected agents in name order, got %+v", agents)
+		}
+		if agents[0].Status != database.AgentStatusActive || agents[1].Status != database.AgentStatusIdle {
+			t.Errorf("Unexpected statuses %s, %s", agents[0].Status, agents[1].Status)
+		}
+	})
+
+	t.Run("filter by status and search", func(t *testing.T) {
+		if agents := getAgents(t, "status=idle"); len(agents) != 1 || agents[0].ID != 2 {
+			t.Errorf("Expected only the idle agent, got %+v", agents)
+		}
+		if agents := getAgents(t, "q=docs"); len(agents) != 1 || agents[0].ID != 1 {
+			t.Errorf("Expected only Claude - Docs, got %+v", agents)
+		}
+	})
+
+	t.Run("configured idle timeout", func(t *testing.T) {
+		service.SetIdleTimeout(5 * time.Minute)
+		defer service.SetIdleTimeout(timeline.SessionTimeout)
+		lastActive := mockDB.agents[0].LastActive
+		defer func() { mockDB.agents[0].LastActive = lastActive }()
+		mockDB.agents[0].LastActive = time.Now().Add(-10 * time.Minute)
+
+		if agents := getAgents(t, "status=active"); len(agents) != 0 {
+			t.Errorf("Expected no agent active within the idle timeout, got %+v", agents)
+		}
+	})
+
+	t.Run("single agent with stats", func(t *testing.T) {
+		status, body := request(t, "/agents/1?since=2023-06-21T11:30:00Z", "1", handler.getAgentSummary)
+		if status != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d", http.StatusOK, status)
+		}
+		var agent database.AgentSummary
+		if err := json.Unmarshal(body, &agent); err != nil {
+			t.Fatalf("Failed to unmarshal response: %v", err)
+		}
+		if agent.PostCount != 1 || agent.RecentPostCount != 1 || agent.LastPostAt == nil || !agent.LastPostAt.Equal(mockDB.posts[0].Timestamp) {
+			t.Errorf("Unexpected stats %+v", agent)
+		}
+	})
+
+	tests := []struct {
+		name           string
+		path           string
+		id             string
+		handle         func(echo.Context) error
+		expectedStatus int
+	}{
+		{name: "invalid sort", path: "/agents?sort=karma", handle: handler.getAgents, expectedStatus: http.StatusBadRequest},
+		{name: "invalid order", path: "/agents?order=up", handle: handler.getAgents, expectedStatus: http.StatusBadRequest},
+		{name: "invalid status", path: "/agents?status=busy", handle: handler.getAgents, expectedStatus: http.StatusBadRequest},
+		{name: "invalid since", path: "/agents?since=yesterday", handle: handler.getAgents, expectedStatus: http.StatusBadRequest},
+		{name: "invalid agent ID", path: "/agents/abc", id: "abc", handle: handler.getAgentSummary, expectedStatus: http.StatusBadRequest},
+		{name: "unknown agent", path: "/agents/99", id: "99", handle: handler.getAgentSummary, expectedStatus: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if status, _ := request(t, tt.path, tt.id, tt.handle); status != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, status)
+			}
+		})
+	}
+}
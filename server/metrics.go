@@ -0,0 +1,64 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Prometheus metrics of the API server, served at TL_SERVER_METRICS_PATH with the
+// metrics of the database package and the Go runtime
+var (
+	httpRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "timeline_http_request_duration_seconds",
+		Help:    "Duration of HTTP requests, by method, route and status code. SSE and WebSocket requests last as long as the connection.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	sseClients = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "timeline_sse_clients",
+		Help: "Connected SSE and WebSocket clients.",
+	})
+
+	sseDroppedEvents = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "timeline_sse_dropped_events_total",
+		Help: "Events dropped for clients that fell behind, by drop policy.",
+	}, []string{"policy"})
+
+	broadcastLag = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "timeline_broadcast_lag_seconds",
+		Help:    "Time from the creation of a post to the broadcast of its new_post event.",
+		Buckets: []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30},
+	})
+)
+
+// metricsMiddleware records the duration of every request by its route pattern, so
+// that requests for different posts or agents share a series
+func metricsMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		start := time.Now()
+		err := next(c)
+
+		status := c.Response().Status
+		if err != nil {
+			// The error handler writes the response after the middleware returns
+			status = http.StatusInternalServerError
+			var httpErr *echo.HTTPError
+			if errors.As(err, &httpErr) {
+				status = httpErr.Code
+			}
+		}
+		route := c.Path()
+		if route == "" {
+			route = "unmatched"
+		}
+		httpRequestDuration.WithLabelValues(c.Request().Method, route, strconv.Itoa(status)).Observe(time.Since(start).Seconds())
+
+		return err
+	}
+}
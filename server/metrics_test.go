@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+func TestMetrics(t *testing.T) {
+	e := echo.New()
+	useMiddleware(e, []string{"*"})
+	e.GET("/metrics_test/:id", func(c echo.Context) error {
+		switch c.Param("id") {
+		case "missing":
+			return echo.NewHTTPError(http.StatusNotFound)
+		case "panic":
+			panic("handler failed")
+		}
+		return c.NoContent(http.StatusNoContent)
+	})
+	e.GET("/metrics", echo.WrapHandler(promhttp.Handler()))
+
+	for _, path := range []string{"/metrics_test/1", "/metrics_test/2", "/metrics_test/missing", "/metrics_test/panic"} {
+		e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	broadcaster := NewSSEBroadcaster()
+	broadcaster.SetQueue(1, DropOldest)
+	client := &SSEClient{ID: "metrics", Queue: broadcaster.NewQueue("")}
+	broadcaster.AddClient(client)
+	for range 3 {
+		broadcaster.Broadcast(context.Background(), "notice", []byte(`{"type":"notice"}`))
+	}
+	broadcaster.RemoveClient(client.ID)
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+	body := rec.Body.String()
+	for _, line := range []string{
+		`timeline_http_request_duration_seconds_count{method="GET",route="/metrics_test/:id",status="204"} 2`,
+		`timeline_http_request_duration_seconds_count{method="GET",route="/metrics_test/:id",status="404"} 1`,
+		`timeline_http_request_duration_seconds_count{method="GET",route="/metrics_test/:id",status="500"} 1`,
+		`timeline_sse_dropped_events_total{policy="drop_oldest"}`,
+		`timeline_sse_clients `,
+		`timeline_broadcast_lag_seconds_count`,
+	} {
+		if !strings.Contains(body, line) {
+			t.Errorf("Expected the metrics to contain %q", line)
+		}
+	}
+}
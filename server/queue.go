@@ -0,0 +1,176 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+)
+
+// SSEQueueSize is the default number of events queued for a client
+const SSEQueueSize = 100
+
+// DropPolicy decides what happens when an event arrives for a client whose queue is full
+type DropPolicy string
+
+const (
+	// DropOldest discards the oldest queued event to make room for the new one
+	DropOldest DropPolicy = "drop_oldest"
+	// Coalesce replaces a queued event with the same key, such as an older post_updated
+	// event of the same post. When there is none, the whole backlog is discarded.
+	Coalesce DropPolicy = "coalesce"
+	// Disconnect discards the backlog and closes the queue, ending the connection
+	Disconnect DropPolicy = "disconnect"
+)
+
+// ParseDropPolicy validates a drop policy name
+func ParseDropPolicy(name string) (DropPolicy, error) {
+	policy := DropPolicy(name)
+	switch policy {
+	case DropOldest, Coalesce, Disconnect:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("invalid drop policy: %q (use %s, %s or %s)", name, DropOldest, Coalesce, Disconnect)
+	}
+}
+
+// EventQueue is the bounded queue of events waiting to be written to one client.
+// Pushing never blocks, so a slow client cannot hold up the broadcaster. When events
+// are lost the next Pop returns a resync_required event carrying the number of lost
+// events, telling the client to refetch what it shows.
+type EventQueue struct {
+	mutex  sync.Mutex
+	events []SSEEvent
+	size   int
+	policy DropPolicy
+	// dropped counts the events lost since the last resync_required event
+	dropped int
+	closed  bool
+	ready   chan struct{}
+	done    chan struct{}
+}
+
+// NewEventQueue creates a queue holding up to size events
+func NewEventQueue(size int, policy DropPolicy) *EventQueue {
+	return &EventQueue{
+		events: make([]SSEEvent, 0, size),
+		size:   size,
+		policy: policy,
+		ready:  make(chan struct{}, 1),
+		done:   make(chan struct{}),
+	}
+}
+
+// Policy returns the drop policy of the queue
+func (q *EventQueue) Policy() DropPolicy {
+	return q.policy
+}
+
+// Push queues an event, applying the drop policy when the queue is full. It returns
+// the number of events the push discarded, and whether it started a gap: it lost
+// events while the client was up to date. Events pushed to a closed queue are ignored.
+func (q *EventQueue) Push(event SSEEvent) (dropped int, started bool) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if q.closed {
+		return 0, false
+	}
+	defer q.signal()
+
+	if len(q.events) < q.size {
+		q.events = append(q.events, event)
+		return 0, false
+	}
+
+	switch q.policy {
+	case Coalesce:
+		if event.Key != "" {
+			if i := slices.IndexFunc(q.events, func(queued SSEEvent) bool { return queued.Key == event.Key }); i >= 0 {
+				q.events[i] = event
+				return 0, false
+			}
+		}
+		dropped = len(q.events) + 1
+		q.events = q.events[:0]
+	case Disconnect:
+		dropped = len(q.events) + 1
+		q.events = nil
+		q.close()
+	default:
+		dropped = 1
+		q.events = append(q.events[1:], event)
+	}
+	started = q.dropped == 0
+	q.dropped += dropped
+	return dropped, started
+}
+
+// MarkLost records events the client missed before they were queued, such as the
+// notifications skipped by the database after a reconnect, so that the next Pop
+// returns a resync_required event. Queued events are kept.
+func (q *EventQueue) MarkLost(dropped int) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if q.closed {
+		return
+	}
+	defer q.signal()
+	q.dropped += dropped
+}
+
+// Pop returns the next event without waiting, or false when the queue is empty.
+// After a gap it first returns a resync_required event whose Dropped field is the
+// number of lost events. Events left in a closed queue can still be popped.
+func (q *EventQueue) Pop() (SSEEvent, bool) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if q.dropped > 0 {
+		event := SSEEvent{Name: SSEEventResyncRequired, Dropped: q.dropped}
+		q.dropped = 0
+		return event, true
+	}
+	if len(q.events) == 0 {
+		return SSEEvent{}, false
+	}
+	event := q.events[0]
+	q.events = q.events[1:]
+	return event, true
+}
+
+// Len returns the number of queued events
+func (q *EventQueue) Len() int {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return len(q.events)
+}
+
+// Ready receives a value after events have been pushed. Pop every event after each receive.
+func (q *EventQueue) Ready() <-chan struct{} {
+	return q.ready
+}
+
+// Done is closed when the queue is closed, by the disconnect policy or by Close
+func (q *EventQueue) Done() <-chan struct{} {
+	return q.done
+}
+
+// Close stops the queue from accepting events
+func (q *EventQueue) Close() {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.close()
+}
+
+func (q *EventQueue) close() {
+	if !q.closed {
+		q.closed = true
+		close(q.done)
+	}
+}
+
+func (q *EventQueue) signal() {
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+}
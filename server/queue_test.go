@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/kmio11/agent-timeline-mcp/internal/database"
+)
+
+func TestParseDropPolicy(t *testing.T) {
+	for _, name := range []string{"drop_oldest", "coalesce", "disconnect"} {
+		if policy, err := ParseDropPolicy(name); err != nil || string(policy) != name {
+			t.Errorf("Expected policy %s, got %q (%v)", name, policy, err)
+		}
+	}
+	if _, err := ParseDropPolicy("block"); err == nil {
+		t.Error("Expected an error for an unknown policy")
+	}
+}
+
+func TestEventQueue(t *testing.T) {
+	event := func(name string, id int) SSEEvent {
+		return SSEEvent{PostID: id, Name: name, Key: fmt.Sprintf("post:%d", id)}
+	}
+	names := func(t *testing.T, queue *EventQueue) []string {
+		t.Helper()
+		var names []string
+		for event, ok := queue.Pop(); ok; event, ok = queue.Pop() {
+			name := fmt.Sprintf("%s:%d", event.Name, event.PostID)
+			if event.Name == SSEEventResyncRequired {
+				name = fmt.Sprintf("%s:%d", event.Name, event.Dropped)
+			}
+			names = append(names, name)
+		}
+		return names
+	}
+	expect := func(t *testing.T, got []string, want ...string) {
+		t.Helper()
+		if fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("Expected events %v, got %v", want, got)
+		}
+	}
+
+	t.Run("drop oldest", func(t *testing.T) {
+		queue := NewEventQueue(2, DropOldest)
+		for id := 1; id <= 2; id++ {
+			if dropped, started := queue.Push(event(SSEEventNewPost, id)); dropped != 0 || started {
+				t.Error("Expected no gap while the queue has room")
+			}
+		}
+		if dropped, started := queue.Push(event(SSEEventNewPost, 3)); dropped != 1 || !started {
+			t.Errorf("Expected the first overflow to drop 1 event and start a gap, got %d %v", dropped, started)
+		}
+		if dropped, started := queue.Push(event(SSEEventNewPost, 4)); dropped != 1 || started {
+			t.Errorf("Expected further overflows to extend the gap, got %d %v", dropped, started)
+		}
+		expect(t, names(t, queue), "resync_required:2", "new_post:3", "new_post:4")
+
+		// The next overflow starts a new gap
+		queue.Push(event(SSEEventNewPost, 5))
+		queue.Push(event(SSEEventNewPost, 6))
+		if _, started := queue.Push(event(SSEEventNewPost, 7)); !started {
+			t.Error("Expected an overflow after a resync to start a new gap")
+		}
+		expect(t, names(t, queue), "resync_required:1", "new_post:6", "new_post:7")
+	})
+
+	t.Run("coalesce", func(t *testing.T) {
+		queue := NewEventQueue(2, Coalesce)
+		queue.Push(event(SSEEventNewPost, 1))
+		queue.Push(event(SSEEventPostUpdated, 2))
+		if dropped, _ := queue.Push(event(SSEEventPostUpdated, 2)); dropped != 0 {
+			t.Error("Expected an update of a queued post to replace it")
+		}
+		expect(t, names(t, queue), "new_post:1", "post_updated:2")
+
+		queue.Push(event(SSEEventNewPost, 1))
+		queue.Push(event(SSEEventNewPost, 2))
+		if dropped, _ := queue.Push(SSEEvent{PostID: 3, Name: SSEEventNewPost}); dropped != 3 {
+			t.Error("Expected an event without a matching key to discard the backlog")
+		}
+		queue.Push(event(SSEEventNewPost, 4))
+		expect(t, names(t, queue), "resync_required:3", "new_post:4")
+	})
+
+	t.Run("disconnect", func(t *testing.T) {
+		queue := NewEventQueue(1, Disconnect)
+		queue.Push(event(SSEEventNewPost, 1))
+		if dropped, started := queue.Push(event(SSEEventNewPost, 2)); dropped != 2 || !started {
+			t.Errorf("Expected the overflow to drop 2 events, got %d %v", dropped, started)
+		}
+		select {
+		case <-queue.Done():
+		default:
+			t.Fatal("Expected the overflow to close the queue")
+		}
+		if dropped, _ := queue.Push(event(SSEEventNewPost, 3)); dropped != 0 {
+			t.Error("Expected a closed queue to ignore events")
+		}
+		expect(t, names(t, queue), "resync_required:2")
+	})
+
+	t.Run("events lost before queueing", func(t *testing.T) {
+		queue := NewEventQueue(2, DropOldest)
+		queue.Push(event(SSEEventNewPost, 1))
+		queue.MarkLost(500)
+		select {
+		case <-queue.Ready():
+		default:
+			t.Fatal("Expected the queue to be ready after events were lost")
+		}
+		expect(t, names(t, queue), "resync_required:500", "new_post:1")
+	})
+
+	t.Run("ready", func(t *testing.T) {
+		queue := NewEventQueue(10, DropOldest)
+		queue.Push(event(SSEEventNewPost, 1))
+		queue.Push(event(SSEEventNewPost, 2))
+		select {
+		case <-queue.Ready():
+		default:
+			t.Fatal("Expected the queue to be ready after a push")
+		}
+		if queue.Len() != 2 {
+			t.Errorf("Expected 2 queued events, got %d", queue.Len())
+		}
+	})
+}
+
+func TestSSEBroadcaster_slowClient(t *testing.T) {
+	broadcaster := NewSSEBroadcaster()
+	broadcaster.SetQueue(3, Disconnect)
+	slow := &SSEClient{ID: "slow", Queue: broadcaster.NewQueue(DropOldest)}
+	disconnected := &SSEClient{ID: "disconnected", Queue: broadcaster.NewQueue("")}
+	broadcaster.AddClient(slow)
+	broadcaster.AddClient(disconnected)
+
+	// Broadcasting to clients that read nothing must not block
+	for id := 1; id <= 10; id++ {
+		data, _ := json.Marshal(map[string]int{"id": id})
+		broadcaster.BroadcastNewPost(context.Background(), id, data, SSESubject{AgentID: 1})
+	}
+
+	resync := pop(t, slow.Queue)
+	data, err := newResyncEvent(slow.Queue, resync, nil)
+	if err != nil {
+		t.Fatalf("Failed to marshal resync event: %v", err)
+	}
+	if resync.Name != SSEEventResyncRequired || string(data) != `{"type":"resync_required","policy":"drop_oldest","dropped":7}` {
+		t.Errorf("Unexpected resync event %s %s", resync.Name, data)
+	}
+	if first := pop(t, slow.Queue); first.PostID != 8 {
+		t.Errorf("Expected the newest events to be kept, got post %d", first.PostID)
+	}
+
+	select {
+	case <-disconnected.Queue.Done():
+	default:
+		t.Fatal("Expected the disconnect policy to close the queue")
+	}
+	sinceID := 0
+	resync = pop(t, disconnected.Queue)
+	if data, _ := newResyncEvent(disconnected.Queue, resync, &sinceID); string(data) != `{"type":"resync_required","policy":"disconnect","dropped":4,"since_id":0}` {
+		t.Errorf("Unexpected resync event %s", data)
+	}
+}
+
+func TestHandleNotification_resync(t *testing.T) {
+	broadcaster := NewSSEBroadcaster()
+	filtered := &SSEClient{ID: "filtered", Queue: broadcaster.NewQueue(Coalesce), Filter: SSEFilter{Channel: "docs"}}
+	broadcaster.AddClient(filtered)
+	ws := &SSEClient{ID: "ws", Queue: broadcaster.NewQueue(DropOldest), Subscriptions: NewSubscriptions()}
+	broadcaster.AddClient(ws)
+
+	payload := &database.NotificationPayload{Operation: database.NotificationResync, Missed: 1500}
+	if err := handleNotification(context.Background(), NewMockDatabase(), broadcaster, payload); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	for _, client := range []*SSEClient{filtered, ws} {
+		resync := pop(t, client.Queue)
+		if data, _ := newResyncEvent(client.Queue, resync, nil); resync.Name != SSEEventResyncRequired || resync.Dropped != 1500 {
+			t.Errorf("Expected a resync_required event for client %s, got %s %s", client.ID, resync.Name, data)
+		}
+	}
+}
+
+// pop returns the next event of a queue
+func pop(t *testing.T, queue *EventQueue) SSEEvent {
+	t.Helper()
+	event, ok := queue.Pop()
+	if !ok {
+		t.Fatal("Expected a queued event")
+	}
+	return event
+}
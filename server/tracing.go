@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.39.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TracingServiceName is the service.name of the exported spans, unless OTEL_SERVICE_NAME is set
+const TracingServiceName = "agent-timeline-server"
+
+// Trace exporters selected by TL_SERVER_TRACES_EXPORTER
+const (
+	// TracesExporterNone records no spans
+	TracesExporterNone = "none"
+	// TracesExporterOTLP sends spans to an OTLP/HTTP collector, configured with the
+	// standard OTEL_EXPORTER_OTLP_* environment variables
+	TracesExporterOTLP = "otlp"
+	// TracesExporterFile appends spans as JSON lines to a file
+	TracesExporterFile = "file"
+)
+
+// tracer creates the spans of broadcasts and event writes
+var tracer = otel.Tracer("github.com/kmio11/agent-timeline-mcp/server")
+
+// setupTracing installs the global tracer provider and the W3C trace context propagator.
+// The returned function flushes the remaining spans and must be called on shutdown.
+func setupTracing(ctx context.Context, exporter, path string) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	var (
+		spanExporter sdktrace.SpanExporter
+		file         *os.File
+		err          error
+	)
+	switch exporter {
+	case TracesExporterNone:
+		return func(context.Context) error { return nil }, nil
+	case TracesExporterOTLP:
+		spanExporter, err = otlptracehttp.New(ctx)
+	case TracesExporterFile:
+		if file, err = os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644); err != nil {
+			return nil, fmt.Errorf("failed to open trace file: %w", err)
+		}
+		spanExporter, err = stdouttrace.New(stdouttrace.WithWriter(file))
+	default:
+		return nil, fmt.Errorf("invalid trace exporter: %q (use %s, %s or %s)", exporter, TracesExporterNone, TracesExporterOTLP, TracesExporterFile)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create trace exporter: %w", err)
+	}
+
+	// Attributes from OTEL_SERVICE_NAME and OTEL_RESOURCE_ATTRIBUTES take precedence
+	res, err := resource.New(ctx,
+		resource.WithAttributes(semconv.ServiceName(TracingServiceName)),
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create trace resource: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(spanExporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(provider)
+
+	return func(ctx context.Context) error {
+		err := provider.Shutdown(ctx)
+		if file != nil {
+			err = errors.Join(err, file.Close())
+		}
+		return err
+	}, nil
+}
+
+// startWriteSpan starts the span of writing an event to a client, as a child of the
+// span that broadcast it. Events that were not broadcast, such as replayed posts,
+// get a span that records nothing.
+func startWriteSpan(event SSEEvent, clientID string) trace.Span {
+	if !event.SpanContext.IsValid() {
+		return trace.SpanFromContext(context.Background())
+	}
+	ctx := trace.ContextWithSpanContext(context.Background(), event.SpanContext)
+	_, span := tracer.Start(ctx, "write "+event.Name,
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(attribute.String("timeline.client_id", clientID)),
+	)
+	return span
+}
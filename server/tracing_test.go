@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/kmio11/agent-timeline-mcp/internal/database"
+	"github.com/kmio11/agent-timeline-mcp/internal/timeline"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestSetupTracing(t *testing.T) {
+	shutdown, err := setupTracing(context.Background(), TracesExporterNone, "")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if err := shutdown(context.Background()); err != nil {
+		t.Errorf("Expected no error on shutdown, got %v", err)
+	}
+
+	if _, err := setupTracing(context.Background(), "jaeger", ""); err == nil {
+		t.Error("Expected an error for an unknown exporter")
+	}
+}
+
+func TestTracing_broadcast(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+
+	mockDB := NewMockDatabase()
+	service := timeline.NewService(mockDB)
+	session, err := service.SignIn(context.Background(), "Claude", "Tracing", "")
+	if err != nil {
+		t.Fatalf("Failed to sign in: %v", err)
+	}
+	posted, err := service.PostTimeline(context.Background(), session.SessionID, "Traced post", nil, "")
+	if err != nil {
+		t.Fatalf("Failed to post: %v", err)
+	}
+
+	broadcaster := NewSSEBroadcaster()
+	client := &SSEClient{ID: "traced", Queue: broadcaster.NewQueue("")}
+	broadcaster.AddClient(client)
+	defer broadcaster.RemoveClient(client.ID)
+
+	// The notification span stands in for the span the listener starts from the payload
+	ctx, notification := otel.Tracer("test").Start(context.Background(), "notification posts")
+	payload := &database.NotificationPayload{Table: database.NotificationTablePosts, PostID: posted.PostID}
+	if err := handleNotification(ctx, mockDB, broadcaster, payload); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	notification.End()
+
+	event := pop(t, client.Queue)
+	startWriteSpan(event, client.ID).End()
+
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = span
+	}
+	broadcast, write := spans["broadcast new_post"], spans["write new_post"]
+	if broadcast == nil || write == nil {
+		t.Fatalf("Expected broadcast and write spans, got %v", spans)
+	}
+	if broadcast.Parent().SpanID() != notification.SpanContext().SpanID() {
+		t.Error("Expected the broadcast span to be a child of the notification span")
+	}
+	if write.Parent().SpanID() != broadcast.SpanContext().SpanID() || write.SpanContext().TraceID() != notification.SpanContext().TraceID() {
+		t.Error("Expected the write span to be a child of the broadcast span in the same trace")
+	}
+
+	// Replayed events were not broadcast and are not traced
+	if span := startWriteSpan(SSEEvent{Name: SSEEventNewPost}, client.ID); span.SpanContext().IsValid() {
+		t.Error("Expected no span for an event without a broadcast span")
+	}
+}
@@ -0,0 +1,389 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/kmio11/agent-timeline-mcp/internal/database"
+	"github.com/kmio11/agent-timeline-mcp/internal/timeline"
+	"github.com/labstack/echo/v4"
+)
+
+// WebSocket connection settings
+const (
+	// WSPingInterval is the time between pings; connections that answer no ping or
+	// message within WSPongTimeout are closed
+	WSPingInterval = 30 * time.Second
+	WSPongTimeout  = 60 * time.Second
+	// WSWriteTimeout limits the time spent writing one message to a client
+	WSWriteTimeout = 10 * time.Second
+	// WSMaxMessageSize limits the size of a client message in bytes
+	WSMaxMessageSize = 8192
+	// WSSendBuffer is the number of replies queued for a connection. A client that keeps
+	// sending requests without reading the replies is disconnected. Events are queued
+	// like those of SSE clients.
+	WSSendBuffer = 100
+	// WSMaxSubscriptions limits the subscriptions of one connection
+	WSMaxSubscriptions = 20
+)
+
+// WebSocket message types
+const (
+	// Client requests
+	WSSubscribe   = "subscribe"
+	WSUnsubscribe = "unsubscribe"
+	WSPost        = "post"
+	WSPing        = "ping"
+
+	// Server messages
+	WSConnected    = "connected"
+	WSSubscribed   = "subscribed"
+	WSUnsubscribed = "unsubscribed"
+	WSPosted       = "posted"
+	WSPong         = "pong"
+	WSEvent        = "event"
+	WSError        = "error"
+)
+
+// WSRequest is a message from a WebSocket client
+type WSRequest struct {
+	Type string `json:"type"`
+	// ID is echoed in the reply. Subscribe and unsubscribe requests use it to name the subscription.
+	ID string `json:"id"`
+	// Filter selects the events of a subscribe request
+	Filter WSFilter `json:"filter"`
+	// SessionID, Content, ParentPostID and Channel are the fields of a post request,
+	// as in POST /posts
+	SessionID    string `json:"session_id"`
+	Content      string `json:"content"`
+	ParentPostID *int   `json:"parent_post_id"`
+	Channel      string `json:"channel"`
+}
+
+// WSFilter selects the events of a subscription, with the query parameters of GET /events
+type WSFilter struct {
+	AgentID     *int   `json:"agent_id"`
+	IdentityKey string `json:"identity_key"`
+	Channel     string `json:"channel"`
+	Tag         string `json:"tag"`
+	Q           string `json:"q"`
+}
+
+// sseFilter normalizes the filter like parseSSEFilter
+func (f WSFilter) sseFilter() SSEFilter {
+	return SSEFilter{
+		AgentID:     f.AgentID,
+		IdentityKey: f.IdentityKey,
+		Channel:     f.Channel,
+		Tag:         database.NormalizeTag(f.Tag),
+		Text:        strings.TrimSpace(f.Q),
+	}
+}
+
+// WSMessage is a message to a WebSocket client
+type WSMessage struct {
+	Type string `json:"type"`
+	// ID is the ID of the request this message replies to
+	ID string `json:"id,omitempty"`
+	// Event is the SSE event name of an event message
+	Event string `json:"event,omitempty"`
+	// Subscriptions are the IDs of the subscriptions matching an event message
+	Subscriptions []string `json:"subscriptions,omitempty"`
+	// Data is the event data, the created post or the connection details
+	Data json.RawMessage `json:"data,omitempty"`
+	// Error, Message and Details describe a failed request, like timeline.Error
+	Error   string         `json:"error,omitempty"`
+	Message string         `json:"message,omitempty"`
+	Details map[string]any `json:"details,omitempty"`
+}
+
+// Subscriptions are the named event filters of a connection
+type Subscriptions struct {
+	mutex   sync.RWMutex
+	filters map[string]SSEFilter
+}
+
+// NewSubscriptions creates an empty set of subscriptions
+func NewSubscriptions() *Subscriptions {
+	return &Subscriptions{filters: make(map[string]SSEFilter)}
+}
+
+// Set adds a subscription or replaces its filter. It returns false when the
+// subscription is new and the limit of WSMaxSubscriptions has been reached.
+func (s *Subscriptions) Set(id string, filter SSEFilter) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, exists := s.filters[id]; !exists && len(s.filters) >= WSMaxSubscriptions {
+		return false
+	}
+	s.filters[id] = filter
+	return true
+}
+
+// Delete removes a subscription, returning false if it does not exist
+func (s *Subscriptions) Delete(id string) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, exists := s.filters[id]; !exists {
+		return false
+	}
+	delete(s.filters, id)
+	return true
+}
+
+// Matching returns the IDs of the subscriptions whose filters match the subject, in order
+func (s *Subscriptions) Matching(subject SSESubject) []string {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	var ids []string
+	for id, filter := range s.filters {
+		if filter.Matches(subject) {
+			ids = append(ids, id)
+		}
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+// checkOrigin allows WebSocket connections from the origins allowed by CORS, which
+// browsers do not apply to WebSocket handshakes. Clients that send no Origin header
+// are not browsers and are always allowed.
+func (h *ApiHandler) checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" || len(h.allowOrigins) == 0 {
+		return true
+	}
+	return slices.Contains(h.allowOrigins, "*") || slices.Contains(h.allowOrigins, origin)
+}
+
+// wsConnection serves the WebSocket protocol to one client. The read loop handles
+// requests and queues the replies; the write loop is the only writer to the socket.
+type wsConnection struct {
+	handler *ApiHandler
+	conn    *websocket.Conn
+	client  *SSEClient
+	replies chan WSMessage
+}
+
+// wsHandler upgrades the request to a WebSocket connection that receives the events
+// of its subscriptions and can post to the timeline
+func (h *ApiHandler) wsHandler(c echo.Context) error {
+	queue, err := newClientQueue(c, h.broadcaster)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	upgrader := websocket.Upgrader{CheckOrigin: h.checkOrigin}
+	conn, err := upgrader.Upgrade(c.Response(), c.Request(), nil)
+	if err != nil {
+		// The upgrader has already responded with an error
+		slog.Warn("WebSocket upgrade failed", "error", err)
+		return nil
+	}
+	defer conn.Close()
+
+	client := &SSEClient{
+		ID:            fmt.Sprintf("ws_%d", time.Now().UnixNano()),
+		Queue:         queue,
+		Request:       c.Request(),
+		Subscriptions: NewSubscriptions(),
+	}
+	h.broadcaster.AddClient(client)
+	defer h.broadcaster.RemoveClient(client.ID)
+
+	ws := &wsConnection{
+		handler: h,
+		conn:    conn,
+		client:  client,
+		replies: make(chan WSMessage, WSSendBuffer),
+	}
+
+	// The connection ends when either loop stops
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go ws.readLoop(ctx, cancel)
+	ws.writeLoop(ctx)
+
+	return nil
+}
+
+// readLoop handles client requests until the client goes away or stops reading replies
+func (ws *wsConnection) readLoop(ctx context.Context, cancel context.CancelFunc) {
+	defer cancel()
+
+	ws.conn.SetReadLimit(WSMaxMessageSize)
+	ws.conn.SetReadDeadline(time.Now().Add(WSPongTimeout))
+	ws.conn.SetPongHandler(func(string) error {
+		return ws.conn.SetReadDeadline(time.Now().Add(WSPongTimeout))
+	})
+
+	for {
+		_, data, err := ws.conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				slog.Debug("WebSocket read failed", "error", err, "client_id", ws.client.ID)
+			}
+			return
+		}
+		// Any message shows that the client is alive
+		ws.conn.SetReadDeadline(time.Now().Add(WSPongTimeout))
+
+		var req WSRequest
+		reply := WSMessage{Type: WSError, Error: timeline.CodeValidationError, Message: "Invalid message"}
+		if err := json.Unmarshal(data, &req); err == nil {
+			reply = ws.handle(ctx, req)
+		}
+
+		select {
+		case ws.replies <- reply:
+		default:
+			slog.Warn("WebSocket reply queue full, closing", "client_id", ws.client.ID)
+			ws.close(websocket.CloseTryAgainLater, "Too slow to receive replies")
+			return
+		}
+	}
+}
+
+// handle executes a client request and returns the reply
+func (ws *wsConnection) handle(ctx context.Context, req WSRequest) WSMessage {
+	switch req.Type {
+	case WSSubscribe:
+		if req.ID == "" {
+			return wsValidationError(req.ID, "Subscription id is required")
+		}
+		if !ws.client.Subscriptions.Set(req.ID, req.Filter.sseFilter()) {
+			return wsValidationError(req.ID, fmt.Sprintf("At most %d subscriptions are allowed", WSMaxSubscriptions))
+		}
+		return WSMessage{Type: WSSubscribed, ID: req.ID}
+
+	case WSUnsubscribe:
+		if !ws.client.Subscriptions.Delete(req.ID) {
+			return wsValidationError(req.ID, "Unknown subscription")
+		}
+		return WSMessage{Type: WSUnsubscribed, ID: req.ID}
+
+	case WSPost:
+		response, err := ws.handler.service.PostTimeline(ctx, req.SessionID, req.Content, req.ParentPostID, req.Channel)
+		if err != nil {
+			return wsTimelineError(req.ID, err)
+		}
+		data, err := json.Marshal(response)
+		if err != nil {
+			return wsTimelineError(req.ID, err)
+		}
+		return WSMessage{Type: WSPosted, ID: req.ID, Data: data}
+
+	case WSPing:
+		return WSMessage{Type: WSPong, ID: req.ID}
+
+	default:
+		return wsValidationError(req.ID, fmt.Sprintf("Unknown message type: %q", req.Type))
+	}
+}
+
+// writeLoop sends the connection message, events, replies and pings until the
+// connection ends. It closes the connection with 1013 (try again later) when the
+// event queue is closed, after the resync_required event of the disconnect policy.
+func (ws *wsConnection) writeLoop(ctx context.Context) {
+	pingTicker := time.NewTicker(WSPingInterval)
+	defer pingTicker.Stop()
+
+	data, _ := json.Marshal(map[string]string{"client_id": ws.client.ID})
+	if err := ws.write(WSMessage{Type: WSConnected, Data: data}); err != nil {
+		return
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			ws.close(websocket.CloseNormalClosure, "")
+			return
+		case <-ws.client.Queue.Ready():
+			if err := ws.writeEvents(); err != nil {
+				return
+			}
+		case <-ws.client.Queue.Done():
+			slog.Warn("WebSocket client too slow, closing", "client_id", ws.client.ID)
+			if err := ws.writeEvents(); err != nil {
+				return
+			}
+			ws.close(websocket.CloseTryAgainLater, "Too slow to receive events")
+			return
+		case reply := <-ws.replies:
+			if err := ws.write(reply); err != nil {
+				return
+			}
+		case <-pingTicker.C:
+			ws.conn.SetWriteDeadline(time.Now().Add(WSWriteTimeout))
+			if err := ws.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// writeEvents sends the queued events
+func (ws *wsConnection) writeEvents() error {
+	queue := ws.client.Queue
+	for event, ok := queue.Pop(); ok; event, ok = queue.Pop() {
+		if event.Name == SSEEventResyncRequired {
+			data, err := newResyncEvent(queue, event, nil)
+			if err != nil {
+				return err
+			}
+			event.Data = data
+		}
+		var subscriptions []string
+		if event.Subject != nil {
+			// Skip events of subscriptions removed after the event was queued
+			if subscriptions = ws.client.Subscriptions.Matching(*event.Subject); len(subscriptions) == 0 {
+				continue
+			}
+		}
+		span := startWriteSpan(event, ws.client.ID)
+		err := ws.write(WSMessage{Type: WSEvent, Event: event.Name, Subscriptions: subscriptions, Data: event.Data})
+		span.End()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (ws *wsConnection) write(message WSMessage) error {
+	ws.conn.SetWriteDeadline(time.Now().Add(WSWriteTimeout))
+	if err := ws.conn.WriteJSON(message); err != nil {
+		slog.Debug("WebSocket write failed", "error", err, "client_id", ws.client.ID)
+		return err
+	}
+	return nil
+}
+
+// close sends a close message. Unlike other writes it may be called from any goroutine.
+func (ws *wsConnection) close(code int, reason string) {
+	message := websocket.FormatCloseMessage(code, reason)
+	ws.conn.WriteControl(websocket.CloseMessage, message, time.Now().Add(WSWriteTimeout))
+}
+
+func wsValidationError(id, message string) WSMessage {
+	return WSMessage{Type: WSError, ID: id, Error: timeline.CodeValidationError, Message: message}
+}
+
+// wsTimelineError is the WebSocket reply for an error of a timeline operation, like timelineError
+func wsTimelineError(id string, err error) WSMessage {
+	var timelineErr *timeline.Error
+	if !errors.As(err, &timelineErr) {
+		slog.Error("Unexpected timeline error", "error", err)
+		timelineErr = &timeline.Error{Code: timeline.CodeDatabaseError, Message: err.Error()}
+	}
+	return WSMessage{Type: WSError, ID: id, Error: timelineErr.Code, Message: timelineErr.Message, Details: timelineErr.Details}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/kmio11/agent-timeline-mcp/internal/database"
+	"github.com/kmio11/agent-timeline-mcp/internal/timeline"
+	"github.com/labstack/echo/v4"
+)
+
+func TestSubscriptions(t *testing.T) {
+	subscriptions := NewSubscriptions()
+	agentID := 2
+	subscriptions.Set("docs", SSEFilter{Channel: "docs"})
+	subscriptions.Set("agent", SSEFilter{AgentID: &agentID})
+
+	if ids := subscriptions.Matching(SSESubject{AgentID: 2, Channel: "docs"}); strings.Join(ids, ",") != "agent,docs" {
+		t.Errorf("Expected both subscriptions to match, got %v", ids)
+	}
+	if ids := subscriptions.Matching(SSESubject{AgentID: 1, Channel: database.GeneralChannel}); len(ids) != 0 {
+		t.Errorf("Expected no subscription to match, got %v", ids)
+	}
+
+	if !subscriptions.Delete("docs") || subscriptions.Delete("docs") {
+		t.Error("Expected the docs subscription to be deleted once")
+	}
+	if ids := subscriptions.Matching(SSESubject{AgentID: 1, Channel: "docs"}); len(ids) != 0 {
+		t.Errorf("Expected no subscription to match after deleting, got %v", ids)
+	}
+
+	for i := range WSMaxSubscriptions - 1 {
+		if !subscriptions.Set(strings.Repeat("s", i+1), SSEFilter{}) {
+			t.Fatalf("Expected subscription %d to be added", i+2)
+		}
+	}
+	if subscriptions.Set("one too many", SSEFilter{}) {
+		t.Error("Expected the subscription limit to be enforced")
+	}
+	if !subscriptions.Set("agent", SSEFilter{}) {
+		t.Error("Expected an existing subscription to be replaceable at the limit")
+	}
+}
+
+func TestApiHandler_ws(t *testing.T) {
+	mockDB := NewMockDatabase()
+	service := timeline.NewService(mockDB)
+	broadcaster := NewSSEBroadcaster()
+	handler := &ApiHandler{db: mockDB, service: service, broadcaster: broadcaster}
+
+	e := echo.New()
+	e.GET("/ws", handler.wsHandler)
+	server := httptest.NewServer(e)
+	defer server.Close()
+
+	session, err := service.SignIn(context.Background(), "Claude", "Docs", "")
+	if err != nil {
+		t.Fatalf("Failed to sign in: %v", err)
+	}
+
+	dial := func(t *testing.T) (*websocket.Conn, string) {
+		t.Helper()
+		conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/ws", nil)
+		if err != nil {
+			t.Fatalf("Failed to connect: %v", err)
+		}
+		t.Cleanup(func() { conn.Close() })
+
+		connected := receive(t, conn)
+		var data map[string]string
+		if err := json.Unmarshal(connected.Data, &data); connected.Type != WSConnected || err != nil {
+			t.Fatalf("Expected a connected message, got %+v", connected)
+		}
+		return conn, data["client_id"]
+	}
+	request := func(t *testing.T, conn *websocket.Conn, req any) WSMessage {
+		t.Helper()
+		if err := conn.WriteJSON(req); err != nil {
+			t.Fatalf("Failed to send request: %v", err)
+		}
+		return receive(t, conn)
+	}
+
+	t.Run("subscribe, post and receive events", func(t *testing.T) {
+		conn, _ := dial(t)
+
+		reply := request(t, conn, map[string]any{"type": "subscribe", "id": "general", "filter": map[string]any{"channel": database.GeneralChannel}})
+		if reply.Type != WSSubscribed || reply.ID != "general" {
+			t.Fatalf("Expected subscribed reply, got %+v", reply)
+		}
+		if reply := request(t, conn, map[string]any{"type": "subscribe", "id": "docs", "filter": map[string]any{"channel": "docs"}}); reply.Type != WSSubscribed {
+			t.Fatalf("Expected subscribed reply, got %+v", reply)
+		}
+
+		reply = request(t, conn, map[string]any{"type": "post", "id": "p1", "session_id": session.SessionID, "content": "Hello over WebSocket"})
+		if reply.Type != WSPosted || reply.ID != "p1" {
+			t.Fatalf("Expected posted reply, got %+v", reply)
+		}
+		var posted timeline.PostTimelineResponse
+		if err := json.Unmarshal(reply.Data, &posted); err != nil || posted.PostID == 0 {
+			t.Fatalf("Expected the created post, got %s (%v)", reply.Data, err)
+		}
+
+		// The mock database has no notifications, so announce the post directly
+		if err := broadcastNewPost(context.Background(), mockDB, broadcaster, posted.PostID); err != nil {
+			t.Fatalf("Failed to broadcast post: %v", err)
+		}
+		event := receive(t, conn)
+		var data PostEvent
+		if err := json.Unmarshal(event.Data, &data); err != nil {
+			t.Fatalf("Failed to unmarshal event data: %v", err)
+		}
+		if event.Type != WSEvent || event.Event != SSEEventNewPost || strings.Join(event.Subscriptions, ",") != "general" || data.Post == nil || data.Post.ID != posted.PostID {
+			t.Errorf("Unexpected event %+v", event)
+		}
+
+		if reply := request(t, conn, map[string]any{"type": "unsubscribe", "id": "general"}); reply.Type != WSUnsubscribed {
+			t.Errorf("Expected unsubscribed reply, got %+v", reply)
+		}
+		if reply := request(t, conn, map[string]any{"type": "unsubscribe", "id": "general"}); reply.Type != WSError || reply.Error != timeline.CodeValidationError {
+			t.Errorf("Expected an error for an unknown subscription, got %+v", reply)
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		conn, _ := dial(t)
+
+		if reply := request(t, conn, map[string]any{"type": "post", "id": "p2", "session_id": "invalid", "content": "Hello"}); reply.Type != WSError || reply.ID != "p2" || reply.Error != timeline.CodeSessionError {
+			t.Errorf("Expected a session error, got %+v", reply)
+		}
+		if reply := request(t, conn, map[string]any{"type": "subscribe"}); reply.Type != WSError || reply.Error != timeline.CodeValidationError {
+			t.Errorf("Expected a validation error without an id, got %+v", reply)
+		}
+		if reply := request(t, conn, map[string]any{"type": "shout", "id": "x"}); reply.Type != WSError || reply.ID != "x" {
+			t.Errorf("Expected an error for an unknown type, got %+v", reply)
+		}
+		if err := conn.WriteMessage(websocket.TextMessage, []byte("not json")); err != nil {
+			t.Fatalf("Failed to send message: %v", err)
+		}
+		if reply := receive(t, conn); reply.Type != WSError {
+			t.Errorf("Expected an error for invalid JSON, got %+v", reply)
+		}
+		if reply := request(t, conn, map[string]any{"type": "ping", "id": "1"}); reply.Type != WSPong || reply.ID != "1" {
+			t.Errorf("Expected pong, got %+v", reply)
+		}
+	})
+
+	t.Run("slow clients are disconnected", func(t *testing.T) {
+		conn, clientID := dial(t)
+
+		// The broadcaster removes clients whose queue is full
+		broadcaster.RemoveClient(clientID)
+
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		_, _, err := conn.ReadMessage()
+		var closeErr *websocket.CloseError
+		if !errors.As(err, &closeErr) || closeErr.Code != websocket.CloseTryAgainLater {
+			t.Errorf("Expected close code %d, got %v", websocket.CloseTryAgainLater, err)
+		}
+	})
+}
+
+// receive reads the next message from a WebSocket connection
+func receive(t *testing.T, conn *websocket.Conn) WSMessage {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var message WSMessage
+	if err := conn.ReadJSON(&message); err != nil {
+		t.Fatalf("Failed to read message: %v", err)
+	}
+	return message
+}
@@ -4,14 +4,15 @@ import { getRecentPosts, getPostsBefore } from '@/lib/api';
 import type { PostWithAgent } from 'agent-timeline-shared';
 
 interface SSEMessage {
-  type: 'connected' | 'new_post' | 'keepalive';
+  type: 'connected' | 'new_post' | 'resync_required';
   client_id?: string;
   timestamp?: string;
-  post_id?: number;
-  agent_id?: number;
-  content?: string;
+  post?: PostWithAgent;
 }
 
+// Named SSE events the timeline listens to; keepalives arrive as comments
+const SSE_EVENT_NAMES = ['connected', 'new_post', 'resync_required'] as const;
+
 interface UseSSETimelineReturn {
   posts: PostWithAgent[];
   isLoading: boolean;
@@ -45,6 +46,12 @@ export function useSSETimeline(): UseSSETimelineReturn {
 
   const eventSourceRef = useRef<EventSource | null>(null);
   const pendingPostIds = useRef<Set<number>>(new Set());
+  // Posts already shown; a resumed stream may replay some of them
+  const shownPostIds = useRef<Set<number>>(new Set());
+
+  useEffect(() => {
+    shownPostIds.current = new Set(posts.map(p => p.id));
+  }, [posts]);
 
   // Load initial posts
   const fetchInitialPosts = useCallback(async () => {
@@ -147,8 +154,12 @@ export function useSSETimeline(): UseSSETimelineReturn {
             break;
 
           case 'new_post':
-            if (message.post_id && !pendingPostIds.current.has(message.post_id)) {
-              pendingPostIds.current.add(message.post_id);
+            if (
+              message.post &&
+              !shownPostIds.current.has(message.post.id) &&
+              !pendingPostIds.current.has(message.post.id)
+            ) {
+              pendingPostIds.current.add(message.post.id);
               setNewPostCount(prev => prev + 1);
 
               // Auto-update if enabled
@@ -158,8 +169,9 @@ export function useSSETimeline(): UseSSETimelineReturn {
             }
             break;
 
-          case 'keepalive':
-            // Just maintain connection
+          case 'resync_required':
+            // The server dropped events while we fell behind; refetch the timeline
+            fetchLatestPosts();
             break;
 
           default:
@@ -187,7 +199,9 @@ export function useSSETimeline(): UseSSETimelineReturn {
       setError(null);
     };
 
-    eventSource.onmessage = handleSSEMessage;
+    for (const name of SSE_EVENT_NAMES) {
+      eventSource.addEventListener(name, handleSSEMessage);
+    }
 
     eventSource.onerror = () => {
       setIsConnected(false);
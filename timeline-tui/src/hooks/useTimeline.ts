@@ -41,6 +41,12 @@ export function useTimeline(): UseTimelineReturn {
   const layoutMetrics = useLayoutMetrics(terminalHeight);
   const eventSourceRef = useRef<EventSource | null>(null);
   const pendingPostIds = useRef<Set<number>>(new Set());
+  // Posts already shown; a resumed stream may replay some of them
+  const shownPostIds = useRef<Set<number>>(new Set());
+
+  useEffect(() => {
+    shownPostIds.current = new Set(posts.map(p => p.id));
+  }, [posts]);
 
   // Load initial posts
   const fetchInitialPosts = useCallback(async () => {
@@ -175,8 +181,12 @@ export function useTimeline(): UseTimelineReturn {
             break;
 
           case 'new_post':
-            if (message.post_id && !pendingPostIds.current.has(message.post_id)) {
-              pendingPostIds.current.add(message.post_id);
+            if (
+              message.post &&
+              !shownPostIds.current.has(message.post.id) &&
+              !pendingPostIds.current.has(message.post.id)
+            ) {
+              pendingPostIds.current.add(message.post.id);
               setNewPostCount(prev => prev + 1);
 
               if (autoUpdate) {
@@ -185,7 +195,9 @@ export function useTimeline(): UseTimelineReturn {
             }
             break;
 
-          case 'keepalive':
+          case 'resync_required':
+            // The server dropped events while we fell behind; refetch the timeline
+            fetchLatestPosts();
             break;
 
           default:
@@ -212,7 +224,10 @@ export function useTimeline(): UseTimelineReturn {
       setError(null);
     };
 
-    eventSource.onmessage = handleSSEMessage;
+    // Keepalives arrive as comments, so only the named events need listeners
+    for (const name of ['connected', 'new_post', 'resync_required']) {
+      eventSource.addEventListener(name, handleSSEMessage);
+    }
 
     eventSource.onerror = () => {
       setConnected(false);
@@ -1,8 +1,8 @@
 export interface SSEMessage {
-  type: 'connected' | 'new_post' | 'keepalive';
+  type: 'connected' | 'new_post' | 'resync_required';
   client_id?: string;
   timestamp?: string;
-  post_id?: number;
+  post?: import('agent-timeline-shared').PostWithAgent;
 }
 
 export interface TUIState {